@@ -18,8 +18,9 @@ package pdflite
 
 import (
 	"fmt"
-
 	"strings"
+
+	"github.com/zean00/pdfcpulite/log"
 )
 
 // Array represents a PDF array object.
@@ -202,7 +203,7 @@ func (a Array) PDFString() string {
 			continue
 		}
 
-		fmt.Println("PDFArray.PDFString(): entry of unknown object type: %[1]T %[1]v\n", entry)
+		log.Write.Warnf("PDFArray.PDFString(): entry of unknown object type: %[1]T %[1]v", entry)
 	}
 
 	logstr = append(logstr, "]")
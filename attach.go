@@ -17,13 +17,14 @@ limitations under the License.
 package pdflite
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strings"
 
-	"errors"
-
 	"github.com/zean00/pdfcpulite/filter"
+	"github.com/zean00/pdfcpulite/log"
 )
 
 func decodedFileSpecStreamDict(xRefTable *XRefTable, fileName string, o Object) (*StreamDict, error) {
@@ -65,13 +66,13 @@ func decodedFileSpecStreamDict(xRefTable *XRefTable, fileName string, o Object)
 
 		// Ignore filter chains with length > 1
 		if len(fpl) > 1 {
-			fmt.Printf("writeFile end: ignore %s, more than 1 filter.\n", fileName)
+			log.Write.Warnf("writeFile end: ignore %s, more than 1 filter.\n", fileName)
 			return nil, nil
 		}
 
 		// Only FlateDecode supported.
 		if fpl[0].Name != filter.Flate {
-			fmt.Printf("writeFile: ignore %s, %s filter unsupported.\n", fileName, fpl[0].Name)
+			log.Write.Warnf("writeFile: ignore %s, %s filter unsupported.\n", fileName, fpl[0].Name)
 			return nil, nil
 		}
 
@@ -85,29 +86,24 @@ func decodedFileSpecStreamDict(xRefTable *XRefTable, fileName string, o Object)
 	return sd, nil
 }
 
-/*
-func extractAttachedFiles(ctx *Context, files StringSet) error {
-
-	writeFile := func(xRefTable *XRefTable, fileName string, o Object) error {
+// extractAttachedFiles returns the contents of the embedded files by name.
+func extractAttachedFiles(ctx *Context, files StringSet) (map[string][]byte, error) {
 
-		path := ctx.Write.DirName + "/" + fileName
+	m := map[string][]byte{}
 
-		fmt.Printf("writeFile begin: %s\n", path)
+	extract := func(xRefTable *XRefTable, fileName string, o Object) error {
 
 		sd, err := decodedFileSpecStreamDict(xRefTable, fileName, o)
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("writing %s\n", path)
-
-		// TODO Refactor into returning only stream object numbers for files to be extracted.
-		// No writing to file in library!
-		if err := ioutil.WriteFile(path, sd.Content, os.ModePerm); err != nil {
-			return err
+		if sd == nil {
+			ctx.Log(log.Write).Warnf("extractAttachedFiles: %s: no supported embedded file stream", fileName)
+			return nil
 		}
 
-		fmt.Printf("writeFile end: %s \n", path)
+		m[fileName] = sd.Content
 
 		return nil
 	}
@@ -118,24 +114,26 @@ func extractAttachedFiles(ctx *Context, files StringSet) error {
 
 			v, ok := ctx.Names["EmbeddedFiles"].Value(fileName)
 			if !ok {
-				fmt.Printf("extractAttachedFiles: %s not found", fileName)
-				continue
+				return nil, fmt.Errorf("pdfcpu: attachment %s not found", fileName)
 			}
 
-			if err := writeFile(ctx.XRefTable, fileName, v); err != nil {
-				return err
+			if err := extract(ctx.XRefTable, fileName, v); err != nil {
+				return nil, err
 			}
-
 		}
 
-		return nil
+		return m, nil
 	}
 
 	// Extract all files.
-	return ctx.Names["EmbeddedFiles"].Process(ctx.XRefTable, writeFile)
+	if err := ctx.Names["EmbeddedFiles"].Process(ctx.XRefTable, extract); err != nil {
+		return nil, err
+	}
+
+	return m, nil
 }
-*/
-/*
+
+// fileSpectDict embeds the file filename and returns an indirect reference to its file specification.
 func fileSpectDict(xRefTable *XRefTable, filename, desc string) (*IndirectRef, error) {
 
 	sd, err := xRefTable.NewEmbeddedFileStreamDict(filename)
@@ -143,7 +141,7 @@ func fileSpectDict(xRefTable *XRefTable, filename, desc string) (*IndirectRef, e
 		return nil, err
 	}
 
-	if err := encodeStream(sd); err != nil {
+	if err = encodeStream(sd); err != nil {
 		return nil, err
 	}
 
@@ -152,16 +150,15 @@ func fileSpectDict(xRefTable *XRefTable, filename, desc string) (*IndirectRef, e
 		return nil, err
 	}
 
-	d, err := xRefTable.NewFileSpecDict(filename, desc, *ir) // Supply description!
+	d, err := xRefTable.NewFileSpecDict(filepath.Base(filename), desc, *ir)
 	if err != nil {
 		return nil, err
 	}
 
 	return xRefTable.IndRefForNewObject(d)
 }
-*/
-/*
-// ok returns true if at least one attachment was added.
+
+// addAttachedFiles returns true if at least one attachment was added.
 func addAttachedFiles(xRefTable *XRefTable, files StringSet, coll bool) (bool, error) {
 
 	if coll {
@@ -174,10 +171,8 @@ func addAttachedFiles(xRefTable *XRefTable, files StringSet, coll bool) (bool, e
 	var ok bool
 	for f := range files {
 
-		s := strings.Split(f, ",")
-		if len(s) == 0 || len(s) > 2 {
-			continue
-		}
+		// filename[,description]
+		s := strings.SplitN(f, ",", 2)
 
 		fileName := s[0]
 		desc := ""
@@ -190,17 +185,20 @@ func addAttachedFiles(xRefTable *XRefTable, files StringSet, coll bool) (bool, e
 			return false, err
 		}
 
-		_, fn := filepath.Split(fileName)
-		if err := xRefTable.Names["EmbeddedFiles"].Add(xRefTable, fn, *ir); err != nil {
+		if err := xRefTable.Names["EmbeddedFiles"].Add(xRefTable, filepath.Base(fileName), *ir); err != nil {
 			return false, err
 		}
 
 		ok = true
 	}
 
-	return ok, nil
+	if !ok {
+		return false, nil
+	}
+
+	return true, xRefTable.bindNameTreeNode("EmbeddedFiles", xRefTable.Names["EmbeddedFiles"], true)
 }
-*/
+
 // removeAttachedFiles returns true if at least one attachment was removed.
 func removeAttachedFiles(xRefTable *XRefTable, files StringSet) (bool, error) {
 
@@ -217,7 +215,7 @@ func removeAttachedFiles(xRefTable *XRefTable, files StringSet) (bool, error) {
 
 	for fileName := range files {
 
-		fmt.Printf("removeAttachedFiles: removing %s\n", fileName)
+		log.Write.Debugf("removeAttachedFiles: removing %s\n", fileName)
 
 		// Any remove operation may be deleting the only key value pair of this name tree.
 		if xRefTable.Names["EmbeddedFiles"] == nil {
@@ -233,11 +231,11 @@ func removeAttachedFiles(xRefTable *XRefTable, files StringSet) (bool, error) {
 		}
 
 		if !ok {
-			fmt.Printf("removeAttachedFiles: %s not found\n", fileName)
+			log.Write.Warnf("removeAttachedFiles: %s not found\n", fileName)
 			continue
 		}
 
-		fmt.Printf("removeAttachedFiles: removed key value pair for %s - empty=%t\n", fileName, empty)
+		log.Write.Tracef("removeAttachedFiles: removed key value pair for %s - empty=%t\n", fileName, empty)
 
 		if empty {
 			// Delete name tree root object.
@@ -249,6 +247,10 @@ func removeAttachedFiles(xRefTable *XRefTable, files StringSet) (bool, error) {
 		removed = true
 	}
 
+	if n := xRefTable.Names["EmbeddedFiles"]; removed && n != nil {
+		return true, xRefTable.bindNameTreeNode("EmbeddedFiles", n, true)
+	}
+
 	return removed, nil
 }
 
@@ -268,26 +270,24 @@ func AttachList(xRefTable *XRefTable) ([]string, error) {
 	return xRefTable.Names["EmbeddedFiles"].KeyList()
 }
 
-/*
-// AttachExtract exports specified embedded files.
-// If no files specified extract all embedded files.
-func AttachExtract(ctx *Context, files StringSet) error {
+// AttachExtract returns the contents of the specified embedded files by name.
+// If no files are specified all embedded files are returned.
+func AttachExtract(ctx *Context, files StringSet) (map[string][]byte, error) {
 
 	if !ctx.Valid {
 		if err := ctx.LocateNameTree("EmbeddedFiles", false); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	if ctx.Names["EmbeddedFiles"] == nil {
-		return errors.Errorf("no attachments available.")
+		return nil, errors.New("pdfcpu: no attachments available")
 	}
 
 	return extractAttachedFiles(ctx, files)
 }
-*/
-/*
-// AttachAdd embeds specified files.
+
+// AttachAdd embeds the specified files given as filename[,description].
 // Existing attachments are replaced.
 // Ensures collection for portfolios.
 // Returns true if at least one attachment was added.
@@ -299,7 +299,7 @@ func AttachAdd(xRefTable *XRefTable, files StringSet, coll bool) (bool, error) {
 
 	return addAttachedFiles(xRefTable, files, coll)
 }
-*/
+
 // AttachRemove deletes specified embedded files.
 // Returns true if at least one attachment could be removed.
 func AttachRemove(xRefTable *XRefTable, files StringSet) (bool, error) {
@@ -336,9 +336,14 @@ func KeywordsAdd(xRefTable *XRefTable, keywords []string) error {
 	}
 
 	for _, s := range keywords {
-		if !MemberOf(s, list) {
-			xRefTable.Keywords += ", " + s
+		if MemberOf(s, list) {
+			continue
 		}
+		if xRefTable.Keywords == "" {
+			xRefTable.Keywords = s
+			continue
+		}
+		xRefTable.Keywords += ", " + s
 	}
 
 	d, err := xRefTable.DereferenceDict(*xRefTable.Info)
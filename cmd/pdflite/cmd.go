@@ -0,0 +1,769 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	pdf "github.com/zean00/pdfcpulite"
+	"github.com/zean00/pdfcpulite/font"
+)
+
+// Flags specific to single commands.
+var (
+	encryptMode string
+	keyLength   int
+	perm        string
+	insertMode  string
+	fontDir     string
+	wmMode      string
+	portfolio   bool
+	importDesc  string
+)
+
+func commands() map[string]*command {
+	return map[string]*command{
+		"validate": {
+			usage: "inFile",
+			short: "validate a file",
+			run:   validate,
+		},
+		"info": {
+			usage: "inFile",
+			short: "print file info",
+			run:   info,
+		},
+		"merge": {
+			usage: "outFile inFile...",
+			short: "concatenate files",
+			run:   merge,
+		},
+		"watermark add": {
+			usage: "[-pages selection] [-mode text|image|pdf] [-dir fontDir] string|file description inFile [outFile]",
+			short: "add watermarks",
+			pages: true,
+			flags: wmFlags,
+			run:   addWatermarks(false),
+		},
+		"watermark remove": {
+			usage: "[-pages selection] inFile [outFile]",
+			short: "remove watermarks and stamps",
+			pages: true,
+			run:   inOutFileCmd(pdf.REMOVEWATERMARKS),
+		},
+		"watermark detect": {
+			usage: "inFile",
+			short: "report whether a file has watermarks or stamps",
+			run:   detectWatermarks,
+		},
+		"stamp add": {
+			usage: "[-pages selection] [-mode text|image|pdf] [-dir fontDir] string|file description inFile [outFile]",
+			short: "add stamps",
+			pages: true,
+			flags: wmFlags,
+			run:   addWatermarks(true),
+		},
+		"stamp remove": {
+			usage: "[-pages selection] inFile [outFile]",
+			short: "remove watermarks and stamps",
+			pages: true,
+			run:   inOutFileCmd(pdf.REMOVEWATERMARKS),
+		},
+		"stamp detect": {
+			usage: "inFile",
+			short: "report whether a file has watermarks or stamps",
+			run:   detectWatermarks,
+		},
+		"attach list": {
+			usage: "inFile",
+			short: "list attachments",
+			run:   inFileCmd(pdf.LISTATTACHMENTS),
+		},
+		"attach add": {
+			usage: "[-portfolio] inFile outFile file[,description]...",
+			short: "add attachments",
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&portfolio, "portfolio", false, "create a portfolio")
+			},
+			run: attachAdd,
+		},
+		"attach extract": {
+			usage: "inFile outDir [file...]",
+			short: "extract some or all attachments",
+			run:   attachExtract,
+		},
+		"attach remove": {
+			usage: "inFile outFile [file...]",
+			short: "remove some or all attachments",
+			run:   attachRemove,
+		},
+		"keywords list": {
+			usage: "inFile",
+			short: "list keywords",
+			run:   inFileCmd(pdf.LISTKEYWORDS),
+		},
+		"keywords add": {
+			usage: "inFile outFile keyword...",
+			short: "add keywords",
+			run:   keywords(pdf.ADDKEYWORDS),
+		},
+		"keywords remove": {
+			usage: "inFile outFile [keyword...]",
+			short: "remove some or all keywords",
+			run:   keywords(pdf.REMOVEKEYWORDS),
+		},
+		"properties list": {
+			usage: "inFile",
+			short: "list document properties",
+			run:   listProperties,
+		},
+		"properties add": {
+			usage: "inFile outFile name=value...",
+			short: "add document properties",
+			run:   properties(pdf.ADDPROPERTIES),
+		},
+		"properties remove": {
+			usage: "inFile outFile [name...]",
+			short: "remove some or all document properties",
+			run:   properties(pdf.REMOVEPROPERTIES),
+		},
+		"permissions list": {
+			usage: "inFile",
+			short: "list user access permissions",
+			run:   listPermissions,
+		},
+		"permissions set": {
+			usage: "-perm permissions inFile [outFile]",
+			short: "set user access permissions",
+			flags: permFlag,
+			run:   setPermissions,
+		},
+		"encrypt": {
+			usage: "[-mode aes|rc4] [-key 40|128|256] [-perm permissions] -opw ownerPW [-upw userPW] inFile [outFile]",
+			short: "encrypt a file",
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&encryptMode, "mode", "aes", "encryption algorithm: aes or rc4")
+				fs.IntVar(&keyLength, "key", 256, "key length in bits: 40, 128 or 256 (aes only)")
+				permFlag(fs)
+			},
+			run: encrypt,
+		},
+		"decrypt": {
+			usage: "[-upw userPW] [-opw ownerPW] inFile [outFile]",
+			short: "decrypt a file",
+			run:   inOutFileCmd(pdf.DECRYPT),
+		},
+		"changeupw": {
+			usage: "[-opw ownerPW] inFile outFile upwOld upwNew",
+			short: "change the user password",
+			run:   changePassword(pdf.CHANGEUPW),
+		},
+		"changeopw": {
+			usage: "[-upw userPW] inFile outFile opwOld opwNew",
+			short: "change the owner password",
+			run:   changePassword(pdf.CHANGEOPW),
+		},
+		"import": {
+			usage: "[-desc description] inFile outFile image...",
+			short: "append images as pages",
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&importDesc, "desc", "", "import description, eg. \"pos:c, sc:0.5\"")
+			},
+			run: importImages,
+		},
+		"pages insert": {
+			usage: "[-pages selection] [-mode before|after] inFile [outFile]",
+			short: "insert blank pages",
+			pages: true,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&insertMode, "mode", "before", "insert before or after selected pages")
+			},
+			run: insertPages,
+		},
+		"fonts list": {
+			usage: "[-dir fontDir]",
+			short: "list core fonts and installed user fonts",
+			flags: dirFlag,
+			run:   listFonts,
+		},
+		"fonts install": {
+			usage: "[-dir fontDir] fontFile...",
+			short: "install TrueType fonts",
+			flags: dirFlag,
+			run:   installFonts,
+		},
+	}
+}
+
+// groups returns the subcommands by command.
+func groups() map[string]map[string]bool {
+
+	m := map[string]map[string]bool{}
+
+	for name := range commands() {
+		ss := strings.Fields(name)
+		if len(ss) < 2 {
+			continue
+		}
+		if m[ss[0]] == nil {
+			m[ss[0]] = map[string]bool{}
+		}
+		m[ss[0]][ss[1]] = true
+	}
+
+	return m
+}
+
+func permFlag(fs *flag.FlagSet) {
+	fs.StringVar(&perm, "perm", "none", "none, all or a comma separated list of: print,printHighQuality,modify,copy,annotate,fillForms,accessibility,assemble")
+}
+
+func dirFlag(fs *flag.FlagSet) {
+	fs.StringVar(&fontDir, "dir", "", "font directory (default: <user config dir>/pdfcpu/fonts)")
+}
+
+func wmFlags(fs *flag.FlagSet) {
+	fs.StringVar(&wmMode, "mode", "text", "watermark type: text, image or pdf")
+	dirFlag(fs)
+}
+
+// inOutFiles returns the input and output file of args and the remaining arguments.
+// If optOut is true the output file may be omitted and defaults to the input file.
+func inOutFiles(args []string, optOut bool) (string, string, []string, error) {
+
+	switch {
+	case len(args) >= 2:
+		return args[0], args[1], args[2:], nil
+	case len(args) == 1 && optOut:
+		return args[0], args[0], nil, nil
+	}
+
+	return "", "", nil, errUsage
+}
+
+// inFileCmd returns a command reading a single file.
+func inFileCmd(mode pdf.CommandMode) func(string, *options, []string) (interface{}, error) {
+	return func(name string, opts *options, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errUsage
+		}
+		return process(pdf.Command{Mode: mode}, opts, args[0], "")
+	}
+}
+
+func validate(name string, opts *options, args []string) (interface{}, error) {
+
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+
+	if _, err := process(pdf.Command{Mode: pdf.VALIDATE}, opts, args[0], ""); err != nil {
+		return nil, err
+	}
+
+	if opts.json {
+		return map[string]bool{"valid": true}, nil
+	}
+
+	return []string{"validation ok"}, nil
+}
+
+func info(name string, opts *options, args []string) (interface{}, error) {
+
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+
+	var di pdf.DocInfo
+
+	ss, err := process(pdf.Command{Mode: pdf.INFO, Info: &di}, opts, args[0], "")
+	if err != nil || !opts.json {
+		return ss, err
+	}
+
+	return di, nil
+}
+
+func listProperties(name string, opts *options, args []string) (interface{}, error) {
+
+	if !opts.json {
+		return inFileCmd(pdf.LISTPROPERTIES)(name, opts, args)
+	}
+
+	di, err := info(name, opts, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return di.(pdf.DocInfo).Properties, nil
+}
+
+func listPermissions(name string, opts *options, args []string) (interface{}, error) {
+
+	if !opts.json {
+		return inFileCmd(pdf.LISTPERMISSIONS)(name, opts, args)
+	}
+
+	di, err := info(name, opts, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return di.(pdf.DocInfo).Permissions, nil
+}
+
+// inOutFileCmd returns a command modifying a file.
+func inOutFileCmd(mode pdf.CommandMode) func(string, *options, []string) (interface{}, error) {
+	return func(name string, opts *options, args []string) (interface{}, error) {
+		inFile, outFile, args, err := inOutFiles(args, true)
+		if err != nil || len(args) > 0 {
+			return nil, errUsage
+		}
+		return process(pdf.Command{Mode: mode}, opts, inFile, outFile)
+	}
+}
+
+func merge(name string, opts *options, args []string) (interface{}, error) {
+
+	if len(args) < 3 {
+		return nil, errUsage
+	}
+
+	var rr []io.ReadSeeker
+
+	for _, fn := range args[2:] {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		rr = append(rr, bytes.NewReader(b))
+	}
+
+	return process(pdf.Command{Mode: pdf.MERGE, InAdd: rr}, opts, args[1], args[0])
+}
+
+func addWatermarks(onTop bool) func(string, *options, []string) (interface{}, error) {
+	return func(name string, opts *options, args []string) (interface{}, error) {
+
+		if len(args) < 3 {
+			return nil, errUsage
+		}
+
+		inFile, outFile, rest, err := inOutFiles(args[2:], true)
+		if err != nil || len(rest) > 0 {
+			return nil, errUsage
+		}
+
+		// User fonts need to be loaded for parsing the description.
+		if err := loadUserFonts(); err != nil {
+			return nil, err
+		}
+
+		var wm *pdf.Watermark
+
+		switch wmMode {
+		case "text":
+			wm, err = pdf.ParseTextWatermarkDetails(args[0], args[1], onTop)
+		case "image":
+			wm, err = pdf.ParseImageWatermarkDetails(args[0], args[1], onTop)
+		case "pdf":
+			wm, err = pdf.ParsePDFWatermarkDetails(args[0], args[1], onTop)
+		default:
+			return nil, fmt.Errorf("invalid mode %q", wmMode)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return process(pdf.Command{Mode: pdf.ADDWATERMARKS, Watermark: wm}, opts, inFile, outFile)
+	}
+}
+
+func detectWatermarks(name string, opts *options, args []string) (interface{}, error) {
+
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ctx, err := pdf.Read(f, configuration(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pdf.DetectWatermarks(ctx); err != nil {
+		return nil, err
+	}
+
+	if opts.json {
+		return map[string]bool{"watermarked": ctx.Watermarked}, nil
+	}
+
+	return []string{strconv.FormatBool(ctx.Watermarked)}, nil
+}
+
+func attachAdd(name string, opts *options, args []string) (interface{}, error) {
+
+	inFile, outFile, args, err := inOutFiles(args, false)
+	if err != nil || len(args) == 0 {
+		return nil, errUsage
+	}
+
+	files := pdf.StringSet{}
+	for _, fn := range args {
+		files[fn] = true
+	}
+
+	mode := pdf.ADDATTACHMENTS
+	if portfolio {
+		mode = pdf.ADDATTACHMENTSPORTFOLIO
+	}
+
+	return process(pdf.Command{Mode: mode, Files: files}, opts, inFile, outFile)
+}
+
+// attachExtract writes the attachments into outDir and returns the paths of the written files.
+func attachExtract(name string, opts *options, args []string) (interface{}, error) {
+
+	inFile, outDir, args, err := inOutFiles(args, false)
+	if err != nil {
+		return nil, errUsage
+	}
+
+	var files pdf.StringSet
+	if len(args) > 0 {
+		files = pdf.StringSet{}
+		for _, fn := range args {
+			files[fn] = true
+		}
+	}
+
+	m := map[string][]byte{}
+
+	if _, err = process(pdf.Command{Mode: pdf.EXTRACTATTACHMENTS, Files: files, Attachments: m}, opts, inFile, ""); err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	fileNames := make([]string, 0, len(m))
+	for fileName := range m {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	ss := []string{}
+	written := map[string]string{}
+
+	for _, fileName := range fileNames {
+
+		// Attachment names are taken from the file and must not escape outDir.
+		base := filepath.Base(fileName)
+		if base == "." || base == ".." || base == string(filepath.Separator) {
+			fmt.Fprintf(opts.stderr, "pdflite %s: skipping attachment %q: invalid file name\n", name, fileName)
+			continue
+		}
+
+		if other, ok := written[base]; ok {
+			fmt.Fprintf(opts.stderr, "pdflite %s: skipping attachment %q: %s already extracted from %q\n", name, fileName, base, other)
+			continue
+		}
+
+		fn := filepath.Join(outDir, base)
+		if err = os.WriteFile(fn, m[fileName], 0644); err != nil {
+			return nil, err
+		}
+
+		written[base] = fileName
+		ss = append(ss, fn)
+	}
+
+	return ss, nil
+}
+
+func attachRemove(name string, opts *options, args []string) (interface{}, error) {
+
+	inFile, outFile, args, err := inOutFiles(args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var files pdf.StringSet
+	if len(args) > 0 {
+		files = pdf.StringSet{}
+		for _, fn := range args {
+			files[fn] = true
+		}
+	}
+
+	return process(pdf.Command{Mode: pdf.REMOVEATTACHMENTS, Files: files}, opts, inFile, outFile)
+}
+
+func keywords(mode pdf.CommandMode) func(string, *options, []string) (interface{}, error) {
+	return func(name string, opts *options, args []string) (interface{}, error) {
+		inFile, outFile, args, err := inOutFiles(args, false)
+		if err != nil || mode == pdf.ADDKEYWORDS && len(args) == 0 {
+			return nil, errUsage
+		}
+		return process(pdf.Command{Mode: mode, Keywords: args}, opts, inFile, outFile)
+	}
+}
+
+func properties(mode pdf.CommandMode) func(string, *options, []string) (interface{}, error) {
+	return func(name string, opts *options, args []string) (interface{}, error) {
+
+		inFile, outFile, args, err := inOutFiles(args, false)
+		if err != nil || mode == pdf.ADDPROPERTIES && len(args) == 0 {
+			return nil, errUsage
+		}
+
+		m := map[string]string{}
+		for _, arg := range args {
+			if mode == pdf.REMOVEPROPERTIES {
+				m[arg] = ""
+				continue
+			}
+			ss := strings.SplitN(arg, "=", 2)
+			if len(ss) != 2 || strings.TrimSpace(ss[0]) == "" {
+				return nil, fmt.Errorf("invalid property %q, expected name=value", arg)
+			}
+			m[strings.TrimSpace(ss[0])] = strings.TrimSpace(ss[1])
+		}
+
+		return process(pdf.Command{Mode: mode, Properties: m}, opts, inFile, outFile)
+	}
+}
+
+// accessPermissions parses the value of the -perm flag.
+func accessPermissions(s string) (pdf.AccessPermissions, error) {
+
+	var ap pdf.AccessPermissions
+
+	switch s {
+	case "none":
+		return ap, nil
+	case "all":
+		return pdf.NewAccessPermissions(int(pdf.PermissionsAll)), nil
+	}
+
+	for _, p := range strings.Split(s, ",") {
+		switch strings.TrimSpace(p) {
+		case "print":
+			ap.Print = true
+		case "printHighQuality":
+			ap.PrintHighQuality = true
+		case "modify":
+			ap.Modify = true
+		case "copy":
+			ap.Copy = true
+		case "annotate":
+			ap.Annotate = true
+		case "fillForms":
+			ap.FillForms = true
+		case "accessibility":
+			ap.Accessibility = true
+		case "assemble":
+			ap.Assemble = true
+		default:
+			return ap, fmt.Errorf("invalid permission %q", p)
+		}
+	}
+
+	return ap, nil
+}
+
+func setPermissions(name string, opts *options, args []string) (interface{}, error) {
+
+	inFile, outFile, args, err := inOutFiles(args, true)
+	if err != nil || len(args) > 0 {
+		return nil, errUsage
+	}
+
+	ap, err := accessPermissions(perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return process(pdf.Command{Mode: pdf.SETPERMISSIONS, Permissions: ap}, opts, inFile, outFile)
+}
+
+func encrypt(name string, opts *options, args []string) (interface{}, error) {
+
+	inFile, outFile, args, err := inOutFiles(args, true)
+	if err != nil || len(args) > 0 {
+		return nil, errUsage
+	}
+
+	if encryptMode != "aes" && encryptMode != "rc4" {
+		return nil, fmt.Errorf("invalid mode %q", encryptMode)
+	}
+
+	ap, err := accessPermissions(perm)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := configuration(opts)
+	conf.EncryptUsingAES = encryptMode == "aes"
+	conf.EncryptKeyLength = keyLength
+	conf.Permissions = int16(ap.P())
+
+	return process(pdf.Command{Mode: pdf.ENCRYPT, Conf: conf}, opts, inFile, outFile)
+}
+
+func changePassword(mode pdf.CommandMode) func(string, *options, []string) (interface{}, error) {
+	return func(name string, opts *options, args []string) (interface{}, error) {
+
+		if len(args) != 4 {
+			return nil, errUsage
+		}
+
+		pwOld, pwNew := args[2], args[3]
+
+		conf := configuration(opts)
+		if mode == pdf.CHANGEUPW {
+			conf.UserPW, conf.UserPWNew = pwOld, &pwNew
+		} else {
+			conf.OwnerPW, conf.OwnerPWNew = pwOld, &pwNew
+		}
+
+		return process(pdf.Command{Mode: mode, Conf: conf}, opts, args[0], args[1])
+	}
+}
+
+func insertPages(name string, opts *options, args []string) (interface{}, error) {
+
+	inFile, outFile, args, err := inOutFiles(args, true)
+	if err != nil || len(args) > 0 {
+		return nil, errUsage
+	}
+
+	mode := pdf.INSERTPAGESBEFORE
+	switch insertMode {
+	case "before":
+	case "after":
+		mode = pdf.INSERTPAGESAFTER
+	default:
+		return nil, fmt.Errorf("invalid mode %q", insertMode)
+	}
+
+	return process(pdf.Command{Mode: mode}, opts, inFile, outFile)
+}
+
+func importImages(name string, opts *options, args []string) (interface{}, error) {
+
+	inFile, outFile, args, err := inOutFiles(args, false)
+	if err != nil || len(args) == 0 {
+		return nil, errUsage
+	}
+
+	imp, err := pdf.ParseImportDetails(importDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	var rr []io.Reader
+
+	for _, fn := range args {
+		f, err := os.Open(fn)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		rr = append(rr, f)
+	}
+
+	return process(pdf.Command{Mode: pdf.IMPORTIMAGES, Images: rr, Import: imp}, opts, inFile, outFile)
+}
+
+// userFontDir returns the directory holding installed user fonts.
+func userFontDir() (string, error) {
+
+	if fontDir == "" {
+		return font.Dir()
+	}
+
+	return fontDir, os.MkdirAll(fontDir, os.ModePerm)
+}
+
+// loadUserFonts makes the fonts installed in the user font directory available.
+func loadUserFonts() error {
+
+	dir, err := userFontDir()
+	if err != nil {
+		return err
+	}
+
+	return font.LoadUserFonts(dir)
+}
+
+func listFonts(name string, opts *options, args []string) (interface{}, error) {
+
+	if len(args) > 0 {
+		return nil, errUsage
+	}
+
+	if err := loadUserFonts(); err != nil {
+		return nil, err
+	}
+
+	ss := font.CoreFontNames()
+	sort.Strings(ss)
+
+	user := font.UserFontNames()
+	sort.Strings(user)
+
+	return append(ss, user...), nil
+}
+
+func installFonts(name string, opts *options, args []string) (interface{}, error) {
+
+	if len(args) == 0 {
+		return nil, errUsage
+	}
+
+	dir, err := userFontDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var ss []string
+
+	for _, fn := range args {
+		if err := font.InstallTrueTypeFont(dir, fn); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn, err)
+		}
+		ss = append(ss, strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn)))
+	}
+
+	return ss, nil
+}
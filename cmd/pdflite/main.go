@@ -0,0 +1,240 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command pdflite is a command line interface to the pdflite library.
+//
+// Usage:
+//
+//	pdflite command [subcommand] [flags] args...
+//
+// Run pdflite help for a list of commands.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+
+	pdf "github.com/zean00/pdfcpulite"
+	"github.com/zean00/pdfcpulite/log"
+)
+
+// errUsage signals wrong arguments, the usage of the command is printed.
+var errUsage = errors.New("usage")
+
+// options holds the flags common to all commands.
+type options struct {
+	upw, opw string
+	pages    string
+	json     bool
+	verbose  bool
+	trace    bool
+	stderr   io.Writer // receives log output
+}
+
+// command is a pdflite command or subcommand.
+// run returns the output lines, or with -json a value to be encoded as the result.
+type command struct {
+	usage string // arguments following the command name
+	short string // one line description
+	pages bool   // accepts -pages
+	flags func(fs *flag.FlagSet)
+	run   func(name string, opts *options, args []string) (interface{}, error)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command given by args and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		return 2
+	}
+
+	name := args[0]
+	args = args[1:]
+
+	if subs, ok := groups()[name]; ok {
+		if len(args) == 0 || !subs[args[0]] {
+			usage(stderr)
+			return 2
+		}
+		name += " " + args[0]
+		args = args[1:]
+	}
+
+	cmd, ok := commands()[name]
+	if !ok {
+		fmt.Fprintf(stderr, "pdflite: unknown command %q\n", name)
+		usage(stderr)
+		return 2
+	}
+
+	opts := &options{stderr: stderr}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.upw, "upw", "", "user password")
+	fs.StringVar(&opts.opw, "opw", "", "owner password")
+	fs.BoolVar(&opts.json, "json", false, "write output as JSON")
+	fs.BoolVar(&opts.verbose, "v", false, "log processing steps to stderr")
+	fs.BoolVar(&opts.trace, "vv", false, "log processing details to stderr")
+	if cmd.pages {
+		fs.StringVar(&opts.pages, "pages", "", "page selection, eg. 1-3,5,even,!2")
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: pdflite %s %s\n\n%s\n\n", name, cmd.usage, cmd.short)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	res, err := cmd.run(name, opts, fs.Args())
+	if err == errUsage {
+		fs.Usage()
+		return 2
+	}
+
+	if opts.json {
+		return writeJSON(stdout, name, res, err)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "pdflite %s: %v\n", name, err)
+		return 1
+	}
+
+	ss, _ := res.([]string)
+	for _, s := range ss {
+		fmt.Fprintln(stdout, s)
+	}
+
+	return 0
+}
+
+// writeJSON writes the result of a command as a JSON object.
+// Commands without output have an empty list as result.
+func writeJSON(w io.Writer, name string, v interface{}, err error) int {
+
+	res := struct {
+		Command string      `json:"command"`
+		Result  interface{} `json:"result"`
+		Error   string      `json:"error,omitempty"`
+	}{Command: name, Result: v}
+
+	if ss, ok := v.([]string); v == nil || ok && ss == nil {
+		res.Result = []string{}
+	}
+
+	code := 0
+	if err != nil {
+		res.Error = err.Error()
+		code = 1
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res); err != nil {
+		return 1
+	}
+
+	return code
+}
+
+func usage(w io.Writer) {
+
+	fmt.Fprintf(w, "pdflite %s\n\nusage: pdflite command [subcommand] [flags] args...\n\ncommands:\n", pdf.VersionStr)
+
+	cmds := commands()
+
+	var names []string
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-20s %s\n", name, cmds[name].short)
+	}
+
+	fmt.Fprintln(w, "\nRun pdflite command [subcommand] -h for details.")
+}
+
+// configuration returns the library configuration for opts.
+func configuration(opts *options) *pdf.Configuration {
+
+	conf := pdf.NewDefaultConfiguration()
+	conf.UserPW = opts.upw
+	conf.OwnerPW = opts.opw
+
+	level := slog.LevelInfo
+	if opts.trace {
+		level = log.LevelTrace
+	}
+
+	if opts.verbose || opts.trace {
+		log.SetLogger(slog.New(slog.NewTextHandler(opts.stderr, &slog.HandlerOptions{Level: level})))
+	}
+
+	return conf
+}
+
+// process runs cmd on inFile and returns the output lines.
+// If cmd modifies the file the result is written to outFile.
+// The output file is written after processing, so outFile may be inFile.
+func process(cmd pdf.Command, opts *options, inFile, outFile string) (interface{}, error) {
+
+	b, err := os.ReadFile(inFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+
+	cmd.In = bytes.NewReader(b)
+	cmd.Out = &out
+	cmd.PageSelection = opts.pages
+	if cmd.Conf == nil {
+		cmd.Conf = configuration(opts)
+	}
+
+	ss, err := pdf.Process(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if out.Len() > 0 {
+		if err = os.WriteFile(outFile, out.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return ss, nil
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zean00/pdfcpulite/log"
+)
+
+// writeTestPDF writes a PDF file with a single page into dir and returns its path.
+func writeTestPDF(t *testing.T, dir string) string {
+	t.Helper()
+
+	return writePDF(t, filepath.Join(dir, "in.pdf"), []string{
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]/Resources<<>>>>",
+	})
+}
+
+// writePDF writes a PDF file made of objs numbered from 1 with the catalog 1 0 R to fn and returns fn.
+func writePDF(t *testing.T, fn string, objs []string) string {
+	t.Helper()
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<</Size %d/Root 1 0 R>>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+
+	if err := os.WriteFile(fn, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return fn
+}
+
+// runJSON runs args, which include -json, and decodes the result into v.
+func runJSON(t *testing.T, v interface{}, args ...string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("%v: got exit code %d\n%s%s", args, code, stdout.String(), stderr.String())
+	}
+
+	res := struct{ Result interface{} }{v}
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("%v: %v\n%s", args, err, stdout.String())
+	}
+}
+
+func TestRun(t *testing.T) {
+
+	missing := filepath.Join(t.TempDir(), "missing.pdf")
+
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{nil, 2},
+		{[]string{"bogus"}, 2},
+		{[]string{"keywords"}, 2},
+		{[]string{"keywords", "bogus"}, 2},
+		{[]string{"keywords", "add", "in.pdf"}, 2},
+		{[]string{"info", "-bogus", "in.pdf"}, 2},
+		{[]string{"info", missing}, 1},
+		{[]string{"fonts", "list", "-dir", t.TempDir()}, 0},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, &stdout, &stderr); code != tt.code {
+			t.Errorf("%v: got exit code %d, want %d\n%s", tt.args, code, tt.code, stderr.String())
+		}
+	}
+
+	// JSON output reports errors too.
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"info", "-json", missing}, &stdout, &stderr); code != 1 {
+		t.Errorf("got exit code %d, want 1", code)
+	}
+
+	var res struct {
+		Command string
+		Result  []string
+		Error   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Command != "info" || res.Error == "" || res.Result == nil {
+		t.Errorf("unexpected JSON output: %s", stdout.String())
+	}
+}
+
+func TestAccessPermissions(t *testing.T) {
+
+	for _, tt := range []struct {
+		s    string
+		want int // P, 0 for an error
+	}{
+		{"none", -3904},
+		{"all", -3904 | 0x0F3C},
+		{"print, copy", -3904 | 0x0014},
+		{"print,bogus", 0},
+	} {
+		ap, err := accessPermissions(tt.s)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("%q: missing error", tt.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.s, err)
+			continue
+		}
+		if ap.P() != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.s, ap.P(), tt.want)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+
+	dir := t.TempDir()
+	in := writeTestPDF(t, dir)
+	out := filepath.Join(dir, "out.pdf")
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "img.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = png.Encode(f, image.NewGray(image.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"validate", in}, &stdout, &stderr); code != 0 || stdout.String() != "validation ok\n" {
+		t.Errorf("validate: got exit code %d, output %q\n%s", code, stdout.String(), stderr.String())
+	}
+
+	var valid map[string]bool
+	runJSON(t, &valid, "validate", "-json", in)
+	if !valid["valid"] {
+		t.Errorf("validate: got %v", valid)
+	}
+
+	var info struct {
+		Version   string
+		PageCount int
+	}
+	runJSON(t, &info, "info", "-json", in)
+	if info.Version != "1.4" || info.PageCount != 1 {
+		t.Errorf("info: got %+v", info)
+	}
+
+	var props map[string]string
+	runJSON(t, nil, "properties", "add", "-json", in, out, "k=v")
+	runJSON(t, &props, "properties", "list", "-json", out)
+	if want := map[string]string{"k": "v"}; !reflect.DeepEqual(props, want) {
+		t.Errorf("properties: got %v, want %v", props, want)
+	}
+
+	var perms map[string]bool
+	runJSON(t, &perms, "permissions", "list", "-json", in)
+	if len(perms) != 8 || !perms["print"] {
+		t.Errorf("permissions: got %v", perms)
+	}
+
+	var wm map[string]bool
+	runJSON(t, &wm, "watermark", "detect", "-json", in)
+	if w, ok := wm["watermarked"]; !ok || w {
+		t.Errorf("watermark detect: got %v", wm)
+	}
+
+	runJSON(t, nil, "attach", "add", "-json", "-portfolio", in, out, filepath.Join(dir, "a.txt")+",first")
+
+	var files []string
+	outDir := filepath.Join(dir, "extracted")
+	runJSON(t, &files, "attach", "extract", "-json", out, outDir)
+	if want := []string{filepath.Join(outDir, "a.txt")}; !reflect.DeepEqual(files, want) {
+		t.Fatalf("attach extract: got %v, want %v", files, want)
+	}
+	if b, err := os.ReadFile(files[0]); err != nil || string(b) != "alpha" {
+		t.Errorf("attach extract: got %q, %v", b, err)
+	}
+
+	runJSON(t, nil, "import", "-json", "-desc", "pos:c", in, out, filepath.Join(dir, "img.png"))
+	runJSON(t, &info, "info", "-json", out)
+	if info.PageCount != 2 {
+		t.Errorf("import: got %d pages, want 2", info.PageCount)
+	}
+
+	// Log output goes to the injected stderr.
+	defer log.SetLogger(nil)
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"info", "-vv", in}, &stdout, &stderr); code != 0 || !strings.Contains(stderr.String(), "level=") {
+		t.Errorf("info -vv: got exit code %d, log %q", code, stderr.String())
+	}
+}
+
+func TestAttachExtractNames(t *testing.T) {
+
+	dir := t.TempDir()
+
+	// Attachments named a/x.txt, b/x.txt, .. and / embedding their index.
+	names := []string{"a/x.txt", "b/x.txt", "..", "/"}
+
+	objs := []string{
+		"<</Type/Catalog/Pages 2 0 R/Names<</EmbeddedFiles 4 0 R>>>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]/Resources<<>>>>",
+	}
+
+	var kv []string
+	for i, n := range names {
+		kv = append(kv, fmt.Sprintf("(%s) %d 0 R", n, 5+2*i))
+	}
+	objs = append(objs, "<</Names["+strings.Join(kv, " ")+"]>>")
+
+	for i, n := range names {
+		objs = append(objs,
+			fmt.Sprintf("<</Type/Filespec/F(%s)/UF(%s)/EF<</F %d 0 R>>>>", n, n, 6+2*i),
+			fmt.Sprintf("<</Type/EmbeddedFile/Length 1>>\nstream\n%d\nendstream", i),
+		)
+	}
+
+	in := writePDF(t, filepath.Join(dir, "in.pdf"), objs)
+	outDir := filepath.Join(dir, "out")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"attach", "extract", in, outDir}, &stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code %d\n%s", code, stderr.String())
+	}
+
+	if got, want := stdout.String(), filepath.Join(outDir, "x.txt")+"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if b, err := os.ReadFile(filepath.Join(outDir, "x.txt")); err != nil || string(b) != "0" {
+		t.Errorf("got %q, %v, want the content of a/x.txt", b, err)
+	}
+
+	for _, s := range []string{`"b/x.txt": x.txt already extracted from "a/x.txt"`, `".."`, `"/"`} {
+		if !strings.Contains(stderr.String(), "skipping attachment "+s) {
+			t.Errorf("missing %s in %s", s, stderr.String())
+		}
+	}
+}
+
+func TestPagesFlag(t *testing.T) {
+
+	// The usage documents -pages for exactly the commands accepting it.
+	for name, cmd := range commands() {
+		if documented := strings.Contains(cmd.usage, "-pages"); documented != cmd.pages {
+			t.Errorf("%s: pages %t, usage %q", name, cmd.pages, cmd.usage)
+		}
+	}
+
+	dir := t.TempDir()
+	in := writeTestPDF(t, dir)
+
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"pages", "insert", "-pages", "1", in, filepath.Join(dir, "out.pdf")}, 0},
+		{[]string{"info", "-pages", "1", in}, 2},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, &stdout, &stderr); code != tt.code {
+			t.Errorf("%v: got exit code %d, want %d\n%s", tt.args, code, tt.code, stderr.String())
+		}
+	}
+}
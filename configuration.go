@@ -16,6 +16,14 @@ limitations under the License.
 
 package pdflite
 
+import (
+	"crypto"
+	"crypto/x509"
+	"log/slog"
+
+	"github.com/zean00/pdfcpulite/log"
+)
+
 const (
 	// ValidationStrict ensures 100% compliance with the spec (PDF 32000-1:2008).
 	ValidationStrict int = iota
@@ -133,14 +141,34 @@ type Configuration struct {
 	// AES:40,128,256 RC4:40,128
 	EncryptKeyLength int
 
+	// Leaves XMP metadata streams unencrypted (EncryptMetadata false). Needs a key length >= 128.
+	UnencryptedMetadata bool
+
+	// Encrypts embedded files only, leaving strings and all other streams unencrypted (EFF). Needs a key length >= 128.
+	EncryptEmbeddedFilesOnly bool
+
 	// Supplied user access permissions, see Table 22
 	Permissions int16
 
+	// Supplied certificate and RSA private key for opening files encrypted by the public-key security handler.
+	Certificate *x509.Certificate
+	PrivateKey  crypto.PrivateKey
+
+	// Recipients for encrypting using the public-key security handler.
+	// If present the public-key security handler is used instead of the standard security handler.
+	Recipients []Recipient
+
 	// Command being executed.
 	Cmd CommandMode
 
 	// Chosen units for outputting paper sizes.
 	Units DisplayUnit
+
+	// Logger receives the log records of contexts using this configuration for LogCategories,
+	// or for all categories if empty. Other records, and those of code not working on a context,
+	// go to the process wide logger installed using log.SetLogger.
+	Logger        *slog.Logger
+	LogCategories []log.Category
 }
 
 // NewDefaultConfiguration returns the default pdfcpu configuration.
@@ -22,6 +22,8 @@ import (
 	"io"
 	"sort"
 	"strings"
+
+	"github.com/zean00/pdfcpulite/log"
 )
 
 // Context represents an environment for processing PDF files.
@@ -31,8 +33,9 @@ type Context struct {
 	Read         *ReadContext
 	Optimize     *OptimizationContext
 	Write        *WriteContext
-	writingPages bool // true, when writing page dicts.
-	dest         bool // true when writing a destination within a page.
+	writingPages bool                       // true, when writing page dicts.
+	dest         bool                       // true when writing a destination within a page.
+	copied       map[*XRefTable]map[int]int // Object numbers of objects copied into this context, by source.
 }
 
 // NewContext initializes a new Context.
@@ -50,11 +53,23 @@ func NewContext(rs io.ReadSeeker, conf *Configuration) (*Context, error) {
 		NewWriteContext(conf.Eol),
 		false,
 		false,
+		nil,
 	}
 
 	return ctx, nil
 }
 
+// Log returns c logging to the logger of the configuration of ctx, see Configuration.Logger.
+// Without a context or configuration c logs to the process wide logger.
+func (ctx *Context) Log(c log.Category) log.Entry {
+
+	if ctx == nil || ctx.Configuration == nil {
+		return c.To(nil, nil)
+	}
+
+	return c.To(ctx.Logger, ctx.LogCategories)
+}
+
 // ResetWriteContext prepares an existing WriteContext for a new file to be written.
 func (ctx *Context) ResetWriteContext() {
 
@@ -130,7 +145,7 @@ func (ctx *Context) String() string {
 	// Print free list.
 	logStr, err := ctx.freeList(logStr)
 	if err != nil {
-		fmt.Println(err)
+		ctx.Log(log.Info).Warnf("%v", err)
 	}
 
 	// Print list of any missing objects.
@@ -220,6 +235,90 @@ func (ctx *Context) addPermissionsToInfoDigest(ss *[]string) {
 	}
 }
 
+// DocInfo represents the info about a PDF file as returned by INFO.
+type DocInfo struct {
+	Version            string            `json:"version"`
+	PageCount          int               `json:"pageCount"`
+	PageSizes          []Dim             `json:"pageSizes"`
+	Units              string            `json:"units"`
+	Title              string            `json:"title"`
+	Author             string            `json:"author"`
+	Subject            string            `json:"subject"`
+	Producer           string            `json:"producer"`
+	Creator            string            `json:"creator"`
+	CreationDate       string            `json:"creationDate"`
+	ModDate            string            `json:"modificationDate"`
+	Keywords           []string          `json:"keywords"`
+	Properties         map[string]string `json:"properties"`
+	Tagged             bool              `json:"tagged"`
+	Hybrid             bool              `json:"hybrid"`
+	Linearized         bool              `json:"linearized"`
+	UsingXRefStreams   bool              `json:"usingXRefStreams"`
+	UsingObjectStreams bool              `json:"usingObjectStreams"`
+	Watermarked        bool              `json:"watermarked"`
+	Encrypted          bool              `json:"encrypted"`
+	Permissions        AccessPermissions `json:"permissions"`
+}
+
+// DocInfo returns info about ctx.
+// Distinct page sizes are listed in page order and converted to the configured units.
+func (ctx *Context) DocInfo() (*DocInfo, error) {
+	v := ctx.HeaderVersion
+	if ctx.RootVersion != nil {
+		v = ctx.RootVersion
+	}
+
+	info := &DocInfo{
+		PageCount:          ctx.PageCount,
+		PageSizes:          []Dim{},
+		Units:              ctx.units(),
+		Title:              ctx.Title,
+		Author:             ctx.Author,
+		Subject:            ctx.Subject,
+		Producer:           ctx.Producer,
+		Creator:            ctx.Creator,
+		CreationDate:       ctx.CreationDate,
+		ModDate:            ctx.ModDate,
+		Keywords:           []string{},
+		Properties:         map[string]string{},
+		Tagged:             ctx.Tagged,
+		Hybrid:             ctx.Read.Hybrid,
+		Linearized:         ctx.Read.Linearized,
+		UsingXRefStreams:   ctx.Read.UsingXRefStreams,
+		UsingObjectStreams: ctx.Read.UsingObjectStreams,
+		Watermarked:        ctx.Watermarked,
+		Encrypted:          ctx.Encrypt != nil,
+		Permissions:        ListPermissions(ctx),
+	}
+	if v != nil {
+		info.Version = v.String()
+	}
+
+	pd, err := ctx.PageDims()
+	if err != nil {
+		return nil, err
+	}
+	m := map[Dim]bool{}
+	for _, d := range pd {
+		if !m[d] {
+			m[d] = true
+			info.PageSizes = append(info.PageSizes, ctx.convertToUnits(d))
+		}
+	}
+
+	if len(ctx.Keywords) > 0 {
+		if info.Keywords, err = KeywordsList(ctx.XRefTable); err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range ctx.Properties {
+		info.Properties[k] = v
+	}
+
+	return info, nil
+}
+
 // InfoDigest returns info about ctx.
 func (ctx *Context) InfoDigest() ([]string, error) {
 	var separator = "............................................"
@@ -402,10 +501,10 @@ func (rc *ReadContext) LogStats(optimized bool) {
 
 	textSize := rc.FileSize - rc.BinaryTotalSize // = non binary content = non stream data
 
-	fmt.Println("Original:")
-	fmt.Printf("File Size            : %s (%d bytes)\n", ByteSize(rc.FileSize), rc.FileSize)
-	fmt.Printf("Total Binary Data    : %s (%d bytes) %4.1f%%\n", ByteSize(rc.BinaryTotalSize), rc.BinaryTotalSize, float32(rc.BinaryTotalSize)/float32(rc.FileSize)*100)
-	fmt.Printf("Total Text   Data    : %s (%d bytes) %4.1f%%\n\n", ByteSize(textSize), textSize, float32(textSize)/float32(rc.FileSize)*100)
+	log.Info.Infof("Original:")
+	log.Info.Infof("File Size            : %s (%d bytes)\n", ByteSize(rc.FileSize), rc.FileSize)
+	log.Info.Infof("Total Binary Data    : %s (%d bytes) %4.1f%%\n", ByteSize(rc.BinaryTotalSize), rc.BinaryTotalSize, float32(rc.BinaryTotalSize)/float32(rc.FileSize)*100)
+	log.Info.Infof("Total Text   Data    : %s (%d bytes) %4.1f%%\n\n", ByteSize(textSize), textSize, float32(textSize)/float32(rc.FileSize)*100)
 
 	// Only when optimizing we get details about resource data usage.
 	if optimized {
@@ -419,10 +518,10 @@ func (rc *ReadContext) LogStats(optimized bool) {
 		// Content stream data, other font related stream data.
 		binaryOtherSize := rc.BinaryTotalSize - binaryImageSize - binaryFontSize
 
-		fmt.Println("Breakup of binary data:")
-		fmt.Printf("images               : %s (%d bytes) %4.1f%%\n", ByteSize(binaryImageSize), binaryImageSize, float32(binaryImageSize)/float32(rc.BinaryTotalSize)*100)
-		fmt.Printf("fonts                : %s (%d bytes) %4.1f%%\n", ByteSize(binaryFontSize), binaryFontSize, float32(binaryFontSize)/float32(rc.BinaryTotalSize)*100)
-		fmt.Printf("other                : %s (%d bytes) %4.1f%%\n\n", ByteSize(binaryOtherSize), binaryOtherSize, float32(binaryOtherSize)/float32(rc.BinaryTotalSize)*100)
+		log.Info.Infof("Breakup of binary data:")
+		log.Info.Infof("images               : %s (%d bytes) %4.1f%%\n", ByteSize(binaryImageSize), binaryImageSize, float32(binaryImageSize)/float32(rc.BinaryTotalSize)*100)
+		log.Info.Infof("fonts                : %s (%d bytes) %4.1f%%\n", ByteSize(binaryFontSize), binaryFontSize, float32(binaryFontSize)/float32(rc.BinaryTotalSize)*100)
+		log.Info.Infof("other                : %s (%d bytes) %4.1f%%\n\n", ByteSize(binaryOtherSize), binaryOtherSize, float32(binaryOtherSize)/float32(rc.BinaryTotalSize)*100)
 	}
 }
 
@@ -757,15 +856,15 @@ func (wc *WriteContext) LogStats() {
 	binaryFontSize := wc.BinaryFontSize
 	binaryOtherSize := binaryTotalSize - binaryImageSize - binaryFontSize // content streams
 
-	fmt.Println("Optimized:")
-	fmt.Printf("File Size            : %s (%d bytes)\n", ByteSize(fileSize), fileSize)
-	fmt.Printf("Total Binary Data    : %s (%d bytes) %4.1f%%\n", ByteSize(binaryTotalSize), binaryTotalSize, float32(binaryTotalSize)/float32(fileSize)*100)
-	fmt.Printf("Total Text   Data    : %s (%d bytes) %4.1f%%\n\n", ByteSize(textSize), textSize, float32(textSize)/float32(fileSize)*100)
+	log.Info.Infof("Optimized:")
+	log.Info.Infof("File Size            : %s (%d bytes)\n", ByteSize(fileSize), fileSize)
+	log.Info.Infof("Total Binary Data    : %s (%d bytes) %4.1f%%\n", ByteSize(binaryTotalSize), binaryTotalSize, float32(binaryTotalSize)/float32(fileSize)*100)
+	log.Info.Infof("Total Text   Data    : %s (%d bytes) %4.1f%%\n\n", ByteSize(textSize), textSize, float32(textSize)/float32(fileSize)*100)
 
-	fmt.Println("Breakup of binary data:")
-	fmt.Printf("images               : %s (%d bytes) %4.1f%%\n", ByteSize(binaryImageSize), binaryImageSize, float32(binaryImageSize)/float32(binaryTotalSize)*100)
-	fmt.Printf("fonts                : %s (%d bytes) %4.1f%%\n", ByteSize(binaryFontSize), binaryFontSize, float32(binaryFontSize)/float32(binaryTotalSize)*100)
-	fmt.Printf("other                : %s (%d bytes) %4.1f%%\n\n", ByteSize(binaryOtherSize), binaryOtherSize, float32(binaryOtherSize)/float32(binaryTotalSize)*100)
+	log.Info.Infof("Breakup of binary data:")
+	log.Info.Infof("images               : %s (%d bytes) %4.1f%%\n", ByteSize(binaryImageSize), binaryImageSize, float32(binaryImageSize)/float32(binaryTotalSize)*100)
+	log.Info.Infof("fonts                : %s (%d bytes) %4.1f%%\n", ByteSize(binaryFontSize), binaryFontSize, float32(binaryFontSize)/float32(binaryTotalSize)*100)
+	log.Info.Infof("other                : %s (%d bytes) %4.1f%%\n\n", ByteSize(binaryOtherSize), binaryOtherSize, float32(binaryOtherSize)/float32(binaryTotalSize)*100)
 }
 
 // WriteEol writes an end of line sequence.
@@ -0,0 +1,68 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/zean00/pdfcpulite/log"
+)
+
+func TestConfigurationLogger(t *testing.T) {
+
+	defer log.SetLogger(nil)
+
+	var global bytes.Buffer
+	log.SetLogger(slog.New(slog.NewTextHandler(&global, &slog.HandlerOptions{Level: log.LevelTrace})), log.Write)
+
+	newConf := func(b *bytes.Buffer, categories ...log.Category) *Configuration {
+		conf := NewDefaultConfiguration()
+		conf.Logger = slog.New(slog.NewTextHandler(b, &slog.HandlerOptions{Level: log.LevelTrace}))
+		conf.LogCategories = categories
+		return conf
+	}
+
+	var b1, b2 bytes.Buffer
+
+	for _, conf := range []*Configuration{newConf(&b1), newConf(&b2, log.Write)} {
+		if _, err := Read(bytes.NewReader(minimalPDF()), conf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !strings.Contains(b1.String(), "category=read") {
+		t.Errorf("missing read records: %s", b1.String())
+	}
+
+	// Read records of a context logging write records only go to the process wide logger,
+	// which is not installed for them.
+	if b2.Len() > 0 || global.Len() > 0 {
+		t.Errorf("unexpected output: %s%s", b2.String(), global.String())
+	}
+
+	// Without a logger of its own a context logs to the process wide logger.
+	ctx := readMinimalPDF(t)
+	ctx.Log(log.Write).Debugf("global")
+	ctx.Log(log.Read).Debugf("dropped")
+
+	if s := global.String(); !strings.Contains(s, "msg=global category=write") || strings.Contains(s, "dropped") {
+		t.Errorf("got %q", s)
+	}
+}
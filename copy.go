@@ -0,0 +1,190 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"errors"
+)
+
+// CopyObject copies o including all objects reachable from o from src into dst and returns the copy.
+//
+// Every indirect object copied is assigned a new object number in dst.
+// Objects already copied from src into dst by an earlier call are reused.
+// Back references into the source page tree (Parent entries and the P entry of annotations) are not followed and dropped.
+// References to undefined or free objects are treated as null (see 7.3.10): dict entries are dropped,
+// array elements become null.
+// src remains unchanged.
+func CopyObject(src, dst *Context, o Object) (Object, error) {
+
+	if src == nil || dst == nil {
+		return nil, errors.New("pdfcpu: copyObject: missing context")
+	}
+
+	if src.XRefTable == dst.XRefTable {
+		return nil, errors.New("pdfcpu: copyObject: source and destination must differ")
+	}
+
+	if dst.Size == nil {
+		return nil, errors.New("pdfcpu: copyObject: destination has no size")
+	}
+
+	if dst.copied == nil {
+		dst.copied = map[*XRefTable]map[int]int{}
+	}
+
+	migrated := dst.copied[src.XRefTable]
+	if migrated == nil {
+		migrated = map[int]int{}
+		dst.copied[src.XRefTable] = migrated
+	}
+
+	return copyInto(src, dst, migrated, o)
+}
+
+// isBackRef returns true if the entry for key of d refers back to the page tree.
+func isBackRef(d Dict, key string) bool {
+
+	if key == "Parent" {
+		return true
+	}
+
+	if key != "P" {
+		return false
+	}
+
+	// Annotations link to their page via P.
+	if t := d.Type(); t != nil && *t == "Annot" {
+		return true
+	}
+
+	_, hasRect := d.Find("Rect")
+	_, hasSubtype := d.Find("Subtype")
+
+	return hasRect && hasSubtype
+}
+
+func copyDictInto(src, dst *Context, migrated map[int]int, d Dict) (Dict, error) {
+
+	if d == nil {
+		return nil, nil
+	}
+
+	d1 := make(Dict, len(d))
+
+	for k, v := range d {
+		if isBackRef(d, k) {
+			continue
+		}
+		o, err := copyInto(src, dst, migrated, v)
+		if err != nil {
+			return nil, err
+		}
+		if o == nil {
+			// A null value is equivalent to an absent entry.
+			continue
+		}
+		d1[k] = o
+	}
+
+	return d1, nil
+}
+
+func copyStreamDictInto(src, dst *Context, migrated map[int]int, sd StreamDict) (StreamDict, error) {
+
+	d, err := copyDictInto(src, dst, migrated, sd.Dict)
+	if err != nil {
+		return sd, err
+	}
+
+	sd1 := copyStreamDict(sd)
+	sd1.Dict = d
+	sd1.StreamLengthObjNr = nil
+
+	for i, f := range sd1.FilterPipeline {
+		if sd1.FilterPipeline[i].DecodeParms, err = copyDictInto(src, dst, migrated, f.DecodeParms); err != nil {
+			return sd, err
+		}
+	}
+
+	return sd1, nil
+}
+
+func copyIndRefInto(src, dst *Context, migrated map[int]int, ir IndirectRef) (Object, error) {
+
+	objNr := ir.ObjectNumber.Value()
+
+	if objNr1, ok := migrated[objNr]; ok {
+		return *NewIndirectRef(objNr1, 0), nil
+	}
+
+	o, err := src.Dereference(ir)
+	if err != nil {
+		return nil, err
+	}
+
+	if o == nil {
+		// Dangling reference, the caller drops or writes null.
+		return nil, nil
+	}
+
+	// Register the new object number before descending in order to terminate cycles.
+	objNr1, err := dst.InsertObject(nil)
+	if err != nil {
+		return nil, err
+	}
+	migrated[objNr] = objNr1
+
+	o1, err := copyInto(src, dst, migrated, o)
+	if err != nil {
+		return nil, err
+	}
+
+	dst.Table[objNr1].Object = o1
+
+	return *NewIndirectRef(objNr1, 0), nil
+}
+
+func copyInto(src, dst *Context, migrated map[int]int, o Object) (Object, error) {
+
+	switch o := o.(type) {
+
+	case IndirectRef:
+		return copyIndRefInto(src, dst, migrated, o)
+
+	case Dict:
+		return copyDictInto(src, dst, migrated, o)
+
+	case StreamDict:
+		return copyStreamDictInto(src, dst, migrated, o)
+
+	case Array:
+		a := make(Array, len(o))
+		for i, v := range o {
+			o1, err := copyInto(src, dst, migrated, v)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = o1
+		}
+		return a, nil
+
+	case ObjectStreamDict, *ObjectStreamDict, XRefStreamDict, *XRefStreamDict:
+		return nil, errors.New("pdfcpu: copyObject: unable to copy object or xref streams")
+	}
+
+	return o, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"testing"
+)
+
+// copyTestObject copies o from src into dst and returns the copied dict.
+func copyTestObject(t *testing.T, src, dst *Context, o Object) Dict {
+	t.Helper()
+
+	o1, err := CopyObject(src, dst, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := dst.DereferenceDict(o1)
+	if err != nil || d == nil {
+		t.Fatalf("got %v, want dict: %v", o1, err)
+	}
+
+	return d
+}
+
+func TestCopyObjectCycle(t *testing.T) {
+
+	src, dst := readMinimalPDF(t), readMinimalPDF(t)
+
+	// a and b refer to each other.
+	a, b := NewDict(), NewDict()
+	irA, _ := src.IndRefForNewObject(a)
+	irB, _ := src.IndRefForNewObject(b)
+	a.Insert("Next", *irB)
+	b.Insert("Next", *irA)
+
+	size := *dst.Size
+
+	a1 := copyTestObject(t, src, dst, *irA)
+
+	if got := *dst.Size - size; got != 2 {
+		t.Errorf("got %d new objects, want 2", got)
+	}
+
+	b1, err := dst.DereferenceDict(a1["Next"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ir := b1.IndirectRefEntry("Next")
+	if ir == nil || ir.ObjectNumber.Value() != size {
+		t.Errorf("got back reference %v, want %d 0 R", ir, size)
+	}
+}
+
+func TestCopyObjectSharedRefs(t *testing.T) {
+
+	src, dst := readMinimalPDF(t), readMinimalPDF(t)
+
+	shared, _ := src.IndRefForNewObject(Dict(map[string]Object{"Type": Name("Shared")}))
+	d := Dict(map[string]Object{"A": *shared, "B": Array{*shared, *shared}})
+
+	size := *dst.Size
+
+	d1 := copyTestObject(t, src, dst, d)
+
+	if got := *dst.Size - size; got != 1 {
+		t.Errorf("got %d new objects, want 1", got)
+	}
+
+	a := d1.ArrayEntry("B")
+	if a == nil || d1["A"] != a[0] || a[0] != a[1] {
+		t.Errorf("shared object copied more than once: %v", d1)
+	}
+
+	// A later copy reuses objects copied before.
+	d2 := copyTestObject(t, src, dst, Dict(map[string]Object{"C": *shared}))
+	if d2["C"] != d1["A"] || *dst.Size-size != 1 {
+		t.Errorf("got %v, want %v", d2["C"], d1["A"])
+	}
+}
+
+func TestCopyObjectDanglingRefs(t *testing.T) {
+
+	src, dst := readMinimalPDF(t), readMinimalPDF(t)
+
+	dangling := *NewIndirectRef(99, 0)
+	d := Dict(map[string]Object{"A": dangling, "B": Array{Integer(1), dangling}})
+
+	d1 := copyTestObject(t, src, dst, d)
+
+	if _, found := d1.Find("A"); found {
+		t.Errorf("dangling reference not dropped: %v", d1)
+	}
+
+	a := d1.ArrayEntry("B")
+	if len(a) != 2 || a[1] != nil {
+		t.Errorf("got %v, want [1 null]", a)
+	}
+}
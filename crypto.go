@@ -26,6 +26,7 @@ import (
 	"crypto/rand"
 	"crypto/rc4"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
@@ -33,6 +34,9 @@ import (
 	"io"
 	"strconv"
 	"time"
+
+	"github.com/zean00/pdfcpulite/filter"
+	"github.com/zean00/pdfcpulite/log"
 )
 
 var (
@@ -64,6 +68,7 @@ var (
 		SETPERMISSIONS:          {0, 0},
 		ADDWATERMARKS:           {1, 0},
 		REMOVEWATERMARKS:        {1, 0},
+		IMPORTIMAGES:            {0, 1},
 		INSERTPAGESBEFORE:       {1, 0},
 		INSERTPAGESAFTER:        {1, 0},
 		REMOVEPAGES:             {1, 0},
@@ -78,7 +83,7 @@ var (
 )
 
 // NewEncryptDict creates a new EncryptDict using the standard security handler.
-func newEncryptDict(needAES bool, keyLength int, permissions int16) Dict {
+func newEncryptDict(needAES bool, keyLength int, permissions int16, encryptMetadata, embeddedFilesOnly bool) Dict {
 
 	d := NewDict()
 
@@ -86,12 +91,13 @@ func newEncryptDict(needAES bool, keyLength int, permissions int16) Dict {
 
 	if keyLength >= 128 {
 		d.Insert("Length", Integer(keyLength))
-		i := 4
+		r, v := 4, 4
 		if keyLength == 256 {
-			i = 5
+			// R5 is deprecated, ISO 32000-2 uses R6 along with Algorithm 2.B.
+			r, v = 6, 5
 		}
-		d.Insert("R", Integer(i))
-		d.Insert("V", Integer(i))
+		d.Insert("R", Integer(r))
+		d.Insert("V", Integer(v))
 	} else {
 		d.Insert("R", Integer(2))
 		d.Insert("V", Integer(1))
@@ -100,8 +106,18 @@ func newEncryptDict(needAES bool, keyLength int, permissions int16) Dict {
 	// Set user access permission flags.
 	d.Insert("P", Integer(permissions))
 
-	d.Insert("StmF", Name("StdCF"))
-	d.Insert("StrF", Name("StdCF"))
+	if embeddedFilesOnly {
+		d.Insert("StmF", Name("Identity"))
+		d.Insert("StrF", Name("Identity"))
+		d.Insert("EFF", Name("StdCF"))
+	} else {
+		d.Insert("StmF", Name("StdCF"))
+		d.Insert("StrF", Name("StdCF"))
+	}
+
+	if !encryptMetadata {
+		d.Insert("EncryptMetadata", Boolean(false))
+	}
 
 	d1 := NewDict()
 	d1.Insert("AuthEvent", Name("DocOpen"))
@@ -137,10 +153,10 @@ func newEncryptDict(needAES bool, keyLength int, permissions int16) Dict {
 	return d
 }
 
-func encKey(userpw string, e *Enc) (key []byte) {
+func encKey(userpw []byte, e *Enc) (key []byte) {
 
 	// 2a
-	pw := []byte(userpw)
+	pw := append([]byte{}, userpw...)
 	if len(pw) >= 32 {
 		pw = pw[:32]
 	} else {
@@ -191,14 +207,25 @@ func encKey(userpw string, e *Enc) (key []byte) {
 // validateUserPassword validates the user password aka document open password.
 func validateUserPassword(ctx *Context) (ok bool, err error) {
 
-	if ctx.E.R == 5 {
-		return validateUserPasswordAES256(ctx)
+	for _, upw := range passwordCandidates(ctx.UserPW, ctx.E.R) {
+		if ok, err = checkUserPassword(ctx, upw); ok || err != nil {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+func checkUserPassword(ctx *Context, upw []byte) (ok bool, err error) {
+
+	if ctx.E.R >= 5 {
+		return validateUserPasswordAES256(ctx, upw)
 	}
 
 	// Alg.4/5 p63
 	// 4a/5a create encryption key using Alg.2 p61
 
-	u, key, err := u(ctx)
+	u, key, err := u(ctx, upw)
 	if err != nil {
 		return false, err
 	}
@@ -217,12 +244,12 @@ func validateUserPassword(ctx *Context) (ok bool, err error) {
 	return ok, nil
 }
 
-func key(ownerpw, userpw string, r, l int) (key []byte) {
+func key(ownerpw, userpw []byte, r, l int) (key []byte) {
 
 	// 3a
-	pw := []byte(ownerpw)
+	pw := append([]byte{}, ownerpw...)
 	if len(pw) == 0 {
-		pw = []byte(userpw)
+		pw = append(pw, userpw...)
 	}
 	if len(pw) >= 32 {
 		pw = pw[:32]
@@ -255,10 +282,7 @@ func key(ownerpw, userpw string, r, l int) (key []byte) {
 }
 
 // O calculates the owner password digest.
-func o(ctx *Context) ([]byte, error) {
-
-	ownerpw := ctx.OwnerPW
-	userpw := ctx.UserPW
+func o(ctx *Context, ownerpw, userpw []byte) ([]byte, error) {
 
 	e := ctx.E
 
@@ -266,7 +290,7 @@ func o(ctx *Context) ([]byte, error) {
 	key := key(ownerpw, userpw, e.R, e.L)
 
 	// 3e
-	o := []byte(userpw)
+	o := append([]byte{}, userpw...)
 	if len(o) >= 32 {
 		o = o[:32]
 	} else {
@@ -302,13 +326,7 @@ func o(ctx *Context) ([]byte, error) {
 }
 
 // U calculates the user password digest.
-func u(ctx *Context) (u []byte, key []byte, err error) {
-
-	// The PW string is generated from OS codepage characters by first converting the string to
-	// PDFDocEncoding. If input is Unicode, first convert to a codepage encoding , and then to
-	// PDFDocEncoding for backward compatibility.
-	userpw := ctx.UserPW
-	//fmt.Printf("U userpw=ctx.UserPW=%s\n", userpw)
+func u(ctx *Context, userpw []byte) (u []byte, key []byte, err error) {
 
 	e := ctx.E
 
@@ -364,6 +382,58 @@ func u(ctx *Context) (u []byte, key []byte, err error) {
 	return u, key, nil
 }
 
+// hashAES256 computes the hash used by the AES-256 security handlers for password validation and key derivation.
+// u is the 48 byte U entry when processing the owner password and nil otherwise.
+func hashAES256(pw, salt, u []byte, r int) []byte {
+
+	b := append(append(append([]byte{}, pw...), salt...), u...)
+	k := sha256.Sum256(b)
+
+	if r == 5 {
+		return k[:]
+	}
+
+	// Algorithm 2.B (ISO 32000-2)
+	key := k[:]
+
+	for i := 0; ; {
+
+		k1 := append(append(append([]byte{}, pw...), key...), u...)
+		k1 = bytes.Repeat(k1, 64)
+
+		// key is at least 32 bytes long, a 16 byte AES key never fails.
+		cb, _ := aes.NewCipher(key[:16])
+
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(cb, key[16:32]).CryptBlocks(e, k1)
+
+		// The first 16 bytes of e taken as a big-endian number modulo 3.
+		var m int
+		for _, c := range e[:16] {
+			m += int(c)
+		}
+
+		switch m % 3 {
+		case 0:
+			h := sha256.Sum256(e)
+			key = h[:]
+		case 1:
+			h := sha512.Sum384(e)
+			key = h[:]
+		case 2:
+			h := sha512.Sum512(e)
+			key = h[:]
+		}
+
+		i++
+		if i >= 64 && int(e[len(e)-1]) <= i-32 {
+			break
+		}
+	}
+
+	return key[:32]
+}
+
 func validationSalt(bb []byte) []byte {
 	return bb[32:40]
 }
@@ -372,99 +442,50 @@ func keySalt(bb []byte) []byte {
 	return bb[40:]
 }
 
-func validateOwnerPasswordAES256(ctx *Context) (ok bool, err error) {
+// validateOwnerPasswordAES256 validates the prepared owner password opw (Algorithm 2.A).
+func validateOwnerPasswordAES256(ctx *Context, opw []byte) (ok bool, err error) {
 
-	if len(ctx.OwnerPW) == 0 {
+	if len(opw) == 0 {
 		return false, nil
 	}
 
-	// TODO Process PW with SASLPrep profile (RFC 4013) of stringprep (RFC 3454).
-	opw := []byte(ctx.OwnerPW)
-	if len(opw) > 127 {
-		opw = opw[:127]
-	}
-	//fmt.Printf("opw <%s> isValidUTF8String: %t\n", opw, utf8.Valid(opw))
-
 	// Algorithm 3.2a 3.
-	b := append(opw, validationSalt(ctx.E.O)...)
-	b = append(b, ctx.E.U...)
-	s := sha256.Sum256(b)
+	s := hashAES256(opw, validationSalt(ctx.E.O), ctx.E.U, ctx.E.R)
 
-	if !bytes.HasPrefix(ctx.E.O, s[:]) {
+	if !bytes.HasPrefix(ctx.E.O, s) {
 		return false, nil
 	}
 
-	b = append(opw, keySalt(ctx.E.O)...)
-	b = append(b, ctx.E.U...)
-	key := sha256.Sum256(b)
+	ctx.EncKey, err = calcFileEncKeyFromOE(ctx, opw)
 
-	cb, err := aes.NewCipher(key[:])
-	if err != nil {
-		return false, err
-	}
-
-	iv := make([]byte, 16)
-	ctx.EncKey = make([]byte, 32)
-
-	mode := cipher.NewCBCDecrypter(cb, iv)
-	mode.CryptBlocks(ctx.EncKey, ctx.E.OE)
-
-	return true, nil
+	return err == nil, err
 }
 
-func validateUserPasswordAES256(ctx *Context) (ok bool, err error) {
-
-	// TODO Process PW with SASLPrep profile (RFC 4013) of stringprep (RFC 3454).
-	upw := []byte(ctx.UserPW)
-	if len(upw) > 127 {
-		upw = upw[:127]
-	}
-	//fmt.Printf("upw <%s> isValidUTF8String: %t\n", upw, utf8.Valid(upw))
+// validateUserPasswordAES256 validates the prepared user password upw (Algorithm 2.A).
+func validateUserPasswordAES256(ctx *Context, upw []byte) (ok bool, err error) {
 
 	// Algorithm 3.2a 4,
-	s := sha256.Sum256(append(upw, validationSalt(ctx.E.U)...))
+	s := hashAES256(upw, validationSalt(ctx.E.U), nil, ctx.E.R)
 
-	if !bytes.HasPrefix(ctx.E.U, s[:]) {
+	if !bytes.HasPrefix(ctx.E.U, s) {
 		return false, nil
 	}
 
-	key := sha256.Sum256(append(upw, keySalt(ctx.E.U)...))
+	ctx.EncKey, err = calcFileEncKeyFromUE(ctx, upw)
 
-	cb, err := aes.NewCipher(key[:])
-	if err != nil {
-		return false, err
-	}
-
-	iv := make([]byte, 16)
-	ctx.EncKey = make([]byte, 32)
-
-	mode := cipher.NewCBCDecrypter(cb, iv)
-	mode.CryptBlocks(ctx.EncKey, ctx.E.UE)
-
-	return true, nil
+	return err == nil, err
 }
 
-// ValidateOwnerPassword validates the owner password aka change permissions password.
-func validateOwnerPassword(ctx *Context) (ok bool, err error) {
+// userPasswordFromO recovers the padded user password from the owner password and "O" (Algorithm 7 a-b).
+func userPasswordFromO(ctx *Context, ownerpw []byte) (upw []byte, err error) {
 
 	e := ctx.E
 
-	if e.R == 5 {
-		return validateOwnerPasswordAES256(ctx)
-	}
-
-	// The PW string is generated from OS codepage characters by first converting the string to
-	// PDFDocEncoding. If input is Unicode, first convert to a codepage encoding , and then to
-	// PDFDocEncoding for backward compatibility.
-
-	ownerpw := ctx.OwnerPW
-	userpw := ctx.UserPW
-
 	// 7a: Alg.3 p62 a-d
-	key := key(ownerpw, userpw, e.R, e.L)
+	key := key(ownerpw, passwordCandidates(ctx.UserPW, e.R)[0], e.R, e.L)
 
 	// 7b
-	upw := make([]byte, len(e.O))
+	upw = make([]byte, len(e.O))
 	copy(upw, e.O)
 
 	var c *rc4.Cipher
@@ -474,7 +495,7 @@ func validateOwnerPassword(ctx *Context) (ok bool, err error) {
 	case 2:
 		c, err = rc4.NewCipher(key)
 		if err != nil {
-			return
+			return nil, err
 		}
 		c.XORKeyStream(upw, upw)
 
@@ -490,30 +511,53 @@ func validateOwnerPassword(ctx *Context) (ok bool, err error) {
 
 			c, err = rc4.NewCipher(keynew)
 			if err != nil {
-				return false, err
+				return nil, err
 			}
 
 			c.XORKeyStream(upw, upw)
 		}
 	}
 
-	// Save user pw
-	upws := ctx.UserPW
+	return upw, nil
+}
+
+// ValidateOwnerPassword validates the owner password aka change permissions password.
+func validateOwnerPassword(ctx *Context) (ok bool, err error) {
+	_, ok, err = ownerPassword(ctx)
+	return ok, err
+}
+
+// ownerPassword returns the prepared owner password if it is valid.
+func ownerPassword(ctx *Context) (opw []byte, ok bool, err error) {
+
+	for _, opw := range passwordCandidates(ctx.OwnerPW, ctx.E.R) {
+		if ok, err = checkOwnerPassword(ctx, opw); ok || err != nil {
+			return opw, ok, err
+		}
+	}
+
+	return nil, false, nil
+}
 
-	ctx.UserPW = string(upw)
-	ok, err = validateUserPassword(ctx)
+func checkOwnerPassword(ctx *Context, opw []byte) (ok bool, err error) {
 
-	// Restore user pw
-	ctx.UserPW = upws
+	if ctx.E.R >= 5 {
+		return validateOwnerPasswordAES256(ctx, opw)
+	}
 
-	return ok, err
+	upw, err := userPasswordFromO(ctx, opw)
+	if err != nil {
+		return false, err
+	}
+
+	return checkUserPassword(ctx, upw)
 }
 
 // SupportedCFEntry returns true if all entries found are supported.
 func supportedCFEntry(d Dict) (bool, error) {
 
 	cfm := d.NameEntry("CFM")
-	if cfm != nil && *cfm != "V2" && *cfm != "AESV2" && *cfm != "AESV3" {
+	if cfm != nil && *cfm != "None" && *cfm != "V2" && *cfm != "AESV2" && *cfm != "AESV3" {
 		return false, errors.New("pdfcpu: supportedCFEntry: invalid entry \"CFM\"")
 	}
 
@@ -559,7 +603,7 @@ func validatePermissions(ctx *Context) (bool, error) {
 
 	// Algorithm 3.2a 5.
 
-	if ctx.E.R != 5 {
+	if ctx.E.R < 5 {
 		return true, nil
 	}
 
@@ -582,7 +626,7 @@ func writePermissions(ctx *Context, d Dict) error {
 
 	// Algorithm 3.10
 
-	if ctx.E.R != 5 {
+	if ctx.E.R < 5 {
 		return nil
 	}
 
@@ -618,7 +662,7 @@ func writePermissions(ctx *Context, d Dict) error {
 func logP(enc *Enc) {
 
 	for _, s := range perms(enc.P) {
-		fmt.Println(s)
+		log.Crypto.Infof("%s", s)
 	}
 
 }
@@ -693,23 +737,31 @@ func getV(d Dict) (*int, error) {
 
 	return v, nil
 }
-func checkStmf(ctx *Context, stmf *string, cfDict Dict) error {
 
-	if stmf != nil && *stmf != "Identity" {
+// cryptFilterMethod returns the crypt filter method of the crypt filter name defined in cfDict
+// and if this method uses AES.
+func cryptFilterMethod(name string, cfDict Dict) (string, bool, error) {
 
-		d := cfDict.DictEntry(*stmf)
-		if d == nil {
-			return fmt.Errorf("pdfcpu: checkStmf: entry \"%s\" missing in \"CF\"", *stmf)
-		}
+	if name == "Identity" {
+		return "Identity", false, nil
+	}
 
-		aes, err := supportedCFEntry(d)
-		if err != nil {
-			return fmt.Errorf(err.Error()+"pdfcpu: checkStmv: unsupported \"%s\" entry in \"CF\"", *stmf)
-		}
-		ctx.AES4Streams = aes
+	d := cfDict.DictEntry(name)
+	if d == nil {
+		return "", false, fmt.Errorf("pdfcpu: cryptFilterMethod: entry \"%s\" missing in \"CF\"", name)
 	}
 
-	return nil
+	aes, err := supportedCFEntry(d)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: unsupported \"%s\" entry in \"CF\"", err, name)
+	}
+
+	cfm := d.NameEntry("CFM")
+	if cfm == nil {
+		return "None", false, nil
+	}
+
+	return *cfm, aes, nil
 }
 
 func checkV(ctx *Context, d Dict) (*int, error) {
@@ -719,8 +771,9 @@ func checkV(ctx *Context, d Dict) (*int, error) {
 		return nil, err
 	}
 
-	// v == 2 implies RC4
+	// v < 4 implies RC4 for everything
 	if *v != 4 && *v != 5 {
+		ctx.CFM4Strings, ctx.CFM4Streams, ctx.CFM4EmbeddedStreams = "V2", "V2", "V2"
 		return v, nil
 	}
 
@@ -730,42 +783,96 @@ func checkV(ctx *Context, d Dict) (*int, error) {
 		return nil, fmt.Errorf("pdfcpu: checkV: required entry \"CF\" missing.")
 	}
 
-	// StmF
-	stmf := d.NameEntry("StmF")
-	err = checkStmf(ctx, stmf, cfDict)
-	if err != nil {
+	ctx.CFM = map[string]string{}
+	for k := range cfDict {
+		if ctx.CFM[k], _, err = cryptFilterMethod(k, cfDict); err != nil {
+			return nil, err
+		}
+	}
+
+	// StmF, defaults to Identity.
+	stmf := "Identity"
+	if n := d.NameEntry("StmF"); n != nil {
+		stmf = *n
+	}
+	if ctx.CFM4Streams, ctx.AES4Streams, err = cryptFilterMethod(stmf, cfDict); err != nil {
 		return nil, err
 	}
 
-	// StrF
-	strf := d.NameEntry("StrF")
-	if strf != nil && *strf != "Identity" {
-		d1 := cfDict.DictEntry(*strf)
-		if d1 == nil {
-			return nil, fmt.Errorf("pdfcpu: checkV: entry \"%s\" missing in \"CF\"", *strf)
-		}
-		aes, err := supportedCFEntry(d1)
-		if err != nil {
-			return nil, fmt.Errorf(err.Error()+"checkV: unsupported \"%s\" entry in \"CF\"", *strf)
-		}
-		ctx.AES4Strings = aes
+	// StrF, defaults to Identity.
+	strf := "Identity"
+	if n := d.NameEntry("StrF"); n != nil {
+		strf = *n
+	}
+	if ctx.CFM4Strings, ctx.AES4Strings, err = cryptFilterMethod(strf, cfDict); err != nil {
+		return nil, err
+	}
+
+	// EFF, defaults to StmF.
+	eff := stmf
+	if n := d.NameEntry("EFF"); n != nil {
+		eff = *n
+	}
+	if ctx.CFM4EmbeddedStreams, ctx.AES4EmbeddedStreams, err = cryptFilterMethod(eff, cfDict); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func identityCFM(cfm string) bool {
+	return cfm == "Identity" || cfm == "None"
+}
+
+// encryptsStrings returns true if strings are subject to encryption.
+func (ctx *Context) encryptsStrings() bool {
+	return ctx.EncKey != nil && !identityCFM(ctx.CFM4Strings)
+}
+
+// streamEncryption returns true if sd is subject to encryption and if so, whether AES is used.
+// A Crypt filter naming a crypt filter missing in the encrypt dict's CF entry is an error.
+func (ctx *Context) streamEncryption(sd *StreamDict) (encrypted, aes bool, err error) {
+
+	// ctx gets created after XRefStream parsing.
+	if ctx == nil || ctx.EncKey == nil {
+		return false, false, nil
 	}
 
-	// EFF
-	eff := d.NameEntry("EFF")
-	if eff != nil && *strf != "Identity" {
-		d := cfDict.DictEntry(*eff)
-		if d == nil {
-			return nil, fmt.Errorf("pdfcpu: checkV: entry \"%s\" missing in \"CF\"", *eff)
+	cfm, aes := ctx.CFM4Streams, ctx.AES4Streams
+
+	if t := sd.Type(); t != nil {
+		switch *t {
+
+		case "XRef":
+			// XRefStreams are not encrypted.
+			return false, false, nil
+
+		case "Metadata":
+			if ctx.E != nil && !ctx.E.Emd {
+				return false, false, nil
+			}
+
+		case "EmbeddedFile":
+			cfm, aes = ctx.CFM4EmbeddedStreams, ctx.AES4EmbeddedStreams
 		}
-		aes, err := supportedCFEntry(d)
-		if err != nil {
-			return nil, fmt.Errorf(err.Error()+"checkV: unsupported \"%s\" entry in \"CF\"", *strf)
+	}
+
+	// A leading Crypt filter overrides the default crypt filter (see 7.6.6).
+	if len(sd.FilterPipeline) > 0 && sd.FilterPipeline[0].Name == filter.Crypt {
+		cfm, aes = "Identity", false
+		if parms := sd.FilterPipeline[0].DecodeParms; parms != nil {
+			// Identity is the only crypt filter name not defined by CF.
+			if n := parms.NameEntry("Name"); n != nil && *n != "Identity" {
+				var ok bool
+				if cfm, ok = ctx.CFM[*n]; !ok {
+					return false, false, fmt.Errorf("pdfcpu: crypt filter \"%s\" missing in \"CF\"", *n)
+				}
+				aes = cfm == "AESV2" || cfm == "AESV3"
+			}
 		}
-		ctx.AES4EmbeddedStreams = aes
 	}
 
-	return v, nil
+	return !identityCFM(cfm), aes, nil
 }
 
 func length(d Dict) (int, error) {
@@ -785,11 +892,8 @@ func length(d Dict) (int, error) {
 func getR(d Dict) (int, error) {
 
 	r := d.IntEntry("R")
-	if r == nil || *r < 2 || *r > 5 {
-		if *r > 5 {
-			return 0, errors.New("pdfcpu: PDF 2.0 encryption not supported")
-		}
-		return 0, errors.New("pdfcpu: encryption: \"R\" must be 2,3,4,5")
+	if r == nil || *r < 2 || *r > 6 {
+		return 0, errors.New("pdfcpu: encryption: \"R\" must be 2,3,4,5,6")
 	}
 
 	return *r, nil
@@ -912,7 +1016,10 @@ func supportedEncryption(ctx *Context, d Dict) (*Enc, error) {
 	}
 
 	var oe, ue, perms []byte
-	if r == 5 {
+	if r >= 5 {
+		if len(o) != 48 || len(u) != 48 {
+			return nil, errors.New("pdfcpu: unsupported encryption: \"O\" and \"U\" must be 48 bytes long")
+		}
 		oe, ue, perms, err = validateAES256Parameters(d)
 		if err != nil {
 			return nil, err
@@ -979,7 +1086,7 @@ func encryptBytes(b []byte, objNr, genNr int, encKey []byte, needAES bool, r int
 
 	if needAES {
 		k := encKey
-		if r != 5 {
+		if r < 5 {
 			k = decryptKey(objNr, genNr, encKey, needAES)
 		}
 		bb, err := encryptAESBytes(b, k)
@@ -1013,7 +1120,7 @@ func decryptBytes(b []byte, objNr, genNr int, encKey []byte, needAES bool, r int
 
 	if needAES {
 		k := encKey
-		if r != 5 {
+		if r < 5 {
 			k = decryptKey(objNr, genNr, encKey, needAES)
 		}
 		bb, err := decryptAESBytes(b, k)
@@ -1197,7 +1304,7 @@ func decryptDeepObject(objIn Object, objNr, genNr int, key []byte, needAES bool,
 func encryptStream(buf []byte, objNr, genNr int, encKey []byte, needAES bool, r int) ([]byte, error) {
 
 	k := encKey
-	if r != 5 {
+	if r < 5 {
 		k = decryptKey(objNr, genNr, encKey, needAES)
 	}
 
@@ -1212,7 +1319,7 @@ func encryptStream(buf []byte, objNr, genNr int, encKey []byte, needAES bool, r
 func decryptStream(buf []byte, objNr, genNr int, encKey []byte, needAES bool, r int) ([]byte, error) {
 
 	k := encKey
-	if r != 5 {
+	if r < 5 {
 		k = decryptKey(objNr, genNr, encKey, needAES)
 	}
 
@@ -1370,12 +1477,11 @@ func decryptHexLiteral(hl HexLiteral, objNr, genNr int, key []byte, needAES bool
 	return decryptBytes(bb, objNr, genNr, key, needAES, r)
 }
 
-func calcFileEncKeyFromUE(ctx *Context) (k []byte, err error) {
+func calcFileEncKeyFromUE(ctx *Context, upw []byte) (k []byte, err error) {
 
-	upw := []byte(ctx.OwnerPW)
-	key := sha256.Sum256(append(upw, keySalt(ctx.E.U)...))
+	key := hashAES256(upw, keySalt(ctx.E.U), nil, ctx.E.R)
 
-	cb, err := aes.NewCipher(key[:])
+	cb, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -1389,14 +1495,11 @@ func calcFileEncKeyFromUE(ctx *Context) (k []byte, err error) {
 	return k, nil
 }
 
-func calcFileEncKeyFromOE(ctx *Context) (k []byte, err error) {
+func calcFileEncKeyFromOE(ctx *Context, opw []byte) (k []byte, err error) {
 
-	opw := []byte(ctx.OwnerPW)
-	b := append(opw, keySalt(ctx.E.O)...)
-	b = append(b, ctx.E.U...)
-	key := sha256.Sum256(b)
+	key := hashAES256(opw, keySalt(ctx.E.O), ctx.E.U, ctx.E.R)
 
-	cb, err := aes.NewCipher(key[:])
+	cb, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -1410,25 +1513,16 @@ func calcFileEncKeyFromOE(ctx *Context) (k []byte, err error) {
 	return k, nil
 }
 
-func calcFileEncKey(ctx *Context, d Dict) (err error) {
-
-	// Calc Random UE (32 bytes)
-	ue := make([]byte, 32)
-	_, err = io.ReadFull(rand.Reader, ue)
-	if err != nil {
-		return err
-	}
-
-	ctx.E.UE = ue
-	d.Update("UE", HexLiteral(hex.EncodeToString(ctx.E.UE)))
+// calcFileEncKey generates a random 256 bit file encryption key.
+func calcFileEncKey(ctx *Context) (err error) {
 
-	// Calc file encryption key.
-	ctx.EncKey, err = calcFileEncKeyFromUE(ctx)
+	ctx.EncKey = make([]byte, 32)
+	_, err = io.ReadFull(rand.Reader, ctx.EncKey)
 
 	return err
 }
 
-func calcOAndUAES256(ctx *Context, d Dict) (err error) {
+func calcOAndUAES256(ctx *Context, d Dict, opw, upw []byte) (err error) {
 
 	// 1) Calc U.
 	b := make([]byte, 16)
@@ -1438,9 +1532,8 @@ func calcOAndUAES256(ctx *Context, d Dict) (err error) {
 	}
 
 	u := append(make([]byte, 32), b...)
-	upw := []byte(ctx.UserPW)
-	h := sha256.Sum256(append(upw, validationSalt(u)...))
-	ctx.E.U = append(h[:], b...)
+	h := hashAES256(upw, validationSalt(u), nil, ctx.E.R)
+	ctx.E.U = append(h, b...)
 	d.Update("U", HexLiteral(hex.EncodeToString(ctx.E.U)))
 
 	// 2) Calc O (depends on U).
@@ -1451,20 +1544,19 @@ func calcOAndUAES256(ctx *Context, d Dict) (err error) {
 	}
 
 	o := append(make([]byte, 32), b...)
-	opw := []byte(ctx.OwnerPW)
-	c := append(opw, validationSalt(o)...)
-	h = sha256.Sum256(append(c, ctx.E.U...))
-	ctx.E.O = append(h[:], b...)
+	h = hashAES256(opw, validationSalt(o), ctx.E.U, ctx.E.R)
+	ctx.E.O = append(h, b...)
 	d.Update("O", HexLiteral(hex.EncodeToString(ctx.E.O)))
 
-	err = calcFileEncKey(ctx, d)
+	err = calcFileEncKey(ctx)
 	if err != nil {
 		return err
 	}
 
 	// Encrypt file encryption key into UE.
-	h = sha256.Sum256(append(upw, keySalt(u)...))
-	cb, err := aes.NewCipher(h[:])
+	ctx.E.UE = make([]byte, 32)
+	h = hashAES256(upw, keySalt(u), nil, ctx.E.R)
+	cb, err := aes.NewCipher(h)
 	if err != nil {
 		return err
 	}
@@ -1475,13 +1567,13 @@ func calcOAndUAES256(ctx *Context, d Dict) (err error) {
 	d.Update("UE", HexLiteral(hex.EncodeToString(ctx.E.UE)))
 
 	// Encrypt file encryption key into OE.
-	c = append(opw, keySalt(o)...)
-	h = sha256.Sum256(append(c, ctx.E.U...))
-	cb, err = aes.NewCipher(h[:])
+	h = hashAES256(opw, keySalt(o), ctx.E.U, ctx.E.R)
+	cb, err = aes.NewCipher(h)
 	if err != nil {
 		return err
 	}
 
+	ctx.E.OE = make([]byte, 32)
 	mode = cipher.NewCBCEncrypter(cb, iv)
 	mode.CryptBlocks(ctx.E.OE, ctx.EncKey)
 	d.Update("OE", HexLiteral(hex.EncodeToString(ctx.E.OE)))
@@ -1491,16 +1583,26 @@ func calcOAndUAES256(ctx *Context, d Dict) (err error) {
 
 func calcOAndU(ctx *Context, d Dict) (err error) {
 
-	if ctx.E.R == 5 {
-		return calcOAndUAES256(ctx, d)
+	opw, err := encodePassword(ctx.OwnerPW, ctx.E.R)
+	if err != nil {
+		return err
+	}
+
+	upw, err := encodePassword(ctx.UserPW, ctx.E.R)
+	if err != nil {
+		return err
+	}
+
+	if ctx.E.R >= 5 {
+		return calcOAndUAES256(ctx, d, opw, upw)
 	}
 
-	ctx.E.O, err = o(ctx)
+	ctx.E.O, err = o(ctx, opw, upw)
 	if err != nil {
 		return err
 	}
 
-	ctx.E.U, ctx.EncKey, err = u(ctx)
+	ctx.E.U, ctx.EncKey, err = u(ctx, upw)
 	if err != nil {
 		return err
 	}
@@ -1510,3 +1612,60 @@ func calcOAndU(ctx *Context, d Dict) (err error) {
 
 	return nil
 }
+
+// setupEncryption prepares ctx for writing an encrypted file.
+// It creates the encrypt dict and calculates the file encryption key
+// using the public-key security handler if recipients are supplied, or else the standard security handler.
+func setupEncryption(ctx *Context) error {
+
+	if ok := validateAlgorithm(ctx); !ok {
+		return errors.New("pdfcpu: unsupported encryption algorithm")
+	}
+
+	if (ctx.UnencryptedMetadata || ctx.EncryptEmbeddedFilesOnly) && ctx.EncryptKeyLength < 128 {
+		return errors.New("pdfcpu: crypt filters need a key length of at least 128 bits")
+	}
+
+	var d Dict
+	var err error
+
+	if len(ctx.Recipients) > 0 {
+
+		if d, err = newPubSecEncryptDict(ctx); err != nil {
+			return err
+		}
+
+	} else {
+
+		d = newEncryptDict(ctx.EncryptUsingAES, ctx.EncryptKeyLength, ctx.Permissions, !ctx.UnencryptedMetadata, ctx.EncryptEmbeddedFilesOnly)
+
+		if ctx.E, err = supportedEncryption(ctx, d); err != nil {
+			return err
+		}
+
+		if ctx.ID == nil {
+			return errors.New("pdfcpu: encrypt: missing ID")
+		}
+
+		if ctx.E.ID, err = idBytes(ctx); err != nil {
+			return err
+		}
+
+		if err = calcOAndU(ctx, d); err != nil {
+			return err
+		}
+
+		if err = writePermissions(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	ir, err := ctx.IndRefForNewObject(d)
+	if err != nil {
+		return err
+	}
+
+	ctx.Encrypt = ir
+
+	return nil
+}
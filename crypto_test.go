@@ -0,0 +1,86 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"testing"
+
+	"github.com/zean00/pdfcpulite/filter"
+)
+
+func TestStreamEncryption(t *testing.T) {
+
+	cryptFilter := func(name string) []PDFFilter {
+		f := PDFFilter{Name: filter.Crypt}
+		if name != "" {
+			f.DecodeParms = Dict(map[string]Object{"Name": Name(name)})
+		}
+		return []PDFFilter{f, {Name: filter.Flate}}
+	}
+
+	for _, tt := range []struct {
+		name      string
+		typ       string
+		fp        []PDFFilter
+		emd       bool
+		encrypted bool
+		aes       bool
+		err       bool
+	}{
+		{"default", "", nil, true, true, true, false},
+		{"xref stream", "XRef", nil, true, false, false, false},
+		{"metadata", "Metadata", nil, true, true, true, false},
+		{"unencrypted metadata", "Metadata", nil, false, false, false, false},
+		{"embedded file", "EmbeddedFile", nil, true, true, false, false},
+		{"crypt filter without name", "", cryptFilter(""), true, false, false, false},
+		{"Identity crypt filter", "", cryptFilter("Identity"), true, false, false, false},
+		{"named AES crypt filter", "", cryptFilter("StdCF"), true, true, true, false},
+		{"named RC4 crypt filter", "", cryptFilter("RC4CF"), true, true, false, false},
+		{"named None crypt filter", "", cryptFilter("NoneCF"), true, false, false, false},
+		{"unknown crypt filter", "", cryptFilter("Unknown"), true, false, false, true},
+	} {
+		ctx := &Context{XRefTable: &XRefTable{
+			E:                   &Enc{Emd: tt.emd},
+			EncKey:              make([]byte, 16),
+			CFM4Streams:         "AESV2",
+			AES4Streams:         true,
+			CFM4EmbeddedStreams: "V2",
+			CFM:                 map[string]string{"StdCF": "AESV2", "RC4CF": "V2", "NoneCF": "None"},
+		}}
+
+		sd := StreamDict{Dict: NewDict(), FilterPipeline: tt.fp}
+		if tt.typ != "" {
+			sd.Insert("Type", Name(tt.typ))
+		}
+
+		encrypted, aes, err := ctx.streamEncryption(&sd)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: missing error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if encrypted != tt.encrypted || aes != tt.aes {
+			t.Errorf("%s: got encrypted=%t aes=%t, want %t %t", tt.name, encrypted, aes, tt.encrypted, tt.aes)
+		}
+	}
+}
@@ -0,0 +1,747 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+// Decoding of image XObjects (see 8.9).
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+
+	"github.com/zean00/pdfcpulite/filter"
+)
+
+// The maximum number of pixels of an image to be decoded.
+const maxImagePixels = 1 << 28
+
+// imageData represents the samples of an image.
+type imageData struct {
+	w, h   int
+	n      int // components per pixel
+	bpc    int
+	rowLen int
+	b      []byte
+}
+
+func newImageData(w, h, n, bpc int, b []byte) *imageData {
+
+	d := &imageData{w: w, h: h, n: n, bpc: bpc, rowLen: (w*n*bpc + 7) / 8, b: b}
+
+	// Tolerate truncated image data.
+	if l := d.rowLen * h; len(b) < l {
+		d.b = make([]byte, l)
+		copy(d.b, b)
+	}
+
+	return d
+}
+
+// sample returns component c of the pixel at x,y.
+func (d *imageData) sample(x, y, c int) int {
+
+	row := d.b[y*d.rowLen : (y+1)*d.rowLen]
+	i := x*d.n + c
+
+	switch d.bpc {
+	case 8:
+		return int(row[i])
+	case 16:
+		return int(row[2*i])<<8 | int(row[2*i+1])
+	}
+
+	bit := i * d.bpc
+	return int(row[bit/8]) >> uint(8-d.bpc-bit%8) & (1<<uint(d.bpc) - 1)
+}
+
+// maxSample returns the largest sample value.
+func (d *imageData) maxSample() float64 {
+	return float64(int(1)<<uint(d.bpc) - 1)
+}
+
+// imageColorSpace converts the color components of an image to RGB (see 8.6).
+type imageColorSpace interface {
+	nComps() int
+	// defaultDecode returns the default Decode array for given bits per component (see 8.9.5.2).
+	defaultDecode(bpc int) []float64
+	// rgb returns the RGB values in [0,1] for the color components c.
+	rgb(c []float64) (r, g, b float64, err error)
+}
+
+func unitRanges(n int) []float64 {
+	d := make([]float64, 2*n)
+	for i := 0; i < n; i++ {
+		d[2*i+1] = 1
+	}
+	return d
+}
+
+type deviceGray struct{}
+
+func (deviceGray) nComps() int {
+	return 1
+}
+
+func (deviceGray) defaultDecode(bpc int) []float64 {
+	return unitRanges(1)
+}
+
+func (deviceGray) rgb(c []float64) (r, g, b float64, err error) {
+	return c[0], c[0], c[0], nil
+}
+
+type deviceRGB struct{}
+
+func (deviceRGB) nComps() int {
+	return 3
+}
+
+func (deviceRGB) defaultDecode(bpc int) []float64 {
+	return unitRanges(3)
+}
+
+func (deviceRGB) rgb(c []float64) (r, g, b float64, err error) {
+	return c[0], c[1], c[2], nil
+}
+
+type deviceCMYK struct{}
+
+func (deviceCMYK) nComps() int {
+	return 4
+}
+
+func (deviceCMYK) defaultDecode(bpc int) []float64 {
+	return unitRanges(4)
+}
+
+// rgb converts CMYK to RGB (see 10.4.2.4).
+func (deviceCMYK) rgb(c []float64) (r, g, b float64, err error) {
+	k := 1 - c[3]
+	return (1 - c[0]) * k, (1 - c[1]) * k, (1 - c[2]) * k, nil
+}
+
+// indexedCS represents an Indexed color space (see 8.6.6.3).
+type indexedCS struct {
+	base   imageColorSpace
+	hival  int
+	lookup []byte
+}
+
+func (indexedCS) nComps() int {
+	return 1
+}
+
+func (cs indexedCS) defaultDecode(bpc int) []float64 {
+	return []float64{0, math.Exp2(float64(bpc)) - 1}
+}
+
+func (cs indexedCS) rgb(c []float64) (r, g, b float64, err error) {
+
+	i := int(clip(math.Floor(c[0]+.5), 0, float64(cs.hival)))
+
+	n := cs.base.nComps()
+	d := cs.base.defaultDecode(8)
+
+	bc := make([]float64, n)
+	for j := range bc {
+		var v byte
+		if k := i*n + j; k < len(cs.lookup) {
+			v = cs.lookup[k]
+		}
+		bc[j] = interpolate(float64(v), 0, 255, d[2*j], d[2*j+1])
+	}
+
+	return cs.base.rgb(bc)
+}
+
+// tintCS represents a Separation or DeviceN color space converted to its alternate color space (see 8.6.6.4, 8.6.6.5).
+type tintCS struct {
+	n         int
+	alternate imageColorSpace
+	tint      pdfFunction
+}
+
+func (cs tintCS) nComps() int {
+	return cs.n
+}
+
+func (cs tintCS) defaultDecode(bpc int) []float64 {
+	return unitRanges(cs.n)
+}
+
+func (cs tintCS) rgb(c []float64) (r, g, b float64, err error) {
+
+	ac, err := cs.tint.eval(c)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if len(ac) < cs.alternate.nComps() {
+		return 0, 0, 0, errors.New("pdfcpu: decodeImage: tint transform output does not match alternate color space")
+	}
+
+	return cs.alternate.rgb(ac)
+}
+
+func colorSpaceForComps(n int) (imageColorSpace, error) {
+	switch n {
+	case 1:
+		return deviceGray{}, nil
+	case 3:
+		return deviceRGB{}, nil
+	case 4:
+		return deviceCMYK{}, nil
+	}
+	return nil, fmt.Errorf("pdfcpu: decodeImage: unsupported number of color components: %d", n)
+}
+
+// stringBytes returns the bytes of a string, hex string or stream object.
+func (xRefTable *XRefTable) stringBytes(o Object) ([]byte, error) {
+
+	o, err := xRefTable.Dereference(o)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := o.(type) {
+
+	case StringLiteral:
+		return Unescape(o.Value())
+
+	case HexLiteral:
+		return o.Bytes()
+
+	case StreamDict:
+		if err = decodeStream(&o); err != nil {
+			return nil, err
+		}
+		return o.Content, nil
+	}
+
+	return nil, fmt.Errorf("pdfcpu: decodeImage: corrupt lookup table: %v", o)
+}
+
+// imageColorSpace returns the color space represented by o.
+func (xRefTable *XRefTable) imageColorSpace(o Object) (imageColorSpace, error) {
+
+	o, err := xRefTable.Dereference(o)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, ok := o.(Name); ok {
+		switch n {
+		case "DeviceGray", "G", "CalGray":
+			return deviceGray{}, nil
+		case "DeviceRGB", "RGB", "CalRGB":
+			return deviceRGB{}, nil
+		case "DeviceCMYK", "CMYK":
+			return deviceCMYK{}, nil
+		}
+		return nil, fmt.Errorf("pdfcpu: decodeImage: unsupported color space %s", n)
+	}
+
+	a, ok := o.(Array)
+	if !ok || len(a) == 0 {
+		return nil, fmt.Errorf("pdfcpu: decodeImage: corrupt color space: %v", o)
+	}
+
+	o, err = xRefTable.Dereference(a[0])
+	if err != nil {
+		return nil, err
+	}
+
+	n, ok := o.(Name)
+	if !ok {
+		return nil, fmt.Errorf("pdfcpu: decodeImage: corrupt color space: %v", a)
+	}
+
+	switch n {
+
+	case "ICCBased":
+		if len(a) < 2 {
+			break
+		}
+		sd, err := xRefTable.DereferenceStreamDict(a[1])
+		if err != nil || sd == nil {
+			return nil, errors.New("pdfcpu: decodeImage: corrupt ICCBased color space")
+		}
+		if n := sd.IntEntry("N"); n != nil {
+			return colorSpaceForComps(*n)
+		}
+		if alt, found := sd.Find("Alternate"); found {
+			return xRefTable.imageColorSpace(alt)
+		}
+
+	case "Indexed", "I":
+		if len(a) < 4 {
+			break
+		}
+		base, err := xRefTable.imageColorSpace(a[1])
+		if err != nil {
+			return nil, err
+		}
+		hival, err := xRefTable.DereferenceInteger(a[2])
+		if err != nil || hival == nil {
+			return nil, errors.New("pdfcpu: decodeImage: corrupt Indexed color space")
+		}
+		lookup, err := xRefTable.stringBytes(a[3])
+		if err != nil {
+			return nil, err
+		}
+		return indexedCS{base: base, hival: hival.Value(), lookup: lookup}, nil
+
+	case "Separation", "DeviceN":
+		if len(a) < 4 {
+			break
+		}
+		comps := 1
+		if n == "DeviceN" {
+			names, err := xRefTable.DereferenceArray(a[1])
+			if err != nil || len(names) == 0 {
+				return nil, errors.New("pdfcpu: decodeImage: corrupt DeviceN color space")
+			}
+			comps = len(names)
+		}
+		alt, err := xRefTable.imageColorSpace(a[2])
+		if err != nil {
+			return nil, err
+		}
+		f, err := xRefTable.parseFunction(a[3])
+		if err != nil {
+			return nil, err
+		}
+		return tintCS{n: comps, alternate: alt, tint: f}, nil
+
+	case "CalGray", "CalRGB", "DeviceGray", "DeviceRGB", "DeviceCMYK":
+		return xRefTable.imageColorSpace(n)
+	}
+
+	return nil, fmt.Errorf("pdfcpu: decodeImage: unsupported color space: %v", a)
+}
+
+// jpegData returns the samples of a DCT encoded image.
+func jpegData(b []byte, parms filter.Parms) (*imageData, error) {
+
+	c, err := jpeg.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	n := 1
+	switch c.ColorModel {
+	case color.YCbCrModel, color.RGBAModel:
+		n = 3
+	case color.CMYKModel:
+		n = 4
+	}
+
+	f, err := filter.NewFilter(filter.DCT, parms)
+	if err != nil {
+		return nil, err
+	}
+
+	var p bytes.Buffer
+	if err = f.Decode(bytes.NewReader(b), &p); err != nil {
+		return nil, err
+	}
+
+	return newImageData(c.Width, c.Height, n, 8, p.Bytes()), nil
+}
+
+// imageData returns the samples of the image XObject sd.
+func (xRefTable *XRefTable) imageData(sd *StreamDict, w, h, n, bpc int) (*imageData, error) {
+
+	fp := sd.FilterPipeline
+
+	if len(fp) > 0 && fp[len(fp)-1].Name == filter.DCT {
+		// DCT encoded images carry their dimensions and number of components.
+		jsd := &StreamDict{Dict: sd.Dict, Raw: sd.Raw, FilterPipeline: fp[:len(fp)-1]}
+		if err := decodeStream(jsd); err != nil {
+			return nil, err
+		}
+		d, err := jpegData(jsd.Content, parmsForFilter(fp[len(fp)-1]))
+		if err != nil {
+			return nil, err
+		}
+		if d.w != w || d.h != h {
+			return nil, errors.New("pdfcpu: decodeImage: DCT image dimensions do not match")
+		}
+		return d, nil
+	}
+
+	ok, err := resolveParmStreams(xRefTable, sd)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("pdfcpu: decodeImage: missing stream referenced by decode parameters")
+	}
+
+	if err = decodeStream(sd); err != nil {
+		return nil, err
+	}
+
+	return newImageData(w, h, n, bpc, sd.Content), nil
+}
+
+// imageDimensions returns the width, height and bits per component of the image XObject sd.
+func imageDimensions(sd *StreamDict) (w, h, bpc int, err error) {
+
+	wp, hp := sd.IntEntry("Width"), sd.IntEntry("Height")
+	if wp == nil || hp == nil || *wp <= 0 || *hp <= 0 || *wp > maxImagePixels / *hp {
+		return 0, 0, 0, errors.New("pdfcpu: decodeImage: invalid image dimensions")
+	}
+
+	bpc = 8
+	if b := sd.IntEntry("BitsPerComponent"); b != nil {
+		bpc = *b
+	}
+
+	if im := sd.BooleanEntry("ImageMask"); im != nil && *im {
+		bpc = 1
+	}
+
+	if !IntMemberOf(bpc, []int{1, 2, 4, 8, 16}) {
+		return 0, 0, 0, fmt.Errorf("pdfcpu: decodeImage: invalid \"BitsPerComponent\": %d", bpc)
+	}
+
+	return *wp, *hp, bpc, nil
+}
+
+// decodeArray returns the Decode array of sd or def.
+func (xRefTable *XRefTable) decodeArray(sd *StreamDict, def []float64) ([]float64, error) {
+
+	d, err := xRefTable.numberArray(sd.Dict["Decode"])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d) != len(def) {
+		return def, nil
+	}
+
+	return d, nil
+}
+
+// imageAlpha represents the soft mask or mask of an image (see 11.6.5.3, 8.9.6).
+type imageAlpha struct {
+	d        *imageData
+	decode   []float64
+	explicit bool      // Explicit masks are painted where samples decode to 0.
+	matte    []float64 // Matte color of a soft mask (see 11.6.5.3).
+	colorKey []int     // Sample ranges to be masked out (see 8.9.6.4).
+}
+
+// at returns the alpha value for the pixel x,y of an image of dimensions w,h with samples s.
+func (a *imageAlpha) at(x, y, w, h int, s []int) float64 {
+
+	if a.colorKey != nil {
+		for i, v := range s {
+			if v < a.colorKey[2*i] || v > a.colorKey[2*i+1] {
+				return 1
+			}
+		}
+		return 0
+	}
+
+	// Masks may have different dimensions than the base image.
+	v := interpolate(float64(a.d.sample(x*a.d.w/w, y*a.d.h/h, 0)), 0, a.d.maxSample(), a.decode[0], a.decode[1])
+
+	if a.explicit {
+		if v < .5 {
+			return 1
+		}
+		return 0
+	}
+
+	return v
+}
+
+func (xRefTable *XRefTable) softMask(o Object, n int) (*imageAlpha, error) {
+
+	sd, err := xRefTable.DereferenceStreamDict(o)
+	if err != nil || sd == nil {
+		return nil, err
+	}
+
+	w, h, bpc, err := imageDimensions(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &imageAlpha{}
+
+	if a.d, err = xRefTable.imageData(sd, w, h, 1, bpc); err != nil {
+		return nil, err
+	}
+
+	if a.decode, err = xRefTable.decodeArray(sd, unitRanges(1)); err != nil {
+		return nil, err
+	}
+
+	if a.matte, err = xRefTable.numberArray(sd.Dict["Matte"]); err != nil {
+		return nil, err
+	}
+	if len(a.matte) != n {
+		a.matte = nil
+	}
+
+	return a, nil
+}
+
+func (xRefTable *XRefTable) mask(o Object, n int) (*imageAlpha, error) {
+
+	o, err := xRefTable.Dereference(o)
+	if err != nil || o == nil {
+		return nil, err
+	}
+
+	if a, ok := o.(Array); ok {
+		// Color key masking
+		ff, err := xRefTable.numberArray(a)
+		if err != nil {
+			return nil, err
+		}
+		if len(ff) != 2*n {
+			return nil, errors.New("pdfcpu: decodeImage: corrupt color key mask")
+		}
+		ck := make([]int, len(ff))
+		for i, f := range ff {
+			ck[i] = int(f)
+		}
+		return &imageAlpha{colorKey: ck}, nil
+	}
+
+	sd, ok := o.(StreamDict)
+	if !ok {
+		return nil, fmt.Errorf("pdfcpu: decodeImage: corrupt mask: %v", o)
+	}
+
+	w, h, _, err := imageDimensions(&sd)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &imageAlpha{explicit: true}
+
+	if a.d, err = xRefTable.imageData(&sd, w, h, 1, 1); err != nil {
+		return nil, err
+	}
+
+	if a.decode, err = xRefTable.decodeArray(&sd, unitRanges(1)); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// decodeImageMask returns the stencil mask sd painted using color c (see 8.9.6.2).
+func (xRefTable *XRefTable) decodeImageMask(sd *StreamDict, w, h int, c color.Color) (image.Image, error) {
+
+	d, err := xRefTable.imageData(sd, w, h, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	decode, err := xRefTable.decodeArray(sd, unitRanges(1))
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		c = color.Black
+	}
+	paint := color.NRGBAModel.Convert(c).(color.NRGBA)
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Samples decoding to 0 get painted.
+			if decode[0]+float64(d.sample(x, y, 0))*(decode[1]-decode[0]) < .5 {
+				img.SetNRGBA(x, y, paint)
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// pixelConverter converts the samples of a pixel to RGB values.
+type pixelConverter struct {
+	cs     imageColorSpace
+	decode []float64
+	max    float64
+	c      []float64
+	cache  map[int][3]float64
+}
+
+// convert returns the RGB values for samples s using the alpha value a for unmultiplying a matte color.
+func (pc *pixelConverter) convert(s []int, a float64, matte []float64) (r, g, b float64, err error) {
+
+	// Cache the results for single component images of up to 8 bits per component.
+	key := -1
+	if len(s) == 1 && pc.max <= 255 && matte == nil {
+		key = s[0]
+		if v, ok := pc.cache[key]; ok {
+			return v[0], v[1], v[2], nil
+		}
+	}
+
+	for i, v := range s {
+		pc.c[i] = interpolate(float64(v), 0, pc.max, pc.decode[2*i], pc.decode[2*i+1])
+		if matte != nil && a > 0 {
+			pc.c[i] = clip(matte[i]+(pc.c[i]-matte[i])/a, 0, 1)
+		}
+	}
+
+	if r, g, b, err = pc.cs.rgb(pc.c); err != nil {
+		return 0, 0, 0, err
+	}
+
+	r, g, b = clip(r, 0, 1), clip(g, 0, 1), clip(b, 0, 1)
+
+	if key >= 0 {
+		pc.cache[key] = [3]float64{r, g, b}
+	}
+
+	return r, g, b, nil
+}
+
+// DecodeImage returns the image represented by the image XObject sd.
+// Image masks are painted using the stencil color, nil means black.
+// Soft masks and masks result in an image with an alpha channel.
+func (xRefTable *XRefTable) DecodeImage(sd *StreamDict, stencil color.Color) (image.Image, error) {
+
+	w, h, bpc, err := imageDimensions(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	if im := sd.BooleanEntry("ImageMask"); im != nil && *im {
+		return xRefTable.decodeImageMask(sd, w, h, stencil)
+	}
+
+	var cs imageColorSpace
+
+	if o, found := sd.Find("ColorSpace"); found {
+		if cs, err = xRefTable.imageColorSpace(o); err != nil {
+			return nil, err
+		}
+	}
+
+	n := 0
+	if cs != nil {
+		n = cs.nComps()
+	}
+
+	d, err := xRefTable.imageData(sd, w, h, n, bpc)
+	if err != nil {
+		return nil, err
+	}
+
+	if cs == nil {
+		// DCT encoded images imply their color space.
+		if d.n == 0 {
+			return nil, errors.New("pdfcpu: decodeImage: missing \"ColorSpace\"")
+		}
+		if cs, err = colorSpaceForComps(d.n); err != nil {
+			return nil, err
+		}
+		n = d.n
+	}
+
+	if d.n != n {
+		return nil, errors.New("pdfcpu: decodeImage: image data does not match color space")
+	}
+
+	decode, err := xRefTable.decodeArray(sd, cs.defaultDecode(d.bpc))
+	if err != nil {
+		return nil, err
+	}
+
+	var alpha *imageAlpha
+
+	if o, found := sd.Find("SMask"); found {
+		if alpha, err = xRefTable.softMask(o, n); err != nil {
+			return nil, err
+		}
+	} else if o, found := sd.Find("Mask"); found {
+		if alpha, err = xRefTable.mask(o, n); err != nil {
+			return nil, err
+		}
+	}
+
+	pc := &pixelConverter{cs: cs, decode: decode, max: d.maxSample(), c: make([]float64, n), cache: map[int][3]float64{}}
+
+	_, gray := cs.(deviceGray)
+	gray = gray && alpha == nil
+
+	var img image.Image
+
+	switch {
+	case gray && d.bpc == 16:
+		img = image.NewGray16(image.Rect(0, 0, w, h))
+	case gray:
+		img = image.NewGray(image.Rect(0, 0, w, h))
+	case d.bpc == 16:
+		img = image.NewNRGBA64(image.Rect(0, 0, w, h))
+	default:
+		img = image.NewNRGBA(image.Rect(0, 0, w, h))
+	}
+
+	s := make([]int, n)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+
+			for i := range s {
+				s[i] = d.sample(x, y, i)
+			}
+
+			a := 1.
+			var matte []float64
+			if alpha != nil {
+				a = alpha.at(x, y, w, h, s)
+				matte = alpha.matte
+			}
+
+			r, g, b, err := pc.convert(s, a, matte)
+			if err != nil {
+				return nil, err
+			}
+
+			switch img := img.(type) {
+			case *image.Gray16:
+				img.SetGray16(x, y, color.Gray16{Y: uint16(r*0xFFFF + .5)})
+			case *image.Gray:
+				img.SetGray(x, y, color.Gray{Y: uint8(r*0xFF + .5)})
+			case *image.NRGBA64:
+				img.SetNRGBA64(x, y, color.NRGBA64{R: uint16(r*0xFFFF + .5), G: uint16(g*0xFFFF + .5), B: uint16(b*0xFFFF + .5), A: uint16(a*0xFFFF + .5)})
+			case *image.NRGBA:
+				img.SetNRGBA(x, y, color.NRGBA{R: uint8(r*0xFF + .5), G: uint8(g*0xFF + .5), B: uint8(b*0xFF + .5), A: uint8(a*0xFF + .5)})
+			}
+		}
+	}
+
+	return img, nil
+}
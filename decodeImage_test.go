@@ -0,0 +1,249 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/zean00/pdfcpulite/filter"
+)
+
+// testImageStream returns an encoded image XObject stream dict.
+func testImageStream(t *testing.T, d Dict, content []byte, filters ...string) *StreamDict {
+
+	t.Helper()
+
+	if d["Width"] == nil {
+		d["Width"] = Integer(2)
+	}
+	if d["Height"] == nil {
+		d["Height"] = Integer(2)
+	}
+
+	sd := &StreamDict{Dict: d, Content: content}
+	for _, f := range filters {
+		sd.FilterPipeline = append(sd.FilterPipeline, PDFFilter{Name: f})
+	}
+
+	if err := encodeStream(sd); err != nil {
+		t.Fatal(err)
+	}
+	sd.Content = nil
+
+	return sd
+}
+
+func rgba(img image.Image, x, y int) color.NRGBA {
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+}
+
+func TestDecodeImage(t *testing.T) {
+
+	xRefTable := newXRefTable(ValidationRelaxed)
+	genNr := 0
+	xRefTable.Table[1] = &XRefTableEntry{Generation: &genNr, Object: StreamDict{Dict: Dict{"N": Integer(3)}, Raw: []byte{}}}
+	icc := NewIndirectRef(1, 0)
+
+	// Tint transform mapping a tint to CMYK cyan.
+	cyan := Dict{"FunctionType": Integer(2), "Domain": NewNumberArray(0, 1), "C0": NewNumberArray(0, 0, 0, 0), "C1": NewNumberArray(1, 0, 0, 0), "N": Integer(1)}
+
+	red := color.NRGBA{255, 0, 0, 255}
+
+	for _, tt := range []struct {
+		name string
+		sd   *StreamDict
+		want []color.NRGBA // pixels in row order
+	}{
+		{
+			"DeviceGray with Decode",
+			testImageStream(t, Dict{"ColorSpace": Name("DeviceGray"), "BitsPerComponent": Integer(8), "Decode": NewNumberArray(1, 0)},
+				[]byte{0, 255, 128, 64}, filter.Flate),
+			[]color.NRGBA{{255, 255, 255, 255}, {0, 0, 0, 255}, {127, 127, 127, 255}, {191, 191, 191, 255}},
+		},
+		{
+			"DeviceRGB 16 bit",
+			testImageStream(t, Dict{"ColorSpace": Name("DeviceRGB"), "BitsPerComponent": Integer(16), "Width": Integer(1), "Height": Integer(1)},
+				[]byte{0xFF, 0xFF, 0, 0, 0x80, 0}),
+			[]color.NRGBA{{255, 0, 128, 255}},
+		},
+		{
+			"DeviceCMYK",
+			testImageStream(t, Dict{"ColorSpace": Name("DeviceCMYK"), "BitsPerComponent": Integer(8), "Width": Integer(1), "Height": Integer(1)},
+				[]byte{255, 0, 0, 0}, filter.LZW),
+			[]color.NRGBA{{0, 255, 255, 255}},
+		},
+		{
+			"Indexed 2 bit",
+			testImageStream(t, Dict{"ColorSpace": Array{Name("Indexed"), Name("DeviceRGB"), Integer(2), NewHexLiteral([]byte{255, 0, 0, 0, 255, 0, 0, 0, 255})}, "BitsPerComponent": Integer(2)},
+				[]byte{0x10, 0x20}),
+			[]color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {255, 0, 0, 255}, {0, 0, 255, 255}},
+		},
+		{
+			"ICCBased",
+			testImageStream(t, Dict{"ColorSpace": Array{Name("ICCBased"), *icc}, "BitsPerComponent": Integer(8), "Width": Integer(1), "Height": Integer(1)},
+				[]byte{1, 2, 3}),
+			[]color.NRGBA{{1, 2, 3, 255}},
+		},
+		{
+			"Separation",
+			testImageStream(t, Dict{"ColorSpace": Array{Name("Separation"), Name("Cyan"), Name("DeviceCMYK"), cyan}, "BitsPerComponent": Integer(1), "Width": Integer(2), "Height": Integer(1)},
+				[]byte{0x40}),
+			[]color.NRGBA{{255, 255, 255, 255}, {0, 255, 255, 255}},
+		},
+		{
+			"ImageMask",
+			testImageStream(t, Dict{"ImageMask": Boolean(true)}, []byte{0x40, 0x80}),
+			[]color.NRGBA{red, {}, {}, red},
+		},
+		{
+			"Color key mask",
+			testImageStream(t, Dict{"ColorSpace": Name("DeviceGray"), "BitsPerComponent": Integer(8), "Mask": NewIntegerArray(10, 20)},
+				[]byte{0, 15, 20, 21}),
+			[]color.NRGBA{{0, 0, 0, 255}, {15, 15, 15, 0}, {20, 20, 20, 0}, {21, 21, 21, 255}},
+		},
+		{
+			"SMask",
+			testImageStream(t, Dict{"ColorSpace": Name("DeviceGray"), "BitsPerComponent": Integer(8),
+				"SMask": *testImageStream(t, Dict{"ColorSpace": Name("DeviceGray"), "BitsPerComponent": Integer(8), "Width": Integer(1), "Height": Integer(2)},
+					[]byte{255, 0}, filter.Flate)},
+				[]byte{0, 50, 100, 150}),
+			[]color.NRGBA{{0, 0, 0, 255}, {50, 50, 50, 255}, {100, 100, 100, 0}, {150, 150, 150, 0}},
+		},
+		{
+			"Explicit mask",
+			testImageStream(t, Dict{"ColorSpace": Name("DeviceGray"), "BitsPerComponent": Integer(8),
+				"Mask": *testImageStream(t, Dict{"ImageMask": Boolean(true)}, []byte{0x80, 0x40})},
+				[]byte{0, 50, 100, 150}),
+			[]color.NRGBA{{0, 0, 0, 0}, {50, 50, 50, 255}, {100, 100, 100, 255}, {150, 150, 150, 0}},
+		},
+	} {
+		img, err := xRefTable.DecodeImage(tt.sd, red)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		w := img.Bounds().Dx()
+		for i, want := range tt.want {
+			if got := rgba(img, i%w, i/w); got != want {
+				t.Errorf("%s: pixel %d: got %v, want %v", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestDecodeImageFilters(t *testing.T) {
+
+	xRefTable := newXRefTable(ValidationRelaxed)
+
+	// DCT
+	src := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range src.Pix {
+		src.Pix[i] = 200
+	}
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, src, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	sd := &StreamDict{
+		Dict:           Dict{"Width": Integer(16), "Height": Integer(16), "ColorSpace": Name("DeviceGray"), "BitsPerComponent": Integer(8)},
+		Raw:            b.Bytes(),
+		FilterPipeline: []PDFFilter{{Name: filter.DCT}},
+	}
+	img, err := xRefTable.DecodeImage(sd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if y := img.(*image.Gray).GrayAt(8, 8).Y; y < 198 || y > 202 {
+		t.Errorf("DCT: got gray %d, want 200", y)
+	}
+
+	// CCITT
+	raw := []byte{0x0F, 0xF0, 0xFF, 0x00}
+	sd = &StreamDict{
+		Dict:           Dict{"Width": Integer(16), "Height": Integer(2), "ColorSpace": Name("DeviceGray"), "BitsPerComponent": Integer(1)},
+		Content:        raw,
+		FilterPipeline: []PDFFilter{{Name: filter.CCITTFax, DecodeParms: Dict{"K": Integer(-1), "Columns": Integer(16)}}},
+	}
+	if err = encodeStream(sd); err != nil {
+		t.Fatal(err)
+	}
+	sd.Content = nil
+
+	if img, err = xRefTable.DecodeImage(sd, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []uint8{255, 0, 255, 0} {
+		x, y := (i%2)*8+4, i/2
+		if got := img.(*image.Gray).GrayAt(x, y).Y; got != want {
+			t.Errorf("CCITT: pixel %d,%d: got %d, want %d", x, y, got, want)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+
+	xRefTable := newXRefTable(ValidationRelaxed)
+
+	calc := StreamDict{
+		Dict:    Dict{"FunctionType": Integer(4), "Domain": NewNumberArray(0, 1, 0, 1), "Range": NewNumberArray(0, 10, 0, 10)},
+		Content: []byte("{ 2 copy gt { exch } if dup 0.5 ge { 1 } { 0 } ifelse 3 1 roll add 2 mul exch }"),
+	}
+
+	sampled := StreamDict{
+		Dict:    Dict{"FunctionType": Integer(0), "Domain": NewNumberArray(0, 1), "Range": NewNumberArray(0, 1), "Size": NewIntegerArray(3), "BitsPerSample": Integer(8)},
+		Content: []byte{0, 255, 0},
+	}
+
+	exp := Dict{"FunctionType": Integer(2), "Domain": NewNumberArray(0, 1), "C0": NewNumberArray(0), "C1": NewNumberArray(1), "N": Integer(2)}
+
+	stitching := Dict{"FunctionType": Integer(3), "Domain": NewNumberArray(0, 1), "Functions": Array{exp, exp},
+		"Bounds": NewNumberArray(.5), "Encode": NewNumberArray(0, 1, 1, 0)}
+
+	for _, tt := range []struct {
+		name string
+		f    Object
+		in   []float64
+		want []float64
+	}{
+		{"calculator", calc, []float64{.75, .25}, []float64{2, 1}},
+		{"sampled", sampled, []float64{.25}, []float64{.5}},
+		{"exponential", exp, []float64{.5}, []float64{.25}},
+		{"stitching", stitching, []float64{.75}, []float64{.25}},
+	} {
+		f, err := xRefTable.parseFunction(tt.f)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		out, err := f.eval(tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		for i := range tt.want {
+			if d := out[i] - tt.want[i]; d < -1e-3 || d > 1e-3 {
+				t.Errorf("%s: got %v, want %v", tt.name, out, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+
+	"github.com/zean00/pdfcpulite/log"
 )
 
 // Dict represents a PDF dict object.
@@ -485,7 +487,7 @@ func (d Dict) PDFString() string {
 			continue
 		}
 
-		fmt.Println("PDFDict.PDFString(): entry of unknown object type: %T %[1]v\n", v)
+		log.Write.Warnf("PDFDict.PDFString(): entry of unknown object type: %[1]T %[1]v", v)
 	}
 
 	logstr = append(logstr, ">>")
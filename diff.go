@@ -0,0 +1,607 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DiffOp represents the kind of a difference between two PDF files.
+type DiffOp string
+
+// Kinds of differences.
+const (
+	DiffAdded   DiffOp = "added"
+	DiffRemoved DiffOp = "removed"
+	DiffChanged DiffOp = "changed"
+)
+
+// Difference represents a single difference between two PDF files.
+//
+// Path locates the entry starting at either the catalog (/Root), a page (/Page[n]) or the document info dict (/Info).
+type Difference struct {
+	Op   DiffOp `json:"op"`
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// DiffReport is the list of differences between two PDF files.
+type DiffReport []Difference
+
+func (r DiffReport) String() string {
+
+	ss := []string{}
+
+	for _, d := range r {
+		switch d.Op {
+		case DiffAdded:
+			ss = append(ss, fmt.Sprintf("+ %s: %s", d.Path, d.New))
+		case DiffRemoved:
+			ss = append(ss, fmt.Sprintf("- %s: %s", d.Path, d.Old))
+		case DiffChanged:
+			ss = append(ss, fmt.Sprintf("~ %s: %s -> %s", d.Path, d.Old, d.New))
+		}
+	}
+
+	return strings.Join(ss, "\n")
+}
+
+// JSON returns the JSON representation of r.
+func (r DiffReport) JSON() ([]byte, error) {
+
+	if r == nil {
+		r = DiffReport{}
+	}
+
+	return json.MarshalIndent(r, "", "  ")
+}
+
+type differ struct {
+	xRefTable1, xRefTable2 *XRefTable
+	pages1, pages2         map[int]int     // page numbers by object number
+	visited                map[[2]int]bool // pairs of compared object numbers
+	report                 DiffReport
+}
+
+// Diff compares two PDF files and returns their differences.
+//
+// The comparison is independent of object numbers and covers the catalog, the pages in order
+// including inherited attributes, resources and decoded content streams, and the document info dict.
+// Font subset prefixes are ignored.
+func Diff(ctx1, ctx2 *Context) (DiffReport, error) {
+
+	df := &differ{
+		xRefTable1: ctx1.XRefTable,
+		xRefTable2: ctx2.XRefTable,
+		visited:    map[[2]int]bool{},
+	}
+
+	refs1, err := pageRefs(df.xRefTable1)
+	if err != nil {
+		return nil, err
+	}
+
+	refs2, err := pageRefs(df.xRefTable2)
+	if err != nil {
+		return nil, err
+	}
+
+	df.pages1 = pageNumbers(refs1)
+	df.pages2 = pageNumbers(refs2)
+
+	if err = df.diffCatalog(); err != nil {
+		return nil, err
+	}
+
+	if err = df.diffPages(len(refs1), len(refs2)); err != nil {
+		return nil, err
+	}
+
+	if err = df.diffObjects("/Info", infoObject(df.xRefTable1), infoObject(df.xRefTable2)); err != nil {
+		return nil, err
+	}
+
+	return df.report, nil
+}
+
+func infoObject(xRefTable *XRefTable) Object {
+	if xRefTable.Info == nil {
+		return nil
+	}
+	return *xRefTable.Info
+}
+
+func pageNumbers(refs []IndirectRef) map[int]int {
+	m := map[int]int{}
+	for i, ir := range refs {
+		m[ir.ObjectNumber.Value()] = i + 1
+	}
+	return m
+}
+
+// pageRefs returns the indirect references of all page dicts in page order.
+func pageRefs(xRefTable *XRefTable) ([]IndirectRef, error) {
+
+	root, err := xRefTable.Pages()
+	if err != nil || root == nil {
+		return nil, err
+	}
+
+	refs := []IndirectRef{}
+	visited := IntSet{}
+
+	var collect func(ir IndirectRef) error
+
+	collect = func(ir IndirectRef) error {
+
+		objNr := ir.ObjectNumber.Value()
+		if visited[objNr] {
+			return fmt.Errorf("pdfcpu: diff: page tree cycle at obj #%d", objNr)
+		}
+		visited[objNr] = true
+
+		d, err := xRefTable.DereferenceDict(ir)
+		if err != nil || d == nil {
+			return err
+		}
+
+		kids := d.ArrayEntry("Kids")
+		if kids == nil {
+			refs = append(refs, ir)
+			return nil
+		}
+
+		for _, o := range kids {
+			ir, ok := o.(IndirectRef)
+			if !ok {
+				continue
+			}
+			if err := collect(ir); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err = collect(*root); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+func (df *differ) add(op DiffOp, path string, o1, o2 Object) {
+
+	d := Difference{Op: op, Path: path}
+
+	if op != DiffAdded {
+		d.Old = diffValue(o1)
+	}
+
+	if op != DiffRemoved {
+		d.New = diffValue(o2)
+	}
+
+	df.report = append(df.report, d)
+}
+
+func diffValue(o Object) string {
+
+	if o == nil {
+		return "null"
+	}
+
+	switch o := o.(type) {
+	case StreamDict:
+		return fmt.Sprintf("stream %s", o.Dict.PDFString())
+	case pageRef:
+		return o.String()
+	}
+
+	return o.PDFString()
+}
+
+// pageRef represents a reference to a page, which is compared by page number instead of content.
+type pageRef int
+
+func (p pageRef) String() string {
+	return fmt.Sprintf("page %d", int(p))
+}
+
+func (p pageRef) PDFString() string {
+	return p.String()
+}
+
+func (df *differ) diffCatalog() error {
+
+	d1, err := df.xRefTable1.Catalog()
+	if err != nil {
+		return err
+	}
+
+	d2, err := df.xRefTable2.Catalog()
+	if err != nil {
+		return err
+	}
+
+	// The page tree is compared page by page.
+	return df.diffDicts("/Root", d1, d2, "Pages")
+}
+
+func effectivePageDict(xRefTable *XRefTable, pageNr int) (Dict, error) {
+
+	d, inhPAttrs, err := xRefTable.PageDict(pageNr)
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	d1 := Dict{}
+	for k, v := range d {
+		d1[k] = v
+	}
+
+	if _, found := d1.Find("Resources"); !found && inhPAttrs.resources != nil {
+		d1["Resources"] = inhPAttrs.resources
+	}
+
+	if _, found := d1.Find("MediaBox"); !found && inhPAttrs.mediaBox != nil {
+		d1["MediaBox"] = inhPAttrs.mediaBox.Array()
+	}
+
+	if _, found := d1.Find("CropBox"); !found && inhPAttrs.cropBox != nil {
+		d1["CropBox"] = inhPAttrs.cropBox.Array()
+	}
+
+	if _, found := d1.Find("Rotate"); !found && inhPAttrs.rotate != 0 {
+		d1["Rotate"] = Integer(inhPAttrs.rotate)
+	}
+
+	return d1, nil
+}
+
+func (df *differ) diffPages(pageCount1, pageCount2 int) error {
+
+	for i := 1; i <= pageCount1 || i <= pageCount2; i++ {
+
+		path := fmt.Sprintf("/Page[%d]", i)
+
+		if i > pageCount2 {
+			df.add(DiffRemoved, path, pageRef(i), nil)
+			continue
+		}
+
+		if i > pageCount1 {
+			df.add(DiffAdded, path, nil, pageRef(i))
+			continue
+		}
+
+		d1, err := effectivePageDict(df.xRefTable1, i)
+		if err != nil {
+			return err
+		}
+
+		d2, err := effectivePageDict(df.xRefTable2, i)
+		if err != nil {
+			return err
+		}
+
+		if err = df.diffDicts(path, d1, d2, "Contents"); err != nil {
+			return err
+		}
+
+		if err = df.diffContent(path+"/Contents", d1, d2); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func pageContent(xRefTable *XRefTable, d Dict) ([]byte, bool, error) {
+
+	o, found := d.Find("Contents")
+	if !found || o == nil {
+		return nil, false, nil
+	}
+
+	bb, err := contentStream(xRefTable, o)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return bb, true, nil
+}
+
+// firstDiffLine returns a description of the first line where b1 and b2 differ.
+func firstDiffLine(b1, b2 []byte) (string, string) {
+
+	l1 := bytes.Split(b1, []byte{'\n'})
+	l2 := bytes.Split(b2, []byte{'\n'})
+
+	line := func(ll [][]byte, i int) string {
+		if i >= len(ll) {
+			return fmt.Sprintf("line %d: <eof>", i+1)
+		}
+		return fmt.Sprintf("line %d: %s", i+1, strings.TrimSpace(string(ll[i])))
+	}
+
+	for i := 0; ; i++ {
+		if i >= len(l1) || i >= len(l2) || !bytes.Equal(l1[i], l2[i]) {
+			return line(l1, i), line(l2, i)
+		}
+	}
+}
+
+func (df *differ) diffContent(path string, d1, d2 Dict) error {
+
+	bb1, found1, err := pageContent(df.xRefTable1, d1)
+	if err != nil {
+		return err
+	}
+
+	bb2, found2, err := pageContent(df.xRefTable2, d2)
+	if err != nil {
+		return err
+	}
+
+	switch {
+
+	case !found1 && !found2:
+
+	case !found1:
+		df.report = append(df.report, Difference{Op: DiffAdded, Path: path, New: fmt.Sprintf("%d bytes", len(bb2))})
+
+	case !found2:
+		df.report = append(df.report, Difference{Op: DiffRemoved, Path: path, Old: fmt.Sprintf("%d bytes", len(bb1))})
+
+	case !bytes.Equal(bb1, bb2):
+		s1, s2 := firstDiffLine(bb1, bb2)
+		df.report = append(df.report, Difference{Op: DiffChanged, Path: path, Old: s1, New: s2})
+	}
+
+	return nil
+}
+
+// resolve dereferences o, replacing references to pages by their page number.
+func (df *differ) resolve(xRefTable *XRefTable, pages map[int]int, o Object) (Object, int, error) {
+
+	ir, ok := o.(IndirectRef)
+	if !ok {
+		return o, 0, nil
+	}
+
+	objNr := ir.ObjectNumber.Value()
+
+	if pageNr, ok := pages[objNr]; ok {
+		return pageRef(pageNr), objNr, nil
+	}
+
+	o, err := xRefTable.Dereference(ir)
+
+	return o, objNr, err
+}
+
+func (df *differ) diffObjects(path string, o1, o2 Object) error {
+
+	o1, objNr1, err := df.resolve(df.xRefTable1, df.pages1, o1)
+	if err != nil {
+		return err
+	}
+
+	o2, objNr2, err := df.resolve(df.xRefTable2, df.pages2, o2)
+	if err != nil {
+		return err
+	}
+
+	if objNr1 > 0 && objNr2 > 0 {
+		k := [2]int{objNr1, objNr2}
+		if df.visited[k] {
+			return nil
+		}
+		df.visited[k] = true
+	}
+
+	switch {
+
+	case o1 == nil && o2 == nil:
+		return nil
+
+	case o1 == nil:
+		df.add(DiffAdded, path, nil, o2)
+		return nil
+
+	case o2 == nil:
+		df.add(DiffRemoved, path, o1, nil)
+		return nil
+
+	case fmt.Sprintf("%T", o1) != fmt.Sprintf("%T", o2):
+		df.add(DiffChanged, path, o1, o2)
+		return nil
+	}
+
+	switch o1 := o1.(type) {
+
+	case Dict:
+		return df.diffDicts(path, o1, o2.(Dict))
+
+	case StreamDict:
+		return df.diffStreamDicts(path, o1, o2.(StreamDict))
+
+	case Array:
+		return df.diffArrays(path, o1, o2.(Array))
+
+	}
+
+	// Object and xref streams are not comparable with ==.
+	if !reflect.DeepEqual(o1, o2) {
+		df.add(DiffChanged, path, o1, o2)
+	}
+
+	return nil
+}
+
+func (df *differ) diffArrays(path string, a1, a2 Array) error {
+
+	for i := 0; i < len(a1) || i < len(a2); i++ {
+
+		p := fmt.Sprintf("%s[%d]", path, i)
+
+		switch {
+
+		case i >= len(a2):
+			df.add(DiffRemoved, p, a1[i], nil)
+
+		case i >= len(a1):
+			df.add(DiffAdded, p, nil, a2[i])
+
+		default:
+			if err := df.diffObjects(p, a1[i], a2[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// stripSubsetPrefix removes the subset tag of a font name, six uppercase letters followed by a plus sign (see 9.6.4).
+func stripSubsetPrefix(o Object) Object {
+
+	n, ok := o.(Name)
+	if !ok || len(n) < 7 || n[6] != '+' {
+		return o
+	}
+
+	for i := 0; i < 6; i++ {
+		if n[i] < 'A' || n[i] > 'Z' {
+			return o
+		}
+	}
+
+	return n[7:]
+}
+
+func sortedKeys(d1, d2 Dict) []string {
+
+	keys := []string{}
+
+	for k := range d1 {
+		keys = append(keys, k)
+	}
+
+	for k := range d2 {
+		if _, found := d1[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (df *differ) diffDicts(path string, d1, d2 Dict, skip ...string) error {
+
+	for _, k := range sortedKeys(d1, d2) {
+
+		if isBackRef(d1, k) || isBackRef(d2, k) || memberOf(k, skip) {
+			continue
+		}
+
+		p := path + "/" + k
+
+		v1, found1 := d1[k]
+		v2, found2 := d2[k]
+
+		switch {
+
+		case !found2:
+			df.add(DiffRemoved, p, v1, nil)
+
+		case !found1:
+			df.add(DiffAdded, p, nil, v2)
+
+		case k == "BaseFont" || k == "FontName":
+			// Ignore font subset prefix.
+			v1, _, err := df.resolve(df.xRefTable1, df.pages1, v1)
+			if err != nil {
+				return err
+			}
+			v2, _, err := df.resolve(df.xRefTable2, df.pages2, v2)
+			if err != nil {
+				return err
+			}
+			if err = df.diffObjects(p, stripSubsetPrefix(v1), stripSubsetPrefix(v2)); err != nil {
+				return err
+			}
+
+		default:
+			if err := df.diffObjects(p, v1, v2); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func streamBytes(sd StreamDict) []byte {
+
+	// Compare decoded content where possible.
+	if err := decodeStream(&sd); err != nil {
+		return sd.Raw
+	}
+
+	return sd.Content
+}
+
+func (df *differ) diffStreamDicts(path string, sd1, sd2 StreamDict) error {
+
+	// Length, Filter and DecodeParms describe the encoding only.
+	if err := df.diffDicts(path, sd1.Dict, sd2.Dict, "Length", "Filter", "DecodeParms"); err != nil {
+		return err
+	}
+
+	bb1, bb2 := streamBytes(sd1), streamBytes(sd2)
+
+	if !bytes.Equal(bb1, bb2) {
+		df.report = append(df.report, Difference{
+			Op:   DiffChanged,
+			Path: path + "/<stream>",
+			Old:  fmt.Sprintf("%d bytes", len(bb1)),
+			New:  fmt.Sprintf("%d bytes", len(bb2)),
+		})
+	}
+
+	return nil
+}
+
+func memberOf(s string, list []string) bool {
+	for _, v := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import "testing"
+
+func TestStripSubsetPrefix(t *testing.T) {
+
+	for _, tt := range []struct {
+		in   Object
+		want Object
+	}{
+		{Name("ABCDEF+Helvetica"), Name("Helvetica")},
+		{Name("Helvetica"), Name("Helvetica")},
+		{Name("ABCDEF+"), Name("")},
+		{Name("ABCDE+Helvetica"), Name("ABCDE+Helvetica")},
+		{Name("ABCDEFG+Helvetica"), Name("ABCDEFG+Helvetica")},
+		{Name("abcdef+Helvetica"), Name("abcdef+Helvetica")},
+		{Name("ABC1EF+Helvetica"), Name("ABC1EF+Helvetica")},
+		{Name("Font+Bold"), Name("Font+Bold")},
+		{StringLiteral("ABCDEF+Helvetica"), StringLiteral("ABCDEF+Helvetica")},
+	} {
+		if got := stripSubsetPrefix(tt.in); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDiffObjects(t *testing.T) {
+
+	osd := func(n int) ObjectStreamDict {
+		return ObjectStreamDict{ObjCount: n, ObjArray: Array{Integer(n)}}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		o1, o2 Object
+		want   []DiffOp
+	}{
+		{"equal integers", Integer(1), Integer(1), nil},
+		{"changed integer", Integer(1), Integer(2), []DiffOp{DiffChanged}},
+		{"changed type", Integer(1), Float(1), []DiffOp{DiffChanged}},
+		{"added", nil, Name("A"), []DiffOp{DiffAdded}},
+		{"removed", Name("A"), nil, []DiffOp{DiffRemoved}},
+		{"equal object streams", osd(1), osd(1), nil},
+		{"changed object stream", osd(1), osd(2), []DiffOp{DiffChanged}},
+		{"nested", Array{osd(1), Integer(1)}, Array{osd(2), Integer(1), Integer(3)}, []DiffOp{DiffChanged, DiffAdded}},
+	} {
+		df := &differ{
+			xRefTable1: &XRefTable{Table: map[int]*XRefTableEntry{}},
+			xRefTable2: &XRefTable{Table: map[int]*XRefTableEntry{}},
+			visited:    map[[2]int]bool{},
+		}
+
+		if err := df.diffObjects("/Root", tt.o1, tt.o2); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var got []DiffOp
+		for _, d := range df.report {
+			got = append(got, d.Op)
+		}
+
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, df.report, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, df.report, tt.want)
+			}
+		}
+	}
+}
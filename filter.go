@@ -21,52 +21,196 @@ package pdflite
 import (
 	"bytes"
 	"encoding/hex"
-	"errors"
-	"fmt"
 	"io"
+	"runtime"
 
 	"github.com/zean00/pdfcpulite/filter"
+	"github.com/zean00/pdfcpulite/log"
 )
 
-func parmsForFilter(d Dict) map[string]int {
+// parmsForFilter returns the decode parameters of f.
+// Streams referenced by decode parameters need to be resolved beforehand.
+func parmsForFilter(f PDFFilter) filter.Parms {
 
-	m := map[string]int{}
+	m := filter.Parms{}
 
-	if d == nil {
-		return m
+	for k, v := range f.DecodeParms {
+
+		switch v := v.(type) {
+
+		case Integer:
+			m[k] = v.Value()
+
+		case Boolean:
+			m[k] = v.Value()
+
+		case Name:
+			m[k] = filter.Name(v.Value())
+		}
+	}
+
+	for k, b := range f.streams {
+		m[k] = b
+	}
+
+	return m
+}
+
+// Streams of at least ParallelFlateThreshold bytes get Flate encoded in blocks of ParallelFlateBlockSize bytes
+// using up to ParallelFlateWorkers goroutines. A threshold of 0 disables parallel compression.
+var (
+	ParallelFlateThreshold = 8 << 20
+	ParallelFlateBlockSize = filter.DefaultFlateBlockSize
+	ParallelFlateWorkers   = runtime.NumCPU()
+)
+
+// DCTQuality is the JPEG quality ranging from 1 to 100 used for DCT encoding.
+var DCTQuality = filter.DefaultDCTQuality
+
+// filterStage applies a single filter reading from r and writing to w.
+type filterStage func(r io.Reader, w io.Writer) error
+
+// runPipeline applies stages to r and writes the result to w.
+// Consecutive stages are connected by pipes and run concurrently without buffering intermediate results.
+func runPipeline(r io.Reader, w io.Writer, stages []filterStage) error {
+
+	if len(stages) == 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	errs := make(chan error, len(stages)-1)
+
+	run := func(st filterStage, r io.Reader, w io.Writer) error {
+		err := st(r, w)
+		// Unblock the preceding stage if st did not consume all of its input.
+		if pr, ok := r.(*io.PipeReader); ok {
+			pr.CloseWithError(io.ErrClosedPipe)
+		}
+		return err
+	}
+
+	for _, st := range stages[:len(stages)-1] {
+		pr, pw := io.Pipe()
+		go func(st filterStage, r io.Reader) {
+			err := run(st, r, pw)
+			pw.CloseWithError(err)
+			errs <- err
+		}(st, r)
+		r = pr
+	}
+
+	err := run(stages[len(stages)-1], r, w)
+
+	// A failing stage causes all following stages to fail with the same error,
+	// a stage finishing early causes all preceding stages to fail with io.ErrClosedPipe.
+	for i := 0; i < len(stages)-1; i++ {
+		if e := <-errs; err == nil && e != io.ErrClosedPipe {
+			err = e
+		}
 	}
 
-	for k, v := range d {
+	return err
+}
+
+// filterStages returns the encoding or decoding stages for the filters of sd.
+func filterStages(sd *StreamDict, encode bool) ([]filterStage, error) {
 
-		i, ok := v.(Integer)
-		if ok {
-			m[k] = i.Value()
+	var stages []filterStage
+
+	for _, f := range sd.FilterPipeline {
+
+		// Crypt filters are applied by the security handler.
+		if f.Name == filter.Crypt {
 			continue
 		}
 
-		// Encode boolean values: false -> 0, true -> 1
-		b, ok := v.(Boolean)
-		if ok {
-			m[k] = 0
-			if b.Value() {
-				m[k] = 1
+		if f.DecodeParms != nil {
+			log.Read.Tracef("filterStages: filter:%s\ndecodeParms:%s\n", f.Name, f.DecodeParms)
+		} else {
+			log.Read.Tracef("filterStages: filter:%s\n", f.Name)
+		}
+
+		parms := parmsForFilter(f)
+
+		if f.Name == filter.CCITTFax {
+			// If the optional decode parameter "Rows" is missing
+			// we limit decoding to the image "Height" if available.
+			if _, ok := parms["Rows"]; !ok {
+				if ip := sd.IntEntry("Height"); ip != nil {
+					parms["Rows"] = *ip
+				}
 			}
+		}
+
+		if encode && f.Name == filter.DCT {
+			// Unless specified otherwise the samples to be encoded are described by the image dict.
+			if _, ok := parms["Columns"]; !ok {
+				if ip := sd.IntEntry("Width"); ip != nil {
+					parms["Columns"] = *ip
+				}
+			}
+			if _, ok := parms["Colors"]; !ok {
+				if n := deviceColorComponents(sd.NameEntry("ColorSpace")); n > 0 {
+					parms["Colors"] = n
+				}
+			}
+		}
+
+		var fi filter.Filter
+		var err error
+
+		switch {
+		case encode && f.Name == filter.Flate && ParallelFlateThreshold > 0 && len(sd.Content) >= ParallelFlateThreshold:
+			fi, err = filter.NewParallelFlate(parms, ParallelFlateBlockSize, ParallelFlateWorkers)
+		case encode && f.Name == filter.DCT:
+			fi, err = filter.NewDCTEncoder(parms, DCTQuality)
+		default:
+			fi, err = filter.NewFilter(f.Name, parms)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if encode {
+			// Encoding applies the filters in reverse order.
+			stages = append([]filterStage{fi.Encode}, stages...)
 			continue
 		}
 
+		stages = append(stages, fi.Decode)
 	}
 
-	return m
+	return stages, nil
+}
+
+// deviceColorComponents returns the number of color components for a named color space or 0.
+func deviceColorComponents(cs *string) int {
+
+	if cs == nil {
+		return 0
+	}
+
+	switch *cs {
+	case "DeviceGray", "CalGray":
+		return 1
+	case "DeviceRGB", "CalRGB":
+		return 3
+	case "DeviceCMYK":
+		return 4
+	}
+
+	return 0
 }
 
 // encodeStream encodes stream dict data by applying its filter pipeline.
 func encodeStream(sd *StreamDict) error {
 
-	fmt.Printf("encodeStream begin")
+	log.Write.Tracef("encodeStream begin")
 
 	// No filter specified, nothing to encode.
 	if sd.FilterPipeline == nil {
-		fmt.Println("encodeStream: returning uncompressed stream.")
+		log.Write.Tracef("encodeStream: returning uncompressed stream.")
 		sd.Raw = sd.Content
 		streamLength := int64(len(sd.Raw))
 		sd.StreamLength = &streamLength
@@ -75,43 +219,26 @@ func encodeStream(sd *StreamDict) error {
 		return nil
 	}
 
-	var b io.Reader
-	b = bytes.NewReader(sd.Content)
-
-	var c *bytes.Buffer
-
-	// Apply each filter in the pipeline to result of preceding filter.
-	for _, f := range sd.FilterPipeline {
-
-		if f.DecodeParms != nil {
-			fmt.Printf("encodeStream: encoding filter:%s\ndecodeParms:%s\n", f.Name, f.DecodeParms)
-		} else {
-			fmt.Printf("encodeStream: encoding filter:%s\n", f.Name)
-		}
-
-		// make parms map[string]int
-		parms := parmsForFilter(f.DecodeParms)
+	stages, err := filterStages(sd, true)
+	if err != nil {
+		return err
+	}
 
-		fi, err := filter.NewFilter(f.Name, parms)
-		if err != nil {
-			return err
-		}
+	sd.Raw = sd.Content
 
-		c, err = fi.Encode(b)
-		if err != nil {
+	if len(stages) > 0 {
+		var b bytes.Buffer
+		if err = runPipeline(bytes.NewReader(sd.Content), &b, stages); err != nil {
 			return err
 		}
-
-		b = c
+		sd.Raw = b.Bytes()
 	}
 
-	sd.Raw = c.Bytes()
-
 	streamLength := int64(len(sd.Raw))
 	sd.StreamLength = &streamLength
 	sd.Update("Length", Integer(streamLength))
 
-	fmt.Printf("encodeStream end")
+	log.Write.Tracef("encodeStream end")
 
 	return nil
 }
@@ -119,7 +246,7 @@ func encodeStream(sd *StreamDict) error {
 // decodeStream decodes streamDict data by applying its filter pipeline.
 func decodeStream(sd *StreamDict) error {
 
-	fmt.Printf("decodeStream begin \n%s\n", sd)
+	log.Read.Tracef("decodeStream begin \n%s\n", sd)
 
 	if sd.Content != nil {
 		// This stream has already been decoded.
@@ -129,62 +256,72 @@ func decodeStream(sd *StreamDict) error {
 	// No filter specified, nothing to decode.
 	if sd.FilterPipeline == nil {
 		sd.Content = sd.Raw
-		fmt.Printf("decodedStream returning %d(#%02x)bytes: \n%s\n", len(sd.Content), len(sd.Content), hex.Dump(sd.Content))
+		if log.Read.Enabled(log.LevelTrace) {
+			log.Read.Tracef("decodedStream returning %d(#%02x)bytes: \n%s\n", len(sd.Content), len(sd.Content), hex.Dump(sd.Content))
+		}
 		return nil
 	}
 
-	var b io.Reader
-	b = bytes.NewReader(sd.Raw)
+	stages, err := filterStages(sd, false)
+	if err != nil {
+		return err
+	}
+
+	if len(stages) == 0 {
+		sd.Content = sd.Raw
+		return nil
+	}
 
-	//fmt.Printf("decodedStream before:\n%s\n", hex.Dump(sd.Raw))
+	var b bytes.Buffer
+	if err = runPipeline(bytes.NewReader(sd.Raw), &b, stages); err != nil {
+		return err
+	}
 
-	var c *bytes.Buffer
+	sd.Content = b.Bytes()
 
-	// Apply each filter in the pipeline to result of preceding filter.
-	for _, f := range sd.FilterPipeline {
+	return nil
+}
 
-		if f.DecodeParms != nil {
-			fmt.Printf("decodeStream: decoding filter:%s\ndecodeParms:%s\n", f.Name, f.DecodeParms)
-		} else {
-			fmt.Printf("decodeStream: decoding filter:%s\n", f.Name)
-		}
+// resolveParmStreams loads the streams referenced by the decode parameters of the filters of sd, eg. JBIG2Globals.
+// It returns false if a referenced stream has not been read yet.
+func resolveParmStreams(xRefTable *XRefTable, sd *StreamDict) (bool, error) {
 
-		// make parms map[string]int
-		parms := parmsForFilter(f.DecodeParms)
+	for i, f := range sd.FilterPipeline {
 
-		if f.Name == filter.CCITTFax {
-			// x/image/ccitt needs the optional decode parameter "Rows"
-			// if not available we supply the image "Height".
-			_, ok := parms["Rows"]
-			if !ok {
-				ip := sd.IntEntry("Height")
-				if ip == nil {
-					return errors.New("pdfcpu: ccitt: \"Height\" required")
-				}
-				parms["Rows"] = *ip
-			}
+		if f.DecodeParms == nil {
+			continue
 		}
 
-		fi, err := filter.NewFilter(f.Name, parms)
-		if err != nil {
-			return err
-		}
+		for k, t := range filter.ParmTypes(f.Name) {
 
-		c, err = fi.Decode(b)
-		if err != nil {
-			return err
-		}
+			if t != filter.StreamParm || f.streams[k] != nil {
+				continue
+			}
 
-		//fmt.Printf("decodedStream after:%s\n%s\n", f.Name, hex.Dump(c.Bytes()))
+			o, found := f.DecodeParms.Find(k)
+			if !found {
+				continue
+			}
 
-		b = c
-	}
+			psd, err := xRefTable.DereferenceStreamDict(o)
+			if err != nil {
+				return false, err
+			}
 
-	sd.Content = c.Bytes()
+			if psd == nil || psd.Raw == nil && psd.Content == nil {
+				return false, nil
+			}
 
-	//fmt.Printf("decodedStream returning %d(#%02x)bytes: \n%s\n", len(sd.Content), len(sd.Content), hex.Dump(c.Bytes()))
+			if err = decodeStream(psd); err != nil {
+				return false, err
+			}
 
-	//fmt.Printf("decodeStream end")
+			if sd.FilterPipeline[i].streams == nil {
+				sd.FilterPipeline[i].streams = map[string][]byte{}
+			}
+			sd.FilterPipeline[i].streams[k] = psd.Content
+		}
+	}
 
-	return nil
+	return true, nil
 }
@@ -17,11 +17,9 @@ limitations under the License.
 package filter
 
 import (
-	"bytes"
 	"encoding/ascii85"
 	"errors"
 	"io"
-	"io/ioutil"
 )
 
 type ascii85Decode struct {
@@ -31,45 +29,37 @@ type ascii85Decode struct {
 const eodASCII85 = "~>"
 
 // Encode implements encoding for an ASCII85Decode filter.
-func (f ascii85Decode) Encode(r io.Reader) (*bytes.Buffer, error) {
+func (f ascii85Decode) Encode(r io.Reader, w io.Writer) error {
 
-	p, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
+	encoder := ascii85.NewEncoder(w)
+
+	if _, err := io.Copy(encoder, r); err != nil {
+		return err
 	}
 
-	buf := &bytes.Buffer{}
-	encoder := ascii85.NewEncoder(buf)
-	encoder.Write(p)
-	encoder.Close()
+	if err := encoder.Close(); err != nil {
+		return err
+	}
 
 	// Add eod sequence
-	buf.WriteString(eodASCII85)
+	_, err := io.WriteString(w, eodASCII85)
 
-	return buf, nil
+	return err
 }
 
 // Decode implements decoding for an ASCII85Decode filter.
-func (f ascii85Decode) Decode(r io.Reader) (*bytes.Buffer, error) {
+func (f ascii85Decode) Decode(r io.Reader, w io.Writer) error {
 
-	p, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
-	}
+	// Cut off on eod sequence: "~>"
+	er := newEODReader(r, eodASCII85[0])
 
-	if !bytes.HasSuffix(p, []byte(eodASCII85)) {
-		return nil, errors.New("pdfcpu: Decode: missing eod marker")
+	if _, err := io.Copy(w, ascii85.NewDecoder(er)); err != nil {
+		return err
 	}
 
-	// Strip eod sequence: "~>"
-	p = p[:len(p)-2]
-
-	decoder := ascii85.NewDecoder(bytes.NewReader(p))
-
-	buf, err := ioutil.ReadAll(decoder)
-	if err != nil {
-		return nil, err
+	if !er.found {
+		return errors.New("pdfcpu: Decode: missing eod marker")
 	}
 
-	return bytes.NewBuffer(buf), nil
+	return nil
 }
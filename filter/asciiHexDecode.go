@@ -17,10 +17,9 @@ limitations under the License.
 package filter
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/hex"
 	"io"
-	"io/ioutil"
 )
 
 type asciiHexDecode struct {
@@ -30,53 +29,76 @@ type asciiHexDecode struct {
 const eodHexDecode = '>'
 
 // Encode implements encoding for an ASCIIHexDecode filter.
-func (f asciiHexDecode) Encode(r io.Reader) (*bytes.Buffer, error) {
+func (f asciiHexDecode) Encode(r io.Reader, w io.Writer) error {
 
-	bb, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
+	if _, err := io.Copy(hex.NewEncoder(w), r); err != nil {
+		return err
 	}
 
-	dst := make([]byte, hex.EncodedLen(len(bb)))
-	hex.Encode(dst, bb)
-
 	// eod marker
-	dst = append(dst, eodHexDecode)
+	_, err := w.Write([]byte{eodHexDecode})
+
+	return err
+}
 
-	return bytes.NewBuffer(dst), nil
+func isWhiteSpace(c byte) bool {
+	return c == 0x09 || c == 0x0A || c == 0x0C || c == 0x0D || c == 0x20
 }
 
 // Decode implements decoding for an ASCIIHexDecode filter.
-func (f asciiHexDecode) Decode(r io.Reader) (*bytes.Buffer, error) {
+func (f asciiHexDecode) Decode(r io.Reader, w io.Writer) error {
 
-	bb, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
-	}
+	// Cut off on eod
+	br := bufio.NewReader(newEODReader(r, eodHexDecode))
+	bw := bufio.NewWriter(w)
 
-	var p []byte
+	var p [2]byte
+	n := 0
 
-	// Remove any white space and cut off on eod
-	for i := 0; i < len(bb); i++ {
-		if bb[i] == eodHexDecode {
+	for {
+
+		c, err := br.ReadByte()
+		if err == io.EOF {
 			break
 		}
-		if !bytes.ContainsRune([]byte{0x09, 0x0A, 0x0C, 0x0D, 0x20}, rune(bb[i])) {
-			p = append(p, bb[i])
+		if err != nil {
+			return err
+		}
+
+		// Remove any white space
+		if isWhiteSpace(c) {
+			continue
+		}
+
+		p[n] = c
+		n++
+
+		if n == 2 {
+			if err = writeHexByte(bw, p); err != nil {
+				return err
+			}
+			n = 0
 		}
 	}
 
 	// if len == odd add "0"
-	if len(p)%2 == 1 {
-		p = append(p, '0')
+	if n == 1 {
+		p[1] = '0'
+		if err := writeHexByte(bw, p); err != nil {
+			return err
+		}
 	}
 
-	dst := make([]byte, hex.DecodedLen(len(p)))
+	return bw.Flush()
+}
+
+func writeHexByte(w io.ByteWriter, p [2]byte) error {
+
+	var b [1]byte
 
-	_, err = hex.Decode(dst, p)
-	if err != nil {
-		return nil, err
+	if _, err := hex.Decode(b[:], p[:]); err != nil {
+		return err
 	}
 
-	return bytes.NewBuffer(dst), nil
+	return w.WriteByte(b[0])
 }
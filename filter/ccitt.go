@@ -0,0 +1,491 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+// CCITT Group 3 and Group 4 facsimile coding (ITU-T T.4 and T.6).
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	errCCITTEOD     = errors.New("pdfcpu: ccitt: unexpected end of data")
+	errCCITTCode    = errors.New("pdfcpu: ccitt: invalid code")
+	errCCITTChanges = errors.New("pdfcpu: ccitt: invalid changing element")
+)
+
+type ccittCode struct {
+	val  int
+	code string
+}
+
+// T.4 Table 2 terminating codes and Table 3 make-up codes.
+
+var ccittWhiteCodes = []ccittCode{
+	{0, "00110101"}, {1, "000111"}, {2, "0111"}, {3, "1000"}, {4, "1011"}, {5, "1100"}, {6, "1110"}, {7, "1111"},
+	{8, "10011"}, {9, "10100"}, {10, "00111"}, {11, "01000"}, {12, "001000"}, {13, "000011"}, {14, "110100"},
+	{15, "110101"}, {16, "101010"}, {17, "101011"}, {18, "0100111"}, {19, "0001100"}, {20, "0001000"},
+	{21, "0010111"}, {22, "0000011"}, {23, "0000100"}, {24, "0101000"}, {25, "0101011"}, {26, "0010011"},
+	{27, "0100100"}, {28, "0011000"}, {29, "00000010"}, {30, "00000011"}, {31, "00011010"}, {32, "00011011"},
+	{33, "00010010"}, {34, "00010011"}, {35, "00010100"}, {36, "00010101"}, {37, "00010110"}, {38, "00010111"},
+	{39, "00101000"}, {40, "00101001"}, {41, "00101010"}, {42, "00101011"}, {43, "00101100"}, {44, "00101101"},
+	{45, "00000100"}, {46, "00000101"}, {47, "00001010"}, {48, "00001011"}, {49, "01010010"}, {50, "01010011"},
+	{51, "01010100"}, {52, "01010101"}, {53, "00100100"}, {54, "00100101"}, {55, "01011000"}, {56, "01011001"},
+	{57, "01011010"}, {58, "01011011"}, {59, "01001010"}, {60, "01001011"}, {61, "00110010"}, {62, "00110011"},
+	{63, "00110100"},
+	{64, "11011"}, {128, "10010"}, {192, "010111"}, {256, "0110111"}, {320, "00110110"}, {384, "00110111"},
+	{448, "01100100"}, {512, "01100101"}, {576, "01101000"}, {640, "01100111"}, {704, "011001100"},
+	{768, "011001101"}, {832, "011010010"}, {896, "011010011"}, {960, "011010100"}, {1024, "011010101"},
+	{1088, "011010110"}, {1152, "011010111"}, {1216, "011011000"}, {1280, "011011001"}, {1344, "011011010"},
+	{1408, "011011011"}, {1472, "010011000"}, {1536, "010011001"}, {1600, "010011010"}, {1664, "011000"},
+	{1728, "010011011"},
+}
+
+var ccittBlackCodes = []ccittCode{
+	{0, "0000110111"}, {1, "010"}, {2, "11"}, {3, "10"}, {4, "011"}, {5, "0011"}, {6, "0010"}, {7, "00011"},
+	{8, "000101"}, {9, "000100"}, {10, "0000100"}, {11, "0000101"}, {12, "0000111"}, {13, "00000100"},
+	{14, "00000111"}, {15, "000011000"}, {16, "0000010111"}, {17, "0000011000"}, {18, "0000001000"},
+	{19, "00001100111"}, {20, "00001101000"}, {21, "00001101100"}, {22, "00000110111"}, {23, "00000101000"},
+	{24, "00000010111"}, {25, "00000011000"}, {26, "000011001010"}, {27, "000011001011"}, {28, "000011001100"},
+	{29, "000011001101"}, {30, "000001101000"}, {31, "000001101001"}, {32, "000001101010"}, {33, "000001101011"},
+	{34, "000011010010"}, {35, "000011010011"}, {36, "000011010100"}, {37, "000011010101"}, {38, "000011010110"},
+	{39, "000011010111"}, {40, "000001101100"}, {41, "000001101101"}, {42, "000011011010"}, {43, "000011011011"},
+	{44, "000001010100"}, {45, "000001010101"}, {46, "000001010110"}, {47, "000001010111"}, {48, "000001100100"},
+	{49, "000001100101"}, {50, "000001010010"}, {51, "000001010011"}, {52, "000000100100"}, {53, "000000110111"},
+	{54, "000000111000"}, {55, "000000100111"}, {56, "000000101000"}, {57, "000001011000"}, {58, "000001011001"},
+	{59, "000000101011"}, {60, "000000101100"}, {61, "000001011010"}, {62, "000001100110"}, {63, "000001100111"},
+	{64, "0000001111"}, {128, "000011001000"}, {192, "000011001001"}, {256, "000001011011"},
+	{320, "000000110011"}, {384, "000000110100"}, {448, "000000110101"}, {512, "0000001101100"},
+	{576, "0000001101101"}, {640, "0000001001010"}, {704, "0000001001011"}, {768, "0000001001100"},
+	{832, "0000001001101"}, {896, "0000001110010"}, {960, "0000001110011"}, {1024, "0000001110100"},
+	{1088, "0000001110101"}, {1152, "0000001110110"}, {1216, "0000001110111"}, {1280, "0000001010010"},
+	{1344, "0000001010011"}, {1408, "0000001010100"}, {1472, "0000001010101"}, {1536, "0000001011010"},
+	{1600, "0000001011011"}, {1664, "0000001100100"}, {1728, "0000001100101"},
+}
+
+// T.4 Table 3a: Extended make-up codes shared by both colors.
+var ccittExtendedCodes = []ccittCode{
+	{1792, "00000001000"}, {1856, "00000001100"}, {1920, "00000001101"}, {1984, "000000010010"},
+	{2048, "000000010011"}, {2112, "000000010100"}, {2176, "000000010101"}, {2240, "000000010110"},
+	{2304, "000000010111"}, {2368, "000000011100"}, {2432, "000000011101"}, {2496, "000000011110"},
+	{2560, "000000011111"},
+}
+
+// Two-dimensional coding modes (T.4 Table 4).
+const (
+	modePass = iota
+	modeHorizontal
+	modeV0
+	modeVR1
+	modeVR2
+	modeVR3
+	modeVL1
+	modeVL2
+	modeVL3
+	modeExtension
+)
+
+var ccittModeCodes = []ccittCode{
+	{modePass, "0001"}, {modeHorizontal, "001"}, {modeV0, "1"},
+	{modeVR1, "011"}, {modeVR2, "000011"}, {modeVR3, "0000011"},
+	{modeVL1, "010"}, {modeVL2, "000010"}, {modeVL3, "0000010"},
+	{modeExtension, "0000001"},
+}
+
+// Vertical mode offsets a1 - b1.
+var verticalModes = map[int]int{
+	modeV0: 0, modeVR1: 1, modeVR2: 2, modeVR3: 3, modeVL1: -1, modeVL2: -2, modeVL3: -3,
+}
+
+const (
+	ccittEOL      = "000000000001"
+	ccittMaxRun   = 2560
+	ccittMaxCode  = 13
+	ccittEOLZeros = 11
+)
+
+// ccittTable maps codes to values for decoding and values to codes for encoding.
+type ccittTable struct {
+	dec map[int]int // key: len<<16 | code
+	enc map[int]string
+}
+
+func newCCITTTable(cc ...[]ccittCode) ccittTable {
+
+	t := ccittTable{dec: map[int]int{}, enc: map[int]string{}}
+
+	for _, c := range cc {
+		for _, e := range c {
+			k := 0
+			for i := 0; i < len(e.code); i++ {
+				k = k<<1 | int(e.code[i]-'0')
+			}
+			t.dec[len(e.code)<<16|k] = e.val
+			t.enc[e.val] = e.code
+		}
+	}
+
+	return t
+}
+
+var (
+	whiteTable = newCCITTTable(ccittWhiteCodes, ccittExtendedCodes)
+	blackTable = newCCITTTable(ccittBlackCodes, ccittExtendedCodes)
+	modeTable  = newCCITTTable(ccittModeCodes)
+)
+
+type bitReader struct {
+	b   []byte
+	pos int // bit position
+}
+
+func (r *bitReader) bit() (int, error) {
+	if r.pos >= len(r.b)*8 {
+		return 0, errCCITTEOD
+	}
+	v := int(r.b[r.pos>>3]>>(7-uint(r.pos&7))) & 1
+	r.pos++
+	return v, nil
+}
+
+func (r *bitReader) eod() bool {
+	return r.pos >= len(r.b)*8
+}
+
+func (r *bitReader) align() {
+	r.pos = (r.pos + 7) &^ 7
+}
+
+// zeros returns the number of consecutive 0 bits at the current position.
+func (r *bitReader) zeros() int {
+	n := 0
+	for p := r.pos; p < len(r.b)*8 && r.b[p>>3]>>(7-uint(p&7))&1 == 0; p++ {
+		n++
+	}
+	return n
+}
+
+// eol consumes an end of line pattern including any preceding fill bits.
+func (r *bitReader) eol() bool {
+	n := r.zeros()
+	if n < ccittEOLZeros || r.pos+n >= len(r.b)*8 {
+		return false
+	}
+	r.pos += n + 1
+	return true
+}
+
+// syncEOL skips to the next end of line pattern without consuming it.
+func (r *bitReader) syncEOL() bool {
+	for !r.eod() {
+		if n := r.zeros(); n >= ccittEOLZeros && r.pos+n < len(r.b)*8 {
+			return true
+		}
+		r.pos++
+	}
+	return false
+}
+
+func (r *bitReader) decode(t ccittTable) (int, error) {
+	k := 0
+	for l := 1; l <= ccittMaxCode; l++ {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		k = k<<1 | b
+		if v, ok := t.dec[l<<16|k]; ok {
+			return v, nil
+		}
+	}
+	return 0, errCCITTCode
+}
+
+// run decodes a run length consisting of make-up codes followed by a terminating code.
+func (r *bitReader) run(t ccittTable) (int, error) {
+	n := 0
+	for {
+		v, err := r.decode(t)
+		if err != nil {
+			return 0, err
+		}
+		n += v
+		if v < 64 {
+			return n, nil
+		}
+	}
+}
+
+type bitWriter struct {
+	bytes.Buffer
+	cur  byte
+	bits uint
+}
+
+func (w *bitWriter) writeBits(s string) {
+	for i := 0; i < len(s); i++ {
+		w.cur = w.cur<<1 | (s[i] - '0')
+		w.bits++
+		if w.bits == 8 {
+			w.WriteByte(w.cur)
+			w.cur, w.bits = 0, 0
+		}
+	}
+}
+
+func (w *bitWriter) align() {
+	if w.bits > 0 {
+		w.WriteByte(w.cur << (8 - w.bits))
+		w.cur, w.bits = 0, 0
+	}
+}
+
+func (w *bitWriter) run(t ccittTable, n int) {
+	for n >= ccittMaxRun+64 {
+		w.writeBits(t.enc[ccittMaxRun])
+		n -= ccittMaxRun
+	}
+	if n >= 64 {
+		w.writeBits(t.enc[n/64*64])
+		n %= 64
+	}
+	w.writeBits(t.enc[n])
+}
+
+// Rows are represented by their changing elements, the positions of pixels differing in color from their predecessor.
+// The first changing element of a row marks the beginning of the first black run.
+
+func changingElements(row []byte, cols int, blackIs1 bool) []int {
+
+	var cc []int
+
+	black := false
+
+	for i := 0; i < cols; i++ {
+		b := row[i>>3]>>(7-uint(i&7))&1 == 1
+		if b == blackIs1 {
+			// black pixel
+			if !black {
+				cc = append(cc, i)
+				black = true
+			}
+			continue
+		}
+		if black {
+			cc = append(cc, i)
+			black = false
+		}
+	}
+
+	return cc
+}
+
+func fillRow(row []byte, cc []int, cols int, blackIs1 bool) {
+
+	white := byte(0)
+	if !blackIs1 {
+		white = 0xFF
+	}
+	for i := range row {
+		row[i] = white
+	}
+
+	for i := 0; i < len(cc); i += 2 {
+		end := cols
+		if i+1 < len(cc) {
+			end = cc[i+1]
+		}
+		for j := cc[i]; j < end; j++ {
+			row[j>>3] ^= 0x80 >> uint(j&7)
+		}
+	}
+}
+
+// nextChange returns the first changing element of cc greater than a0 (or at least 0 for a0 < 0)
+// starting a run of color black (or white), together with its index.
+func nextChange(cc []int, a0 int, black bool, cols int) (int, int) {
+	for i, c := range cc {
+		if c > a0 && (i%2 == 0) == black {
+			return c, i
+		}
+	}
+	return cols, len(cc)
+}
+
+// b1b2 returns the changing elements b1 and b2 of the reference line for a0 and its color.
+func b1b2(ref []int, a0 int, black bool, cols int) (int, int) {
+	b1, i := nextChange(ref, a0, !black, cols)
+	b2 := cols
+	if i+1 < len(ref) {
+		b2 = ref[i+1]
+	}
+	return b1, b2
+}
+
+func runTable(black bool) ccittTable {
+	if black {
+		return blackTable
+	}
+	return whiteTable
+}
+
+func encode1D(w *bitWriter, cc []int, cols int) {
+
+	a0, black := 0, false
+
+	for i := 0; ; i++ {
+		a1 := cols
+		if i < len(cc) {
+			a1 = cc[i]
+		}
+		w.run(runTable(black), a1-a0)
+		if a1 >= cols {
+			// A trailing black run needs a terminating white run.
+			return
+		}
+		a0, black = a1, !black
+	}
+}
+
+func encode2D(w *bitWriter, cc, ref []int, cols int) {
+
+	a0, black := -1, false
+
+	for a0 < cols {
+
+		a1, i := nextChange(cc, a0, !black, cols)
+		b1, b2 := b1b2(ref, a0, black, cols)
+
+		if b2 < a1 {
+			w.writeBits(modeTable.enc[modePass])
+			a0 = b2
+			continue
+		}
+
+		if d := a1 - b1; d >= -3 && d <= 3 {
+			for m, v := range verticalModes {
+				if v == d {
+					w.writeBits(modeTable.enc[m])
+					break
+				}
+			}
+			a0, black = a1, !black
+			continue
+		}
+
+		a2 := cols
+		if i+1 < len(cc) {
+			a2 = cc[i+1]
+		}
+
+		if a0 < 0 {
+			a0 = 0
+		}
+
+		w.writeBits(modeTable.enc[modeHorizontal])
+		w.run(runTable(black), a1-a0)
+		w.run(runTable(!black), a2-a1)
+		a0 = a2
+	}
+}
+
+func decode1D(r *bitReader, cols int) ([]int, error) {
+
+	var cc []int
+
+	a0, black := 0, false
+
+	for a0 < cols {
+		n, err := r.run(runTable(black))
+		if err != nil {
+			return nil, err
+		}
+		a0 += n
+		if a0 > cols {
+			return nil, errCCITTChanges
+		}
+		if a0 < cols {
+			cc = append(cc, a0)
+		}
+		black = !black
+	}
+
+	return cc, nil
+}
+
+func decode2D(r *bitReader, ref []int, cols int) ([]int, error) {
+
+	var cc []int
+
+	a0, black := -1, false
+
+	for a0 < cols {
+
+		m, err := r.decode(modeTable)
+		if err != nil {
+			return nil, err
+		}
+
+		b1, b2 := b1b2(ref, a0, black, cols)
+
+		switch m {
+
+		case modePass:
+			a0 = b2
+
+		case modeHorizontal:
+			if a0 < 0 {
+				a0 = 0
+			}
+			n1, err := r.run(runTable(black))
+			if err != nil {
+				return nil, err
+			}
+			n2, err := r.run(runTable(!black))
+			if err != nil {
+				return nil, err
+			}
+			a1, a2 := a0+n1, a0+n1+n2
+			if a2 > cols {
+				return nil, errCCITTChanges
+			}
+			if a1 < cols {
+				cc = append(cc, a1)
+			}
+			if a2 < cols {
+				cc = append(cc, a2)
+			}
+			a0 = a2
+
+		case modeExtension:
+			return nil, errors.New("pdfcpu: ccitt: extension codes not supported")
+
+		default:
+			a1 := b1 + verticalModes[m]
+			if a1 < 0 || a1 > cols || a1 <= a0 && a0 >= 0 {
+				return nil, errCCITTChanges
+			}
+			if a1 < cols {
+				cc = append(cc, a1)
+			}
+			a0, black = a1, !black
+		}
+	}
+
+	return cc, nil
+}
@@ -17,77 +17,271 @@ limitations under the License.
 package filter
 
 import (
-	"bytes"
 	"errors"
-	"fmt"
 	"io"
-
-	"golang.org/x/image/ccitt"
+	"io/ioutil"
 )
 
+// The maximum number of columns of a CCITT encoded image.
+const ccittMaxColumns = 1 << 20
+
 type ccittDecode struct {
 	baseFilter
 }
 
-// Encode implements encoding for an CCITTDecode filter.
-func (f ccittDecode) Encode(r io.Reader) (*bytes.Buffer, error) {
-	// TODO
-	return nil, nil
+// ccittParms represents the decode parameters of a CCITTFaxDecode filter (see 7.4.6, Table 11).
+type ccittParms struct {
+	// <0 : Pure two-dimensional encoding (Group 4)
+	// =0 : Pure one-dimensional encoding (Group 3, 1-D)
+	// >0 : Mixed one- and two-dimensional encoding (Group 3, 2-D)
+	k                int
+	endOfLine        bool
+	encodedByteAlign bool
+	columns          int
+	rows             int // 0 = unknown
+	endOfBlock       bool
+	blackIs1         bool
+	damagedRows      int
 }
 
-// Decode implements decoding for a CCITTDecode filter.
-func (f ccittDecode) Decode(r io.Reader) (*bytes.Buffer, error) {
+func (f ccittDecode) ccittParms() (*ccittParms, error) {
 
-	fmt.Println("DecodeCCITT begin")
+	p := &ccittParms{
+		k:                f.parms.Int("K", 0),
+		endOfLine:        f.parms.Bool("EndOfLine", false),
+		encodedByteAlign: f.parms.Bool("EncodedByteAlign", false),
+		columns:          f.parms.Int("Columns", 1728),
+		rows:             f.parms.Int("Rows", 0),
+		endOfBlock:       f.parms.Bool("EndOfBlock", true),
+		blackIs1:         f.parms.Bool("BlackIs1", false),
+		damagedRows:      f.parms.Int("DamagedRowsBeforeError", 0),
+	}
 
-	var ok bool
+	if p.columns <= 0 || p.columns > ccittMaxColumns {
+		return nil, errors.New("pdfcpu: ccitt: invalid DecodeParam \"Columns\"")
+	}
 
-	// <0 : Pure two-dimensional encoding (Group 4)
-	// =0 : Pure one-dimensional encoding (Group 3, 1-D)
-	// >0 : Mixed one- and two-dimensional encoding (Group 3, 2-D)
-	k := 0
-	k, ok = f.parms["K"]
-	if ok && k > 0 {
-		return nil, errors.New("pdfcpu: filter CCITTFax k > 0 currently unsupported")
+	if p.rows < 0 {
+		return nil, errors.New("pdfcpu: ccitt: invalid DecodeParam \"Rows\"")
+	}
+
+	return p, nil
+}
+
+// alignLine writes fill bits so the next line starts on a byte boundary.
+// If lines start with EOL the fill precedes the EOL.
+func (p *ccittParms) alignLine(w *bitWriter) {
+
+	if !p.encodedByteAlign {
+		return
+	}
+
+	if !p.endOfLine {
+		w.align()
+		return
+	}
+
+	for (w.bits+uint(len(ccittEOL)))%8 != 0 {
+		w.writeBits("0")
+	}
+}
+
+// Encode implements encoding for a CCITTDecode filter.
+func (f ccittDecode) Encode(r io.Reader, w io.Writer) error {
+
+	p, err := f.ccittParms()
+	if err != nil {
+		return err
+	}
+
+	row := make([]byte, (p.columns+7)/8)
+
+	bw := &bitWriter{}
+
+	var ref []int
+
+	for i := 0; p.rows == 0 || i < p.rows; i++ {
+
+		if _, err = io.ReadFull(r, row); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// Ignore any incomplete last row.
+				break
+			}
+			return err
+		}
+
+		cc := changingElements(row, p.columns, p.blackIs1)
+
+		p.alignLine(bw)
+
+		if p.endOfLine {
+			bw.writeBits(ccittEOL)
+		}
+
+		oneD := p.k == 0 || p.k > 0 && i%p.k == 0
+
+		if p.k > 0 {
+			// Tag bit: 1 = one-dimensional, 0 = two-dimensional coding of the next line.
+			if oneD {
+				bw.writeBits("1")
+			} else {
+				bw.writeBits("0")
+			}
+		}
+
+		if oneD {
+			encode1D(bw, cc, p.columns)
+		} else {
+			encode2D(bw, cc, ref, p.columns)
+		}
+
+		ref = cc
+
+		// Pass on completed bytes.
+		if _, err = bw.WriteTo(w); err != nil {
+			return err
+		}
+	}
+
+	if p.endOfBlock {
+
+		p.alignLine(bw)
+
+		if p.k < 0 {
+			// EOFB
+			bw.writeBits(ccittEOL + ccittEOL)
+		} else {
+			// RTC
+			for i := 0; i < 6; i++ {
+				bw.writeBits(ccittEOL)
+				if p.k > 0 {
+					bw.writeBits("1")
+				}
+			}
+		}
 	}
 
-	cols := 1728
-	col, ok := f.parms["Columns"]
-	if ok {
-		cols = col
+	bw.align()
+
+	_, err = bw.WriteTo(w)
+
+	return err
+}
+
+// endOfData returns true if the remaining encoded data consists of fill bits only.
+func endOfData(rd *bitReader) bool {
+	return rd.pos+rd.zeros() >= len(rd.b)*8
+}
+
+// lineStart consumes fill bits and any EOL preceding the next line.
+// It returns false if there are no more lines because of an EOFB, RTC or the end of data.
+func (p *ccittParms) lineStart(rd *bitReader) (bool, error) {
+
+	if p.encodedByteAlign && !p.endOfLine {
+		rd.align()
+	}
+
+	if endOfData(rd) {
+		return false, nil
+	}
+
+	if !rd.eol() {
+		return true, nil
+	}
+
+	// An EOL followed by another EOL marks the end of data:
+	// EOFB consists of 2 EOLs, RTC of 6 EOLs each followed by a tag bit if K > 0.
+	pos := rd.pos
+	if p.k > 0 {
+		if _, err := rd.bit(); err != nil {
+			return false, nil
+		}
+	}
+	if rd.eol() || endOfData(rd) {
+		return false, nil
 	}
+	rd.pos = pos
 
-	rows, ok := f.parms["Rows"]
-	if !ok {
-		return nil, errors.New("pdfcpu: ccitt: missing DecodeParam \"Rows\"")
+	return true, nil
+}
+
+func (p *ccittParms) decodeLine(rd *bitReader, ref []int) ([]int, error) {
+
+	oneD := p.k == 0
+
+	if p.k > 0 {
+		tag, err := rd.bit()
+		if err != nil {
+			return nil, err
+		}
+		oneD = tag == 1
 	}
 
-	blackIs1 := false
-	v, ok := f.parms["BlackIs1"]
-	if ok && v == 1 {
-		blackIs1 = true
+	if oneD {
+		return decode1D(rd, p.columns)
 	}
 
-	encodedByteAlign := false
-	v, ok = f.parms["EncodedByteAlign"]
-	if ok && v == 1 {
-		encodedByteAlign = true
+	return decode2D(rd, ref, p.columns)
+}
+
+// decode decodes the rows of CCITT encoded data.
+func (p *ccittParms) decode(data []byte, w io.Writer) error {
+
+	rd := &bitReader{b: data}
+	row := make([]byte, (p.columns+7)/8)
+	damaged := 0
+
+	var ref []int
+
+	for i := 0; p.rows == 0 || i < p.rows; i++ {
+
+		more, err := p.lineStart(rd)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+
+		cc, err := p.decodeLine(rd, ref)
+		if err != nil {
+
+			// Damaged rows may only be detected for lines starting with EOL using one-dimensional reference lines.
+			if !p.endOfLine || p.k < 0 || damaged >= p.damagedRows {
+				return err
+			}
+
+			// Replace the damaged row with its predecessor and resume at the next EOL.
+			damaged++
+			cc = ref
+			if !rd.syncEOL() {
+				rd.pos = len(rd.b) * 8
+			}
+		}
+
+		fillRow(row, cc, p.columns, p.blackIs1)
+		if _, err = w.Write(row); err != nil {
+			return err
+		}
+
+		ref = cc
 	}
 
-	opts := &ccitt.Options{Invert: blackIs1, Align: encodedByteAlign}
+	return nil
+}
+
+// Decode implements decoding for a CCITTDecode filter.
+func (f ccittDecode) Decode(r io.Reader, w io.Writer) error {
 
-	mode := ccitt.Group3
-	if k < 0 {
-		mode = ccitt.Group4
+	p, err := f.ccittParms()
+	if err != nil {
+		return err
 	}
-	rd := ccitt.NewReader(r, ccitt.MSB, mode, cols, rows, opts)
 
-	var b bytes.Buffer
-	written, err := io.Copy(&b, rd)
+	data, err := ioutil.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	fmt.Printf("DecodeCCITT: decoded %d bytes.\n", written)
 
-	return &b, nil
+	return p.decode(data, w)
 }
@@ -0,0 +1,233 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestCCITTCodesPrefixFree(t *testing.T) {
+
+	for _, cc := range [][]ccittCode{
+		append(append([]ccittCode{}, ccittWhiteCodes...), ccittExtendedCodes...),
+		append(append([]ccittCode{}, ccittBlackCodes...), ccittExtendedCodes...),
+		ccittModeCodes,
+	} {
+		for i, c1 := range cc {
+			for j, c2 := range cc {
+				if i != j && strings.HasPrefix(c2.code, c1.code) {
+					t.Errorf("code %s(%d) is a prefix of %s(%d)", c1.code, c1.val, c2.code, c2.val)
+				}
+			}
+		}
+	}
+}
+
+// testBitmap returns rows of random runs including runs longer than the maximum make-up code.
+func testBitmap(cols, rows int) []byte {
+
+	rowLen := (cols + 7) / 8
+	b := make([]byte, rowLen*rows)
+	rnd := rand.New(rand.NewSource(int64(cols*rows + 1)))
+
+	for i := 0; i < rows; i++ {
+		row := b[i*rowLen : (i+1)*rowLen]
+		switch i % 5 {
+		case 0:
+			// all black
+		case 1:
+			for j := range row {
+				row[j] = 0xFF
+			}
+		default:
+			black := rnd.Intn(2) == 0
+			for x := 0; x < cols; {
+				n := 1 + rnd.Intn(20)
+				if rnd.Intn(10) == 0 {
+					n = rnd.Intn(3000)
+				}
+				for ; n > 0 && x < cols; n, x = n-1, x+1 {
+					if !black {
+						row[x>>3] |= 0x80 >> uint(x&7)
+					}
+				}
+				black = !black
+			}
+		}
+		// Padding bits are white.
+		for x := cols; x < rowLen*8; x++ {
+			row[x>>3] |= 0x80 >> uint(x&7)
+		}
+	}
+
+	return b
+}
+
+func TestCCITTRoundTrip(t *testing.T) {
+
+	for _, k := range []int{-1, 0, 1, 4} {
+		for _, cols := range []int{1, 7, 8, 45, 1728, 5000} {
+			for _, eol := range []bool{false, true} {
+				for _, align := range []bool{false, true} {
+					for _, eob := range []bool{false, true} {
+
+						parms := Parms{
+							"K":                k,
+							"Columns":          cols,
+							"EndOfLine":        eol,
+							"EncodedByteAlign": align,
+							"EndOfBlock":       eob,
+						}
+
+						rows := 12
+						if !eob && !eol {
+							// Without markers the decoder relies on Rows.
+							parms["Rows"] = rows
+						}
+
+						raw := testBitmap(cols, rows)
+
+						f, _ := NewFilter(CCITTFax, parms)
+
+						enc, err := encodeBytes(f, raw)
+						if err != nil {
+							t.Fatalf("%v: encode: %v", parms, err)
+						}
+
+						dec, err := decodeBytes(f, enc)
+						if err != nil {
+							t.Fatalf("%v: decode: %v", parms, err)
+						}
+
+						if !bytes.Equal(dec, raw) {
+							t.Errorf("%v: roundtrip mismatch", parms)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCCITTBlackIs1(t *testing.T) {
+
+	raw := []byte{0x0F, 0xF0}
+
+	f, _ := NewFilter(CCITTFax, Parms{"K": -1, "Columns": 8, "BlackIs1": true})
+
+	enc, err := encodeBytes(f, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, _ := NewFilter(CCITTFax, Parms{"K": -1, "Columns": 8})
+
+	dec, err := decodeBytes(g, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare(t, dec, []byte{0xF0, 0x0F})
+}
+
+func TestCCITTEncoding(t *testing.T) {
+
+	for _, tt := range []struct {
+		k   int
+		raw string
+		enc string
+	}{
+		// white 8
+		{0, "\xFF", "\x98"},
+		// white 4, black 4
+		{0, "\xF0", "\xB6"},
+		// V0
+		{-1, "\xFF", "\x80"},
+		// V0 V0
+		{-1, "\xFF\xFF", "\xC0"},
+		// tag 1, white 4, black 4, tag 0, V0 V0
+		{2, "\xF0\xF0", "\xDB\x60"},
+	} {
+		f, _ := NewFilter(CCITTFax, Parms{"K": tt.k, "Columns": 8, "EndOfBlock": false})
+
+		enc, err := encodeBytes(f, []byte(tt.raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare(t, enc, []byte(tt.enc))
+
+		dec, err := decodeBytes(f, enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare(t, dec, []byte(tt.raw))
+	}
+}
+
+func TestCCITTDamagedRows(t *testing.T) {
+
+	w := &bitWriter{}
+	w.writeBits(ccittEOL + "1011" + "011")   // white 4, black 4
+	w.writeBits(ccittEOL + "00110100")       // white 63 exceeds Columns
+	w.writeBits(ccittEOL + "10011")          // white 8
+	w.writeBits(strings.Repeat(ccittEOL, 6)) // RTC
+	w.align()
+
+	parms := Parms{"Columns": 8, "EndOfLine": true}
+
+	f, _ := NewFilter(CCITTFax, parms)
+	if _, err := decodeBytes(f, w.Bytes()); err == nil {
+		t.Error("expected error for damaged row")
+	}
+
+	parms["DamagedRowsBeforeError"] = 1
+
+	f, _ = NewFilter(CCITTFax, parms)
+	dec, err := decodeBytes(f, w.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare(t, dec, []byte{0xF0, 0xF0, 0xFF})
+}
+
+func TestCCITTInvalidParms(t *testing.T) {
+
+	for _, parms := range []Parms{
+		{"Columns": 0},
+		{"Columns": 1<<20 + 1},
+		{"Columns": math.MaxInt32},
+		{"Rows": -1},
+	} {
+		if _, err := NewFilter(CCITTFax, parms); err == nil {
+			t.Errorf("%v: expected error", parms)
+		}
+
+		// The filter checks its parameters before allocating a row.
+		f := ccittDecode{baseFilter{parms}}
+
+		if _, err := decodeBytes(f, []byte{0}); err == nil {
+			t.Errorf("%v: expected decode error", parms)
+		}
+
+		if _, err := encodeBytes(f, []byte{0}); err == nil {
+			t.Errorf("%v: expected encode error", parms)
+		}
+	}
+}
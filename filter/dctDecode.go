@@ -0,0 +1,237 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+)
+
+// DefaultDCTQuality is the JPEG quality used for DCT encoding unless specified otherwise.
+const DefaultDCTQuality = jpeg.DefaultQuality
+
+// dctDecode decodes JPEG data into raw samples as described in 7.4.8.
+// Encoding expects raw 8 bit samples with "Colors" components per pixel and "Columns" pixels per row.
+type dctDecode struct {
+	baseFilter
+	quality int
+}
+
+// NewDCTEncoder returns a DCT filter encoding with given JPEG quality ranging from 1 to 100.
+// If a DCT filter has been registered it is returned instead.
+func NewDCTEncoder(parms Parms, quality int) (Filter, error) {
+
+	if quality < 1 || quality > 100 {
+		return nil, errors.New("pdfcpu: filter DCTDecode: quality must be between 1 and 100")
+	}
+
+	if err := parms.Validate(DCT); err != nil {
+		return nil, err
+	}
+
+	if f := registered(DCT); f != nil {
+		return f(parms)
+	}
+
+	return dctDecode{baseFilter: baseFilter{parms}, quality: quality}, nil
+}
+
+// Encode implements encoding for a DCTDecode filter.
+func (f dctDecode) Encode(r io.Reader, w io.Writer) error {
+
+	colors := f.parms.Int("Colors", 1)
+	if colors != 1 && colors != 3 {
+		return fmt.Errorf("pdfcpu: filter DCTDecode: encoding %d color components not supported", colors)
+	}
+
+	if colors == 3 && f.parms.Int("ColorTransform", 1) == 0 {
+		return errors.New("pdfcpu: filter DCTDecode: encoding requires \"ColorTransform\" 1")
+	}
+
+	if !f.parms.Has("Columns") {
+		return errors.New("pdfcpu: filter DCTDecode: encoding requires \"Columns\"")
+	}
+	columns := f.parms.Int("Columns", 1)
+
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	rowSize := columns * colors
+	if len(p) == 0 || len(p)%rowSize != 0 {
+		return errors.New("pdfcpu: filter DCTDecode: data does not match \"Columns\" and \"Colors\"")
+	}
+	rect := image.Rect(0, 0, columns, len(p)/rowSize)
+
+	var img image.Image
+
+	if colors == 1 {
+		img = &image.Gray{Pix: p, Stride: columns, Rect: rect}
+	} else {
+		rgba := image.NewRGBA(rect)
+		for i, j := 0, 0; i < len(p); i, j = i+3, j+4 {
+			copy(rgba.Pix[j:j+3], p[i:i+3])
+			rgba.Pix[j+3] = 0xFF
+		}
+		img = rgba
+	}
+
+	quality := f.quality
+	if quality == 0 {
+		quality = DefaultDCTQuality
+	}
+
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
+
+// Decode implements decoding for a DCTDecode filter.
+func (f dctDecode) Decode(r io.Reader, w io.Writer) error {
+
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	c, err := jpeg.DecodeConfig(bytes.NewReader(p))
+	if err != nil {
+		return err
+	}
+
+	n := 1
+	switch c.ColorModel {
+	case color.YCbCrModel, color.RGBAModel:
+		n = 3
+	case color.CMYKModel:
+		n = 4
+	}
+
+	if n > 1 && !hasAdobeMarker(p) {
+		// Let image/jpeg apply the color transform requested by the decode parameters.
+		// An Adobe APP14 marker present in the data takes precedence.
+		ct := f.parms.Int("ColorTransform", n%2)
+		if n == 4 && ct == 1 {
+			// YCCK
+			ct = 2
+		}
+		p = withAdobeMarker(p, byte(ct))
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(p))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(samples(img))
+	return err
+}
+
+// samples returns the 8 bit samples of a decoded JPEG.
+func samples(img image.Image) []byte {
+
+	rect := img.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+
+	switch img := img.(type) {
+
+	case *image.Gray:
+		p := make([]byte, 0, w*h)
+		for y := 0; y < h; y++ {
+			p = append(p, img.Pix[y*img.Stride:y*img.Stride+w]...)
+		}
+		return p
+
+	case *image.CMYK:
+		// Adobe CMYK JPEGs are stored inverted. image/jpeg reverts this inversion, DCTDecode does not.
+		p := make([]byte, 0, 4*w*h)
+		for y := 0; y < h; y++ {
+			for _, v := range img.Pix[y*img.Stride : y*img.Stride+4*w] {
+				p = append(p, 0xFF-v)
+			}
+		}
+		return p
+	}
+
+	p := make([]byte, 0, 3*w*h)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			p = append(p, c.R, c.G, c.B)
+		}
+	}
+
+	return p
+}
+
+// hasAdobeMarker reports whether the JPEG header contains an Adobe APP14 marker.
+func hasAdobeMarker(p []byte) bool {
+
+	// Skip SOI and walk the marker segments up to the start of scan.
+	for i := 2; i+4 <= len(p); {
+
+		if p[i] != 0xFF {
+			return false
+		}
+
+		m := p[i+1]
+		if m == 0xFF {
+			// Fill byte
+			i++
+			continue
+		}
+
+		if m == 0xDA {
+			// SOS
+			return false
+		}
+
+		l := int(p[i+2])<<8 | int(p[i+3])
+
+		if m == 0xEE && l >= 14 && i+9 <= len(p) && string(p[i+4:i+9]) == "Adobe" {
+			return true
+		}
+
+		i += 2 + l
+	}
+
+	return false
+}
+
+// withAdobeMarker returns p with an Adobe APP14 marker specifying transform inserted after SOI.
+func withAdobeMarker(p []byte, transform byte) []byte {
+
+	app14 := []byte{
+		0xFF, 0xEE, 0x00, 0x0E,
+		'A', 'd', 'o', 'b', 'e',
+		0x00, 0x64, // version
+		0x00, 0x00, // flags0
+		0x00, 0x00, // flags1
+		transform,
+	}
+
+	q := make([]byte, 0, len(p)+len(app14))
+	q = append(q, p[:2]...)
+	q = append(q, app14...)
+
+	return append(q, p[2:]...)
+}
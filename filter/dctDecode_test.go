@@ -0,0 +1,138 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+)
+
+// solid returns the samples of an image of n pixels using color c.
+func solid(n int, c ...byte) []byte {
+	return bytes.Repeat(c, n)
+}
+
+func near(got, want []byte, tolerance int) bool {
+
+	if len(got) != len(want) {
+		return false
+	}
+
+	for i := range got {
+		if d := int(got[i]) - int(want[i]); d < -tolerance || d > tolerance {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestDCTRoundtrip(t *testing.T) {
+
+	for _, tt := range []struct {
+		colors int
+		raw    []byte
+	}{
+		{1, solid(16*8, 200)},
+		{3, solid(16*8, 200, 100, 50)},
+	} {
+		f, err := NewDCTEncoder(Parms{"Columns": 16, "Colors": tt.colors}, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		enc, err := encodeBytes(f, tt.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dec, err := decodeBytes(f, enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !near(dec, tt.raw, 3) {
+			t.Errorf("colors %d: roundtrip mismatch: got % x", tt.colors, dec[:tt.colors])
+		}
+	}
+}
+
+func TestDCTColorTransform(t *testing.T) {
+
+	raw := solid(8*8, 200, 100, 50)
+
+	f, _ := NewDCTEncoder(Parms{"Columns": 8, "Colors": 3}, 100)
+	enc, err := encodeBytes(f, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y, cb, cr := color.RGBToYCbCr(200, 100, 50)
+	ycc := solid(8*8, y, cb, cr)
+
+	for _, tt := range []struct {
+		name  string
+		enc   []byte
+		parms Parms
+		want  []byte
+	}{
+		{"default", enc, nil, raw},
+		{"no transform", enc, Parms{"ColorTransform": 0}, ycc},
+		{"APP14 precedence", withAdobeMarker(enc, 1), Parms{"ColorTransform": 0}, raw},
+	} {
+		f, err := NewFilter(DCT, tt.parms)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dec, err := decodeBytes(f, tt.enc)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if !near(dec, tt.want, 3) {
+			t.Errorf("%s: got % x, want % x", tt.name, dec[:3], tt.want[:3])
+		}
+	}
+
+	if hasAdobeMarker(enc) || !hasAdobeMarker(withAdobeMarker(enc, 0)) {
+		t.Error("hasAdobeMarker: unexpected result")
+	}
+}
+
+func TestDCTEncodeErrors(t *testing.T) {
+
+	if _, err := NewDCTEncoder(nil, 0); err == nil {
+		t.Error("missing error for quality 0")
+	}
+
+	for _, parms := range []Parms{
+		nil,
+		{"Columns": 3, "Colors": 4},
+		{"Columns": 3, "Colors": 3, "ColorTransform": 0},
+		{"Columns": 5},
+	} {
+		f, err := NewFilter(DCT, parms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = encodeBytes(f, solid(3, 1, 2, 3)); err == nil {
+			t.Errorf("%v: missing error", parms)
+		}
+	}
+}
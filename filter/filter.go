@@ -20,10 +20,11 @@ package filter
 // See 7.4 for a list of defined filter pdfcpu.
 
 import (
-	"bytes"
+	"bufio"
 	"errors"
-	"fmt"
 	"io"
+	"sort"
+	"sync"
 )
 
 // PDF defines the following filters.
@@ -37,6 +38,7 @@ const (
 	JBIG2     = "JBIG2Decode"
 	DCT       = "DCTDecode"
 	JPX       = "JPXDecode"
+	Crypt     = "Crypt"
 )
 
 var (
@@ -45,16 +47,54 @@ var (
 	ErrUnsupportedFilter = errors.New("pdfcpu: filter not supported")
 )
 
-// Filter defines an interface for encoding/decoding buffers.
+// Filter defines an interface for encoding/decoding streams.
 type Filter interface {
-	Encode(r io.Reader) (*bytes.Buffer, error)
-	Decode(r io.Reader) (*bytes.Buffer, error)
-	//Encode(r io.Reader, w io.Writer) error
-	//Decode(r io.Reader, w io.Writer) error
+	// Encode reads data from r and writes the encoded data to w.
+	Encode(r io.Reader, w io.Writer) error
+	// Decode reads encoded data from r and writes the decoded data to w.
+	Decode(r io.Reader, w io.Writer) error
 }
 
-// NewFilter returns a filter for given filterName and an optional parameter dictionary.
-func NewFilter(filterName string, parms map[string]int) (filter Filter, err error) {
+// Factory returns a filter for given decode parameters.
+type Factory func(parms Parms) (Filter, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a filter implementation available under filterName.
+// A registered filter takes precedence over the built-in filter of the same name,
+// registering a nil Factory restores the built-in filter.
+func Register(filterName string, f Factory) {
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if f == nil {
+		delete(registry, filterName)
+		return
+	}
+
+	registry[filterName] = f
+}
+
+func registered(filterName string) Factory {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry[filterName]
+}
+
+// NewFilter returns a filter for given filterName and optional decode parameters.
+func NewFilter(filterName string, parms Parms) (filter Filter, err error) {
+
+	if err = parms.Validate(filterName); err != nil {
+		return nil, err
+	}
+
+	if f := registered(filterName); f != nil {
+		return f(parms)
+	}
 
 	switch filterName {
 
@@ -71,19 +111,19 @@ func NewFilter(filterName string, parms map[string]int) (filter Filter, err erro
 		filter = lzwDecode{baseFilter{parms}}
 
 	case Flate:
-		filter = flate{baseFilter{parms}}
+		filter = flate{baseFilter: baseFilter{parms}}
 
 	case CCITTFax:
 		filter = ccittDecode{baseFilter{parms}}
-	case DCT:
-		// Unsupported
-		fallthrough
+
 	case JBIG2:
-		// Unsupported
-		fallthrough
+		filter = jbig2Decode{baseFilter{parms}}
+
+	case DCT:
+		filter = dctDecode{baseFilter: baseFilter{parms}}
+
 	case JPX:
 		// Unsupported
-		fmt.Printf("Filter not supported: <%s>", filterName)
 		err = ErrUnsupportedFilter
 	default:
 		err = errors.New("Invalid filter: " + filterName)
@@ -92,12 +132,79 @@ func NewFilter(filterName string, parms map[string]int) (filter Filter, err erro
 	return filter, err
 }
 
-// List return the list of all supported PDF filters.
+// List return the list of all supported PDF filters including registered filters.
 func List() []string {
+
 	// Exclude CCITTFax, DCT, JBIG2 & JPX since they only makes sense in the context of image processing.
-	return []string{ASCII85, ASCIIHex, RunLength, LZW, Flate}
+	list := []string{ASCII85, ASCIIHex, RunLength, LZW, Flate}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+	for name := range registry {
+		if !memberOf(name, list) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return append(list, names...)
+}
+
+func memberOf(s string, list []string) bool {
+	for _, v := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
 }
 
 type baseFilter struct {
-	parms map[string]int
+	parms Parms
+}
+
+// eodReader reads from r up to an end of data marker.
+type eodReader struct {
+	r     *bufio.Reader
+	eod   byte
+	found bool
+}
+
+func newEODReader(r io.Reader, eod byte) *eodReader {
+	return &eodReader{r: bufio.NewReader(r), eod: eod}
+}
+
+func (er *eodReader) Read(p []byte) (int, error) {
+
+	if er.found {
+		return 0, io.EOF
+	}
+
+	n := 0
+
+	for n < len(p) {
+
+		c, err := er.r.ReadByte()
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+
+		if c == er.eod {
+			er.found = true
+			if n == 0 {
+				return 0, io.EOF
+			}
+			break
+		}
+
+		p[n] = c
+		n++
+	}
+
+	return n, nil
 }
@@ -0,0 +1,257 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+// Block-parallel Flate compression producing a single zlib stream (see RFC 1950, RFC 1951).
+// Each block is compressed independently using the trailing 32K of the preceding block as dictionary
+// and ends with a sync flush so compressed blocks can be concatenated.
+
+import (
+	"bytes"
+	stdflate "compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/adler32"
+	"io"
+)
+
+const (
+	// DefaultFlateBlockSize is the default number of uncompressed bytes per block for parallel compression.
+	DefaultFlateBlockSize = 1 << 20
+
+	// The size of the deflate sliding window.
+	flateWindowSize = 32 << 10
+
+	// The modulus used by Adler-32.
+	adlerBase = 65521
+)
+
+// NewParallelFlate returns a Flate filter encoding blocks of blockSize bytes using up to workers goroutines.
+// If a Flate filter has been registered it is returned instead.
+func NewParallelFlate(parms Parms, blockSize, workers int) (Filter, error) {
+
+	if blockSize < flateWindowSize {
+		return nil, errors.New("pdfcpu: filter FlateDecode: block size must be >= 32K")
+	}
+
+	if workers < 1 {
+		return nil, errors.New("pdfcpu: filter FlateDecode: workers must be > 0")
+	}
+
+	if err := parms.Validate(Flate); err != nil {
+		return nil, err
+	}
+
+	if f := registered(Flate); f != nil {
+		return f(parms)
+	}
+
+	return flate{baseFilter: baseFilter{parms}, blockSize: blockSize, workers: workers}, nil
+}
+
+// adler32Combine returns the Adler-32 checksum of the concatenation of two byte sequences
+// given their checksums adler1 and adler2 and the length of the second sequence.
+func adler32Combine(adler1, adler2 uint32, len2 int) uint32 {
+
+	rem := uint32(len2 % adlerBase)
+
+	sum1 := adler1 & 0xFFFF
+	sum2 := rem * sum1 % adlerBase
+
+	sum1 += adler2&0xFFFF + adlerBase - 1
+	sum2 += adler1>>16 + adler2>>16 + adlerBase - rem
+
+	if sum1 >= adlerBase {
+		sum1 -= adlerBase
+	}
+	if sum1 >= adlerBase {
+		sum1 -= adlerBase
+	}
+	if sum2 >= adlerBase<<1 {
+		sum2 -= adlerBase << 1
+	}
+	if sum2 >= adlerBase {
+		sum2 -= adlerBase
+	}
+
+	return sum2<<16 | sum1
+}
+
+// flateBlock represents a block being compressed.
+type flateBlock struct {
+	data []byte
+	dict []byte
+	last bool
+	out  bytes.Buffer
+	sum  uint32
+	done chan error
+}
+
+func (b *flateBlock) compress() error {
+
+	b.sum = adler32.Checksum(b.data)
+
+	fw, err := stdflate.NewWriterDict(&b.out, stdflate.DefaultCompression, b.dict)
+	if err != nil {
+		return err
+	}
+
+	if _, err = fw.Write(b.data); err != nil {
+		return err
+	}
+
+	if b.last {
+		return fw.Close()
+	}
+
+	// A sync flush terminates the block on a byte boundary without marking it final.
+	return fw.Flush()
+}
+
+// readBlocks reads r in blocks and starts compressing each block using at most workers goroutines.
+// The blocks are sent to blocks in stream order.
+func (f flate) readBlocks(r io.Reader, blocks chan<- *flateBlock, quit <-chan struct{}) error {
+
+	defer close(blocks)
+
+	sem := make(chan struct{}, f.workers)
+
+	var prev []byte
+
+	buf := make([]byte, f.blockSize)
+	n, err := io.ReadFull(r, buf)
+
+	for {
+
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		b := &flateBlock{data: buf[:n], last: err != nil, done: make(chan error, 1)}
+
+		if !b.last {
+			// Read ahead in order to detect the last block.
+			buf = make([]byte, f.blockSize)
+			n, err = io.ReadFull(r, buf)
+			b.last = err == io.EOF
+		}
+
+		if len(prev) > flateWindowSize {
+			prev = prev[len(prev)-flateWindowSize:]
+		}
+		b.dict = prev
+		prev = b.data
+
+		select {
+		case sem <- struct{}{}:
+		case <-quit:
+			return nil
+		}
+
+		go func(b *flateBlock) {
+			b.done <- b.compress()
+			<-sem
+		}(b)
+
+		select {
+		case blocks <- b:
+		case <-quit:
+			return nil
+		}
+
+		if b.last {
+			return nil
+		}
+	}
+}
+
+// encodeParallel compresses r into a zlib stream using block-parallel compression.
+func (f flate) encodeParallel(r io.Reader, w io.Writer) error {
+
+	// zlib header: deflate with 32K window, default compression, no dictionary.
+	if _, err := w.Write([]byte{0x78, 0x9C}); err != nil {
+		return err
+	}
+
+	blocks := make(chan *flateBlock, f.workers)
+	quit := make(chan struct{})
+	readErr := make(chan error, 1)
+
+	go func() {
+		readErr <- f.readBlocks(r, blocks, quit)
+	}()
+
+	sum := uint32(1)
+
+	var err error
+
+	for b := range blocks {
+		if err == nil {
+			err = <-b.done
+		}
+		if err == nil {
+			_, err = w.Write(b.out.Bytes())
+		}
+		if err != nil {
+			// Stop reading and drain pending blocks.
+			select {
+			case <-quit:
+			default:
+				close(quit)
+			}
+			continue
+		}
+		sum = adler32Combine(sum, b.sum, len(b.data))
+	}
+
+	if e := <-readErr; err == nil {
+		err = e
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var trailer [4]byte
+	binary.BigEndian.PutUint32(trailer[:], sum)
+
+	_, err = w.Write(trailer[:])
+
+	return err
+}
+
+// encodeParallelPredicted applies the optional predictor and compresses the result using block-parallel compression.
+func (f flate) encodeParallelPredicted(r io.Reader, w io.Writer) error {
+
+	p := f.predictor()
+	if p.p == PredictorNo {
+		return f.encodeParallel(r, w)
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(p.encode(r, pw))
+	}()
+
+	err := f.encodeParallel(pr, w)
+
+	// Unblock the predictor if compression failed.
+	pr.CloseWithError(io.ErrClosedPipe)
+
+	return err
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"hash/adler32"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestAdler32Combine(t *testing.T) {
+
+	b := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(b)
+
+	for _, i := range []int{0, 1, 5552, 65521, 65522, 99999, 100000} {
+		got := adler32Combine(adler32.Checksum(b[:i]), adler32.Checksum(b[i:]), len(b)-i)
+		if want := adler32.Checksum(b); got != want {
+			t.Errorf("split %d: got %08x, want %08x", i, got, want)
+		}
+	}
+}
+
+func TestParallelFlate(t *testing.T) {
+
+	const blockSize = flateWindowSize
+
+	rnd := rand.New(rand.NewSource(2))
+
+	for _, size := range []int{0, 1, blockSize - 1, blockSize, 3*blockSize + blockSize/2, 10 * blockSize} {
+		for _, workers := range []int{1, 4} {
+			for _, predictor := range []int{PredictorNo, PredictorOptimum} {
+
+				// Compressible data with references across block boundaries.
+				raw := make([]byte, size)
+				for i := range raw {
+					raw[i] = byte(rnd.Intn(4))
+				}
+
+				parms := Parms{"Predictor": predictor, "Columns": 64}
+				if predictor != PredictorNo {
+					raw = raw[:size/64*64]
+				}
+
+				f, err := NewParallelFlate(parms, blockSize, workers)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				enc, err := encodeBytes(f, raw)
+				if err != nil {
+					t.Fatalf("size %d workers %d: %v", size, workers, err)
+				}
+
+				// The result is a valid zlib stream including its checksum.
+				zr, err := zlib.NewReader(bytes.NewReader(enc))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err = ioutil.ReadAll(zr); err != nil {
+					t.Fatalf("size %d workers %d: %v", size, workers, err)
+				}
+
+				dec, err := decodeBytes(f, enc)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(dec, raw) {
+					t.Errorf("size %d workers %d predictor %d: roundtrip mismatch", size, workers, predictor)
+				}
+			}
+		}
+	}
+}
+
+type failingReader struct {
+	n   int
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, r.err
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	r.n -= len(p)
+	return len(p), nil
+}
+
+func TestParallelFlateReadError(t *testing.T) {
+
+	errRead := errors.New("read failed")
+
+	f, _ := NewParallelFlate(nil, flateWindowSize, 4)
+
+	err := f.Encode(&failingReader{n: 5 * flateWindowSize, err: errRead}, ioutil.Discard)
+	if err != errRead {
+		t.Errorf("got error %v, want %v", err, errRead)
+	}
+
+	if err = f.Encode(&failingReader{n: 1 << 20, err: io.EOF}, errWriter{}); err == nil {
+		t.Error("missing write error")
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
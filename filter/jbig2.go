@@ -0,0 +1,287 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+// JBIG2 arithmetic decoding and generic region decoding (ITU-T T.88, 6.2 and Annex E).
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+type qe struct {
+	qe         uint32
+	nmps, nlps uint8
+	switchFlag bool
+}
+
+// T.88 Table E.1: Qe values and probability estimation.
+var qeTable = []qe{
+	{0x5601, 1, 1, true}, {0x3401, 2, 6, false}, {0x1801, 3, 9, false}, {0x0AC1, 4, 12, false},
+	{0x0521, 5, 29, false}, {0x0221, 38, 33, false}, {0x5601, 7, 6, true}, {0x5401, 8, 14, false},
+	{0x4801, 9, 14, false}, {0x3801, 10, 14, false}, {0x3001, 11, 17, false}, {0x2401, 12, 18, false},
+	{0x1C01, 13, 20, false}, {0x1601, 29, 21, false}, {0x5601, 15, 14, true}, {0x5401, 16, 14, false},
+	{0x5101, 17, 15, false}, {0x4801, 18, 16, false}, {0x3801, 19, 17, false}, {0x3401, 20, 18, false},
+	{0x3001, 21, 19, false}, {0x2801, 22, 19, false}, {0x2401, 23, 20, false}, {0x2201, 24, 21, false},
+	{0x1C01, 25, 22, false}, {0x1801, 26, 23, false}, {0x1601, 27, 24, false}, {0x1401, 28, 25, false},
+	{0x1201, 29, 26, false}, {0x1101, 30, 27, false}, {0x0AC1, 31, 28, false}, {0x09C1, 32, 29, false},
+	{0x08A1, 33, 30, false}, {0x0521, 34, 31, false}, {0x0441, 35, 32, false}, {0x02A1, 36, 33, false},
+	{0x0221, 37, 34, false}, {0x0141, 38, 35, false}, {0x0111, 39, 36, false}, {0x0085, 40, 37, false},
+	{0x0049, 41, 38, false}, {0x0025, 42, 39, false}, {0x0015, 43, 40, false}, {0x0009, 44, 41, false},
+	{0x0005, 45, 42, false}, {0x0001, 45, 43, false}, {0x5601, 46, 46, false},
+}
+
+// arithContext holds the state of a context as index into qeTable << 1 | MPS.
+type arithContexts []uint8
+
+// arithDecoder implements the MQ decoder (see E.3).
+type arithDecoder struct {
+	b  []byte
+	bp int
+	c  uint32
+	a  uint32
+	ct int
+}
+
+func newArithDecoder(b []byte) *arithDecoder {
+	d := &arithDecoder{b: b}
+	d.c = uint32(d.byteAt(0)) << 16
+	d.byteIn()
+	d.c <<= 7
+	d.ct -= 7
+	d.a = 0x8000
+	return d
+}
+
+// byteAt returns 0xFF beyond the end of data.
+func (d *arithDecoder) byteAt(i int) byte {
+	if i >= len(d.b) {
+		return 0xFF
+	}
+	return d.b[i]
+}
+
+func (d *arithDecoder) byteIn() {
+	if d.byteAt(d.bp) == 0xFF {
+		if d.byteAt(d.bp+1) > 0x8F {
+			d.c += 0xFF00
+			d.ct = 8
+			return
+		}
+		d.bp++
+		d.c += uint32(d.byteAt(d.bp)) << 9
+		d.ct = 7
+		return
+	}
+	d.bp++
+	d.c += uint32(d.byteAt(d.bp)) << 8
+	d.ct = 8
+}
+
+func (d *arithDecoder) renorm() {
+	for {
+		if d.ct == 0 {
+			d.byteIn()
+		}
+		d.a <<= 1
+		d.c <<= 1
+		d.ct--
+		if d.a&0x8000 != 0 {
+			return
+		}
+	}
+}
+
+// decode decodes a bit using the context cx.
+func (d *arithDecoder) decode(cx arithContexts, i int) int {
+
+	idx, mps := cx[i]>>1, int(cx[i]&1)
+	q := qeTable[idx]
+
+	var bit int
+
+	d.a -= q.qe
+
+	if d.c>>16 < q.qe {
+		// LPS exchange
+		if d.a < q.qe {
+			bit = mps
+			idx = q.nmps
+		} else {
+			bit = 1 - mps
+			if q.switchFlag {
+				mps = bit
+			}
+			idx = q.nlps
+		}
+		d.a = q.qe
+	} else {
+		d.c -= q.qe << 16
+		if d.a&0x8000 != 0 {
+			return mps
+		}
+		// MPS exchange
+		if d.a < q.qe {
+			bit = 1 - mps
+			if q.switchFlag {
+				mps = bit
+			}
+			idx = q.nlps
+		} else {
+			bit = mps
+			idx = q.nmps
+		}
+	}
+
+	cx[i] = idx<<1 | uint8(mps)
+	d.renorm()
+
+	return bit
+}
+
+// bitmap represents a JBIG2 bitmap with one byte per pixel, 1 = black.
+type bitmap struct {
+	w, h int
+	b    []byte
+}
+
+func newBitmap(w, h int) *bitmap {
+	return &bitmap{w: w, h: h, b: make([]byte, w*h)}
+}
+
+// pixel returns the pixel at x,y or 0 if outside the bitmap.
+func (bm *bitmap) pixel(x, y int) byte {
+	if x < 0 || x >= bm.w || y < 0 || y >= bm.h {
+		return 0
+	}
+	return bm.b[y*bm.w+x]
+}
+
+type point struct {
+	x, y int
+}
+
+// Generic region templates without adaptive template pixels (see 6.2.5.3).
+var genericTemplates = [][]point{
+	{{-1, -2}, {0, -2}, {1, -2}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1}, {-4, 0}, {-3, 0}, {-2, 0}, {-1, 0}},
+	{{-1, -2}, {0, -2}, {1, -2}, {2, -2}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1}, {-3, 0}, {-2, 0}, {-1, 0}},
+	{{-1, -2}, {0, -2}, {1, -2}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {-2, 0}, {-1, 0}},
+	{{-3, -1}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {-4, 0}, {-3, 0}, {-2, 0}, {-1, 0}},
+}
+
+// Contexts used for decoding the typical prediction bit SLTP (see 6.2.5.7).
+var tpgdonContexts = []int{0x9B25, 0x0795, 0x00E5, 0x0195}
+
+// genericRegion represents the parameters of the generic region decoding procedure (see 6.2.2).
+type genericRegion struct {
+	w, h     int
+	mmr      bool
+	template int
+	tpgdon   bool
+	at       []point
+}
+
+// contextTemplate returns the template pixels including adaptive pixels,
+// ordered from the most significant to the least significant context bit.
+func (gr *genericRegion) contextTemplate() ([]point, error) {
+
+	if gr.template < 0 || gr.template > 3 {
+		return nil, errors.New("pdfcpu: jbig2: invalid generic region template")
+	}
+
+	t := append([]point{}, genericTemplates[gr.template]...)
+
+	for _, p := range gr.at {
+		if p.y > 0 || p.y == 0 && p.x >= 0 {
+			return nil, errors.New("pdfcpu: jbig2: invalid adaptive template pixel")
+		}
+		t = append(t, p)
+	}
+
+	sort.SliceStable(t, func(i, j int) bool {
+		if t[i].y != t[j].y {
+			return t[i].y < t[j].y
+		}
+		return t[i].x < t[j].x
+	})
+
+	return t, nil
+}
+
+func (gr *genericRegion) decodeMMR(data []byte) (*bitmap, error) {
+
+	p := &ccittParms{k: -1, columns: gr.w, rows: gr.h, endOfBlock: true, blackIs1: true}
+
+	var buf bytes.Buffer
+	if err := p.decode(data, &buf); err != nil {
+		return nil, err
+	}
+
+	b := buf.Bytes()
+	bm := newBitmap(gr.w, gr.h)
+	rowLen := (gr.w + 7) / 8
+
+	for y := 0; y < gr.h && (y+1)*rowLen <= len(b); y++ {
+		for x := 0; x < gr.w; x++ {
+			bm.b[y*gr.w+x] = b[y*rowLen+x>>3] >> (7 - uint(x&7)) & 1
+		}
+	}
+
+	return bm, nil
+}
+
+func (gr *genericRegion) decode(data []byte) (*bitmap, error) {
+
+	if gr.mmr {
+		return gr.decodeMMR(data)
+	}
+
+	t, err := gr.contextTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	bm := newBitmap(gr.w, gr.h)
+	cx := make(arithContexts, 1<<uint(len(t)))
+	d := newArithDecoder(data)
+
+	ltp := 0
+
+	for y := 0; y < gr.h; y++ {
+
+		if gr.tpgdon {
+			ltp ^= d.decode(cx, tpgdonContexts[gr.template])
+			if ltp == 1 {
+				if y > 0 {
+					copy(bm.b[y*gr.w:(y+1)*gr.w], bm.b[(y-1)*gr.w:y*gr.w])
+				}
+				continue
+			}
+		}
+
+		for x := 0; x < gr.w; x++ {
+			c := 0
+			for _, p := range t {
+				c = c<<1 | int(bm.pixel(x+p.x, y+p.y))
+			}
+			bm.b[y*gr.w+x] = byte(d.decode(cx, c))
+		}
+	}
+
+	return bm, nil
+}
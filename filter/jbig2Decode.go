@@ -0,0 +1,519 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// JBIG2 segment types (see 7.3).
+const (
+	segSymbolDictionary                = 0
+	segIntermediateTextRegion          = 4
+	segImmediateTextRegion             = 6
+	segImmediateLosslessTextRegion     = 7
+	segPatternDictionary               = 16
+	segIntermediateHalftoneRegion      = 20
+	segImmediateHalftoneRegion         = 22
+	segImmediateLosslessHalftoneRegion = 23
+	segIntermediateGenericRegion       = 36
+	segImmediateGenericRegion          = 38
+	segImmediateLosslessGenericRegion  = 39
+	segIntermediateRefinementRegion    = 40
+	segImmediateRefinementRegion       = 42
+	segImmediateLosslessRefinement     = 43
+	segPageInformation                 = 48
+	segEndOfPage                       = 49
+	segEndOfStripe                     = 50
+	segEndOfFile                       = 51
+	segProfiles                        = 52
+	segTables                          = 53
+	segExtension                       = 62
+)
+
+var errJBIG2Corrupt = errors.New("pdfcpu: jbig2: corrupt segment data")
+
+// The maximum number of pixels of a page or region bitmap to be decoded.
+const maxImagePixels = 1 << 28
+
+// validSize returns true if a bitmap of w x h pixels may be allocated.
+func validSize(w, h int) bool {
+	if w < 0 || h < 0 || w > 1<<20 || h > 1<<20 {
+		return false
+	}
+	return h == 0 || w <= maxImagePixels/h
+}
+
+type jbig2Decode struct {
+	baseFilter
+}
+
+type segmentHeader struct {
+	nr         uint32
+	typ        int
+	pageAssoc  uint32
+	dataLength uint32 // 0xFFFFFFFF = unknown
+}
+
+// jbig2Page represents the page being composed.
+type jbig2Page struct {
+	*bitmap
+	def           byte
+	unknownHeight bool
+}
+
+// jbig2Reader parses JBIG2 segments in sequential organization as embedded in PDF (see 7.4.7 of ISO 32000-1).
+type jbig2Reader struct {
+	b    []byte
+	pos  int
+	page *jbig2Page
+}
+
+func (r *jbig2Reader) need(n int) error {
+	if n < 0 || r.pos+n > len(r.b) {
+		return errJBIG2Corrupt
+	}
+	return nil
+}
+
+func (r *jbig2Reader) uint8() (uint8, error) {
+	if err := r.need(1); err != nil {
+		return 0, err
+	}
+	v := r.b[r.pos]
+	r.pos++
+	return v, nil
+}
+
+func (r *jbig2Reader) uint32() (uint32, error) {
+	if err := r.need(4); err != nil {
+		return 0, err
+	}
+	v := binary.BigEndian.Uint32(r.b[r.pos:])
+	r.pos += 4
+	return v, nil
+}
+
+// segmentHeader parses a segment header (see 7.2).
+func (r *jbig2Reader) segmentHeader() (*segmentHeader, error) {
+
+	nr, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := r.uint8()
+	if err != nil {
+		return nil, err
+	}
+
+	sh := &segmentHeader{nr: nr, typ: int(flags & 0x3F)}
+
+	// Referred-to segment count and retention flags
+	b, err := r.uint8()
+	if err != nil {
+		return nil, err
+	}
+
+	count := int(b >> 5)
+	if count == 7 {
+		// long form
+		r.pos--
+		c, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		count = int(c & 0x1FFFFFFF)
+		if err = r.need((count + 8) / 8); err != nil {
+			return nil, err
+		}
+		r.pos += (count + 8) / 8
+	}
+
+	// Referred-to segment numbers
+	size := 1
+	if nr > 65536 {
+		size = 4
+	} else if nr > 256 {
+		size = 2
+	}
+	if err = r.need(count * size); err != nil {
+		return nil, err
+	}
+	r.pos += count * size
+
+	// Segment page association
+	if flags&0x40 > 0 {
+		sh.pageAssoc, err = r.uint32()
+	} else {
+		var pa uint8
+		pa, err = r.uint8()
+		sh.pageAssoc = uint32(pa)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sh.dataLength, err = r.uint32()
+
+	return sh, err
+}
+
+// regionInfo represents a region segment information field (see 7.4.1).
+type regionInfo struct {
+	w, h, x, y int
+	op         int
+}
+
+func (r *jbig2Reader) regionInfo() (*regionInfo, error) {
+
+	var v [4]uint32
+
+	for i := range v {
+		u, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		v[i] = u
+	}
+
+	flags, err := r.uint8()
+	if err != nil {
+		return nil, err
+	}
+
+	ri := &regionInfo{w: int(v[0]), h: int(v[1]), x: int(int32(v[2])), y: int(int32(v[3])), op: int(flags & 0x07)}
+	if !validSize(ri.w, ri.h) {
+		return nil, errJBIG2Corrupt
+	}
+
+	return ri, nil
+}
+
+// unknownDataLength returns the length of the remaining data of an immediate generic region segment
+// with unknown data length and the number of rows it contains (see 7.2.7).
+func (r *jbig2Reader) unknownDataLength(mmr bool) (int, int, error) {
+
+	marker := []byte{0xFF, 0xAC}
+	if mmr {
+		marker = []byte{0x00, 0x00}
+	}
+
+	i := bytes.Index(r.b[r.pos:], marker)
+	if i < 0 || r.pos+i+6 > len(r.b) {
+		return 0, 0, errJBIG2Corrupt
+	}
+
+	rows := binary.BigEndian.Uint32(r.b[r.pos+i+2:])
+
+	return i + 6, int(rows), nil
+}
+
+func (r *jbig2Reader) genericRegion(sh *segmentHeader) error {
+
+	start := r.pos
+
+	ri, err := r.regionInfo()
+	if err != nil {
+		return err
+	}
+
+	flags, err := r.uint8()
+	if err != nil {
+		return err
+	}
+
+	gr := &genericRegion{
+		w:        ri.w,
+		h:        ri.h,
+		mmr:      flags&0x01 > 0,
+		template: int(flags>>1) & 0x03,
+		tpgdon:   flags&0x08 > 0,
+	}
+
+	if flags&0x10 > 0 {
+		return errors.New("pdfcpu: jbig2: extended reference template not supported")
+	}
+
+	if !gr.mmr {
+		n := 1
+		if gr.template == 0 {
+			n = 4
+		}
+		for i := 0; i < n; i++ {
+			if err = r.need(2); err != nil {
+				return err
+			}
+			gr.at = append(gr.at, point{int(int8(r.b[r.pos])), int(int8(r.b[r.pos+1]))})
+			r.pos += 2
+		}
+	}
+
+	var l int
+
+	if sh.dataLength == 0xFFFFFFFF {
+		l, gr.h, err = r.unknownDataLength(gr.mmr)
+		if err != nil {
+			return err
+		}
+		ri.h = gr.h
+	} else {
+		l = int(sh.dataLength) - (r.pos - start)
+	}
+
+	if err = r.need(l); err != nil {
+		return err
+	}
+
+	bm, err := gr.decode(r.b[r.pos : r.pos+l])
+	if err != nil {
+		return err
+	}
+
+	r.pos += l
+
+	if sh.typ == segIntermediateGenericRegion {
+		// Intermediate results are only used by refinement regions.
+		return nil
+	}
+
+	return r.compose(bm, ri)
+}
+
+// pageInformation parses a page information segment (see 7.4.8).
+func (r *jbig2Reader) pageInformation() error {
+
+	w, err := r.uint32()
+	if err != nil {
+		return err
+	}
+
+	h, err := r.uint32()
+	if err != nil {
+		return err
+	}
+
+	// Skip resolution.
+	if err = r.need(8); err != nil {
+		return err
+	}
+	r.pos += 8
+
+	flags, err := r.uint8()
+	if err != nil {
+		return err
+	}
+
+	p := &jbig2Page{def: flags >> 2 & 0x01}
+
+	if h == 0xFFFFFFFF {
+		h = 0
+		p.unknownHeight = true
+	}
+
+	if !validSize(int(w), int(h)) {
+		return errJBIG2Corrupt
+	}
+
+	p.bitmap = newBitmap(int(w), int(h))
+	if p.def == 1 {
+		for i := range p.b {
+			p.b[i] = 1
+		}
+	}
+
+	r.page = p
+
+	return nil
+}
+
+// growPage extends a page of unknown height to h rows.
+func (r *jbig2Reader) growPage(h int) error {
+
+	p := r.page
+	if !p.unknownHeight || h <= p.h {
+		return nil
+	}
+
+	if !validSize(p.w, h) {
+		return errJBIG2Corrupt
+	}
+
+	b := make([]byte, p.w*h)
+	copy(b, p.b)
+	for i := len(p.b); i < len(b); i++ {
+		b[i] = p.def
+	}
+
+	p.b, p.h = b, h
+
+	return nil
+}
+
+// compose combines a region bitmap with the page using the region's external combination operator (see 7.4.1.5).
+func (r *jbig2Reader) compose(bm *bitmap, ri *regionInfo) error {
+
+	if r.page == nil {
+		return errors.New("pdfcpu: jbig2: missing page information")
+	}
+
+	if err := r.growPage(ri.y + bm.h); err != nil {
+		return err
+	}
+
+	p := r.page
+
+	for y := 0; y < bm.h; y++ {
+		py := ri.y + y
+		if py < 0 || py >= p.h {
+			continue
+		}
+		for x := 0; x < bm.w; x++ {
+			px := ri.x + x
+			if px < 0 || px >= p.w {
+				continue
+			}
+			dst, src := &p.b[py*p.w+px], bm.b[y*bm.w+x]
+			switch ri.op {
+			case 0:
+				*dst |= src
+			case 1:
+				*dst &= src
+			case 2:
+				*dst ^= src
+			case 3:
+				*dst = 1 - (*dst ^ src)
+			case 4:
+				*dst = src
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *jbig2Reader) decodeSegments() error {
+
+	for r.pos < len(r.b) {
+
+		sh, err := r.segmentHeader()
+		if err != nil {
+			return err
+		}
+
+		start := r.pos
+
+		switch sh.typ {
+
+		case segPageInformation:
+			err = r.pageInformation()
+
+		case segImmediateGenericRegion, segImmediateLosslessGenericRegion, segIntermediateGenericRegion:
+			err = r.genericRegion(sh)
+
+		case segEndOfStripe:
+			var y uint32
+			if y, err = r.uint32(); err == nil && r.page != nil {
+				err = r.growPage(int(y) + 1)
+			}
+
+		case segEndOfPage, segEndOfFile:
+			return nil
+
+		case segSymbolDictionary, segPatternDictionary, segTables, segProfiles, segExtension:
+			// Dictionaries are only used by unsupported region types.
+			if sh.dataLength == 0xFFFFFFFF {
+				return errJBIG2Corrupt
+			}
+
+		case segIntermediateTextRegion, segImmediateTextRegion, segImmediateLosslessTextRegion,
+			segIntermediateHalftoneRegion, segImmediateHalftoneRegion, segImmediateLosslessHalftoneRegion,
+			segIntermediateRefinementRegion, segImmediateRefinementRegion, segImmediateLosslessRefinement:
+			return ErrUnsupportedFilter
+
+		default:
+			return fmt.Errorf("pdfcpu: jbig2: invalid segment type %d", sh.typ)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if sh.dataLength != 0xFFFFFFFF {
+			if err = r.need(start + int(sh.dataLength) - r.pos); err != nil {
+				return err
+			}
+			r.pos = start + int(sh.dataLength)
+		}
+	}
+
+	return nil
+}
+
+// Encode implements encoding for a JBIG2Decode filter.
+func (f jbig2Decode) Encode(r io.Reader, w io.Writer) error {
+	return errors.New("pdfcpu: jbig2: encoding not supported")
+}
+
+// Decode implements decoding for a JBIG2Decode filter.
+// The segments of the decode parameter "JBIG2Globals" precede the segments of the page.
+func (f jbig2Decode) Decode(r io.Reader, w io.Writer) error {
+
+	if globals := f.parms.Stream("JBIG2Globals"); globals != nil {
+		r = io.MultiReader(bytes.NewReader(globals), r)
+	}
+
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	rd := &jbig2Reader{b: p}
+
+	if err = rd.decodeSegments(); err != nil {
+		return err
+	}
+
+	if rd.page == nil {
+		return errors.New("pdfcpu: jbig2: missing page information")
+	}
+
+	// Pack pixels, 1 bits are white and 0 bits are black.
+	pg := rd.page
+	row := make([]byte, (pg.w+7)/8)
+
+	for y := 0; y < pg.h; y++ {
+		for i := range row {
+			row[i] = 0xFF
+		}
+		for x := 0; x < pg.w; x++ {
+			if pg.b[y*pg.w+x] == 1 {
+				row[x>>3] &^= 0x80 >> uint(x&7)
+			}
+		}
+		if _, err = w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,439 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// arithEncoder implements the MQ encoder (see E.2).
+type arithEncoder struct {
+	out []byte // out[0] is the byte preceding the coded data
+	c   uint32
+	a   uint32
+	ct  int
+}
+
+func newArithEncoder() *arithEncoder {
+	return &arithEncoder{out: []byte{0}, a: 0x8000, ct: 12}
+}
+
+func (e *arithEncoder) byteOut() {
+	b := &e.out[len(e.out)-1]
+	if *b == 0xFF {
+		e.out = append(e.out, byte(e.c>>20))
+		e.c &= 0xFFFFF
+		e.ct = 7
+		return
+	}
+	if e.c < 0x8000000 {
+		e.out = append(e.out, byte(e.c>>19))
+		e.c &= 0x7FFFF
+		e.ct = 8
+		return
+	}
+	*b++
+	if *b == 0xFF {
+		e.c &= 0x7FFFFFF
+		e.out = append(e.out, byte(e.c>>20))
+		e.c &= 0xFFFFF
+		e.ct = 7
+		return
+	}
+	e.out = append(e.out, byte(e.c>>19))
+	e.c &= 0x7FFFF
+	e.ct = 8
+}
+
+func (e *arithEncoder) renorm() {
+	for {
+		e.a <<= 1
+		e.c <<= 1
+		e.ct--
+		if e.ct == 0 {
+			e.byteOut()
+		}
+		if e.a&0x8000 != 0 {
+			return
+		}
+	}
+}
+
+func (e *arithEncoder) encode(cx arithContexts, i, bit int) {
+
+	idx, mps := cx[i]>>1, int(cx[i]&1)
+	q := qeTable[idx]
+
+	e.a -= q.qe
+
+	if bit != mps {
+		if e.a < q.qe {
+			e.c += q.qe
+		} else {
+			e.a = q.qe
+		}
+		if q.switchFlag {
+			mps = 1 - mps
+		}
+		cx[i] = q.nlps<<1 | uint8(mps)
+		e.renorm()
+		return
+	}
+
+	if e.a&0x8000 != 0 {
+		e.c += q.qe
+		return
+	}
+	if e.a < q.qe {
+		e.a = q.qe
+	} else {
+		e.c += q.qe
+	}
+	cx[i] = q.nmps<<1 | uint8(mps)
+	e.renorm()
+}
+
+func (e *arithEncoder) flush() []byte {
+	t := e.c + e.a
+	e.c |= 0xFFFF
+	if e.c >= t {
+		e.c -= 0x8000
+	}
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	if e.out[len(e.out)-1] != 0xFF {
+		e.out = append(e.out, 0xFF)
+	}
+	return append(e.out[1:], 0xAC)
+}
+
+func TestArithDecoder(t *testing.T) {
+
+	// T.88 H.2 Test sequence for arithmetic coder
+	raw, _ := hex.DecodeString("000200510000" + "00C0035287" + "2AAAAAAAAA82C02000FCD79EF6BF7FED904F46A3BF")
+	enc, _ := hex.DecodeString("84C73BFCE1A14304" + "0220000041" + "0DBB86F4317FFF88FF37471ADB6ADFFFAC")
+
+	e := newArithEncoder()
+	cx := make(arithContexts, 1)
+	for _, b := range raw {
+		for i := 7; i >= 0; i-- {
+			e.encode(cx, 0, int(b>>uint(i))&1)
+		}
+	}
+	compare(t, e.flush(), enc)
+
+	d := newArithDecoder(enc)
+	cx = make(arithContexts, 1)
+	dec := make([]byte, len(raw))
+	for i := range dec {
+		for j := 0; j < 8; j++ {
+			dec[i] = dec[i]<<1 | byte(d.decode(cx, 0))
+		}
+	}
+	compare(t, dec, raw)
+}
+
+// encodeGeneric encodes bm using generic region decoding procedure parameters gr.
+func encodeGeneric(t *testing.T, gr *genericRegion, bm *bitmap) []byte {
+
+	tmpl, err := gr.contextTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := newArithEncoder()
+	cx := make(arithContexts, 1<<uint(len(tmpl)))
+
+	ltp := 0
+
+	for y := 0; y < bm.h; y++ {
+
+		if gr.tpgdon {
+			same := y > 0 && bytes.Equal(bm.b[y*bm.w:(y+1)*bm.w], bm.b[(y-1)*bm.w:y*bm.w])
+			if !same && y == 0 {
+				same = bytes.Count(bm.b[:bm.w], []byte{0}) == bm.w
+			}
+			sltp := 0
+			if same != (ltp == 1) {
+				sltp = 1
+			}
+			e.encode(cx, tpgdonContexts[gr.template], sltp)
+			ltp ^= sltp
+			if ltp == 1 {
+				continue
+			}
+		}
+
+		for x := 0; x < bm.w; x++ {
+			c := 0
+			for _, p := range tmpl {
+				c = c<<1 | int(bm.pixel(x+p.x, y+p.y))
+			}
+			e.encode(cx, c, int(bm.b[y*bm.w+x]))
+		}
+	}
+
+	return e.flush()
+}
+
+func testJBIG2Bitmap(w, h int) *bitmap {
+
+	bm := newBitmap(w, h)
+	rnd := rand.New(rand.NewSource(int64(w*h + 1)))
+
+	for y := 0; y < h; y++ {
+		switch {
+		case y%7 == 3:
+			// duplicate row
+			if y > 0 {
+				copy(bm.b[y*w:(y+1)*w], bm.b[(y-1)*w:y*w])
+			}
+		default:
+			for x := 0; x < w; x++ {
+				if rnd.Intn(4) == 0 || x > w/2 && y%3 == 0 {
+					bm.b[y*w+x] = 1
+				}
+			}
+		}
+	}
+
+	return bm
+}
+
+func segment(nr uint32, typ int, data []byte, unknownLength bool) []byte {
+
+	var b bytes.Buffer
+
+	binary.Write(&b, binary.BigEndian, nr)
+	b.WriteByte(byte(typ))
+	b.WriteByte(0) // no referred-to segments
+	b.WriteByte(1) // page 1
+
+	l := uint32(len(data))
+	if unknownLength {
+		l = 0xFFFFFFFF
+	}
+	binary.Write(&b, binary.BigEndian, l)
+	b.Write(data)
+
+	return b.Bytes()
+}
+
+func pageInfo(w, h uint32, striped bool) []byte {
+
+	var b bytes.Buffer
+
+	binary.Write(&b, binary.BigEndian, w)
+	binary.Write(&b, binary.BigEndian, h)
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	b.WriteByte(0)
+
+	striping := uint16(0)
+	if striped {
+		striping = 0x8000 | 16
+	}
+	binary.Write(&b, binary.BigEndian, striping)
+
+	return b.Bytes()
+}
+
+func genericRegionSegment(gr *genericRegion, x, y int, op byte, data []byte) []byte {
+
+	var b bytes.Buffer
+
+	binary.Write(&b, binary.BigEndian, uint32(gr.w))
+	binary.Write(&b, binary.BigEndian, uint32(gr.h))
+	binary.Write(&b, binary.BigEndian, uint32(x))
+	binary.Write(&b, binary.BigEndian, uint32(y))
+	b.WriteByte(op)
+
+	flags := byte(gr.template << 1)
+	if gr.mmr {
+		flags |= 0x01
+	}
+	if gr.tpgdon {
+		flags |= 0x08
+	}
+	b.WriteByte(flags)
+
+	for _, p := range gr.at {
+		b.WriteByte(byte(int8(p.x)))
+		b.WriteByte(byte(int8(p.y)))
+	}
+
+	b.Write(data)
+
+	return b.Bytes()
+}
+
+// packed returns the JBIG2Decode filter output for bm.
+func packed(bm *bitmap) []byte {
+
+	rowLen := (bm.w + 7) / 8
+	b := bytes.Repeat([]byte{0xFF}, rowLen*bm.h)
+
+	for y := 0; y < bm.h; y++ {
+		for x := 0; x < bm.w; x++ {
+			if bm.b[y*bm.w+x] == 1 {
+				b[y*rowLen+x>>3] &^= 0x80 >> uint(x&7)
+			}
+		}
+	}
+
+	return b
+}
+
+func decodeJBIG2(t *testing.T, b []byte, parms Parms) []byte {
+
+	t.Helper()
+
+	f, err := NewFilter(JBIG2, parms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := decodeBytes(f, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dec
+}
+
+var defaultAT = [][]point{
+	{{3, -1}, {-3, -1}, {2, -2}, {-2, -2}},
+	{{3, -1}},
+	{{2, -1}},
+	{{2, -1}},
+}
+
+func TestJBIG2GenericRegion(t *testing.T) {
+
+	for template := 0; template < 4; template++ {
+		for _, tpgdon := range []bool{false, true} {
+			for _, unknownLength := range []bool{false, true} {
+
+				bm := testJBIG2Bitmap(37, 29)
+
+				gr := &genericRegion{w: bm.w, h: bm.h, template: template, tpgdon: tpgdon, at: defaultAT[template]}
+
+				data := encodeGeneric(t, gr, bm)
+				if unknownLength {
+					data = append(data, 0, 0, 0, byte(bm.h))
+				}
+
+				var b bytes.Buffer
+				b.Write(segment(0, segPageInformation, pageInfo(uint32(bm.w), uint32(bm.h), false), false))
+				b.Write(segment(1, segImmediateGenericRegion, genericRegionSegment(gr, 0, 0, 0, data), unknownLength))
+				b.Write(segment(2, segEndOfPage, nil, false))
+
+				if !bytes.Equal(decodeJBIG2(t, b.Bytes(), nil), packed(bm)) {
+					t.Errorf("template %d tpgdon %t unknown length %t: mismatch", template, tpgdon, unknownLength)
+				}
+			}
+		}
+	}
+}
+
+func TestJBIG2GenericRegionMMR(t *testing.T) {
+
+	bm := testJBIG2Bitmap(45, 12)
+
+	f, _ := NewFilter(CCITTFax, Parms{"K": -1, "Columns": bm.w})
+
+	enc, err := encodeBytes(f, packed(bm))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gr := &genericRegion{w: bm.w, h: bm.h, mmr: true}
+
+	var b bytes.Buffer
+	b.Write(segment(0, segPageInformation, pageInfo(uint32(bm.w), uint32(bm.h), false), false))
+	b.Write(segment(1, segImmediateLosslessGenericRegion, genericRegionSegment(gr, 0, 0, 0, enc), false))
+
+	compare(t, decodeJBIG2(t, b.Bytes(), nil), packed(bm))
+}
+
+func TestJBIG2StripedPage(t *testing.T) {
+
+	// Two stripes of a page with unknown height combined with a globals page information segment.
+	bm := testJBIG2Bitmap(20, 16)
+
+	top := &bitmap{w: 20, h: 8, b: bm.b[:20*8]}
+	bottom := &bitmap{w: 20, h: 8, b: bm.b[20*8:]}
+
+	gr := &genericRegion{w: 20, h: 8, template: 2, at: defaultAT[2]}
+
+	globals := segment(0, segPageInformation, pageInfo(20, 0xFFFFFFFF, true), false)
+
+	var b bytes.Buffer
+	b.Write(segment(1, segImmediateGenericRegion, genericRegionSegment(gr, 0, 0, 4, encodeGeneric(t, gr, top)), false))
+	b.Write(segment(2, segEndOfStripe, []byte{0, 0, 0, 7}, false))
+	b.Write(segment(3, segImmediateGenericRegion, genericRegionSegment(gr, 0, 8, 4, encodeGeneric(t, gr, bottom)), false))
+	b.Write(segment(4, segEndOfStripe, []byte{0, 0, 0, 15}, false))
+	b.Write(segment(5, segEndOfPage, nil, false))
+
+	compare(t, decodeJBIG2(t, b.Bytes(), Parms{"JBIG2Globals": globals}), packed(bm))
+}
+
+func TestJBIG2UnsupportedSegment(t *testing.T) {
+
+	var b bytes.Buffer
+	b.Write(segment(0, segPageInformation, pageInfo(8, 8, false), false))
+	b.Write(segment(1, segImmediateTextRegion, []byte(strings.Repeat("\x00", 17)), false))
+
+	f, _ := NewFilter(JBIG2, nil)
+	if _, err := decodeBytes(f, b.Bytes()); err != ErrUnsupportedFilter {
+		t.Errorf("expected ErrUnsupportedFilter, got %v", err)
+	}
+}
+
+func TestJBIG2OversizedBitmap(t *testing.T) {
+
+	gr := &genericRegion{w: 1 << 20, h: 1 << 20, template: 2, at: defaultAT[2]}
+
+	for _, tt := range []struct {
+		name string
+		segs [][]byte
+	}{
+		{"page", [][]byte{
+			segment(0, segPageInformation, pageInfo(1<<20, 1<<20, false), false),
+		}},
+		{"region", [][]byte{
+			segment(0, segPageInformation, pageInfo(8, 8, false), false),
+			segment(1, segImmediateGenericRegion, genericRegionSegment(gr, 0, 0, 4, nil), false),
+		}},
+		{"stripe", [][]byte{
+			segment(0, segPageInformation, pageInfo(1<<20, 0xFFFFFFFF, true), false),
+			segment(1, segEndOfStripe, []byte{0, 0x0F, 0xFF, 0xFF}, false),
+		}},
+	} {
+		f, _ := NewFilter(JBIG2, nil)
+		if _, err := decodeBytes(f, bytes.Join(tt.segs, nil)); err != errJBIG2Corrupt {
+			t.Errorf("%s: got %v, want %v", tt.name, err, errJBIG2Corrupt)
+		}
+	}
+}
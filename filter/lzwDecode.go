@@ -17,12 +17,7 @@ limitations under the License.
 package filter
 
 import (
-	"bytes"
-	"fmt"
 	"io"
-	"strconv"
-
-	"errors"
 
 	"github.com/hhrutter/lzw"
 )
@@ -31,54 +26,29 @@ type lzwDecode struct {
 	baseFilter
 }
 
-// Encode implements encoding for an LZWDecode filter.
-func (f lzwDecode) Encode(r io.Reader) (*bytes.Buffer, error) {
-
-	fmt.Println("EncodeLZW begin")
-
-	var b bytes.Buffer
+func (f lzwDecode) earlyChange() bool {
+	return f.parms.Int("EarlyChange", 1) == 1
+}
 
-	ec, ok := f.parms["EarlyChange"]
-	if !ok {
-		ec = 1
-	}
+// Encode implements encoding for an LZWDecode filter.
+func (f lzwDecode) Encode(r io.Reader, w io.Writer) error {
 
-	wc := lzw.NewWriter(&b, ec == 1)
-	defer wc.Close()
+	wc := lzw.NewWriter(w, f.earlyChange())
 
-	written, err := io.Copy(wc, r)
-	if err != nil {
-		return nil, err
+	// Optional decode parameters need preprocessing.
+	if err := f.predictor().encode(r, wc); err != nil {
+		return err
 	}
-	fmt.Printf("EncodeLZW end: %d bytes written\n", written)
 
-	return &b, nil
+	return wc.Close()
 }
 
 // Decode implements decoding for an LZWDecode filter.
-func (f lzwDecode) Decode(r io.Reader) (*bytes.Buffer, error) {
+func (f lzwDecode) Decode(r io.Reader, w io.Writer) error {
 
-	fmt.Println("DecodeLZW begin")
-
-	p, found := f.parms["Predictor"]
-	if found && p > 1 {
-		return nil, errors.New("DecodeLZW: unsupported predictor %d" + strconv.Itoa(p))
-	}
-
-	ec, ok := f.parms["EarlyChange"]
-	if !ok {
-		ec = 1
-	}
-
-	rc := lzw.NewReader(r, ec == 1)
+	rc := lzw.NewReader(r, f.earlyChange())
 	defer rc.Close()
 
-	var b bytes.Buffer
-	written, err := io.Copy(&b, rc)
-	if err != nil {
-		return nil, err
-	}
-	fmt.Printf("DecodeLZW: decoded %d bytes.\n", written)
-
-	return &b, nil
+	// Optional decode parameters need postprocessing.
+	return f.predictor().decode(rc, w)
 }
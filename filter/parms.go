@@ -0,0 +1,255 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Parms represents the decode parameters of a filter (see 7.4, Table 6, 8, 11, 12, 13, 14).
+// Values are of type int, bool, Name or []byte for the decoded content of a referenced stream.
+type Parms map[string]interface{}
+
+// Name represents a name parameter value.
+type Name string
+
+// ParmType represents the type of a filter parameter.
+type ParmType int
+
+// The types of filter parameters.
+const (
+	IntParm ParmType = iota
+	BoolParm
+	NameParm
+	StreamParm
+)
+
+func (t ParmType) String() string {
+	switch t {
+	case IntParm:
+		return "integer"
+	case BoolParm:
+		return "boolean"
+	case NameParm:
+		return "name"
+	case StreamParm:
+		return "stream"
+	}
+	return "unknown"
+}
+
+func parmType(v interface{}) (ParmType, bool) {
+	switch v.(type) {
+	case int:
+		return IntParm, true
+	case bool:
+		return BoolParm, true
+	case Name:
+		return NameParm, true
+	case []byte:
+		return StreamParm, true
+	}
+	return 0, false
+}
+
+var predictorParms = map[string]ParmType{
+	"Predictor":        IntParm,
+	"Colors":           IntParm,
+	"BitsPerComponent": IntParm,
+	"Columns":          IntParm,
+}
+
+// filterParms defines the decode parameters of each filter.
+var filterParms = map[string]map[string]ParmType{
+	ASCII85:   {},
+	ASCIIHex:  {},
+	RunLength: {},
+	LZW:       merge(predictorParms, map[string]ParmType{"EarlyChange": IntParm}),
+	Flate:     predictorParms,
+	CCITTFax: {
+		"K":                      IntParm,
+		"EndOfLine":              BoolParm,
+		"EncodedByteAlign":       BoolParm,
+		"Columns":                IntParm,
+		"Rows":                   IntParm,
+		"EndOfBlock":             BoolParm,
+		"BlackIs1":               BoolParm,
+		"DamagedRowsBeforeError": IntParm,
+	},
+	JBIG2: {"JBIG2Globals": StreamParm},
+	DCT:   {"ColorTransform": IntParm, "Colors": IntParm, "Columns": IntParm}, // Colors and Columns describe the samples to be encoded.
+	JPX:   {},
+	Crypt: {"Type": NameParm, "Name": NameParm},
+}
+
+func merge(m1, m2 map[string]ParmType) map[string]ParmType {
+	m := map[string]ParmType{}
+	for k, v := range m1 {
+		m[k] = v
+	}
+	for k, v := range m2 {
+		m[k] = v
+	}
+	return m
+}
+
+// ParmTypes returns the decode parameters defined for filterName.
+func ParmTypes(filterName string) map[string]ParmType {
+	return filterParms[filterName]
+}
+
+// Int returns the integer value for key or def if key is not present.
+func (p Parms) Int(key string, def int) int {
+	if i, ok := p[key].(int); ok {
+		return i
+	}
+	return def
+}
+
+// Bool returns the boolean value for key or def if key is not present.
+func (p Parms) Bool(key string, def bool) bool {
+	if b, ok := p[key].(bool); ok {
+		return b
+	}
+	return def
+}
+
+// Name returns the name value for key or def if key is not present.
+func (p Parms) Name(key string, def Name) Name {
+	if n, ok := p[key].(Name); ok {
+		return n
+	}
+	return def
+}
+
+// Stream returns the stream content for key or nil if key is not present.
+func (p Parms) Stream(key string) []byte {
+	if b, ok := p[key].([]byte); ok {
+		return b
+	}
+	return nil
+}
+
+// Has returns true if a value for key is present.
+func (p Parms) Has(key string) bool {
+	_, ok := p[key]
+	return ok
+}
+
+// validate checks p against the decode parameters defined for filterName.
+// Parameters not defined for filterName are ignored.
+func (p Parms) validate(filterName string) error {
+
+	defs := filterParms[filterName]
+
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		want, ok := defs[k]
+		if !ok {
+			continue
+		}
+
+		got, ok := parmType(p[k])
+		if !ok {
+			return fmt.Errorf("pdfcpu: filter %s: unsupported value type %T for parameter %s", filterName, p[k], k)
+		}
+
+		if got != want {
+			return fmt.Errorf("pdfcpu: filter %s: parameter %s must be a %s, got %s", filterName, k, want, got)
+		}
+	}
+
+	return nil
+}
+
+// validatePredictorParms checks the parameters of a predictor function (see 7.4.4.4, Table 8).
+func (p Parms) validatePredictorParms(filterName string) error {
+
+	if !p.Has("Predictor") {
+		return nil
+	}
+
+	if pr := p.Int("Predictor", PredictorNo); !intMemberOf(pr, []int{PredictorNo, PredictorTIFF,
+		PredictorNone, PredictorSub, PredictorUp, PredictorAverage, PredictorPaeth, PredictorOptimum}) {
+		return fmt.Errorf("pdfcpu: filter %s: undefined \"Predictor\" %d", filterName, pr)
+	}
+
+	if c := p.Int("Colors", 1); c < 1 {
+		return fmt.Errorf("pdfcpu: filter %s: \"Colors\" must be > 0", filterName)
+	}
+
+	if bpc := p.Int("BitsPerComponent", 8); !intMemberOf(bpc, []int{1, 2, 4, 8, 16}) {
+		return fmt.Errorf("pdfcpu: filter %s: unexpected \"BitsPerComponent\": %d", filterName, bpc)
+	}
+
+	if c := p.Int("Columns", 1); c < 1 {
+		return fmt.Errorf("pdfcpu: filter %s: \"Columns\" must be > 0", filterName)
+	}
+
+	return nil
+}
+
+// Validate checks p against the decode parameters defined for filterName including their value ranges.
+func (p Parms) Validate(filterName string) error {
+
+	if err := p.validate(filterName); err != nil {
+		return err
+	}
+
+	switch filterName {
+
+	case Flate:
+		return p.validatePredictorParms(filterName)
+
+	case LZW:
+		if ec := p.Int("EarlyChange", 1); ec != 0 && ec != 1 {
+			return fmt.Errorf("pdfcpu: filter %s: \"EarlyChange\" must be 0 or 1", filterName)
+		}
+		return p.validatePredictorParms(filterName)
+
+	case CCITTFax:
+		if c := p.Int("Columns", 1728); c < 1 || c > ccittMaxColumns {
+			return fmt.Errorf("pdfcpu: filter %s: \"Columns\" must be > 0 and <= %d", filterName, ccittMaxColumns)
+		}
+		if r := p.Int("Rows", 0); r < 0 {
+			return fmt.Errorf("pdfcpu: filter %s: \"Rows\" must be >= 0", filterName)
+		}
+		if d := p.Int("DamagedRowsBeforeError", 0); d < 0 {
+			return fmt.Errorf("pdfcpu: filter %s: \"DamagedRowsBeforeError\" must be >= 0", filterName)
+		}
+
+	case DCT:
+		if ct := p.Int("ColorTransform", 0); ct != 0 && ct != 1 {
+			return fmt.Errorf("pdfcpu: filter %s: \"ColorTransform\" must be 0 or 1", filterName)
+		}
+		if c := p.Int("Colors", 1); !intMemberOf(c, []int{1, 3, 4}) {
+			return fmt.Errorf("pdfcpu: filter %s: \"Colors\" must be 1, 3 or 4", filterName)
+		}
+		if c := p.Int("Columns", 1); c < 1 {
+			return fmt.Errorf("pdfcpu: filter %s: \"Columns\" must be > 0", filterName)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import "testing"
+
+func TestParmsValidate(t *testing.T) {
+
+	for _, tt := range []struct {
+		filterName string
+		parms      Parms
+		ok         bool
+	}{
+		{Flate, nil, true},
+		{Flate, Parms{"Predictor": 12, "Colors": 3, "BitsPerComponent": 8, "Columns": 100}, true},
+		{Flate, Parms{"Predictor": 9}, false},
+		{Flate, Parms{"Predictor": 2, "BitsPerComponent": 3}, false},
+		{Flate, Parms{"Predictor": 2, "Colors": 0}, false},
+		{Flate, Parms{"Predictor": true}, false},
+		{LZW, Parms{"EarlyChange": 0}, true},
+		{LZW, Parms{"EarlyChange": 2}, false},
+		{CCITTFax, Parms{"K": -1, "BlackIs1": true, "Columns": 2560}, true},
+		{CCITTFax, Parms{"BlackIs1": 1}, false},
+		{CCITTFax, Parms{"Rows": -1}, false},
+		{JBIG2, Parms{"JBIG2Globals": []byte{}}, true},
+		{JBIG2, Parms{"JBIG2Globals": 7}, false},
+		{DCT, Parms{"ColorTransform": 1}, true},
+		{DCT, Parms{"ColorTransform": 2}, false},
+		{DCT, Parms{"Colors": 3, "Columns": 8}, true},
+		{DCT, Parms{"Colors": 2}, false},
+		{Crypt, Parms{"Name": Name("Identity")}, true},
+		{Crypt, Parms{"Name": "Identity"}, false},
+		// Parameters not defined for a filter are ignored.
+		{ASCII85, Parms{"Predictor": "x"}, true},
+	} {
+		err := tt.parms.Validate(tt.filterName)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s %v: got error %v, want ok=%t", tt.filterName, tt.parms, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"fmt"
+	"io"
+)
+
+// predictor represents the parameters of a predictor function used by Flate and LZW (see 7.4.4.4, Table 8).
+type predictor struct {
+	p       int
+	colors  int
+	bpc     int
+	columns int
+}
+
+func (f baseFilter) predictor() predictor {
+
+	return predictor{
+
+		p: f.parms.Int("Predictor", PredictorNo),
+
+		// Colors, int
+		// The number of interleaved colour components per sample.
+		// Valid values are 1 to 4 (PDF 1.0) and 1 or greater (PDF 1.3). Default value: 1.
+		colors: f.parms.Int("Colors", 1),
+
+		// BitsPerComponent, int
+		// The number of bits used to represent each colour component in a sample.
+		// Valid values are 1, 2, 4, 8, and (PDF 1.5) 16. Default value: 8.
+		bpc: f.parms.Int("BitsPerComponent", 8),
+
+		// Columns, int
+		// The number of samples in each row. Default value: 1.
+		columns: f.parms.Int("Columns", 1),
+	}
+}
+
+func (p predictor) png() bool {
+	return p.p >= PredictorNone
+}
+
+func (p predictor) bytesPerPixel() int {
+	return (p.bpc*p.colors + 7) / 8
+}
+
+// rowSize returns the number of bytes of an unpredicted row.
+func (p predictor) rowSize() int {
+	return (p.bpc*p.colors*p.columns + 7) / 8
+}
+
+// sample returns the i-th component value of row.
+func sample(row []byte, i, bpc int) int {
+	switch bpc {
+	case 8:
+		return int(row[i])
+	case 16:
+		return int(row[2*i])<<8 | int(row[2*i+1])
+	}
+	bit := i * bpc
+	return int(row[bit/8]) >> uint(8-bpc-bit%8) & (1<<uint(bpc) - 1)
+}
+
+// setSample sets the i-th component value of row to v modulo 2^bpc.
+func setSample(row []byte, i, bpc, v int) {
+	switch bpc {
+	case 8:
+		row[i] = byte(v)
+		return
+	case 16:
+		row[2*i], row[2*i+1] = byte(v>>8), byte(v)
+		return
+	}
+	bit := i * bpc
+	shift := uint(8 - bpc - bit%8)
+	mask := byte(1<<uint(bpc)-1) << shift
+	row[bit/8] = row[bit/8]&^mask | byte(v)<<shift&mask
+}
+
+// tiffRow applies TIFF Predictor 2 to row.
+// Each component is predicted by the same component of the preceding sample.
+func (p predictor) tiffRow(row []byte, encode bool) {
+
+	n := p.colors * p.columns
+
+	if encode {
+		for i := n - 1; i >= p.colors; i-- {
+			setSample(row, i, p.bpc, sample(row, i, p.bpc)-sample(row, i-p.colors, p.bpc))
+		}
+		return
+	}
+
+	for i := p.colors; i < n; i++ {
+		setSample(row, i, p.bpc, sample(row, i, p.bpc)+sample(row, i-p.colors, p.bpc))
+	}
+}
+
+// pngRow writes the row cdat filtered by the PNG filter f to dst.
+// pdat is the preceding unfiltered row.
+func pngRow(f int, dst, cdat, pdat []byte, bytesPerPixel int) {
+
+	switch f {
+
+	case PNGNone:
+		copy(dst, cdat)
+
+	case PNGSub:
+		copy(dst, cdat[:bytesPerPixel])
+		for i := bytesPerPixel; i < len(cdat); i++ {
+			dst[i] = cdat[i] - cdat[i-bytesPerPixel]
+		}
+
+	case PNGUp:
+		for i := range cdat {
+			dst[i] = cdat[i] - pdat[i]
+		}
+
+	case PNGAverage:
+		for i := 0; i < bytesPerPixel; i++ {
+			dst[i] = cdat[i] - pdat[i]/2
+		}
+		for i := bytesPerPixel; i < len(cdat); i++ {
+			dst[i] = cdat[i] - uint8((int(cdat[i-bytesPerPixel])+int(pdat[i]))/2)
+		}
+
+	case PNGPaeth:
+		for i := 0; i < bytesPerPixel; i++ {
+			dst[i] = cdat[i] - paeth(0, pdat[i], 0)
+		}
+		for i := bytesPerPixel; i < len(cdat); i++ {
+			dst[i] = cdat[i] - paeth(cdat[i-bytesPerPixel], pdat[i], pdat[i-bytesPerPixel])
+		}
+	}
+}
+
+// rowCost estimates the compressed size of a filtered row
+// by the sum of the absolute values of its bytes taken as signed values.
+func rowCost(row []byte) int {
+	c := 0
+	for _, b := range row {
+		c += abs(int(int8(b)))
+	}
+	return c
+}
+
+// encodeRow writes the PNG filter type followed by the filtered row cdat to dst.
+// For PredictorOptimum the filter type resulting in the lowest cost gets selected for each row.
+// buf provides space for an additional filtered row.
+func (p predictor) encodeRow(dst, buf, cdat, pdat []byte) {
+
+	bpp := p.bytesPerPixel()
+
+	if p.p != PredictorOptimum {
+		f := p.p - PredictorNone
+		dst[0] = byte(f)
+		pngRow(f, dst[1:], cdat, pdat, bpp)
+		return
+	}
+
+	dst[0] = PNGNone
+	pngRow(PNGNone, dst[1:], cdat, pdat, bpp)
+	min := rowCost(dst[1:])
+
+	for f := PNGSub; f <= PNGPaeth; f++ {
+		pngRow(f, buf, cdat, pdat, bpp)
+		if c := rowCost(buf); c < min {
+			min = c
+			dst[0] = byte(f)
+			copy(dst[1:], buf)
+		}
+	}
+}
+
+// encode applies the predictor to the rows read from r and writes the predicted rows to w.
+func (p predictor) encode(r io.Reader, w io.Writer) error {
+
+	if p.p == PredictorNo {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	rowSize := p.rowSize()
+
+	// cr and pr are the bytes for the current and previous row.
+	cr := make([]byte, rowSize)
+	pr := make([]byte, rowSize)
+
+	var out, buf []byte
+	if p.png() {
+		// PNG prediction uses a row filter byte prefixing the pixelbytes of a row.
+		out = make([]byte, rowSize+1)
+		buf = make([]byte, rowSize)
+	}
+
+	for {
+
+		n, err := io.ReadFull(r, cr)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		if n != rowSize {
+			return fmt.Errorf("pdfcpu: predictor: data ends within a row, expected %d bytes, got: %d", rowSize, n)
+		}
+
+		if !p.png() {
+			p.tiffRow(cr, true)
+			if _, err = w.Write(cr); err != nil {
+				return err
+			}
+			continue
+		}
+
+		p.encodeRow(out, buf, cr, pr)
+		if _, err = w.Write(out); err != nil {
+			return err
+		}
+
+		// Swap byte slices.
+		pr, cr = cr, pr
+	}
+}
+
+func (p predictor) processRow(pr, cr []byte) []byte {
+
+	//fmt.Printf("pr(%v) =\n%s\n", &pr, hex.Dump(pr))
+	//fmt.Printf("cr(%v) =\n%s\n", &cr, hex.Dump(cr))
+
+	if !p.png() {
+		p.tiffRow(cr, false)
+		return cr
+	}
+
+	// Apply the filter.
+	cdat := cr[1:]
+	pdat := pr[1:]
+
+	bytesPerPixel := p.bytesPerPixel()
+
+	// Get row filter from 1st byte.
+	// The value of Predictor supplied by the decoding filter need not match the value
+	// used when the data was encoded if they are both greater than or equal to 10.
+	switch cr[0] {
+
+	case PNGNone:
+		// No operation.
+
+	case PNGSub:
+		for i := bytesPerPixel; i < len(cdat); i++ {
+			cdat[i] += cdat[i-bytesPerPixel]
+		}
+
+	case PNGUp:
+		for i, p := range pdat {
+			cdat[i] += p
+		}
+
+	case PNGAverage:
+		// The average of the two neighboring pixels (left and above).
+		// Raw(x) - floor((Raw(x-bpp)+Prior(x))/2)
+		for i := 0; i < bytesPerPixel; i++ {
+			cdat[i] += pdat[i] / 2
+		}
+		for i := bytesPerPixel; i < len(cdat); i++ {
+			cdat[i] += uint8((int(cdat[i-bytesPerPixel]) + int(pdat[i])) / 2)
+		}
+
+	case PNGPaeth:
+		filterPaeth(cdat, pdat, bytesPerPixel)
+
+	}
+
+	return cdat
+}
+
+// decode reverts the predictor for the rows read from r and writes the resulting rows to w.
+func (p predictor) decode(r io.Reader, w io.Writer) error {
+
+	if p.p == PredictorNo {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	rowSize := p.rowSize()
+	if p.png() {
+		// PNG prediction uses a row filter byte prefixing the pixelbytes of a row.
+		rowSize++
+	}
+
+	// cr and pr are the bytes for the current and previous row.
+	cr := make([]byte, rowSize)
+	pr := make([]byte, rowSize)
+
+	for {
+
+		// Read decompressed bytes for one pixel row.
+		n, err := io.ReadFull(r, cr)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		if n != rowSize {
+			return fmt.Errorf("pdfcpu: predictor: read error, expected %d bytes, got: %d", rowSize, n)
+		}
+
+		if _, err = w.Write(p.processRow(pr, cr)); err != nil {
+			return err
+		}
+
+		// Swap byte slices.
+		pr, cr = cr, pr
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testImage returns rows of a smooth gradient image.
+func testImage(rows, rowSize int) []byte {
+	b := make([]byte, rows*rowSize)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < rowSize; x++ {
+			b[y*rowSize+x] = byte(x*3 + y*5 + x*y/7)
+		}
+	}
+	return b
+}
+
+func TestPredictorRoundtrip(t *testing.T) {
+
+	predictors := []int{PredictorNo, PredictorTIFF, PredictorNone, PredictorSub,
+		PredictorUp, PredictorAverage, PredictorPaeth, PredictorOptimum}
+
+	for _, filterName := range []string{Flate, LZW} {
+		for _, pr := range predictors {
+			for _, colors := range []int{1, 3} {
+				for _, bpc := range []int{1, 2, 4, 8, 16} {
+					for _, columns := range []int{1, 5, 17} {
+
+						parms := Parms{"Predictor": pr, "Colors": colors, "BitsPerComponent": bpc, "Columns": columns}
+
+						f, err := NewFilter(filterName, parms)
+						if err != nil {
+							t.Fatal(err)
+						}
+
+						raw := testImage(10, (colors*bpc*columns+7)/8)
+
+						enc, err := encodeBytes(f, raw)
+						if err != nil {
+							t.Fatalf("%s %v: encode: %v", filterName, parms, err)
+						}
+
+						dec, err := decodeBytes(f, enc)
+						if err != nil {
+							t.Fatalf("%s %v: decode: %v", filterName, parms, err)
+						}
+
+						if !bytes.Equal(dec, raw) {
+							t.Errorf("%s %v: roundtrip mismatch", filterName, parms)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPredictorCompression(t *testing.T) {
+
+	raw := testImage(100, 300)
+
+	size := func(predictor int) int {
+		f, _ := NewFilter(Flate, Parms{"Predictor": predictor, "Colors": 3, "Columns": 100})
+		enc, err := encodeBytes(f, raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(enc)
+	}
+
+	if n, m := size(PredictorNo), size(PredictorOptimum); m >= n {
+		t.Errorf("PredictorOptimum: got %d bytes, want less than %d bytes", m, n)
+	}
+}
+
+func TestPredictorPNGDecode(t *testing.T) {
+
+	// Rows using Sub, Up, Average and Paeth for 2 samples of 2 colors.
+	enc := []byte{
+		PNGSub, 1, 2, 3, 4,
+		PNGUp, 1, 1, 1, 1,
+		PNGAverage, 1, 1, 1, 1,
+		PNGPaeth, 1, 1, 1, 1,
+	}
+
+	want := []byte{
+		1, 2, 4, 6,
+		2, 3, 5, 7,
+		2, 2, 4, 5,
+		3, 3, 5, 6,
+	}
+
+	p := predictor{p: PredictorOptimum, colors: 2, bpc: 8, columns: 2}
+
+	var b bytes.Buffer
+	if err := p.decode(bytes.NewReader(enc), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("got %v, want %v", b.Bytes(), want)
+	}
+}
+
+func TestLZWEarlyChange(t *testing.T) {
+
+	raw := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 200)
+
+	for _, ec := range []int{0, 1} {
+
+		f, _ := NewFilter(LZW, Parms{"EarlyChange": ec})
+
+		enc, err := encodeBytes(f, raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dec, err := decodeBytes(f, enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(dec, raw) {
+			t.Errorf("EarlyChange %d: roundtrip mismatch", ec)
+		}
+
+		// Decoding with the other code width switch fails or yields different data.
+		g, _ := NewFilter(LZW, Parms{"EarlyChange": 1 - ec})
+		if dec, err = decodeBytes(g, enc); err == nil && bytes.Equal(dec, raw) {
+			t.Errorf("EarlyChange %d: not honored", ec)
+		}
+	}
+}
@@ -17,46 +17,53 @@ limitations under the License.
 package filter
 
 import (
-	"bytes"
+	"bufio"
 	"io"
-	"io/ioutil"
 )
 
 type runLengthDecode struct {
 	baseFilter
 }
 
-func (f runLengthDecode) decode(w io.ByteWriter, src []byte) {
+const eodRunLength = 0x80
 
-	for i := 0; i < len(src); {
-		b := src[i]
-		if b == 0x80 {
-			// eod
-			break
+func (f runLengthDecode) decode(w io.ByteWriter, r *bufio.Reader) error {
+
+	for {
+
+		b, err := r.ReadByte()
+		if err == io.EOF || b == eodRunLength {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
-		i++
+
 		if b < 0x80 {
 			c := int(b) + 1
 			for j := 0; j < c; j++ {
-				w.WriteByte(src[i])
-				i++
+				if b, err = r.ReadByte(); err != nil {
+					return err
+				}
+				w.WriteByte(b)
 			}
 			continue
 		}
+
 		c := 257 - int(b)
+		if b, err = r.ReadByte(); err != nil {
+			return err
+		}
 		for j := 0; j < c; j++ {
-			w.WriteByte(src[i])
+			w.WriteByte(b)
 		}
-		i++
 	}
-
-	return
 }
 
+// encode writes the runs of src without eod marker.
 func (f runLengthDecode) encode(w io.ByteWriter, src []byte) {
 
 	const maxLen = 0x80
-	const eod = 0x80
 
 	i := 0
 	b := src[i]
@@ -74,7 +81,6 @@ func (f runLengthDecode) encode(w io.ByteWriter, src []byte) {
 			w.WriteByte(byte(257 - c))
 			w.WriteByte(b)
 			if i == len(src) {
-				w.WriteByte(0x80)
 				return
 			}
 			b = src[i]
@@ -94,7 +100,6 @@ func (f runLengthDecode) encode(w io.ByteWriter, src []byte) {
 				w.WriteByte(src[start+j])
 			}
 			if i == len(src) {
-				w.WriteByte(0x80)
 				return
 			}
 		} else {
@@ -113,29 +118,39 @@ func (f runLengthDecode) encode(w io.ByteWriter, src []byte) {
 }
 
 // Encode implements encoding for a RunLengthDecode filter.
-func (f runLengthDecode) Encode(r io.Reader) (*bytes.Buffer, error) {
+func (f runLengthDecode) Encode(r io.Reader, w io.Writer) error {
 
-	p, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
+	bw := bufio.NewWriter(w)
+
+	// Runs do not span chunks.
+	p := make([]byte, 32*1024)
+
+	for {
+		n, err := io.ReadFull(r, p)
+		if n > 0 {
+			f.encode(bw, p[:n])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	var b bytes.Buffer
-	f.encode(&b, p)
+	bw.WriteByte(eodRunLength)
 
-	return &b, nil
+	return bw.Flush()
 }
 
 // Decode implements decoding for an RunLengthDecode filter.
-func (f runLengthDecode) Decode(r io.Reader) (*bytes.Buffer, error) {
+func (f runLengthDecode) Decode(r io.Reader, w io.Writer) error {
 
-	p, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
-	}
+	bw := bufio.NewWriter(w)
 
-	var b bytes.Buffer
-	f.decode(&b, p)
+	if err := f.decode(bw, bufio.NewReader(r)); err != nil {
+		return err
+	}
 
-	return &b, nil
+	return bw.Flush()
 }
@@ -19,6 +19,7 @@ package filter
 import (
 	"bytes"
 	"encoding/hex"
+	"strings"
 	"testing"
 )
 
@@ -42,6 +43,18 @@ func compare(t *testing.T, a, b []byte) {
 
 }
 
+func encodeBytes(f Filter, p []byte) ([]byte, error) {
+	var b bytes.Buffer
+	err := f.Encode(bytes.NewReader(p), &b)
+	return b.Bytes(), err
+}
+
+func decodeBytes(f Filter, p []byte) ([]byte, error) {
+	var b bytes.Buffer
+	err := f.Decode(bytes.NewReader(p), &b)
+	return b.Bytes(), err
+}
+
 func TestRunLengthEncoding(t *testing.T) {
 
 	f := runLengthDecode{baseFilter{}}
@@ -67,11 +80,15 @@ func TestRunLengthEncoding(t *testing.T) {
 		{"\x00\x00\x01\x02\x00\x00", "\xFF\x00\x01\x01\x02\xFF\x00\x80"},
 	} {
 		var enc bytes.Buffer
-		f.encode(&enc, []byte(tt.raw))
+		if err := f.Encode(strings.NewReader(tt.raw), &enc); err != nil {
+			t.Fatal(err)
+		}
 		compare(t, enc.Bytes(), []byte(tt.enc))
 
 		var raw bytes.Buffer
-		f.decode(&raw, enc.Bytes())
+		if err := f.Decode(bytes.NewReader(enc.Bytes()), &raw); err != nil {
+			t.Fatal(err)
+		}
 		compare(t, raw.Bytes(), []byte(tt.raw))
 	}
 
@@ -0,0 +1,214 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/zean00/pdfcpulite/filter"
+)
+
+func TestFilterPipeline(t *testing.T) {
+
+	content := []byte(strings.Repeat("BT /F1 12 Tf 72 712 Td (Hello World) Tj ET\n", 1000))
+
+	sd := StreamDict{Dict: NewDict(), Content: content}
+	sd.FilterPipeline = []PDFFilter{{Name: filter.ASCII85}, {Name: filter.RunLength}, {Name: filter.Flate}}
+
+	if err := encodeStream(&sd); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first filter of the pipeline is applied last.
+	if !bytes.HasSuffix(sd.Raw, []byte("~>")) {
+		t.Errorf("encoded stream does not end with the ASCII85 eod marker")
+	}
+
+	sd.Content = nil
+	if err := decodeStream(&sd); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(sd.Content, content) {
+		t.Error("decoded stream differs from original content")
+	}
+}
+
+func TestRunPipelineErrors(t *testing.T) {
+
+	errStage := errors.New("stage failed")
+
+	copyStage := func(r io.Reader, w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	failStage := func(r io.Reader, w io.Writer) error {
+		return errStage
+	}
+
+	firstByte := func(r io.Reader, w io.Writer) error {
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		_, err := w.Write(b)
+		return err
+	}
+
+	in := strings.Repeat("x", 1<<20)
+
+	for _, tt := range []struct {
+		stages []filterStage
+		out    string
+		err    error
+	}{
+		{[]filterStage{copyStage, copyStage, copyStage}, in, nil},
+		{[]filterStage{failStage, copyStage, copyStage}, "", errStage},
+		{[]filterStage{copyStage, failStage, copyStage}, "", errStage},
+		{[]filterStage{copyStage, copyStage, failStage}, "", errStage},
+		// Stages finishing early do not block preceding stages.
+		{[]filterStage{copyStage, firstByte, copyStage}, "x", nil},
+		{[]filterStage{copyStage, copyStage, firstByte}, "x", nil},
+	} {
+		var b bytes.Buffer
+		err := runPipeline(strings.NewReader(in), &b, tt.stages)
+		if err != tt.err {
+			t.Errorf("got error %v, want %v", err, tt.err)
+			continue
+		}
+		if err == nil && b.String() != tt.out {
+			t.Errorf("got %d bytes, want %d", b.Len(), len(tt.out))
+		}
+	}
+}
+
+func TestPDFFilterPipelineDecodeParms(t *testing.T) {
+
+	parms := Dict{"Predictor": Integer(12), "Columns": Integer(4)}
+
+	for _, tt := range []struct {
+		decodeParms Object
+		want        []Dict
+	}{
+		{nil, []Dict{nil, nil}},
+		{Array{nil, parms}, []Dict{nil, parms}},
+		// Missing trailing entries use default parameters.
+		{Array{parms}, []Dict{parms, nil}},
+	} {
+		d := Dict{"Filter": Array{Name(filter.ASCII85), Name(filter.Flate)}}
+		if tt.decodeParms != nil {
+			d["DecodeParms"] = tt.decodeParms
+		}
+
+		fp, err := pdfFilterPipeline(nil, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, f := range fp {
+			if (f.DecodeParms == nil) != (tt.want[i] == nil) {
+				t.Errorf("%v: filter %s: got decode parms %v, want %v", tt.decodeParms, f.Name, f.DecodeParms, tt.want[i])
+			}
+		}
+	}
+
+	p := parmsForFilter(PDFFilter{Name: filter.CCITTFax, DecodeParms: Dict{"K": Integer(-1), "BlackIs1": Boolean(true)}})
+	if p.Int("K", 0) != -1 || !p.Bool("BlackIs1", false) {
+		t.Errorf("unexpected filter parms: %v", p)
+	}
+}
+
+type copyFilter struct{}
+
+func (copyFilter) Encode(r io.Reader, w io.Writer) error {
+	_, err := io.Copy(w, r)
+	return err
+}
+
+func (copyFilter) Decode(r io.Reader, w io.Writer) error {
+	_, err := io.Copy(w, r)
+	return err
+}
+
+func TestFilterRegistry(t *testing.T) {
+
+	filter.Register(filter.JPX, func(parms filter.Parms) (filter.Filter, error) {
+		return copyFilter{}, nil
+	})
+
+	found := false
+	for _, name := range filter.List() {
+		found = found || name == filter.JPX
+	}
+	if !found {
+		t.Errorf("registered filter %s not listed", filter.JPX)
+	}
+
+	content := []byte("image data")
+
+	sd := StreamDict{Dict: NewDict(), Content: content}
+	sd.FilterPipeline = []PDFFilter{{Name: filter.Flate}, {Name: filter.JPX}}
+
+	if err := encodeStream(&sd); err != nil {
+		t.Fatal(err)
+	}
+
+	sd.Content = nil
+	if err := decodeStream(&sd); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(sd.Content, content) {
+		t.Error("decoded stream differs from original content")
+	}
+
+	// Restore the built-in filter.
+	filter.Register(filter.JPX, nil)
+
+	if _, err := filter.NewFilter(filter.JPX, nil); err != filter.ErrUnsupportedFilter {
+		t.Errorf("got error %v, want %v", err, filter.ErrUnsupportedFilter)
+	}
+}
+
+func TestParallelFlateStream(t *testing.T) {
+
+	defer func(threshold int) { ParallelFlateThreshold = threshold }(ParallelFlateThreshold)
+	ParallelFlateThreshold = 1
+
+	content := []byte(strings.Repeat("0 0 m 612 792 l S\n", 200000))
+
+	sd := StreamDict{Dict: NewDict(), Content: content}
+	sd.FilterPipeline = []PDFFilter{{Name: filter.Flate}}
+
+	if err := encodeStream(&sd); err != nil {
+		t.Fatal(err)
+	}
+
+	sd.Content = nil
+	if err := decodeStream(&sd); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(sd.Content, content) {
+		t.Error("decoded stream differs from original content")
+	}
+}
@@ -19,29 +19,36 @@ package font
 
 import (
 	"encoding/binary"
+	"encoding/gob"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+
+	"github.com/zean00/pdfcpulite/log"
 )
 
 const scalerType = "\x00\x01\x00\x00"
 
 type ttf struct {
-	PostscriptName     string            // name: NameID 6
-	Protected          bool              // OS/2: fsType
-	UnitsPerEm         int               // head: unitsPerEm
-	Ascent             int               // OS/2: sTypoAscender
-	Descent            int               // OS/2: sTypoDescender
-	CapHeight          int               // OS/2: sCapHeight
-	FirstChar          uint16            // OS/2: fsFirstCharIndex
-	LastChar           uint16            // OS/2: fsLastCharIndex
-	LLx, LLy, URx, URy float64           // head: xMin, yMin, xMax, yMax (fontbox)
-	ItalicAngle        float64           // post: italicAngle
-	FixedPitch         bool              // post: isFixedPitch
-	Bold               bool              // OS/2: usWeightClass == 7
-	HorMetricsCount    int               // hhea: numOfLongHorMetrics
-	GlyphCount         int               // maxp: numGlyphs
-	GlyphWidths        []int             // hmtx: fd.HorMetricsCount.advanceWidth
-	Chars              map[uint16]uint16 // cmap
+	PostscriptName     string          // name: NameID 6
+	Protected          bool            // OS/2: fsType
+	UnitsPerEm         int             // head: unitsPerEm
+	Ascent             int             // OS/2: sTypoAscender
+	Descent            int             // OS/2: sTypoDescender
+	CapHeight          int             // OS/2: sCapHeight
+	FirstChar          uint16          // OS/2: fsFirstCharIndex
+	LastChar           uint16          // OS/2: fsLastCharIndex
+	LLx, LLy, URx, URy float64         // head: xMin, yMin, xMax, yMax (fontbox)
+	ItalicAngle        float64         // post: italicAngle
+	FixedPitch         bool            // post: isFixedPitch
+	Bold               bool            // OS/2: usWeightClass == 7
+	HorMetricsCount    int             // hhea: numOfLongHorMetrics
+	GlyphCount         int             // maxp: numGlyphs
+	GlyphWidths        []int           // hmtx: fd.HorMetricsCount.advanceWidth
+	Chars              map[rune]uint16 // cmap
 	FontFile           []byte
 }
 
@@ -98,7 +105,7 @@ func (fd ttf) PrintChars() string {
 		}
 		sb.WriteString(fmt.Sprintf("%04x:%04x(%d)\n", c, g, g))
 	}
-	fmt.Printf("using glyphs[%04x,%04x] [%d,%d]\n", min, max, min, max)
+	log.Info.Debugf("using glyphs[%04x,%04x] [%d,%d]\n", min, max, min, max)
 	return sb.String()
 }
 
@@ -314,7 +321,7 @@ func (t table) parseWinUnicodeBMPCharToGlyphMappingTable(fd *ttf) error {
 				v = c + idDelta
 			}
 			if gi := uint32(v) % uint32(65536); gi > 0 {
-				fd.Chars[c] = uint16(gi)
+				fd.Chars[rune(c)] = uint16(gi)
 			}
 			j++
 		}
@@ -323,25 +330,74 @@ func (t table) parseWinUnicodeBMPCharToGlyphMappingTable(fd *ttf) error {
 	return nil
 }
 
+func (t table) parseWinUnicodeFullCharToGlyphMappingTable(fd *ttf) error {
+
+	groupCount := int(t.uint32(12))
+	if 16+groupCount*12 > len(t.data) {
+		return fmt.Errorf("corrupt WinUnicodeFullCharToGlyphMappingTable")
+	}
+
+	for i := 0; i < groupCount; i++ {
+		off := 16 + i*12
+		startCode := t.uint32(off)
+		endCode := t.uint32(off + 4)
+		startGlyph := t.uint32(off + 8)
+		//fmt.Printf("Group %02d: startc:%06x endc:%06x startGlyph:%d\n", i, startCode, endCode, startGlyph)
+		if startCode > endCode || endCode > 0x10FFFF {
+			continue
+		}
+		for c := startCode; c <= endCode; c++ {
+			if gi := startGlyph + c - startCode; gi > 0 && gi <= 0xFFFF {
+				fd.Chars[rune(c)] = uint16(gi)
+			}
+		}
+	}
+
+	return nil
+}
+
 func (t table) parseCharToGlyphMappingTable(fd *ttf) error {
 
 	// Note: For symbolic fonts the 'cmap' and 'name' tables must use platform ID 3 (Microsoft) and encoding ID 0.
 
-	fd.Chars = map[uint16]uint16{}
+	fd.Chars = map[rune]uint16{}
 
 	tableCount := t.uint16(2)
 	//fmt.Printf("glyphMappingTables: %d\n", tableCount)
 	baseOff := 4
+	if baseOff+int(tableCount)*8 > len(t.data) {
+		return fmt.Errorf("corrupt cmap")
+	}
 	var pf, enc, f uint16
+	var bmp *table
 	for i := 0; i < int(tableCount); i++ {
 		off := baseOff + i*8
 		pf = t.uint16(off)
 		enc = t.uint16(off + 2)
 		o := t.uint32(off + 4)
+		if uint64(o)+8 > uint64(len(t.data)) {
+			return fmt.Errorf("corrupt cmap")
+		}
 		f = t.uint16(int(o))
-		l := t.uint16(int(o) + 2)
-		//fmt.Printf("platformID:%d enc:%d o:%04x format:%d length:%d\n", pf, enc, o, f, l)
-		if pf == 3 && enc == 1 && f == 4 {
+		//fmt.Printf("platformID:%d enc:%d o:%04x format:%d\n", pf, enc, o, f)
+		if f != 4 && f != 12 {
+			continue
+		}
+		l := uint32(t.uint16(int(o) + 2))
+		if f == 12 {
+			l = t.uint32(int(o) + 4)
+		}
+		if uint64(o)+uint64(l) > uint64(len(t.data)) {
+			return fmt.Errorf("corrupt cmap")
+		}
+		if pf == 3 && enc == 10 && f == 12 {
+			// Format 12 is a bit like format 4, in that it defines segments for sparse representation in a 4-byte character space.
+			// It is required for Unicode fonts covering characters above U+FFFF on Windows, eg. emoji.
+			// It is the most useful of the cmap formats with 32-bit support and a superset of the BMP mapping.
+			t1 := table{off: o, size: l, data: t.data[o : o+l]}
+			return t1.parseWinUnicodeFullCharToGlyphMappingTable(fd)
+		}
+		if pf == 3 && enc == 1 && f == 4 && bmp == nil {
 			// We are interested in the standard character-to-glyph-index mapping table
 			// for the Windows platform for fonts that support Unicode BMP characters.
 			//
@@ -353,23 +409,19 @@ func (t table) parseCharToGlyphMappingTable(fd *ttf) error {
 			// It should be used when the character codes for a font fall into several contiguous ranges,
 			// possibly with holes in some or all of the ranges. That is, some of the codes in a range
 			// may not be associated with glyphs in the font.
-			if f == 4 {
-				b := t.data[o : o+uint32(l)]
-				t1 := table{off: o, size: uint32(l), data: b}
-				return t1.parseWinUnicodeBMPCharToGlyphMappingTable(fd)
-			}
+			bmp = &table{off: o, size: l, data: t.data[o : o+l]}
 
 			// Format 6 is used to map 16-bit, 2-byte, characters to glyph indexes.
 			// It is sometimes called the trimmed table mapping. It should be used when character codes
 			// for a font fall into a single contiguous range. This results in what is termed a dense mapping.
-
-			// Format 12 is a bit like format 4, in that it defines segments for sparse representation in a 4-byte character space.
-			// It is required for Unicode fonts covering characters above U+FFFF on Windows.
-			// It is the most useful of the cmap formats with 32-bit support.
 		}
 	}
 
-	return fmt.Errorf("missing WinUnicodeBMPCharToGlyphMappingTable")
+	if bmp == nil {
+		return fmt.Errorf("missing WinUnicodeBMPCharToGlyphMappingTable")
+	}
+
+	return bmp.parseWinUnicodeBMPCharToGlyphMappingTable(fd)
 }
 
 func calcTableChecksum(tag string, b []byte) uint32 {
@@ -379,7 +431,9 @@ func calcTableChecksum(tag string, b []byte) uint32 {
 		if tag == "head" && i == 2 {
 			continue
 		}
-		sum += binary.BigEndian.Uint32(b[i*4 : (i+1)*4])
+		var w [4]byte
+		copy(w[:], b[i*4:])
+		sum += binary.BigEndian.Uint32(w[:])
 	}
 	return sum
 }
@@ -391,79 +445,51 @@ func getNext32BitAlignedLength(i uint32) uint32 {
 	return i
 }
 
-/*
 func parseFontDir(name string) (map[string]table, error) {
 
-	f, err := os.Open(name)
+	b, err := ioutil.ReadFile(name)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	b := make([]byte, 6)
-	n, err := f.Read(b)
-	if err != nil {
-		return nil, err
-	}
-	if n != 6 {
-		return nil, fmt.Errorf("corrupt file")
-	}
-	//fmt.Printf("read %d bytes\n%s\n", n, hex.Dump(b))
+	return parseTables(b)
+}
+
+// parseTables returns the tables of the TrueType font file b.
+func parseTables(b []byte) (map[string]table, error) {
 
-	if (string(b[:4])) != scalerType {
+	if len(b) < 12 || string(b[:4]) != scalerType {
 		return nil, fmt.Errorf("corrupt file")
 	}
 
 	c := int(binary.BigEndian.Uint16(b[4:]))
-	//fmt.Printf("we have %d tables\n", c)
-
-	b = make([]byte, c*16)
-	n, err = f.ReadAt(b, 12)
-	if err != nil {
-		return nil, err
-	}
-	if n != c*16 {
+	if len(b) < 12+c*16 {
 		return nil, fmt.Errorf("corrupt file")
 	}
 
 	tables := map[string]table{}
-	tags := []string{}
 
 	for j := 0; j < c; j++ {
-		off := j * 16
-		b1 := b[off : off+16]
-		//fmt.Printf("t%02d: %s", j, hex.Dump(b1))
+		b1 := b[12+j*16 : 12+(j+1)*16]
 		tag := string(b1[:4])
 		chk := binary.BigEndian.Uint32(b1[4:8])
 		o := binary.BigEndian.Uint32(b1[8:12])
 		l := binary.BigEndian.Uint32(b1[12:])
-		//fmt.Printf("tag: %s chk:%d o:%d l:%d\n\n", tag, chk, o, l)
-		ll := getNext32BitAlignedLength(l)
-		t := make([]byte, ll)
-		n, err = f.ReadAt(t, int64(o))
-		if err != nil {
-			return nil, err
-		}
-		if n != int(ll) {
+		if uint64(o)+uint64(l) > uint64(len(b)) {
 			return nil, fmt.Errorf("corrupt table")
 		}
 
-		tables[tag] = table{off: o, size: ll, data: t}
+		t := b[o : o+l]
+		tables[tag] = table{off: o, size: l, data: t}
 
-		//fmt.Printf("table <%s>:\n%s\n", tag, hex.Dump(t))
-		sum := calcTableChecksum(tag, t)
-		if sum != chk {
+		if sum := calcTableChecksum(tag, t); sum != chk {
 			return nil, fmt.Errorf("table<%s> checksum error", tag)
 		}
-
-		tags = append(tags, tag)
 	}
 
-	//fmt.Println(tags)
-
 	return tables, nil
 }
-*/
+
 func parse(tags map[string]table, tag string, fd *ttf) error {
 	t, found := tags[tag]
 	if !found {
@@ -498,7 +524,6 @@ func parse(tags map[string]table, tag string, fd *ttf) error {
 	return err
 }
 
-/*
 func writeGob(fileName string, fd ttf) error {
 	//fmt.Printf("writing gob to: %s\n", fileName)
 	f, err := os.Create(fileName)
@@ -560,9 +585,8 @@ func InstallTrueTypeFont(fontDir, fontName string) error {
 	//fmt.Printf("Read %s:\n", fdNew)
 
 	if !reflect.DeepEqual(fd, fdNew) {
-		return errors.Errorf("%s can't be installed", fontName)
+		return fmt.Errorf("pdfcpu: %s can't be installed", fontName)
 	}
 
 	return nil
 }
-*/
@@ -17,7 +17,12 @@ limitations under the License.
 package font
 
 import (
+	"encoding/gob"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/zean00/pdfcpulite/types"
@@ -25,22 +30,22 @@ import (
 
 // TTFLight represents a TrueType font w/o font file.
 type TTFLight struct {
-	PostscriptName     string            // name: NameID 6
-	Protected          bool              // OS/2: fsType
-	UnitsPerEm         int               // head: unitsPerEm
-	Ascent             int               // OS/2: sTypoAscender
-	Descent            int               // OS/2: sTypoDescender
-	CapHeight          int               // OS/2: sCapHeight
-	FirstChar          uint16            // OS/2: fsFirstCharIndex
-	LastChar           uint16            // OS/2: fsLastCharIndex
-	LLx, LLy, URx, URy float64           // head: xMin, yMin, xMax, yMax (fontbox)
-	ItalicAngle        float64           // post: italicAngle
-	FixedPitch         bool              // post: isFixedPitch
-	Bold               bool              // OS/2: usWeightClass == 7
-	HorMetricsCount    int               // hhea: numOfLongHorMetrics
-	GlyphCount         int               // maxp: numGlyphs
-	GlyphWidths        []int             // hmtx: fd.HorMetricsCount.advanceWidth
-	Chars              map[uint16]uint16 // cmap
+	PostscriptName     string          // name: NameID 6
+	Protected          bool            // OS/2: fsType
+	UnitsPerEm         int             // head: unitsPerEm
+	Ascent             int             // OS/2: sTypoAscender
+	Descent            int             // OS/2: sTypoDescender
+	CapHeight          int             // OS/2: sCapHeight
+	FirstChar          uint16          // OS/2: fsFirstCharIndex
+	LastChar           uint16          // OS/2: fsLastCharIndex
+	LLx, LLy, URx, URy float64         // head: xMin, yMin, xMax, yMax (fontbox)
+	ItalicAngle        float64         // post: italicAngle
+	FixedPitch         bool            // post: isFixedPitch
+	Bold               bool            // OS/2: usWeightClass == 7
+	HorMetricsCount    int             // hhea: numOfLongHorMetrics
+	GlyphCount         int             // maxp: numGlyphs
+	GlyphWidths        []int           // hmtx: fd.HorMetricsCount.advanceWidth
+	Chars              map[rune]uint16 // cmap
 }
 
 func (fd TTFLight) String() string {
@@ -79,9 +84,11 @@ HorMetricsCount = %d
 // UserFontMetrics represents font metrics for user installed TrueType fonts.
 var UserFontMetrics = map[string]TTFLight{}
 
-/*
+// UserFontDir is the directory holding the installed user fonts.
+// It is set by LoadUserFonts.
+var UserFontDir string
+
 func load(fileName string, fd *TTFLight) error {
-	//fmt.Printf("reading gob from: %s\n", fileName)
 	f, err := os.Open(fileName)
 	if err != nil {
 		return err
@@ -91,14 +98,9 @@ func load(fileName string, fd *TTFLight) error {
 	return dec.Decode(fd)
 }
 
-// Read reads in the font file bytes from gob
-func Read(fileName string) ([]byte, error) {
-	dir, err := Dir()
-	if err != nil {
-		return nil, err
-	}
-	fn := filepath.Join(dir, fileName+".gob")
-	//fmt.Printf("reading in fontFile from %s\n", fn)
+// Read reads in the font file bytes of an installed user font.
+func Read(fontName string) ([]byte, error) {
+	fn := filepath.Join(UserFontDir, fontName+".gob")
 	f, err := os.Open(fn)
 	if err != nil {
 		return nil, err
@@ -109,13 +111,12 @@ func Read(fileName string) ([]byte, error) {
 	err = dec.Decode(ff)
 	return ff.FontFile, err
 }
-*/
+
 func isSupportedFontFile(filename string) bool {
 	return strings.HasSuffix(strings.ToLower(filename), ".gob")
 }
 
-/*
-// Dir returns the path where pdfcpu stores font info for embedding.
+// Dir returns the default path where pdfcpu stores font info for embedding.
 func Dir() (string, error) {
 	userConfigDir, err := os.UserConfigDir()
 	if err != nil {
@@ -125,37 +126,29 @@ func Dir() (string, error) {
 	return fontDir, os.MkdirAll(fontDir, os.ModePerm)
 }
 
-func init() {
-	//fmt.Println("metrics.init begin")
-	dir, err := Dir()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed access to font dir: %v\n", err)
-		os.Exit(1)
-	}
-	//fmt.Printf("fontDir = %s\n", dir)
+// LoadUserFonts loads the metrics of all user fonts installed in dir.
+// An installed font is referred to by the base name of its font file.
+func LoadUserFonts(dir string) error {
 	files, err := ioutil.ReadDir(dir)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed access to fonts dir: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 	for _, f := range files {
-		if isSupportedFontFile(f.Name()) {
-			ttf := TTFLight{}
-			fn := filepath.Join(dir, f.Name())
-			if err := load(fn, &ttf); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed access to %s:  %v\n", f.Name(), err)
-				os.Exit(1)
-			}
-			fn = strings.TrimSuffix(f.Name(), path.Ext(f.Name()))
-			//fmt.Printf("loading %s.ttf...\n", fn)
-			//fmt.Printf("Loaded %s:\n%s", fn, ttf)
-			UserFontMetrics[fn] = ttf
+		if !isSupportedFontFile(f.Name()) {
+			continue
 		}
+		ttf := TTFLight{}
+		if err := load(filepath.Join(dir, f.Name()), &ttf); err != nil {
+			// Fonts installed before characters were keyed by rune need to be reinstalled.
+			return fmt.Errorf("pdfcpu: can't load %s, try reinstalling the font: %v", f.Name(), err)
+		}
+		fn := strings.TrimSuffix(f.Name(), path.Ext(f.Name()))
+		UserFontMetrics[fn] = ttf
 	}
-	//fmt.Println()
-	//fmt.Println("metrics.init end")
+	UserFontDir = dir
+	return nil
 }
-*/
+
 // BoundingBox returns the font bounding box for a given font as specified in the corresponding AFM file.
 func BoundingBox(fontName string) *types.Rectangle {
 	if IsCoreFont(fontName) {
@@ -168,17 +161,17 @@ func BoundingBox(fontName string) *types.Rectangle {
 	return types.NewRectangle(llx, lly, urx, ury)
 }
 
-// CharWidth returns the character width for a char and font in glyph space units.
+// CharWidth returns the character width for a CP1252 character code and font in glyph space units.
 func CharWidth(fontName string, c int) int {
 	if IsCoreFont(fontName) {
 		return CoreFontCharWidth(fontName, c)
 	}
 	ttf := UserFontMetrics[fontName]
-	if WinAnsiGlyphMap[c] == ".notdef" {
-		//fmt.Printf("Character %d missing in WinAnsiGlyphMap\n", uint16(c))
+	r := WinAnsiRune(c)
+	if r == 0 {
 		return int(ttf.GlyphWidths[0])
 	}
-	pos, ok := ttf.Chars[uint16(c)]
+	pos, ok := ttf.Chars[r]
 	if !ok {
 		//fmt.Printf("Character %s (%04x) missing\n", metrics.WinAnsiGlyphMap[c], uint16(c))
 		return int(ttf.GlyphWidths[0])
@@ -194,26 +187,41 @@ func fontScalingFactor(glyphSpaceUnits, userSpaceUnits float64) int {
 	return int(userSpaceUnits / glyphSpaceUnits * 1000)
 }
 
-// TextWidth represents the width in user space units for a given text string, font name and font size.
-func TextWidth(text, fontName string, fontSize int) float64 {
-	var width float64
+// RuneWidth returns the width of r for an installed user font in glyph space units.
+func RuneWidth(fontName string, r rune) int {
+	ttf := UserFontMetrics[fontName]
+	if pos, ok := ttf.Chars[r]; ok && int(pos) < len(ttf.GlyphWidths) {
+		return ttf.GlyphWidths[pos]
+	}
+	return ttf.GlyphWidths[0]
+}
+
+// glyphSpaceWidth returns the width of text in glyph space units.
+// User fonts are measured by rune, all other fonts using CP1252.
+func glyphSpaceWidth(text, fontName string) int {
+	var w int
+	if IsUserFont(fontName) {
+		for _, r := range text {
+			w += RuneWidth(fontName, r)
+		}
+		return w
+	}
+	text = WinAnsiEncode(text)
 	for i := 0; i < len(text); i++ {
-		w := CharWidth(fontName, int(text[i]))
-		width += userSpaceUnits(float64(w), fontSize)
+		w += CharWidth(fontName, int(text[i]))
 	}
-	//fmt.Printf("TextWidth:%.2f\n", width)
-	return width
+	return w
+}
+
+// TextWidth represents the width in user space units for a given text string, font name and font size.
+func TextWidth(text, fontName string, fontSize int) float64 {
+	return userSpaceUnits(float64(glyphSpaceWidth(text, fontName)), fontSize)
 }
 
 // Size returns the needed font size (aka. font scaling factor) in points
 // for rendering a given text string using a given font name with a given user space width.
 func Size(text, fontName string, width float64) int {
-	var i int
-	for j := 0; j < len(text); j++ {
-		i += CharWidth(fontName, int(text[j]))
-	}
-	//fmt.Printf("FontSize:%d\n", fontScalingFactor(float64(i), width))
-	return fontScalingFactor(float64(i), width)
+	return fontScalingFactor(float64(glyphSpaceWidth(text, fontName)), width)
 }
 
 // UserSpaceFontBBox returns the font box for given font name and font size in user space coordinates.
@@ -0,0 +1,47 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package font
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTextWidth(t *testing.T) {
+
+	UserFontMetrics["Test"] = TTFLight{
+		GlyphWidths: []int{500, 600, 1000},
+		Chars:       map[rune]uint16{'a': 1, 'Ж': 2, '字': 2, '😀': 2},
+	}
+	defer delete(UserFontMetrics, "Test")
+
+	for _, tt := range []struct {
+		text, fontName string
+		want           float64
+	}{
+		{"é", "Helvetica", 5.56}, // CP1252 eacute
+		{"Ж", "Helvetica", 5.56}, // '?'
+		{"aЖ字", "Test", 26},      // by rune
+		{"a€", "Test", 11},       // .notdef
+		{"😀", "Test", 10},        // beyond the BMP
+		{"😁", "Test", 5},         // .notdef
+	} {
+		if got := TextWidth(tt.text, tt.fontName, 10); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%q %s: got %.2f, want %.2f", tt.text, tt.fontName, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package font
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// Composite glyph flags.
+const (
+	argsAreWords   = 0x0001
+	weHaveAScale   = 0x0008
+	moreComponents = 0x0020
+	weHaveXYScale  = 0x0040
+	weHaveTwoByTwo = 0x0080
+)
+
+const (
+	checkSumMagic   = 0xB1B0AFBA
+	headCheckSumOff = 8 // head: checkSumAdjustment
+)
+
+// Tables copied unchanged into a subset.
+var subsetCopyTables = []string{"OS/2", "cvt ", "fpgm", "gasp", "name", "prep"}
+
+// Subset returns a TrueType font file holding the glyphs of fontFile needed to render rs
+// including .notdef and all glyphs referenced by composite glyphs.
+// The glyphs are renumbered keeping their order, gids maps original to new glyph ids.
+// The cmap of the subset maps the runes of rs.
+func Subset(fontFile []byte, rs []rune) (b []byte, gids map[uint16]uint16, err error) {
+
+	tables, err := parseTables(fontFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "loca", "glyf", "cmap", "post"} {
+		if _, ok := tables[tag]; !ok {
+			return nil, nil, fmt.Errorf("pdfcpu: font subset: missing table %s", tag)
+		}
+	}
+
+	fd := ttf{}
+	if err := tables["cmap"].parseCharToGlyphMappingTable(&fd); err != nil {
+		return nil, nil, err
+	}
+
+	glyphs, err := glyphData(tables)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Collect the glyphs needed.
+	used := map[uint16]bool{0: true}
+	chars := map[rune]uint16{}
+	queue := []uint16{}
+	for _, r := range rs {
+		g, ok := fd.Chars[r]
+		if !ok || int(g) >= len(glyphs) {
+			continue
+		}
+		chars[r] = g
+		if !used[g] {
+			used[g] = true
+			queue = append(queue, g)
+		}
+	}
+
+	for len(queue) > 0 {
+		g := queue[0]
+		queue = queue[1:]
+		for _, c := range components(glyphs[g]) {
+			if int(c.gid) < len(glyphs) && !used[c.gid] {
+				used[c.gid] = true
+				queue = append(queue, c.gid)
+			}
+		}
+	}
+
+	old := make([]uint16, 0, len(used))
+	for g := range used {
+		old = append(old, g)
+	}
+	sort.Slice(old, func(i, j int) bool { return old[i] < old[j] })
+
+	gids = map[uint16]uint16{}
+	for i, g := range old {
+		gids[g] = uint16(i)
+	}
+
+	glyf, loca := subsetGlyphs(glyphs, old, gids)
+
+	hmtx, err := subsetHorMetrics(tables, old)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	n := uint16(len(old))
+
+	head := patched(tables["head"].data, 50, 1) // long loca offsets
+	binary.BigEndian.PutUint32(head[headCheckSumOff:], 0)
+
+	sub := map[string][]byte{
+		"head": head,
+		"hhea": patched(tables["hhea"].data, 34, n),
+		"maxp": patched(tables["maxp"].data, 4, n),
+		"hmtx": hmtx,
+		"loca": loca,
+		"glyf": glyf,
+		"cmap": subsetCharMap(chars, gids),
+		"post": patchedPost(tables["post"].data),
+	}
+
+	for _, tag := range subsetCopyTables {
+		if t, ok := tables[tag]; ok {
+			sub[tag] = t.data
+		}
+	}
+
+	b = writeTables(sub)
+
+	// Set head.checkSumAdjustment.
+	for i := 0; i < len(sub); i++ {
+		rec := b[12+i*16:]
+		if string(rec[:4]) == "head" {
+			off := binary.BigEndian.Uint32(rec[8:])
+			binary.BigEndian.PutUint32(b[off+headCheckSumOff:], checkSumMagic-calcTableChecksum("", b))
+		}
+	}
+
+	return b, gids, nil
+}
+
+// SubsetTag returns the six letter tag to be prefixed to the name of the font subset b.
+func SubsetTag(b []byte) string {
+	h := fnv.New32a()
+	h.Write(b)
+	sum := h.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + byte(sum%26)
+		sum /= 26
+	}
+	return string(tag)
+}
+
+// glyphData returns the glyph descriptions of the glyf table by glyph id.
+func glyphData(tables map[string]table) ([][]byte, error) {
+
+	glyf, loca := tables["glyf"].data, tables["loca"]
+	n := int(tables["maxp"].uint16(4))
+	long := tables["head"].int16(50) == 1
+
+	offset := func(i int) int {
+		if long {
+			return int(loca.uint32(i * 4))
+		}
+		return int(loca.uint16(i*2)) * 2
+	}
+
+	if long && len(loca.data) < (n+1)*4 || !long && len(loca.data) < (n+1)*2 {
+		return nil, fmt.Errorf("pdfcpu: font subset: corrupt loca table")
+	}
+
+	glyphs := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		from, thru := offset(i), offset(i+1)
+		if from > thru || thru > len(glyf) {
+			return nil, fmt.Errorf("pdfcpu: font subset: corrupt glyph %d", i)
+		}
+		glyphs[i] = glyf[from:thru]
+	}
+
+	return glyphs, nil
+}
+
+type component struct {
+	off int // offset of the glyph index within the glyph description
+	gid uint16
+}
+
+// components returns the glyphs referenced by a composite glyph description.
+func components(g []byte) []component {
+
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return nil
+	}
+
+	var cc []component
+
+	for off := 10; off+4 <= len(g); {
+		flags := binary.BigEndian.Uint16(g[off:])
+		cc = append(cc, component{off: off + 2, gid: binary.BigEndian.Uint16(g[off+2:])})
+		off += 4
+		if flags&argsAreWords > 0 {
+			off += 4
+		} else {
+			off += 2
+		}
+		switch {
+		case flags&weHaveAScale > 0:
+			off += 2
+		case flags&weHaveXYScale > 0:
+			off += 4
+		case flags&weHaveTwoByTwo > 0:
+			off += 8
+		}
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+
+	return cc
+}
+
+// subsetGlyphs returns the glyf and long loca table for the glyphs old.
+func subsetGlyphs(glyphs [][]byte, old []uint16, gids map[uint16]uint16) (glyf, loca []byte) {
+
+	var b bytes.Buffer
+	loca = make([]byte, (len(old)+1)*4)
+
+	for i, g := range old {
+		binary.BigEndian.PutUint32(loca[i*4:], uint32(b.Len()))
+		data := append([]byte{}, glyphs[g]...)
+		for _, c := range components(data) {
+			binary.BigEndian.PutUint16(data[c.off:], gids[c.gid])
+		}
+		b.Write(data)
+		for b.Len()%4 > 0 {
+			b.WriteByte(0)
+		}
+	}
+	binary.BigEndian.PutUint32(loca[len(old)*4:], uint32(b.Len()))
+
+	return b.Bytes(), loca
+}
+
+// subsetHorMetrics returns a hmtx table with a long horizontal metric for each of the glyphs old.
+func subsetHorMetrics(tables map[string]table, old []uint16) ([]byte, error) {
+
+	t := tables["hmtx"]
+	hmCount := int(tables["hhea"].uint16(34))
+	n := int(tables["maxp"].uint16(4))
+
+	if hmCount == 0 || len(t.data) < hmCount*4+(n-hmCount)*2 {
+		return nil, fmt.Errorf("pdfcpu: font subset: corrupt hmtx table")
+	}
+
+	b := make([]byte, len(old)*4)
+	for i, g := range old {
+		aw, lsb := t.uint16((hmCount-1)*4), uint16(0)
+		if int(g) < hmCount {
+			aw, lsb = t.uint16(int(g)*4), t.uint16(int(g)*4+2)
+		} else {
+			lsb = t.uint16(hmCount*4 + (int(g)-hmCount)*2)
+		}
+		binary.BigEndian.PutUint16(b[i*4:], aw)
+		binary.BigEndian.PutUint16(b[i*4+2:], lsb)
+	}
+
+	return b, nil
+}
+
+// subsetCharMap returns a cmap table with a Windows Unicode BMP format 4 subtable for chars.
+// Characters beyond the BMP are mapped by an additional Windows Unicode full repertoire format 12 subtable.
+func subsetCharMap(chars map[rune]uint16, gids map[uint16]uint16) []byte {
+
+	codes := make([]int, 0, len(chars))
+	for c := range chars {
+		if c != 0xFFFF {
+			codes = append(codes, int(c))
+		}
+	}
+	sort.Ints(codes)
+
+	subtables := [][]byte{subsetCharMapBMP(codes, chars, gids)}
+	encodings := []uint16{1}
+	if n := len(codes); n > 0 && codes[n-1] > 0xFFFF {
+		subtables = append(subtables, subsetCharMapFull(codes, chars, gids))
+		encodings = append(encodings, 10)
+	}
+
+	// cmap header and encoding records sorted by platform and encoding id.
+	off := 4 + len(subtables)*8
+	b := make([]byte, off)
+	binary.BigEndian.PutUint16(b[2:], uint16(len(subtables)))
+	for i, st := range subtables {
+		binary.BigEndian.PutUint16(b[4+i*8:], 3)
+		binary.BigEndian.PutUint16(b[6+i*8:], encodings[i])
+		binary.BigEndian.PutUint32(b[8+i*8:], uint32(off))
+		off += len(st)
+	}
+
+	for _, st := range subtables {
+		b = append(b, st...)
+	}
+
+	return b
+}
+
+// subsetCharMapFull returns a format 12 cmap subtable for the sorted codes of chars.
+func subsetCharMapFull(codes []int, chars map[rune]uint16, gids map[uint16]uint16) []byte {
+
+	// Groups of consecutive codes mapping to consecutive glyphs.
+	type group struct{ start, end, glyph uint32 }
+	var groups []group
+	for _, c := range codes {
+		g := uint32(gids[chars[rune(c)]])
+		if l := len(groups) - 1; l >= 0 && int(groups[l].end)+1 == c && groups[l].glyph+uint32(c)-groups[l].start == g {
+			groups[l].end++
+			continue
+		}
+		groups = append(groups, group{uint32(c), uint32(c), g})
+	}
+
+	b := make([]byte, 16+len(groups)*12)
+	binary.BigEndian.PutUint16(b[0:], 12)
+	binary.BigEndian.PutUint32(b[4:], uint32(len(b)))
+	binary.BigEndian.PutUint32(b[12:], uint32(len(groups)))
+	for i, g := range groups {
+		binary.BigEndian.PutUint32(b[16+i*12:], g.start)
+		binary.BigEndian.PutUint32(b[20+i*12:], g.end)
+		binary.BigEndian.PutUint32(b[24+i*12:], g.glyph)
+	}
+
+	return b
+}
+
+// subsetCharMapBMP returns a format 4 cmap subtable for the BMP characters of the sorted codes of chars.
+func subsetCharMapBMP(codes []int, chars map[rune]uint16, gids map[uint16]uint16) []byte {
+
+	// Segments of consecutive codes mapping to consecutive glyphs.
+	type segment struct{ start, end, delta uint16 }
+	var segs []segment
+	for _, c := range codes {
+		if c > 0xFFFF {
+			break
+		}
+		delta := gids[chars[rune(c)]] - uint16(c)
+		if l := len(segs) - 1; l >= 0 && int(segs[l].end)+1 == c && segs[l].delta == delta {
+			segs[l].end++
+			continue
+		}
+		segs = append(segs, segment{uint16(c), uint16(c), delta})
+	}
+	segs = append(segs, segment{0xFFFF, 0xFFFF, 1})
+
+	segCount := len(segs)
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= segCount {
+		searchRange *= 2
+		entrySelector++
+	}
+	searchRange *= 2
+
+	length := 16 + segCount*8
+	st := make([]byte, length)
+
+	binary.BigEndian.PutUint16(st[0:], 4)
+	binary.BigEndian.PutUint16(st[2:], uint16(length))
+	binary.BigEndian.PutUint16(st[6:], uint16(segCount*2))
+	binary.BigEndian.PutUint16(st[8:], uint16(searchRange))
+	binary.BigEndian.PutUint16(st[10:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(st[12:], uint16(segCount*2-searchRange))
+
+	endOff := 14
+	startOff := endOff + segCount*2 + 2
+	deltaOff := startOff + segCount*2
+	for i, s := range segs {
+		binary.BigEndian.PutUint16(st[endOff+i*2:], s.end)
+		binary.BigEndian.PutUint16(st[startOff+i*2:], s.start)
+		binary.BigEndian.PutUint16(st[deltaOff+i*2:], s.delta)
+		// idRangeOffsets remain 0.
+	}
+
+	return st
+}
+
+// patched returns a copy of table data with the uint16 at off set to v.
+func patched(data []byte, off int, v uint16) []byte {
+	b := append([]byte{}, data...)
+	binary.BigEndian.PutUint16(b[off:], v)
+	return b
+}
+
+// patchedPost returns a version 3.0 post table, glyph names are dropped.
+func patchedPost(data []byte) []byte {
+	b := make([]byte, 32)
+	copy(b, data)
+	binary.BigEndian.PutUint32(b, 0x00030000)
+	return b
+}
+
+// writeTables returns a TrueType font file made of tables.
+func writeTables(tables map[string][]byte) []byte {
+
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	n := len(tags)
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= n {
+		searchRange *= 2
+		entrySelector++
+	}
+	searchRange *= 16
+
+	dir := make([]byte, 12+n*16)
+	copy(dir, scalerType)
+	binary.BigEndian.PutUint16(dir[4:], uint16(n))
+	binary.BigEndian.PutUint16(dir[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(dir[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(dir[10:], uint16(n*16-searchRange))
+
+	var b bytes.Buffer
+	off := uint32(len(dir))
+
+	for i, tag := range tags {
+		data := tables[tag]
+		rec := dir[12+i*16:]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[4:], calcTableChecksum(tag, data))
+		binary.BigEndian.PutUint32(rec[8:], off)
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(data)))
+		b.Write(data)
+		l := getNext32BitAlignedLength(uint32(len(data)))
+		b.Write(make([]byte, l-uint32(len(data))))
+		off += l
+	}
+
+	return append(dir, b.Bytes()...)
+}
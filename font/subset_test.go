@@ -0,0 +1,156 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package font
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testFont returns a font with the glyphs .notdef, A, B and C using short loca offsets.
+// B is a composite glyph made of C, 😀 is rendered using A.
+func testFont() []byte {
+
+	simple := make([]byte, 12) // no contours
+	composite := make([]byte, 16)
+	binary.BigEndian.PutUint16(composite, 0xFFFF) // numberOfContours -1
+	binary.BigEndian.PutUint16(composite[12:], 3) // glyphIndex, args are bytes
+
+	glyphs := [][]byte{nil, simple, composite, simple}
+
+	var glyf []byte
+	loca := make([]byte, (len(glyphs)+1)*2)
+	for i, g := range glyphs {
+		binary.BigEndian.PutUint16(loca[i*2:], uint16(len(glyf)/2))
+		glyf = append(glyf, g...)
+	}
+	binary.BigEndian.PutUint16(loca[len(glyphs)*2:], uint16(len(glyf)/2))
+
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint16(head[18:], 1000) // unitsPerEm
+
+	hhea := make([]byte, 36)
+	binary.BigEndian.PutUint16(hhea[34:], 2) // numberOfHMetrics
+
+	maxp := make([]byte, 6)
+	binary.BigEndian.PutUint16(maxp[4:], uint16(len(glyphs)))
+
+	// Advance widths of .notdef and A, left side bearings of B and C.
+	hmtx := []byte{0x01, 0xF4, 0, 1, 0x02, 0x58, 0, 2, 0, 7, 0, 8}
+
+	chars := map[rune]uint16{'A': 1, 'B': 2, 'C': 3, '😀': 1}
+	gids := map[uint16]uint16{0: 0, 1: 1, 2: 2, 3: 3}
+
+	return writeTables(map[string][]byte{
+		"head": head,
+		"hhea": hhea,
+		"maxp": maxp,
+		"hmtx": hmtx,
+		"loca": loca,
+		"glyf": glyf,
+		"cmap": subsetCharMap(chars, gids),
+		"post": make([]byte, 32),
+	})
+}
+
+func TestSubset(t *testing.T) {
+
+	b, gids, err := Subset(testFont(), []rune("BB"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[uint16]uint16{0: 0, 2: 1, 3: 2}; !reflect.DeepEqual(gids, want) {
+		t.Errorf("gids: got %v, want %v", gids, want)
+	}
+
+	tables, err := parseTables(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sum := calcTableChecksum("", b); sum != checkSumMagic {
+		t.Errorf("file checksum: got %08x, want %08x", sum, checkSumMagic)
+	}
+
+	if n := tables["maxp"].uint16(4); n != 3 {
+		t.Errorf("numGlyphs: got %d, want 3", n)
+	}
+
+	glyphs, err := glyphData(tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cc := components(glyphs[1]); len(cc) != 1 || cc[0].gid != 2 {
+		t.Errorf("components: got %v, want glyph 2", cc)
+	}
+
+	if want := []byte{0x01, 0xF4, 0, 1, 0x02, 0x58, 0, 7, 0x02, 0x58, 0, 8}; !reflect.DeepEqual(tables["hmtx"].data, want) {
+		t.Errorf("hmtx: got %v, want %v", tables["hmtx"].data, want)
+	}
+
+	fd := ttf{}
+	if err := tables["cmap"].parseCharToGlyphMappingTable(&fd); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[rune]uint16{'B': 1}; !reflect.DeepEqual(fd.Chars, want) {
+		t.Errorf("cmap: got %v, want %v", fd.Chars, want)
+	}
+
+	if tag := SubsetTag(b); len(tag) != 6 || tag != SubsetTag(b) {
+		t.Errorf("invalid subset tag %q", tag)
+	}
+}
+
+func TestSubsetBeyondBMP(t *testing.T) {
+
+	// Both A and 😀 render glyph 1 of the subset.
+	b, _, err := Subset(testFont(), []rune("A😀"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := parseTables(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Format 4 and format 12 subtables.
+	cmap := tables["cmap"]
+	if n := cmap.uint16(2); n != 2 || cmap.uint16(12) != 3 || cmap.uint16(14) != 10 {
+		t.Fatalf("cmap: got %d encoding records", n)
+	}
+
+	fd := ttf{}
+	if err := cmap.parseCharToGlyphMappingTable(&fd); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[rune]uint16{'A': 1, '😀': 1}; !reflect.DeepEqual(fd.Chars, want) {
+		t.Errorf("cmap: got %v, want %v", fd.Chars, want)
+	}
+
+	// The BMP subtable alone.
+	st := cmap.data[cmap.uint32(8):cmap.uint32(16)]
+	fd.Chars = map[rune]uint16{}
+	if err := (table{data: st}).parseWinUnicodeBMPCharToGlyphMappingTable(&fd); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[rune]uint16{'A': 1}; !reflect.DeepEqual(fd.Chars, want) {
+		t.Errorf("format 4: got %v, want %v", fd.Chars, want)
+	}
+}
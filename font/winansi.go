@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package font
+
+import "strings"
+
+// winAnsiRunes maps the CP1252 codes 0x80-0x9F to Unicode.
+// All other codes are identical to ISO-8859-1.
+var winAnsiRunes = map[int]rune{
+	0x80: 0x20AC, // Euro
+	0x82: 0x201A, // quotesinglbase
+	0x83: 0x0192, // florin
+	0x84: 0x201E, // quotedblbase
+	0x85: 0x2026, // ellipsis
+	0x86: 0x2020, // dagger
+	0x87: 0x2021, // daggerdbl
+	0x88: 0x02C6, // circumflex
+	0x89: 0x2030, // perthousand
+	0x8A: 0x0160, // Scaron
+	0x8B: 0x2039, // guilsinglleft
+	0x8C: 0x0152, // OE
+	0x8E: 0x017D, // Zcaron
+	0x91: 0x2018, // quoteleft
+	0x92: 0x2019, // quoteright
+	0x93: 0x201C, // quotedblleft
+	0x94: 0x201D, // quotedblright
+	0x95: 0x2022, // bullet
+	0x96: 0x2013, // endash
+	0x97: 0x2014, // emdash
+	0x98: 0x02DC, // tilde
+	0x99: 0x2122, // trademark
+	0x9A: 0x0161, // scaron
+	0x9B: 0x203A, // guilsinglright
+	0x9C: 0x0153, // oe
+	0x9E: 0x017E, // zcaron
+	0x9F: 0x0178, // Ydieresis
+}
+
+var winAnsiCodes = map[rune]byte{}
+
+func init() {
+	for c, r := range winAnsiRunes {
+		winAnsiCodes[r] = byte(c)
+	}
+}
+
+// WinAnsiRune returns the Unicode code point for the CP1252 character code c
+// or 0 if c is undefined.
+func WinAnsiRune(c int) rune {
+	if c < 0 || c > 0xFF || c == 0x7F {
+		return 0
+	}
+	if c >= 0x80 && c <= 0x9F {
+		return winAnsiRunes[c]
+	}
+	return rune(c)
+}
+
+// WinAnsiEncode encodes the UTF-8 string s using CP1252.
+// Characters not representable are replaced by '?'.
+func WinAnsiEncode(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r < 0x80 || r >= 0xA0 && r <= 0xFF:
+			sb.WriteByte(byte(r))
+		case winAnsiCodes[r] != 0:
+			sb.WriteByte(winAnsiCodes[r])
+		default:
+			sb.WriteByte('?')
+		}
+	}
+	return sb.String()
+}
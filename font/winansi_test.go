@@ -0,0 +1,50 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package font
+
+import "testing"
+
+func TestWinAnsi(t *testing.T) {
+
+	for _, tt := range []struct {
+		s, want string
+	}{
+		{"abc", "abc"},
+		{"Café", "Caf\xe9"},
+		{"€ – “x”", "\x80 \x96 \x93x\x94"},
+		{"Ω", "?"},
+	} {
+		if got := WinAnsiEncode(tt.s); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.s, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		c    int
+		want rune
+	}{
+		{'A', 'A'},
+		{0x80, '€'},
+		{0x81, 0},
+		{0x9F, 'Ÿ'},
+		{0xE9, 'é'},
+	} {
+		if got := WinAnsiRune(tt.c); got != tt.want {
+			t.Errorf("%#x: got %q, want %q", tt.c, got, tt.want)
+		}
+	}
+}
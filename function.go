@@ -0,0 +1,765 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+// Evaluation of PDF functions (see 7.10) as used by tint transformations.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// pdfFunction maps m input values to n output values.
+type pdfFunction interface {
+	eval(in []float64) ([]float64, error)
+}
+
+// functionBase holds the entries common to all function types (see 7.10.1, Table 38).
+type functionBase struct {
+	domain []float64
+	rng    []float64 // optional for types 2 and 3
+}
+
+func clip(x, min, max float64) float64 {
+	return math.Max(min, math.Min(max, x))
+}
+
+func interpolate(x, xmin, xmax, ymin, ymax float64) float64 {
+	if xmax == xmin {
+		return ymin
+	}
+	return ymin + (x-xmin)*(ymax-ymin)/(xmax-xmin)
+}
+
+func (fb functionBase) clipInput(in []float64) ([]float64, error) {
+	if len(in)*2 != len(fb.domain) {
+		return nil, fmt.Errorf("pdfcpu: function: expected %d input values, got %d", len(fb.domain)/2, len(in))
+	}
+	out := make([]float64, len(in))
+	for i, x := range in {
+		out[i] = clip(x, fb.domain[2*i], fb.domain[2*i+1])
+	}
+	return out, nil
+}
+
+func (fb functionBase) clipOutput(out []float64) []float64 {
+	for i := range out {
+		if 2*i+1 < len(fb.rng) {
+			out[i] = clip(out[i], fb.rng[2*i], fb.rng[2*i+1])
+		}
+	}
+	return out
+}
+
+// sampledFunction represents a type 0 function (see 7.10.2).
+type sampledFunction struct {
+	functionBase
+	size    []int
+	bps     int
+	encode  []float64
+	decode  []float64
+	samples []byte
+}
+
+func (f sampledFunction) sample(i int) float64 {
+	var v uint64
+	bit := i * f.bps
+	for j := 0; j < f.bps; j++ {
+		b := bit + j
+		if b/8 < len(f.samples) {
+			v = v<<1 | uint64(f.samples[b/8]>>(7-uint(b%8))&1)
+		} else {
+			v <<= 1
+		}
+	}
+	return float64(v)
+}
+
+func (f sampledFunction) eval(in []float64) ([]float64, error) {
+
+	in, err := f.clipInput(in)
+	if err != nil {
+		return nil, err
+	}
+
+	m, n := len(f.size), len(f.rng)/2
+
+	// Position within the sample table for each input dimension.
+	e := make([]float64, m)
+	for i, x := range in {
+		e[i] = clip(interpolate(x, f.domain[2*i], f.domain[2*i+1], f.encode[2*i], f.encode[2*i+1]), 0, float64(f.size[i]-1))
+	}
+
+	out := make([]float64, n)
+	max := math.Exp2(float64(f.bps)) - 1
+
+	// Multilinear interpolation between the 2^m surrounding samples.
+	for corner := 0; corner < 1<<uint(m); corner++ {
+
+		weight, index, stride := 1.0, 0, 1
+
+		for i := 0; i < m; i++ {
+			lo := math.Floor(e[i])
+			frac := e[i] - lo
+			j := int(lo)
+			if corner>>uint(i)&1 == 1 {
+				if j+1 < f.size[i] {
+					j++
+				}
+				weight *= frac
+			} else {
+				weight *= 1 - frac
+			}
+			index += j * stride
+			stride *= f.size[i]
+		}
+
+		if weight == 0 {
+			continue
+		}
+
+		for k := 0; k < n; k++ {
+			out[k] += weight * f.sample(index*n+k)
+		}
+	}
+
+	for k := range out {
+		out[k] = interpolate(out[k], 0, max, f.decode[2*k], f.decode[2*k+1])
+	}
+
+	return f.clipOutput(out), nil
+}
+
+// exponentialFunction represents a type 2 function (see 7.10.3).
+type exponentialFunction struct {
+	functionBase
+	c0, c1 []float64
+	n      float64
+}
+
+func (f exponentialFunction) eval(in []float64) ([]float64, error) {
+
+	in, err := f.clipInput(in)
+	if err != nil {
+		return nil, err
+	}
+
+	xn := math.Pow(in[0], f.n)
+
+	out := make([]float64, len(f.c0))
+	for i := range out {
+		out[i] = f.c0[i] + xn*(f.c1[i]-f.c0[i])
+	}
+
+	return f.clipOutput(out), nil
+}
+
+// stitchingFunction represents a type 3 function (see 7.10.4).
+type stitchingFunction struct {
+	functionBase
+	functions []pdfFunction
+	bounds    []float64
+	encode    []float64
+}
+
+func (f stitchingFunction) eval(in []float64) ([]float64, error) {
+
+	in, err := f.clipInput(in)
+	if err != nil {
+		return nil, err
+	}
+
+	x := in[0]
+
+	k := 0
+	for k < len(f.bounds) && x >= f.bounds[k] {
+		k++
+	}
+
+	lo, hi := f.domain[0], f.domain[1]
+	if k > 0 {
+		lo = f.bounds[k-1]
+	}
+	if k < len(f.bounds) {
+		hi = f.bounds[k]
+	}
+
+	out, err := f.functions[k].eval([]float64{interpolate(x, lo, hi, f.encode[2*k], f.encode[2*k+1])})
+	if err != nil {
+		return nil, err
+	}
+
+	return f.clipOutput(out), nil
+}
+
+// calculatorFunction represents a type 4 function (see 7.10.5).
+type calculatorFunction struct {
+	functionBase
+	prog []psToken
+}
+
+// psToken represents a number, an operator or a procedure of a PostScript calculator program.
+type psToken struct {
+	op   string
+	num  float64
+	proc []psToken
+}
+
+func parsePSProc(tokens []string, i int) ([]psToken, int, error) {
+
+	var proc []psToken
+
+	for i < len(tokens) {
+
+		t := tokens[i]
+		i++
+
+		switch t {
+
+		case "{":
+			p, j, err := parsePSProc(tokens, i)
+			if err != nil {
+				return nil, 0, err
+			}
+			proc = append(proc, psToken{proc: p})
+			i = j
+
+		case "}":
+			return proc, i, nil
+
+		default:
+			if f, err := strconv.ParseFloat(t, 64); err == nil {
+				proc = append(proc, psToken{num: f})
+				continue
+			}
+			proc = append(proc, psToken{op: t})
+		}
+	}
+
+	return nil, 0, errors.New("pdfcpu: function: unterminated PostScript procedure")
+}
+
+func parseCalculatorProgram(s string) ([]psToken, error) {
+
+	s = strings.NewReplacer("{", " { ", "}", " } ").Replace(s)
+	tokens := strings.Fields(s)
+
+	if len(tokens) == 0 || tokens[0] != "{" {
+		return nil, errors.New("pdfcpu: function: missing PostScript procedure")
+	}
+
+	prog, _, err := parsePSProc(tokens, 1)
+
+	return prog, err
+}
+
+// psStack represents the operand stack of a PostScript calculator.
+type psStack []float64
+
+var errPSStack = errors.New("pdfcpu: function: PostScript stack underflow")
+
+func (s *psStack) push(f float64) {
+	*s = append(*s, f)
+}
+
+func (s *psStack) pop() (float64, error) {
+	if len(*s) == 0 {
+		return 0, errPSStack
+	}
+	f := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+	return f, nil
+}
+
+func (s *psStack) pop2() (float64, float64, error) {
+	b, err := s.pop()
+	if err != nil {
+		return 0, 0, err
+	}
+	a, err := s.pop()
+	return a, b, err
+}
+
+func psBool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var psUnaryOps = map[string]func(float64) float64{
+	"abs":      math.Abs,
+	"ceiling":  math.Ceil,
+	"cos":      func(x float64) float64 { return math.Cos(x * math.Pi / 180) },
+	"cvi":      math.Trunc,
+	"cvr":      func(x float64) float64 { return x },
+	"floor":    math.Floor,
+	"ln":       math.Log,
+	"log":      math.Log10,
+	"neg":      func(x float64) float64 { return -x },
+	"round":    func(x float64) float64 { return math.Floor(x + .5) },
+	"sin":      func(x float64) float64 { return math.Sin(x * math.Pi / 180) },
+	"sqrt":     math.Sqrt,
+	"truncate": math.Trunc,
+	"not": func(x float64) float64 {
+		// Booleans are represented by 0 and 1.
+		if x == 0 || x == 1 {
+			return 1 - x
+		}
+		return float64(^int64(x))
+	},
+}
+
+var psBinaryOps = map[string]func(a, b float64) float64{
+	"add": func(a, b float64) float64 { return a + b },
+	"sub": func(a, b float64) float64 { return a - b },
+	"mul": func(a, b float64) float64 { return a * b },
+	"div": func(a, b float64) float64 { return a / b },
+	"idiv": func(a, b float64) float64 {
+		if int64(b) == 0 {
+			return 0
+		}
+		return float64(int64(a) / int64(b))
+	},
+	"mod": func(a, b float64) float64 {
+		if int64(b) == 0 {
+			return 0
+		}
+		return float64(int64(a) % int64(b))
+	},
+	"exp": math.Pow,
+	"atan": func(a, b float64) float64 {
+		d := math.Atan2(a, b) * 180 / math.Pi
+		if d < 0 {
+			d += 360
+		}
+		return d
+	},
+	"and":      func(a, b float64) float64 { return float64(int64(a) & int64(b)) },
+	"or":       func(a, b float64) float64 { return float64(int64(a) | int64(b)) },
+	"xor":      func(a, b float64) float64 { return float64(int64(a) ^ int64(b)) },
+	"bitshift": psBitshift,
+	"eq":       func(a, b float64) float64 { return psBool(a == b) },
+	"ne":       func(a, b float64) float64 { return psBool(a != b) },
+	"gt":       func(a, b float64) float64 { return psBool(a > b) },
+	"ge":       func(a, b float64) float64 { return psBool(a >= b) },
+	"lt":       func(a, b float64) float64 { return psBool(a < b) },
+	"le":       func(a, b float64) float64 { return psBool(a <= b) },
+}
+
+func psBitshift(a, b float64) float64 {
+	if b < 0 {
+		return float64(int64(a) >> uint(-b))
+	}
+	return float64(int64(a) << uint(b))
+}
+
+func (s *psStack) stackOp(op string) (bool, error) {
+
+	switch op {
+
+	case "true":
+		s.push(1)
+
+	case "false":
+		s.push(0)
+
+	case "pop":
+		_, err := s.pop()
+		return true, err
+
+	case "exch":
+		a, b, err := s.pop2()
+		if err != nil {
+			return true, err
+		}
+		s.push(b)
+		s.push(a)
+
+	case "dup":
+		a, err := s.pop()
+		if err != nil {
+			return true, err
+		}
+		s.push(a)
+		s.push(a)
+
+	case "copy":
+		n, err := s.pop()
+		if err != nil {
+			return true, err
+		}
+		if int(n) < 0 || int(n) > len(*s) {
+			return true, errPSStack
+		}
+		*s = append(*s, (*s)[len(*s)-int(n):]...)
+
+	case "index":
+		n, err := s.pop()
+		if err != nil {
+			return true, err
+		}
+		if int(n) < 0 || int(n) >= len(*s) {
+			return true, errPSStack
+		}
+		s.push((*s)[len(*s)-1-int(n)])
+
+	case "roll":
+		n, j, err := s.pop2()
+		if err != nil {
+			return true, err
+		}
+		if int(n) < 0 || int(n) > len(*s) {
+			return true, errPSStack
+		}
+		if int(n) == 0 {
+			return true, nil
+		}
+		t := (*s)[len(*s)-int(n):]
+		k := ((int(j) % len(t)) + len(t)) % len(t)
+		r := append(append([]float64{}, t[len(t)-k:]...), t[:len(t)-k]...)
+		copy(t, r)
+
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (s *psStack) exec(prog []psToken) error {
+
+	for i := 0; i < len(prog); i++ {
+
+		t := prog[i]
+
+		if t.proc != nil {
+			// Procedures are operands of a following if or ifelse.
+			if i+1 < len(prog) && prog[i+1].op == "if" {
+				c, err := s.pop()
+				if err != nil {
+					return err
+				}
+				if c != 0 {
+					if err = s.exec(t.proc); err != nil {
+						return err
+					}
+				}
+				i++
+				continue
+			}
+			if i+2 < len(prog) && prog[i+1].proc != nil && prog[i+2].op == "ifelse" {
+				c, err := s.pop()
+				if err != nil {
+					return err
+				}
+				p := prog[i+1].proc
+				if c != 0 {
+					p = t.proc
+				}
+				if err = s.exec(p); err != nil {
+					return err
+				}
+				i += 2
+				continue
+			}
+			return errors.New("pdfcpu: function: unexpected PostScript procedure")
+		}
+
+		if t.op == "" {
+			s.push(t.num)
+			continue
+		}
+
+		if f, ok := psUnaryOps[t.op]; ok {
+			a, err := s.pop()
+			if err != nil {
+				return err
+			}
+			s.push(f(a))
+			continue
+		}
+
+		if f, ok := psBinaryOps[t.op]; ok {
+			a, b, err := s.pop2()
+			if err != nil {
+				return err
+			}
+			s.push(f(a, b))
+			continue
+		}
+
+		ok, err := s.stackOp(t.op)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("pdfcpu: function: unsupported PostScript operator %s", t.op)
+		}
+	}
+
+	return nil
+}
+
+func (f calculatorFunction) eval(in []float64) ([]float64, error) {
+
+	in, err := f.clipInput(in)
+	if err != nil {
+		return nil, err
+	}
+
+	s := psStack(in)
+	if err = s.exec(f.prog); err != nil {
+		return nil, err
+	}
+
+	n := len(f.rng) / 2
+	if len(s) < n {
+		return nil, errPSStack
+	}
+
+	out := append([]float64{}, s[len(s)-n:]...)
+
+	return f.clipOutput(out), nil
+}
+
+// numberArray returns the numbers of the array o, which may be an indirect reference.
+func (xRefTable *XRefTable) numberArray(o Object) ([]float64, error) {
+
+	a, err := xRefTable.DereferenceArray(o)
+	if err != nil || a == nil {
+		return nil, err
+	}
+
+	ff := make([]float64, len(a))
+	for i, o := range a {
+		if ff[i], err = xRefTable.DereferenceNumber(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return ff, nil
+}
+
+// parseFunction returns the function represented by the dict or stream dict o.
+func (xRefTable *XRefTable) parseFunction(o Object) (pdfFunction, error) {
+
+	o, err := xRefTable.Dereference(o)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		d  Dict
+		sd *StreamDict
+	)
+
+	switch o := o.(type) {
+	case Dict:
+		d = o
+	case StreamDict:
+		sd, d = &o, o.Dict
+	default:
+		return nil, fmt.Errorf("pdfcpu: function: corrupt function object: %v", o)
+	}
+
+	ft := d.IntEntry("FunctionType")
+	if ft == nil {
+		return nil, errors.New("pdfcpu: function: missing \"FunctionType\"")
+	}
+
+	var fb functionBase
+
+	if fb.domain, err = xRefTable.numberArray(d["Domain"]); err != nil {
+		return nil, err
+	}
+	if len(fb.domain) == 0 || len(fb.domain)%2 > 0 {
+		return nil, errors.New("pdfcpu: function: corrupt \"Domain\"")
+	}
+
+	if fb.rng, err = xRefTable.numberArray(d["Range"]); err != nil {
+		return nil, err
+	}
+	if len(fb.rng)%2 > 0 {
+		return nil, errors.New("pdfcpu: function: corrupt \"Range\"")
+	}
+
+	switch *ft {
+
+	case 0:
+		return xRefTable.sampledFunction(fb, sd)
+
+	case 2:
+		return xRefTable.exponentialFunction(fb, d)
+
+	case 3:
+		return xRefTable.stitchingFunction(fb, d)
+
+	case 4:
+		if sd == nil || len(fb.rng) == 0 {
+			return nil, errors.New("pdfcpu: function: corrupt type 4 function")
+		}
+		if err = decodeStream(sd); err != nil {
+			return nil, err
+		}
+		prog, err := parseCalculatorProgram(string(sd.Content))
+		if err != nil {
+			return nil, err
+		}
+		return calculatorFunction{functionBase: fb, prog: prog}, nil
+	}
+
+	return nil, fmt.Errorf("pdfcpu: function: invalid \"FunctionType\" %d", *ft)
+}
+
+func (xRefTable *XRefTable) sampledFunction(fb functionBase, sd *StreamDict) (pdfFunction, error) {
+
+	if sd == nil || len(fb.rng) == 0 {
+		return nil, errors.New("pdfcpu: function: corrupt type 0 function")
+	}
+
+	f := sampledFunction{functionBase: fb}
+
+	size, err := xRefTable.numberArray(sd.Dict["Size"])
+	if err != nil {
+		return nil, err
+	}
+	if len(size) != len(fb.domain)/2 {
+		return nil, errors.New("pdfcpu: function: corrupt \"Size\"")
+	}
+
+	n := len(fb.rng) / 2
+	total := n
+	for _, s := range size {
+		if s < 1 || s > 1<<16 {
+			return nil, errors.New("pdfcpu: function: corrupt \"Size\"")
+		}
+		f.size = append(f.size, int(s))
+		total *= int(s)
+	}
+
+	bps := sd.IntEntry("BitsPerSample")
+	if bps == nil || !IntMemberOf(*bps, []int{1, 2, 4, 8, 12, 16, 24, 32}) {
+		return nil, errors.New("pdfcpu: function: corrupt \"BitsPerSample\"")
+	}
+	f.bps = *bps
+
+	if f.encode, err = xRefTable.numberArray(sd.Dict["Encode"]); err != nil {
+		return nil, err
+	}
+	if f.encode == nil {
+		for _, s := range f.size {
+			f.encode = append(f.encode, 0, float64(s-1))
+		}
+	}
+
+	if f.decode, err = xRefTable.numberArray(sd.Dict["Decode"]); err != nil {
+		return nil, err
+	}
+	if f.decode == nil {
+		f.decode = fb.rng
+	}
+
+	if len(f.encode) != len(fb.domain) || len(f.decode) != len(fb.rng) {
+		return nil, errors.New("pdfcpu: function: corrupt \"Encode\" or \"Decode\"")
+	}
+
+	if err = decodeStream(sd); err != nil {
+		return nil, err
+	}
+
+	if len(sd.Content)*8 < total*f.bps {
+		return nil, errors.New("pdfcpu: function: insufficient sample data")
+	}
+
+	f.samples = sd.Content
+
+	return f, nil
+}
+
+func (xRefTable *XRefTable) exponentialFunction(fb functionBase, d Dict) (pdfFunction, error) {
+
+	if len(fb.domain) != 2 {
+		return nil, errors.New("pdfcpu: function: type 2 function needs 1 input value")
+	}
+
+	f := exponentialFunction{functionBase: fb, c0: []float64{0}, c1: []float64{1}}
+
+	var err error
+
+	if o, found := d.Find("C0"); found {
+		if f.c0, err = xRefTable.numberArray(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if o, found := d.Find("C1"); found {
+		if f.c1, err = xRefTable.numberArray(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(f.c0) != len(f.c1) {
+		return nil, errors.New("pdfcpu: function: \"C0\" and \"C1\" differ in size")
+	}
+
+	if f.n, err = xRefTable.DereferenceNumber(d["N"]); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (xRefTable *XRefTable) stitchingFunction(fb functionBase, d Dict) (pdfFunction, error) {
+
+	if len(fb.domain) != 2 {
+		return nil, errors.New("pdfcpu: function: type 3 function needs 1 input value")
+	}
+
+	f := stitchingFunction{functionBase: fb}
+
+	a, err := xRefTable.DereferenceArray(d["Functions"])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range a {
+		fn, err := xRefTable.parseFunction(o)
+		if err != nil {
+			return nil, err
+		}
+		f.functions = append(f.functions, fn)
+	}
+
+	if f.bounds, err = xRefTable.numberArray(d["Bounds"]); err != nil {
+		return nil, err
+	}
+
+	if f.encode, err = xRefTable.numberArray(d["Encode"]); err != nil {
+		return nil, err
+	}
+
+	k := len(f.functions)
+	if k == 0 || len(f.bounds) != k-1 || len(f.encode) != 2*k {
+		return nil, errors.New("pdfcpu: function: corrupt type 3 function")
+	}
+
+	return f, nil
+}
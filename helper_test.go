@@ -0,0 +1,70 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// minimalPDF returns a single page PDF file using a classic xref table.
+func minimalPDF() []byte {
+
+	return testPDF([]string{
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]/Resources<<>>>>",
+		"<</Producer(test)>>",
+	})
+}
+
+// testPDF returns a PDF file made of objs numbered from 1 with the catalog 1 0 R and the info dict 4 0 R.
+func testPDF(objs []string) []byte {
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+
+	fmt.Fprintf(&b, "trailer\n<</Size %d/Root 1 0 R/Info 4 0 R/ID[<0123456789abcdef><0123456789abcdef>]>>\n", len(objs)+1)
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xref)
+
+	return b.Bytes()
+}
+
+// readMinimalPDF returns the context of minimalPDF.
+func readMinimalPDF(t *testing.T) *Context {
+	t.Helper()
+
+	ctx, err := Read(bytes.NewReader(minimalPDF()), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ctx
+}
@@ -17,12 +17,14 @@ limitations under the License.
 package pdflite
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
 
+	"github.com/zean00/pdfcpulite/filter"
 	"github.com/zean00/pdfcpulite/types"
 )
 
@@ -415,7 +417,6 @@ func importImagePDFBytes(wr io.Writer, pageDim *Dim, imgWidth, imgHeight float64
 		m[0][0], m[0][1], m[1][0], m[1][1], m[2][0], m[2][1])
 }
 
-/*
 // NewPageForImage creates a new page dict in xRefTable for given image reader r.
 func NewPageForImage(xRefTable *XRefTable, r io.Reader, parentIndRef *IndirectRef, imp *Import) (*IndirectRef, error) {
 
@@ -476,4 +477,40 @@ func NewPageForImage(xRefTable *XRefTable, r io.Reader, parentIndRef *IndirectRe
 
 	return xRefTable.IndRefForNewObject(pageDict)
 }
-*/
+
+// ImportImages appends a page for each image read from rr to the page tree of xRefTable.
+func ImportImages(xRefTable *XRefTable, rr []io.Reader, imp *Import) error {
+
+	if imp == nil {
+		imp = DefaultImportConfig()
+	}
+
+	root, err := xRefTable.Pages()
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		return errors.New("pdfcpu: importImages: missing page tree")
+	}
+
+	d, err := xRefTable.DereferenceDict(*root)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rr {
+
+		ir, err := NewPageForImage(xRefTable, r, root, imp)
+		if err != nil {
+			return err
+		}
+
+		if err = AppendPageTree(ir, 1, d); err != nil {
+			return err
+		}
+
+		xRefTable.PageCount++
+	}
+
+	return nil
+}
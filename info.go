@@ -17,9 +17,10 @@ limitations under the License.
 package pdflite
 
 import (
-	"fmt"
 	"strings"
 	"time"
+
+	"github.com/zean00/pdfcpulite/log"
 )
 
 func csvSafeString(s string) string {
@@ -34,10 +35,14 @@ func handleInfoDict(ctx *Context, d Dict) (err error) {
 		switch key {
 
 		case "Title":
-			fmt.Println("found Title")
+			ctx.Log(log.Read).Tracef("found Title")
+			ctx.Title, err = ctx.DereferenceText(value)
+			if err != nil {
+				return err
+			}
 
 		case "Author":
-			fmt.Println("found Author")
+			ctx.Log(log.Read).Tracef("found Author")
 			// Record for stats.
 			ctx.Author, err = ctx.DereferenceText(value)
 			if err != nil {
@@ -46,13 +51,22 @@ func handleInfoDict(ctx *Context, d Dict) (err error) {
 			ctx.Author = csvSafeString(ctx.Author)
 
 		case "Subject":
-			fmt.Println("found Subject")
+			ctx.Log(log.Read).Tracef("found Subject")
+			ctx.Subject, err = ctx.DereferenceText(value)
+			if err != nil {
+				return err
+			}
 
 		case "Keywords":
-			fmt.Println("found Keywords")
+			ctx.Log(log.Read).Tracef("found Keywords")
+			// Record for keyword commands.
+			ctx.Keywords, err = ctx.DereferenceText(value)
+			if err != nil {
+				return err
+			}
 
 		case "Creator":
-			fmt.Println("found Creator")
+			ctx.Log(log.Read).Tracef("found Creator")
 			// Record for stats.
 			ctx.Creator, err = ctx.DereferenceText(value)
 			if err != nil {
@@ -62,17 +76,34 @@ func handleInfoDict(ctx *Context, d Dict) (err error) {
 
 		case "Producer", "CreationDate", "ModDate":
 			// pdfcpu will modify these as direct dict entries.
-			fmt.Printf("found %s", key)
+			ctx.Log(log.Read).Tracef("found %s", key)
 			if indRef, ok := value.(IndirectRef); ok {
 				// Get rid of these extra objects.
 				ctx.Optimize.DuplicateInfoObjects[int(indRef.ObjectNumber)] = true
 			}
+			// Record the original values.
+			s, err := ctx.DereferenceText(value)
+			if err != nil {
+				return err
+			}
+			switch key {
+			case "Producer":
+				ctx.Producer = s
+			case "CreationDate":
+				ctx.CreationDate = s
+			case "ModDate":
+				ctx.ModDate = s
+			}
 
 		case "Trapped":
-			fmt.Println("found Trapped")
+			ctx.Log(log.Read).Tracef("found Trapped")
 
 		default:
-			fmt.Printf("handleInfoDict: found out of spec entry %s %v\n", key, value)
+			ctx.Log(log.Read).Debugf("handleInfoDict: found out of spec entry %s %v\n", key, value)
+			// Record text entries as document properties.
+			if v, err := ctx.DereferenceText(value); err == nil {
+				ctx.Properties[key] = v
+			}
 
 		}
 	}
@@ -136,16 +167,16 @@ func ensureInfoDict(ctx *Context) error {
 // Write the document info object for this PDF file.
 func writeDocumentInfoDict(ctx *Context) error {
 
-	fmt.Printf("*** writeDocumentInfoDict begin: offset=%d ***\n", ctx.Write.Offset)
+	ctx.Log(log.Write).Tracef("*** writeDocumentInfoDict begin: offset=%d ***\n", ctx.Write.Offset)
 
 	// Note: The document info object is optional but pdfcpu ensures one.
 
 	if ctx.Info == nil {
-		fmt.Printf("writeDocumentInfoObject end: No info object present, offset=%d\n", ctx.Write.Offset)
+		ctx.Log(log.Write).Tracef("writeDocumentInfoObject end: No info object present, offset=%d\n", ctx.Write.Offset)
 		return nil
 	}
 
-	fmt.Printf("writeDocumentInfoObject: %s\n", *ctx.Info)
+	ctx.Log(log.Write).Tracef("writeDocumentInfoObject: %s\n", *ctx.Info)
 
 	o := *ctx.Info
 
@@ -159,7 +190,7 @@ func writeDocumentInfoDict(ctx *Context) error {
 		return err
 	}
 
-	fmt.Printf("*** writeDocumentInfoDict end: offset=%d ***\n", ctx.Write.Offset)
+	ctx.Log(log.Write).Tracef("*** writeDocumentInfoDict end: offset=%d ***\n", ctx.Write.Offset)
 
 	return nil
 }
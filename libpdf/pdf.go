@@ -3,11 +3,11 @@ package libpdf
 import (
 	"encoding/json"
 	"encoding/hex"
-	"fmt"
 	"C"
 
 	"github.com/mattetti/filebuffer"
 	pdf "github.com/zean00/pdfcpulite"
+	"github.com/zean00/pdfcpulite/log"
 )
 
 //Annotation model
@@ -82,7 +82,7 @@ func extractAnnotation(bin []byte) ([]Annotation, error) {
 	for i := 1; i <= ctx.XRefTable.PageCount; i++ {
 		pd, _, err := ctx.XRefTable.PageDict(i)
 		if err != nil {
-			fmt.Println(err)
+			log.Read.Warnf("%v", err)
 			continue
 		}
 		v, ok := pd.Find("Annots")
@@ -113,7 +113,7 @@ func extractAnnotation(bin []byte) ([]Annotation, error) {
 				//fmt.Println(obj.ObjectNumber)
 				an, err := ctx.XRefTable.FindObject(obj.ObjectNumber.Value())
 				if err != nil {
-					//fmt.Println(err)
+					//log.Read.Warnf("%v", err)
 					continue
 				}
 				dict, ok := an.(pdf.Dict)
@@ -132,7 +132,7 @@ func extractAnnotation(bin []byte) ([]Annotation, error) {
 
 				r, ok := dict.Find("Rect")
 				if !ok {
-					fmt.Println("Rectangle not found")
+					log.Read.Warnf("Rectangle not found")
 					continue
 				}
 
@@ -141,24 +141,24 @@ func extractAnnotation(bin []byte) ([]Annotation, error) {
 				case pdf.IndirectRef:
 					rect, err := ctx.XRefTable.FindObject(v.ObjectNumber.Value())
 					if err != nil {
-						fmt.Println(err)
+						log.Read.Warnf("%v", err)
 						continue
 					}
 
 					coord, ok := rect.(pdf.Array)
 					if !ok {
-						fmt.Println("Not an array of coordinate")
+						log.Read.Warnf("Not an array of coordinate")
 						continue
 					}
 
 					if len(coord) != 4 {
-						fmt.Println("Invalid coordinate array")
+						log.Read.Warnf("Invalid coordinate array")
 						continue
 					}
 					box = pdf.RectForArray(coord)
 				case pdf.Array:
 					if len(v) != 4 {
-						fmt.Println("Invalid coordinate array")
+						log.Read.Warnf("Invalid coordinate array")
 						continue
 					}
 					box = pdf.RectForArray(v)
@@ -174,7 +174,7 @@ func extractAnnotation(bin []byte) ([]Annotation, error) {
 					case pdf.HexLiteral:
 						bs, err := h.Bytes()
 						if err != nil {
-							fmt.Println("Error get bytes")
+							log.Read.Warnf("Error get bytes")
 							continue
 						}
 						content = string(bs)
@@ -191,7 +191,7 @@ func extractAnnotation(bin []byte) ([]Annotation, error) {
 						case pdf.HexLiteral:
 							bs, err := h.Bytes()
 							if err != nil {
-								fmt.Println("Error get bytes")
+								log.Read.Warnf("Error get bytes")
 								continue
 							}
 							content = string(bs)
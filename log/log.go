@@ -0,0 +1,205 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package log provides leveled logging by category for pdfcpu.
+//
+// Records are passed to a log/slog Logger carrying the category as attribute "category".
+// Records logged by category go to the process wide logger installed using SetLogger,
+// records logged using an Entry go to the logger of the Entry if it has one.
+// Logging is silent until a logger is installed.
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// LevelTrace is the level used for detailed tracing of processing steps.
+const LevelTrace = slog.LevelDebug - 4
+
+// Category identifies the processing stage a log record originates from.
+type Category string
+
+// pdfcpu logs using the following categories.
+const (
+	Read     Category = "read"
+	Validate Category = "validate"
+	Optimize Category = "optimize"
+	Write    Category = "write"
+	Crypto   Category = "crypto"
+	Info     Category = "info"
+)
+
+// CategoryKey is the attribute key of the category of a log record.
+const CategoryKey = "category"
+
+type config struct {
+	logger     *slog.Logger
+	categories map[Category]bool // nil means all categories.
+}
+
+var cfg atomic.Value // *config
+
+// SetLogger installs l as the logger for records of given categories or of all categories if none are given.
+// A nil logger turns logging off.
+//
+// The logger is process wide and shared by all contexts not having a logger of their own, so SetLogger
+// is meant to be called once during program setup. It is safe to call concurrently with logging.
+func SetLogger(l *slog.Logger, categories ...Category) {
+
+	if l == nil {
+		cfg.Store((*config)(nil))
+		return
+	}
+
+	c := &config{logger: l}
+
+	if len(categories) > 0 {
+		c.categories = map[Category]bool{}
+		for _, cat := range categories {
+			c.categories[cat] = true
+		}
+	}
+
+	cfg.Store(c)
+}
+
+// Entry logs records of a category using a logger of its own, if any, see Category.To.
+type Entry struct {
+	c      Category
+	logger *slog.Logger
+}
+
+// To returns an Entry logging records of c to l if c is one of categories or categories is empty.
+// Otherwise, or if l is nil, the Entry logs to the logger installed using SetLogger.
+func (c Category) To(l *slog.Logger, categories []Category) Entry {
+
+	e := Entry{c: c}
+
+	if l == nil {
+		return e
+	}
+
+	if len(categories) == 0 {
+		e.logger = l
+		return e
+	}
+
+	for _, cat := range categories {
+		if cat == c {
+			e.logger = l
+			break
+		}
+	}
+
+	return e
+}
+
+// Enabled returns true if records of category c at given level are being logged.
+func (c Category) Enabled(level slog.Level) bool {
+	return Entry{c: c}.Enabled(level)
+}
+
+// Enabled returns true if records of e at given level are being logged.
+func (e Entry) Enabled(level slog.Level) bool {
+	return e.target(level) != nil
+}
+
+func (e Entry) target(level slog.Level) *slog.Logger {
+
+	l := e.logger
+
+	if l == nil {
+		conf, _ := cfg.Load().(*config)
+		if conf == nil {
+			return nil
+		}
+		if conf.categories != nil && !conf.categories[e.c] {
+			return nil
+		}
+		l = conf.logger
+	}
+
+	if !l.Enabled(context.Background(), level) {
+		return nil
+	}
+
+	return l
+}
+
+func (e Entry) log(level slog.Level, format string, args []interface{}) {
+
+	l := e.target(level)
+	if l == nil {
+		return
+	}
+
+	msg := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+
+	// Skip runtime.Callers, log and the exported logging method.
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.AddAttrs(slog.String(CategoryKey, string(e.c)))
+
+	_ = l.Handler().Handle(context.Background(), r)
+}
+
+// Tracef logs a formatted message at LevelTrace.
+func (c Category) Tracef(format string, args ...interface{}) {
+	Entry{c: c}.log(LevelTrace, format, args)
+}
+
+// Debugf logs a formatted message at slog.LevelDebug.
+func (c Category) Debugf(format string, args ...interface{}) {
+	Entry{c: c}.log(slog.LevelDebug, format, args)
+}
+
+// Infof logs a formatted message at slog.LevelInfo.
+func (c Category) Infof(format string, args ...interface{}) {
+	Entry{c: c}.log(slog.LevelInfo, format, args)
+}
+
+// Warnf logs a formatted message at slog.LevelWarn.
+func (c Category) Warnf(format string, args ...interface{}) {
+	Entry{c: c}.log(slog.LevelWarn, format, args)
+}
+
+// Tracef logs a formatted message at LevelTrace.
+func (e Entry) Tracef(format string, args ...interface{}) {
+	e.log(LevelTrace, format, args)
+}
+
+// Debugf logs a formatted message at slog.LevelDebug.
+func (e Entry) Debugf(format string, args ...interface{}) {
+	e.log(slog.LevelDebug, format, args)
+}
+
+// Infof logs a formatted message at slog.LevelInfo.
+func (e Entry) Infof(format string, args ...interface{}) {
+	e.log(slog.LevelInfo, format, args)
+}
+
+// Warnf logs a formatted message at slog.LevelWarn.
+func (e Entry) Warnf(format string, args ...interface{}) {
+	e.log(slog.LevelWarn, format, args)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+
+	defer SetLogger(nil)
+
+	var b bytes.Buffer
+
+	logger := func(level slog.Level) *slog.Logger {
+		b.Reset()
+		return slog.New(slog.NewTextHandler(&b, &slog.HandlerOptions{Level: level, AddSource: true}))
+	}
+
+	// Silent by default.
+	if Read.Enabled(slog.LevelError) {
+		t.Fatal("logging enabled by default")
+	}
+
+	for _, tt := range []struct {
+		level      slog.Level
+		categories []Category
+		log        func()
+		want       string // message and attributes, empty for no output
+	}{
+		{LevelTrace, nil, func() { Read.Tracef("object %d\n", 7) }, "msg=\"object 7\" category=read"},
+		{slog.LevelDebug, nil, func() { Write.Tracef("object %d", 7) }, ""},
+		{slog.LevelDebug, nil, func() { Write.Debugf("object %d", 7) }, "msg=\"object 7\" category=write"},
+		{slog.LevelInfo, []Category{Crypto}, func() { Read.Warnf("corrupt") }, ""},
+		{slog.LevelInfo, []Category{Crypto, Info}, func() { Info.Infof("size") }, "msg=size category=info"},
+	} {
+		SetLogger(logger(tt.level), tt.categories...)
+
+		tt.log()
+
+		got := b.String()
+
+		if tt.want == "" {
+			if got != "" {
+				t.Errorf("unexpected output: %s", got)
+			}
+			continue
+		}
+
+		if !strings.Contains(got, "level="+tt.level.String()) || !strings.Contains(got, tt.want) {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+
+		// The source location is the caller of the logging method.
+		if !strings.Contains(got, "log_test.go") {
+			t.Errorf("missing caller location: %s", got)
+		}
+	}
+}
+
+func TestEntry(t *testing.T) {
+
+	defer SetLogger(nil)
+
+	var global, own bytes.Buffer
+
+	SetLogger(slog.New(slog.NewTextHandler(&global, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	l := slog.New(slog.NewTextHandler(&own, &slog.HandlerOptions{Level: slog.LevelInfo, AddSource: true}))
+
+	for _, tt := range []struct {
+		log         func()
+		global, own string // expected output, empty for none
+	}{
+		{func() { Read.To(l, nil).Infof("own") }, "", "msg=own category=read"},
+		{func() { Read.To(l, nil).Debugf("below level") }, "", ""},
+		{func() { Read.To(l, []Category{Read}).Warnf("own") }, "", "msg=own category=read"},
+		{func() { Write.To(l, []Category{Read}).Infof("global") }, "msg=global category=write", ""},
+		{func() { Write.To(nil, nil).Debugf("global") }, "msg=global category=write", ""},
+	} {
+		global.Reset()
+		own.Reset()
+
+		tt.log()
+
+		for _, c := range []struct {
+			name, got, want string
+		}{
+			{"global", global.String(), tt.global},
+			{"own", own.String(), tt.own},
+		} {
+			if (c.want == "") != (c.got == "") || !strings.Contains(c.got, c.want) {
+				t.Errorf("%s: got %q, want %q", c.name, c.got, c.want)
+			}
+		}
+
+		// The source location is the caller of the logging method.
+		if tt.own != "" && !strings.Contains(own.String(), "log_test.go") {
+			t.Errorf("missing caller location: %s", own.String())
+		}
+	}
+}
@@ -16,7 +16,7 @@ limitations under the License.
 
 package pdflite
 
-import "fmt"
+import "github.com/zean00/pdfcpulite/log"
 
 func patchIndRef(ir *IndirectRef, lookup map[int]int) {
 	i := ir.ObjectNumber.Value()
@@ -25,7 +25,7 @@ func patchIndRef(ir *IndirectRef, lookup map[int]int) {
 
 func patchObject(o Object, lookup map[int]int) Object {
 
-	fmt.Printf("patchObject before: %v\n", o)
+	log.Write.Tracef("patchObject before: %v\n", o)
 
 	var ob Object
 
@@ -57,14 +57,14 @@ func patchObject(o Object, lookup map[int]int) Object {
 
 	}
 
-	fmt.Printf("patchObject end: %v\n", ob)
+	log.Write.Tracef("patchObject end: %v\n", ob)
 
 	return ob
 }
 
 func patchDict(d Dict, lookup map[int]int) {
 
-	fmt.Printf("patchDict before: %v\n", d)
+	log.Write.Tracef("patchDict before: %v\n", d)
 
 	for k, obj := range d {
 		o := patchObject(obj, lookup)
@@ -73,12 +73,12 @@ func patchDict(d Dict, lookup map[int]int) {
 		}
 	}
 
-	fmt.Printf("patchDict after: %v\n", d)
+	log.Write.Tracef("patchDict after: %v\n", d)
 }
 
 func patchArray(a Array, lookup map[int]int) {
 
-	fmt.Printf("patchArray begin: %v\n", a)
+	log.Write.Tracef("patchArray begin: %v\n", a)
 
 	for i, obj := range a {
 		o := patchObject(obj, lookup)
@@ -87,7 +87,7 @@ func patchArray(a Array, lookup map[int]int) {
 		}
 	}
 
-	fmt.Printf("patchArray end: %v\n", a)
+	log.Write.Tracef("patchArray end: %v\n", a)
 }
 
 func objNrsIntSet(ctx *Context) IntSet {
@@ -133,8 +133,8 @@ func patchObjects(s IntSet, lookup map[int]int) IntSet {
 
 func patchSourceObjectNumbers(ctxSource, ctxDest *Context) {
 
-	fmt.Printf("patchSourceObjectNumbers: ctxSource: xRefTableSize:%d trailer.Size:%d - %s\n", len(ctxSource.Table), *ctxSource.Size, ctxSource.Read.FileName)
-	fmt.Printf("patchSourceObjectNumbers:   ctxDest: xRefTableSize:%d trailer.Size:%d - %s\n", len(ctxDest.Table), *ctxDest.Size, ctxDest.Read.FileName)
+	ctxSource.Log(log.Write).Tracef("patchSourceObjectNumbers: ctxSource: xRefTableSize:%d trailer.Size:%d - %s\n", len(ctxSource.Table), *ctxSource.Size, ctxSource.Read.FileName)
+	ctxSource.Log(log.Write).Tracef("patchSourceObjectNumbers:   ctxDest: xRefTableSize:%d trailer.Size:%d - %s\n", len(ctxDest.Table), *ctxDest.Size, ctxDest.Read.FileName)
 
 	// Patch source xref tables obj numbers which are essentially the keys.
 	//logInfoMerge.Printf("Source XRefTable before:\n%s\n", ctxSource)
@@ -169,14 +169,14 @@ func patchSourceObjectNumbers(ctxSource, ctxDest *Context) {
 		entry := ctxSource.Table[k]
 
 		if entry.Free {
-			fmt.Printf("patch free entry: old offset:%d\n", *entry.Offset)
+			ctxSource.Log(log.Write).Tracef("patch free entry: old offset:%d\n", *entry.Offset)
 			off := int(*entry.Offset)
 			if off == 0 {
 				continue
 			}
 			i := int64(lookup[off])
 			entry.Offset = &i
-			fmt.Printf("patch free entry: new offset:%d\n", *entry.Offset)
+			ctxSource.Log(log.Write).Tracef("patch free entry: new offset:%d\n", *entry.Offset)
 			continue
 		}
 
@@ -203,12 +203,12 @@ func patchSourceObjectNumbers(ctxSource, ctxDest *Context) {
 	// Patch object stream object numbers.
 	ctxSource.Read.ObjectStreams = patchObjects(ctxSource.Read.ObjectStreams, lookup)
 
-	fmt.Printf("patchSourceObjectNumbers end")
+	ctxSource.Log(log.Write).Tracef("patchSourceObjectNumbers end")
 }
 
 func appendSourcePageTreeToDestPageTree(ctxSource, ctxDest *Context) error {
 
-	fmt.Println("appendSourcePageTreeToDestPageTree begin")
+	ctxSource.Log(log.Write).Tracef("appendSourcePageTreeToDestPageTree begin")
 
 	indRefPageTreeRootDictSource, err := ctxSource.Pages()
 	if err != nil {
@@ -227,27 +227,27 @@ func appendSourcePageTreeToDestPageTree(ctxSource, ctxDest *Context) error {
 	pageCountDest := pageTreeRootDictDest.IntEntry("Count")
 
 	a := pageTreeRootDictDest.ArrayEntry("Kids")
-	fmt.Printf("Kids before: %v\n", a)
+	ctxSource.Log(log.Write).Tracef("Kids before: %v\n", a)
 
 	pageTreeRootDictSource.Insert("Parent", *indRefPageTreeRootDictDest)
 
 	// The source page tree gets appended on to the dest page tree.
 	a = append(a, *indRefPageTreeRootDictSource)
-	fmt.Printf("Kids after: %v\n", a)
+	ctxSource.Log(log.Write).Tracef("Kids after: %v\n", a)
 
 	pageTreeRootDictDest.Update("Count", Integer(*pageCountDest+*pageCountSource))
 	pageTreeRootDictDest.Update("Kids", a)
 
 	ctxDest.PageCount += ctxSource.PageCount
 
-	fmt.Println("appendSourcePageTreeToDestPageTree end")
+	ctxSource.Log(log.Write).Tracef("appendSourcePageTreeToDestPageTree end")
 
 	return nil
 }
 
 func appendSourceObjectsToDest(ctxSource, ctxDest *Context) {
 
-	fmt.Println("appendSourceObjectsToDest begin")
+	ctxSource.Log(log.Write).Tracef("appendSourceObjectsToDest begin")
 
 	for objNr, entry := range ctxSource.Table {
 
@@ -256,15 +256,16 @@ func appendSourceObjectsToDest(ctxSource, ctxDest *Context) {
 			continue
 		}
 
-		fmt.Printf("adding obj %d from src to dest\n", objNr)
+		ctxSource.Log(log.Write).Tracef("adding obj %d from src to dest\n", objNr)
 
+		ctxDest.snapshot(objNr)
 		ctxDest.Table[objNr] = entry
 
 		*ctxDest.Size++
 
 	}
 
-	fmt.Println("appendSourceObjectsToDest end")
+	ctxSource.Log(log.Write).Tracef("appendSourceObjectsToDest end")
 }
 
 // merge two disjunct IntSets
@@ -276,14 +277,14 @@ func mergeIntSets(src, dest IntSet) {
 
 func mergeDuplicateObjNumberIntSets(ctxSource, ctxDest *Context) {
 
-	fmt.Println("mergeDuplicateObjNumberIntSets begin")
+	ctxSource.Log(log.Write).Tracef("mergeDuplicateObjNumberIntSets begin")
 
 	mergeIntSets(ctxSource.Optimize.DuplicateInfoObjects, ctxDest.Optimize.DuplicateInfoObjects)
 	mergeIntSets(ctxSource.LinearizationObjs, ctxDest.LinearizationObjs)
 	mergeIntSets(ctxSource.Read.XRefStreams, ctxDest.Read.XRefStreams)
 	mergeIntSets(ctxSource.Read.ObjectStreams, ctxDest.Read.ObjectStreams)
 
-	fmt.Println("mergeDuplicateObjNumberIntSets end")
+	ctxSource.Log(log.Write).Tracef("mergeDuplicateObjNumberIntSets end")
 }
 
 // MergeXRefTables merges Context ctxSource into ctxDest by appending its page tree.
@@ -293,14 +294,14 @@ func MergeXRefTables(ctxSource, ctxDest *Context) (err error) {
 	patchSourceObjectNumbers(ctxSource, ctxDest)
 
 	// Append ctxSource pageTree to ctxDest pageTree.
-	fmt.Println("appendSourcePageTreeToDestPageTree")
+	ctxSource.Log(log.Write).Tracef("appendSourcePageTreeToDestPageTree")
 	err = appendSourcePageTreeToDestPageTree(ctxSource, ctxDest)
 	if err != nil {
 		return err
 	}
 
 	// Append ctxSource objects to ctxDest
-	fmt.Println("appendSourceObjectsToDest")
+	ctxSource.Log(log.Write).Tracef("appendSourceObjectsToDest")
 	appendSourceObjectsToDest(ctxSource, ctxDest)
 
 	// Mark source's root object as free.
@@ -319,10 +320,10 @@ func MergeXRefTables(ctxSource, ctxDest *Context) (err error) {
 	}
 
 	// Merge all IntSets containing redundant object numbers.
-	fmt.Println("mergeDuplicateObjNumberIntSets")
+	ctxSource.Log(log.Write).Tracef("mergeDuplicateObjNumberIntSets")
 	mergeDuplicateObjNumberIntSets(ctxSource, ctxDest)
 
-	fmt.Printf("Dest XRefTable after merge:\n%s\n", ctxDest)
+	ctxSource.Log(log.Write).Tracef("Dest XRefTable after merge:\n%s\n", ctxDest)
 
 	return nil
 }
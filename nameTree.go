@@ -17,8 +17,11 @@ limitations under the License.
 package pdflite
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/zean00/pdfcpulite/log"
 )
 
 const maxEntries = 3
@@ -96,6 +99,68 @@ func (n Node) Value(k string) (Object, bool) {
 	return nil, false
 }
 
+// loadNameTreeNode returns a node mirroring the name tree node d including all of its kids.
+func loadNameTreeNode(xRefTable *XRefTable, d Dict, depth int) (*Node, error) {
+
+	if depth > 100 {
+		return nil, errors.New("pdfcpu: name tree too deep")
+	}
+
+	n := &Node{D: &d}
+
+	o, found := d.Find("Kids")
+	if !found {
+
+		names, err := xRefTable.DereferenceArray(d["Names"])
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i+1 < len(names); i += 2 {
+			k, err := xRefTable.DereferenceText(names[i])
+			if err != nil {
+				return nil, err
+			}
+			n.AddToLeaf(k, names[i+1])
+		}
+
+		if len(n.Names) > 0 {
+			n.Kmin, n.Kmax = n.Names[0].k, n.Names[len(n.Names)-1].k
+		}
+
+		return n, nil
+	}
+
+	kids, err := xRefTable.DereferenceArray(o)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range kids {
+
+		kd, err := xRefTable.DereferenceDict(o)
+		if err != nil {
+			return nil, err
+		}
+		if kd == nil {
+			continue
+		}
+
+		kid, err := loadNameTreeNode(xRefTable, kd, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		n.Kids = append(n.Kids, kid)
+	}
+
+	if len(n.Kids) > 0 {
+		n.Kmin, n.Kmax = n.Kids[0].Kmin, n.Kids[len(n.Kids)-1].Kmax
+	}
+
+	return n, nil
+}
+
 // AddToLeaf adds an entry to a leaf.
 func (n *Node) AddToLeaf(k string, v Object) {
 
@@ -126,27 +191,27 @@ func (n *Node) Add(xRefTable *XRefTable, k string, v Object) error {
 		if len(n.Names) == 0 {
 			n.Names = append(n.Names, entry{k, v})
 			n.Kmin, n.Kmax = k, k
-			fmt.Printf("first key=%s\n", k)
+			log.Write.Tracef("first key=%s\n", k)
 			return nil
 		}
 
-		fmt.Printf("kmin=%s kmax=%s\n", n.Kmin, n.Kmax)
+		log.Write.Tracef("kmin=%s kmax=%s\n", n.Kmin, n.Kmax)
 
 		if k < n.Kmin {
 			// Insert (k,v) at the beginning.
-			fmt.Printf("Insert k:%s at beginning\n", k)
+			log.Write.Tracef("Insert k:%s at beginning\n", k)
 			n.Kmin = k
 			n.Names = append(n.Names, entry{})
 			copy(n.Names[1:], n.Names[0:])
 			n.Names[0] = entry{k, v}
 		} else if k > n.Kmax {
 			// Insert (k,v) at the end.
-			fmt.Printf("Insert k:%s at end\n", k)
+			log.Write.Tracef("Insert k:%s at end\n", k)
 			n.Kmax = k
 			n.Names = append(n.Names, entry{k, v})
 		} else {
 			// Insert (k,v) somewhere in the middle.
-			fmt.Printf("Insert k:%s in the middle\n", k)
+			log.Write.Tracef("Insert k:%s in the middle\n", k)
 			for i, e := range n.Names {
 
 				if e.k < k {
@@ -226,7 +291,7 @@ func (n *Node) removeFromNames(xRefTable *XRefTable, k string) (ok bool, err err
 
 			if xRefTable != nil {
 				// Remove object graph of value.
-				fmt.Println("removeFromNames: deleting object graph of v")
+				log.Write.Tracef("removeFromNames: deleting object graph of v")
 				err := xRefTable.DeleteObjectGraph(v.v)
 				if err != nil {
 					return false, err
@@ -254,7 +319,7 @@ func (n *Node) removeFromLeaf(xRefTable *XRefTable, k string) (empty, ok bool, e
 	if len(n.Names) == 1 {
 		if xRefTable != nil {
 			// Remove object graph of value.
-			fmt.Println("removeFromLeaf: deleting object graph of v")
+			log.Write.Tracef("removeFromLeaf: deleting object graph of v")
 			err := xRefTable.DeleteObjectGraph(n.Names[0].v)
 			if err != nil {
 				return false, false, err
@@ -269,7 +334,7 @@ func (n *Node) removeFromLeaf(xRefTable *XRefTable, k string) (empty, ok bool, e
 
 		if xRefTable != nil {
 			// Remove object graph of value.
-			fmt.Println("removeFromLeaf: deleting object graph of v")
+			log.Write.Tracef("removeFromLeaf: deleting object graph of v")
 			err := xRefTable.DeleteObjectGraph(n.Names[0].v)
 			if err != nil {
 				return false, false, err
@@ -285,7 +350,7 @@ func (n *Node) removeFromLeaf(xRefTable *XRefTable, k string) (empty, ok bool, e
 
 		if xRefTable != nil {
 			// Remove object graph of value.
-			fmt.Println("removeFromLeaf: deleting object graph of v")
+			log.Write.Tracef("removeFromLeaf: deleting object graph of v")
 			err := xRefTable.DeleteObjectGraph(n.Names[len(n.Names)-1].v)
 			if err != nil {
 				return false, false, err
@@ -335,15 +400,15 @@ func (n *Node) removeFromKids(xRefTable *XRefTable, k string) (ok bool, err erro
 
 			if i == 0 {
 				// Remove first kid.
-				fmt.Println("removeFromKids: remove first kid.")
+				log.Write.Tracef("removeFromKids: remove first kid.")
 				n.Kids = n.Kids[1:]
 			} else if i == len(n.Kids)-1 {
-				fmt.Println("removeFromKids: remove last kid.")
+				log.Write.Tracef("removeFromKids: remove last kid.")
 				// Remove last kid.
 				n.Kids = n.Kids[:len(n.Kids)-1]
 			} else {
 				// Remove kid from the middle.
-				fmt.Println("removeFromKids: remove kid form the middle.")
+				log.Write.Tracef("removeFromKids: remove kid form the middle.")
 				n.Kids = append(n.Kids[:i], n.Kids[i+1:]...)
 			}
 
@@ -351,7 +416,7 @@ func (n *Node) removeFromKids(xRefTable *XRefTable, k string) (ok bool, err erro
 
 				// If only one kid remains we can merge it with its parent.
 				// By doing this we get rid of a redundant intermediary node.
-				fmt.Println("removeFromKids: only 1 kid")
+				log.Write.Tracef("removeFromKids: only 1 kid")
 
 				if xRefTable != nil {
 					err = xRefTable.deleteObject(*n.D)
@@ -362,7 +427,7 @@ func (n *Node) removeFromKids(xRefTable *XRefTable, k string) (ok bool, err erro
 
 				*n = *n.Kids[0]
 
-				fmt.Printf("removeFromKids: new n = %s\n", n)
+				log.Write.Tracef("removeFromKids: new n = %s\n", n)
 
 				return true, nil
 			}
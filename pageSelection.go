@@ -0,0 +1,140 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PagesForPageSelection returns the pages of a document with pageCount pages chosen by selection.
+//
+// selection is a comma separated list of expressions:
+//
+//	even   even pages
+//	odd    odd pages
+//	#      page #
+//	#-#    page range
+//	-#     pages 1 to #
+//	#-     pages # to the last page
+//	l      the last page, also usable as range bound eg. 5-l
+//
+// An expression prefixed with ! or n excludes its pages.
+// Exclusions are applied after inclusions. If there are exclusions only, all pages are selected initially.
+func PagesForPageSelection(pageCount int, selection string) (IntSet, error) {
+
+	incl, excl := IntSet{}, IntSet{}
+	var inclusions bool
+
+	for _, expr := range strings.Split(selection, ",") {
+
+		expr = strings.TrimSpace(expr)
+		if expr == "" {
+			continue
+		}
+
+		m := incl
+		if expr[0] == '!' || expr[0] == 'n' {
+			m = excl
+			expr = expr[1:]
+		} else {
+			inclusions = true
+		}
+
+		from, thru, err := pageRange(expr, pageCount)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := from; i <= thru && i <= pageCount; i++ {
+			switch expr {
+			case "even":
+				if i%2 == 0 {
+					m[i] = true
+				}
+			case "odd":
+				if i%2 == 1 {
+					m[i] = true
+				}
+			default:
+				m[i] = true
+			}
+		}
+	}
+
+	if !inclusions {
+		for i := 1; i <= pageCount; i++ {
+			incl[i] = true
+		}
+	}
+
+	for i := range excl {
+		delete(incl, i)
+	}
+
+	return incl, nil
+}
+
+// pageRange returns the bounds of a page selection expression without prefix.
+func pageRange(expr string, pageCount int) (from, thru int, err error) {
+
+	if expr == "even" || expr == "odd" {
+		return 1, pageCount, nil
+	}
+
+	page := func(s string, dflt int) (int, error) {
+		switch s {
+		case "":
+			return dflt, nil
+		case "l":
+			return pageCount, nil
+		}
+		i, err := strconv.Atoi(s)
+		if err != nil || i < 1 {
+			return 0, fmt.Errorf("pdfcpu: invalid page selection: %s", expr)
+		}
+		return i, nil
+	}
+
+	i := strings.Index(expr, "-")
+	if i < 0 {
+		if expr == "" {
+			return 0, 0, fmt.Errorf("pdfcpu: invalid page selection: %s", expr)
+		}
+		from, err = page(expr, 0)
+		return from, from, err
+	}
+
+	if expr == "-" {
+		return 0, 0, fmt.Errorf("pdfcpu: invalid page selection: %s", expr)
+	}
+
+	if from, err = page(expr[:i], 1); err != nil {
+		return 0, 0, err
+	}
+
+	if thru, err = page(expr[i+1:], pageCount); err != nil {
+		return 0, 0, err
+	}
+
+	if from > thru {
+		return 0, 0, fmt.Errorf("pdfcpu: invalid page selection: %s", expr)
+	}
+
+	return from, thru, nil
+}
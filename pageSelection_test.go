@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPagesForPageSelection(t *testing.T) {
+
+	for _, tt := range []struct {
+		selection string
+		want      []int // nil for an error
+	}{
+		{"1", []int{1}},
+		{"2-4", []int{2, 3, 4}},
+		{"-2", []int{1, 2}},
+		{"5-", []int{5, 6}},
+		{"l", []int{6}},
+		{"4-l", []int{4, 5, 6}},
+		{"even", []int{2, 4, 6}},
+		{"odd,!5", []int{1, 3}},
+		{"!1-4", []int{5, 6}},
+		{"n2, n6", []int{1, 3, 4, 5}},
+		{"1,9", []int{1}},
+		{"", []int{1, 2, 3, 4, 5, 6}},
+		{"x", nil},
+		{"0", nil},
+		{"4-2", nil},
+		{"-", nil},
+	} {
+		got, err := PagesForPageSelection(6, tt.selection)
+
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%q: missing error", tt.selection)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", tt.selection, err)
+			continue
+		}
+
+		pages := []int{}
+		for i := range got {
+			pages = append(pages, i)
+		}
+		sort.Ints(pages)
+
+		if !reflect.DeepEqual(pages, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.selection, pages, tt.want)
+		}
+	}
+}
@@ -41,7 +41,8 @@ const (
 // like a PDF page, a sheet of paper or an image grid
 // in user space, inches, centimetres or millimetres.
 type Dim struct {
-	Width, Height float64
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
 }
 
 // ToInches converts d to inches.
@@ -19,10 +19,11 @@ package pdflite
 import (
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"strconv"
 	"strings"
 	"unicode"
+
+	"github.com/zean00/pdfcpulite/log"
 )
 
 var (
@@ -91,7 +92,7 @@ func positionToNextEOL(s string) string {
 // trimLeftSpace trims leading whitespace and trailing comment.
 func trimLeftSpace(s string) (outstr string, trimmedSpaces int) {
 
-	fmt.Printf("TrimLeftSpace: begin %s\n", s)
+	log.Read.Tracef("TrimLeftSpace: begin %s\n", s)
 
 	whitespace := func(c rune) bool { return unicode.IsSpace(c) }
 
@@ -100,19 +101,19 @@ func trimLeftSpace(s string) (outstr string, trimmedSpaces int) {
 	for {
 		// trim leading whitespace
 		outstr = strings.TrimLeftFunc(outstr, whitespace)
-		fmt.Printf("1 outstr: <%s>\n", outstr)
+		log.Read.Tracef("1 outstr: <%s>\n", outstr)
 		if len(outstr) <= 1 || outstr[0] != '%' {
 			break
 		}
 		// trim PDF comment (= '%' up to eol)
 		outstr = positionToNextEOL(outstr)
-		fmt.Printf("2 outstr: <%s>\n", outstr)
+		log.Read.Tracef("2 outstr: <%s>\n", outstr)
 
 	}
 
 	trimmedSpaces = len(s) - len(outstr)
 
-	fmt.Printf("TrimLeftSpace: end %s %d\n", outstr, trimmedSpaces)
+	log.Read.Tracef("TrimLeftSpace: end %s %d\n", outstr, trimmedSpaces)
 
 	return outstr, trimmedSpaces
 }
@@ -120,7 +121,7 @@ func trimLeftSpace(s string) (outstr string, trimmedSpaces int) {
 // HexString validates and formats a hex string to be of even length.
 func hexString(s string) (*string, bool) {
 
-	fmt.Printf("HexString(%s)\n", s)
+	log.Read.Tracef("HexString(%s)\n", s)
 
 	if len(s) == 0 {
 		s1 := ""
@@ -138,10 +139,10 @@ func hexString(s string) (*string, bool) {
 			}
 			continue
 		}
-		fmt.Printf("checking <%c>\n", c)
+		log.Read.Tracef("checking <%c>\n", c)
 		isHexChar := false
 		for _, hexch := range "ABCDEF1234567890" {
-			fmt.Printf("checking against <%c>\n", hexch)
+			log.Read.Tracef("checking against <%c>\n", hexch)
 			if c == hexch {
 				isHexChar = true
 				sb.WriteRune(c)
@@ -150,12 +151,12 @@ func hexString(s string) (*string, bool) {
 			}
 		}
 		if !isHexChar {
-			fmt.Println("isHexStr returning false")
+			log.Read.Tracef("isHexStr returning false")
 			return nil, false
 		}
 	}
 
-	fmt.Println("isHexStr returning true")
+	log.Read.Tracef("isHexStr returning true")
 
 	// If the final digit of a hexadecimal string is missing -
 	// that is, if there is an odd number of digits - the final digit shall be assumed to be 0.
@@ -229,7 +230,7 @@ func delimiter(b byte) bool {
 // parseObjectAttributes parses object number and generation of the next object for given string buffer.
 func parseObjectAttributes(line *string) (objectNumber *int, generationNumber *int, err error) {
 
-	fmt.Printf("ParseObjectAttributes: buf=<%s>\n", *line)
+	log.Read.Tracef("ParseObjectAttributes: buf=<%s>\n", *line)
 
 	if line == nil || len(*line) == 0 {
 		return nil, nil, errors.New("pdfcpu: ParseObjectAttributes: buf not available")
@@ -297,7 +298,7 @@ func parseArray(line *string) (*Array, error) {
 
 	l := *line
 
-	fmt.Printf("ParseArray: %s\n", l)
+	log.Read.Tracef("ParseArray: %s\n", l)
 
 	if !strings.HasPrefix(l, "[") {
 		return nil, errArrayCorrupt
@@ -326,7 +327,7 @@ func parseArray(line *string) (*Array, error) {
 		if err != nil {
 			return nil, err
 		}
-		fmt.Printf("ParseArray: new array obj=%v\n", obj)
+		log.Read.Tracef("ParseArray: new array obj=%v\n", obj)
 		a = append(a, obj)
 
 		// we are positioned on the char behind the last parsed array entry.
@@ -346,7 +347,7 @@ func parseArray(line *string) (*Array, error) {
 
 	*line = l
 
-	fmt.Printf("ParseArray: returning array (len=%d): %v\n", len(a), a)
+	log.Read.Tracef("ParseArray: returning array (len=%d): %v\n", len(a), a)
 
 	return &a, nil
 }
@@ -379,7 +380,7 @@ func parseStringLiteral(line *string) (Object, error) {
 
 	l := *line
 
-	fmt.Printf("parseStringLiteral: begin <%s>\n", l)
+	log.Read.Tracef("parseStringLiteral: begin <%s>\n", l)
 
 	if len(l) < 2 || !strings.HasPrefix(l, "(") {
 		return nil, errStringLiteralCorrupt
@@ -403,7 +404,7 @@ func parseStringLiteral(line *string) (Object, error) {
 	*line = forwardParseBuf(l[i:], 1)
 
 	stringLiteral := StringLiteral(balParStr)
-	fmt.Printf("parseStringLiteral: end <%s>\n", stringLiteral)
+	log.Read.Tracef("parseStringLiteral: end <%s>\n", stringLiteral)
 
 	return stringLiteral, nil
 }
@@ -418,7 +419,7 @@ func parseHexLiteral(line *string) (Object, error) {
 
 	l := *line
 
-	fmt.Printf("parseHexLiteral: %s\n", l)
+	log.Read.Tracef("parseHexLiteral: %s\n", l)
 
 	if len(l) < 3 || !strings.HasPrefix(l, "<") {
 		return nil, errHexLiteralCorrupt
@@ -481,7 +482,7 @@ func parseName(line *string) (*Name, error) {
 
 	l := *line
 
-	fmt.Printf("parseNameObject: %s\n", l)
+	log.Read.Tracef("parseNameObject: %s\n", l)
 
 	if len(l) < 2 || !strings.HasPrefix(l, "/") {
 		return nil, errNameObjectCorrupt
@@ -518,7 +519,7 @@ func parseDict(line *string) (*Dict, error) {
 
 	l := *line
 
-	fmt.Printf("ParseDict: %s\n", l)
+	log.Read.Tracef("ParseDict: %s\n", l)
 
 	if len(l) < 4 || !strings.HasPrefix(l, "<<") {
 		return nil, errDictionaryCorrupt
@@ -543,13 +544,13 @@ func parseDict(line *string) (*Dict, error) {
 		if err != nil {
 			return nil, err
 		}
-		fmt.Printf("ParseDict: key = %s\n", key)
+		log.Read.Tracef("ParseDict: key = %s\n", key)
 
 		// position to first non whitespace after key
 		l, _ = trimLeftSpace(l)
 
 		if len(l) == 0 {
-			fmt.Println("ParseDict: only whitespace after key")
+			log.Read.Tracef("ParseDict: only whitespace after key")
 			// only whitespace after key
 			return nil, errDictionaryNotTerminated
 		}
@@ -562,7 +563,7 @@ func parseDict(line *string) (*Dict, error) {
 		// Specifying the null object as the value of a dictionary entry (7.3.7, "Dictionary Objects")
 		// shall be equivalent to omitting the entry entirely.
 		if obj != nil {
-			fmt.Printf("ParseDict: dict[%s]=%v\n", key, obj)
+			log.Read.Tracef("ParseDict: dict[%s]=%v\n", key, obj)
 			if ok := d.Insert(string(*key), obj); !ok {
 				return nil, errDictionaryDuplicateKey
 			}
@@ -586,7 +587,7 @@ func parseDict(line *string) (*Dict, error) {
 
 	*line = l
 
-	fmt.Printf("ParseDict: returning dict at: %v\n", d)
+	log.Read.Tracef("ParseDict: returning dict at: %v\n", d)
 
 	return &d, nil
 }
@@ -631,7 +632,7 @@ func parseNumericOrIndRef(line *string) (Object, error) {
 		}
 
 		// We have a Float!
-		fmt.Printf("parseNumericOrIndRef: value is numeric float: %f\n", f)
+		log.Read.Tracef("parseNumericOrIndRef: value is numeric float: %f\n", f)
 		*line = l1
 		return Float(f), nil
 	}
@@ -640,7 +641,7 @@ func parseNumericOrIndRef(line *string) (Object, error) {
 
 	// if not followed by whitespace return sole integer value.
 	if i1 <= 0 || delimiter(l[i1]) {
-		fmt.Printf("parseNumericOrIndRef: value is numeric int: %d\n", i)
+		log.Read.Tracef("parseNumericOrIndRef: value is numeric int: %d\n", i)
 		*line = l1
 		return Integer(i), nil
 	}
@@ -663,7 +664,7 @@ func parseNumericOrIndRef(line *string) (Object, error) {
 	// if only 2 token, can't be indirect reference.
 	// if not followed by whitespace return sole integer value.
 	if i2 <= 0 || delimiter(l[i2]) {
-		fmt.Printf("parseNumericOrIndRef: 2 objects => value is numeric int: %d\n", i)
+		log.Read.Tracef("parseNumericOrIndRef: 2 objects => value is numeric int: %d\n", i)
 		*line = l1
 		return Integer(i), nil
 	}
@@ -677,7 +678,7 @@ func parseNumericOrIndRef(line *string) (Object, error) {
 	if err != nil {
 		// 2nd int(generation number) not available.
 		// Can't be an indirect reference.
-		fmt.Printf("parseNumericOrIndRef: 3 objects, 2nd no int, value is no indirect ref but numeric int: %d\n", i)
+		log.Read.Tracef("parseNumericOrIndRef: 3 objects, 2nd no int, value is no indirect ref but numeric int: %d\n", i)
 		*line = l1
 		return Integer(i), nil
 	}
@@ -702,7 +703,7 @@ func parseNumericOrIndRef(line *string) (Object, error) {
 
 	// 'R' not available.
 	// Can't be an indirect reference.
-	fmt.Printf("parseNumericOrIndRef: value is no indirect ref(no 'R') but numeric int: %d\n", i)
+	log.Read.Tracef("parseNumericOrIndRef: value is no indirect ref(no 'R') but numeric int: %d\n", i)
 	*line = l1
 
 	return Integer(i), nil
@@ -716,7 +717,7 @@ func parseHexLiteralOrDict(l *string) (val Object, err error) {
 
 	// if next char = '<' parseDict.
 	if (*l)[1] == '<' {
-		fmt.Println("parseHexLiteralOrDict: value = Dictionary")
+		log.Read.Tracef("parseHexLiteralOrDict: value = Dictionary")
 		d, err := parseDict(l)
 		if err != nil {
 			return nil, err
@@ -724,7 +725,7 @@ func parseHexLiteralOrDict(l *string) (val Object, err error) {
 		val = *d
 	} else {
 		// hex literals
-		fmt.Println("parseHexLiteralOrDict: value = Hex Literal")
+		log.Read.Tracef("parseHexLiteralOrDict: value = Hex Literal")
 		if val, err = parseHexLiteral(l); err != nil {
 			return nil, err
 		}
@@ -737,19 +738,19 @@ func parseBooleanOrNull(l string) (val Object, s string, ok bool) {
 
 	// null, absent object
 	if strings.HasPrefix(l, "null") {
-		fmt.Println("parseBoolean: value = null")
+		log.Read.Tracef("parseBoolean: value = null")
 		return nil, "null", true
 	}
 
 	// boolean true
 	if strings.HasPrefix(l, "true") {
-		fmt.Println("parseBoolean: value = true")
+		log.Read.Tracef("parseBoolean: value = true")
 		return Boolean(true), "true", true
 	}
 
 	// boolean false
 	if strings.HasPrefix(l, "false") {
-		fmt.Println("parseBoolean: value = false")
+		log.Read.Tracef("parseBoolean: value = false")
 		return Boolean(false), "false", true
 	}
 
@@ -765,7 +766,7 @@ func parseObject(line *string) (Object, error) {
 
 	l := *line
 
-	fmt.Printf("ParseObject: buf= <%s>\n", l)
+	log.Read.Tracef("ParseObject: buf= <%s>\n", l)
 
 	// position to first non whitespace char
 	l, _ = trimLeftSpace(l)
@@ -780,7 +781,7 @@ func parseObject(line *string) (Object, error) {
 	switch l[0] {
 
 	case '[': // array
-		fmt.Println("ParseObject: value = Array")
+		log.Read.Tracef("ParseObject: value = Array")
 		a, err := parseArray(&l)
 		if err != nil {
 			return nil, err
@@ -788,7 +789,7 @@ func parseObject(line *string) (Object, error) {
 		value = *a
 
 	case '/': // name
-		fmt.Println("ParseObject: value = Name Object")
+		log.Read.Tracef("ParseObject: value = Name Object")
 		nameObj, err := parseName(&l)
 		if err != nil {
 			return nil, err
@@ -802,7 +803,7 @@ func parseObject(line *string) (Object, error) {
 		}
 
 	case '(': // string literal
-		fmt.Printf("ParseObject: value = String Literal: <%s>\n", l)
+		log.Read.Tracef("ParseObject: value = String Literal: <%s>\n", l)
 		if value, err = parseStringLiteral(&l); err != nil {
 			return nil, err
 		}
@@ -825,7 +826,7 @@ func parseObject(line *string) (Object, error) {
 
 	}
 
-	fmt.Printf("ParseObject returning %v\n", value)
+	log.Read.Tracef("ParseObject returning %v\n", value)
 
 	*line = l
 
@@ -835,7 +836,7 @@ func parseObject(line *string) (Object, error) {
 // parseXRefStreamDict creates a XRefStreamDict out of a StreamDict.
 func parseXRefStreamDict(sd *StreamDict) (*XRefStreamDict, error) {
 
-	fmt.Println("ParseXRefStreamDict: begin")
+	log.Read.Tracef("ParseXRefStreamDict: begin")
 
 	if sd.Size() == nil {
 		return nil, errors.New("pdfcpu: ParseXRefStreamDict: \"Size\" not available")
@@ -846,7 +847,7 @@ func parseXRefStreamDict(sd *StreamDict) (*XRefStreamDict, error) {
 	//	Read optional parameter Index
 	indArr := sd.Index()
 	if indArr != nil {
-		fmt.Println("ParseXRefStreamDict: using index dict")
+		log.Read.Tracef("ParseXRefStreamDict: using index dict")
 
 		//indArr := *pIndArr
 		if len(indArr)%2 > 1 {
@@ -871,7 +872,7 @@ func parseXRefStreamDict(sd *StreamDict) (*XRefStreamDict, error) {
 		}
 
 	} else {
-		fmt.Println("ParseXRefStreamDict: no index dict")
+		log.Read.Tracef("ParseXRefStreamDict: no index dict")
 		for i := 0; i < *sd.Size(); i++ {
 			objs = append(objs, i)
 
@@ -924,7 +925,7 @@ func parseXRefStreamDict(sd *StreamDict) (*XRefStreamDict, error) {
 		PreviousOffset: sd.Prev(),
 	}
 
-	fmt.Println("ParseXRefStreamDict: end")
+	log.Read.Tracef("ParseXRefStreamDict: end")
 
 	return &xsd, nil
 }
@@ -0,0 +1,225 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+// Password preparation for the standard security handler (see 7.6.4.3.1 and 7.6.4.3.3).
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/bidi"
+	"golang.org/x/text/unicode/norm"
+)
+
+type runeRange struct {
+	lo, hi rune
+}
+
+func inRanges(r rune, rr []runeRange) bool {
+	for _, x := range rr {
+		if r >= x.lo && r <= x.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// Stringprep tables (RFC 3454) used by the SASLprep profile (RFC 4013).
+var (
+	// C.1.2 Non-ASCII space characters
+	nonASCIISpace = []runeRange{
+		{0x00A0, 0x00A0}, {0x1680, 0x1680}, {0x2000, 0x200B}, {0x202F, 0x202F}, {0x205F, 0x205F}, {0x3000, 0x3000},
+	}
+
+	// B.1 Commonly mapped to nothing
+	mappedToNothing = []runeRange{
+		{0x00AD, 0x00AD}, {0x034F, 0x034F}, {0x1806, 0x1806}, {0x180B, 0x180D}, {0x200B, 0x200D},
+		{0x2060, 0x2060}, {0xFE00, 0xFE0F}, {0xFEFF, 0xFEFF},
+	}
+
+	// C.1.2, C.2.1, C.2.2, C.3, C.4, C.5, C.6, C.7, C.8, C.9
+	prohibited = []runeRange{
+		// C.2.1 ASCII control characters
+		{0x0000, 0x001F}, {0x007F, 0x007F},
+		// C.2.2 Non-ASCII control characters
+		{0x0080, 0x009F}, {0x06DD, 0x06DD}, {0x070F, 0x070F}, {0x180E, 0x180E}, {0x200C, 0x200D},
+		{0x2028, 0x2029}, {0x2060, 0x2063}, {0x206A, 0x206F}, {0xFEFF, 0xFEFF}, {0xFFF9, 0xFFFC},
+		{0x1D173, 0x1D17A},
+		// C.3 Private use
+		{0xE000, 0xF8FF}, {0xF0000, 0xFFFFD}, {0x100000, 0x10FFFD},
+		// C.4 Non-character code points
+		{0xFDD0, 0xFDEF}, {0xFFFE, 0xFFFF},
+		// C.5 Surrogate codes
+		{0xD800, 0xDFFF},
+		// C.6 Inappropriate for plain text
+		{0xFFF9, 0xFFFD},
+		// C.7 Inappropriate for canonical representation
+		{0x2FF0, 0x2FFB},
+		// C.8 Change display properties or deprecated
+		{0x0340, 0x0341}, {0x200E, 0x200F}, {0x202A, 0x202E},
+		// C.9 Tagging characters
+		{0xE0001, 0xE0001}, {0xE0020, 0xE007F},
+	}
+)
+
+func prohibitedRune(r rune) bool {
+
+	// C.4: The last two code points of each plane are non-characters.
+	if r&0xFFFE == 0xFFFE {
+		return true
+	}
+
+	return inRanges(r, nonASCIISpace) || inRanges(r, prohibited)
+}
+
+func bidiClass(r rune) bidi.Class {
+	p, _ := bidi.LookupRune(r)
+	return p.Class()
+}
+
+// saslPrep prepares s using the SASLprep profile (RFC 4013) of stringprep (RFC 3454)
+// with unassigned code points allowed.
+func saslPrep(s string) (string, error) {
+
+	// 1) Map
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case inRanges(r, nonASCIISpace):
+			sb.WriteRune(' ')
+		case inRanges(r, mappedToNothing):
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	// 2) Normalize
+	s = norm.NFKC.String(sb.String())
+
+	// 3) Prohibit
+	var randAL, l bool
+	for _, r := range s {
+		if prohibitedRune(r) {
+			return "", fmt.Errorf("pdfcpu: saslPrep: prohibited character %U", r)
+		}
+		switch bidiClass(r) {
+		case bidi.R, bidi.AL:
+			randAL = true
+		case bidi.L:
+			l = true
+		}
+	}
+
+	// 4) Check bidi
+	if randAL {
+		rr := []rune(s)
+		if l {
+			return "", errors.New("pdfcpu: saslPrep: mixed bidi directions")
+		}
+		if c := bidiClass(rr[0]); c != bidi.R && c != bidi.AL {
+			return "", errors.New("pdfcpu: saslPrep: right-to-left string must start with a right-to-left character")
+		}
+		if c := bidiClass(rr[len(rr)-1]); c != bidi.R && c != bidi.AL {
+			return "", errors.New("pdfcpu: saslPrep: right-to-left string must end with a right-to-left character")
+		}
+	}
+
+	return s, nil
+}
+
+// pdfDocEncoding maps the code points 0x18-0x1F and 0x80-0xA0 of PDFDocEncoding to Unicode (see Annex D.2).
+// 0xA1-0xFF (except undefined 0xAD) match ISO Latin 1.
+var pdfDocEncoding = map[byte]rune{
+	0x18: 0x02D8, 0x19: 0x02C7, 0x1A: 0x02C6, 0x1B: 0x02D9, 0x1C: 0x02DD, 0x1D: 0x02DB, 0x1E: 0x02DA, 0x1F: 0x02DC,
+	0x80: 0x2022, 0x81: 0x2020, 0x82: 0x2021, 0x83: 0x2026, 0x84: 0x2014, 0x85: 0x2013, 0x86: 0x0192, 0x87: 0x2044,
+	0x88: 0x2039, 0x89: 0x203A, 0x8A: 0x2212, 0x8B: 0x2030, 0x8C: 0x201E, 0x8D: 0x201C, 0x8E: 0x201D, 0x8F: 0x2018,
+	0x90: 0x2019, 0x91: 0x201A, 0x92: 0x2122, 0x93: 0xFB01, 0x94: 0xFB02, 0x95: 0x0141, 0x96: 0x0152, 0x97: 0x0160,
+	0x98: 0x0178, 0x99: 0x017D, 0x9A: 0x0131, 0x9B: 0x0142, 0x9C: 0x0153, 0x9D: 0x0161, 0x9E: 0x017E, 0xA0: 0x20AC,
+}
+
+var unicodeToPDFDoc = func() map[rune]byte {
+	m := map[rune]byte{}
+	for b, r := range pdfDocEncoding {
+		m[r] = b
+	}
+	return m
+}()
+
+// encodePDFDoc converts s to PDFDocEncoding.
+func encodePDFDoc(s string) ([]byte, error) {
+
+	var b bytes.Buffer
+
+	for _, r := range s {
+
+		if c, ok := unicodeToPDFDoc[r]; ok {
+			b.WriteByte(c)
+			continue
+		}
+
+		if r < 0x18 || r >= 0x20 && r < 0x7F || r >= 0xA1 && r <= 0xFF && r != 0xAD {
+			b.WriteByte(byte(r))
+			continue
+		}
+
+		return nil, fmt.Errorf("pdfcpu: character %U not representable in PDFDocEncoding", r)
+	}
+
+	return b.Bytes(), nil
+}
+
+// encodePassword returns the password bytes for a standard security handler of revision r.
+// Revisions 2-4 use PDFDocEncoding, revisions 5 and 6 use UTF-8 processed by SASLprep and truncated to 127 bytes.
+func encodePassword(pw string, r int) ([]byte, error) {
+
+	if r < 5 {
+		// Compose any decomposed characters first.
+		return encodePDFDoc(norm.NFC.String(pw))
+	}
+
+	s, err := saslPrep(pw)
+	if err != nil {
+		return nil, err
+	}
+
+	b := []byte(s)
+	if len(b) > 127 {
+		b = b[:127]
+	}
+
+	return b, nil
+}
+
+// passwordCandidates returns the password bytes to try for pw when opening a file of revision r.
+// Next to the spec conforming encoding this includes the raw UTF-8 bytes used by some writers.
+func passwordCandidates(pw string, r int) [][]byte {
+
+	raw := []byte(pw)
+	if r >= 5 && len(raw) > 127 {
+		raw = raw[:127]
+	}
+
+	b, err := encodePassword(pw, r)
+	if err != nil || bytes.Equal(b, raw) {
+		return [][]byte{raw}
+	}
+
+	return [][]byte{b, raw}
+}
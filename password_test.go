@@ -0,0 +1,281 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestSASLPrep(t *testing.T) {
+
+	for _, tt := range []struct {
+		in, out string
+		ok      bool
+	}{
+		// RFC 4013, 3. Examples
+		{"I\u00ADX", "IX", true},
+		{"user", "user", true},
+		{"USER", "USER", true},
+		{"ª", "a", true},
+		{"Ⅸ", "IX", true},
+		{"\u0007", "", false},
+		{"ا1", "", false},
+
+		{"pass\u00A0word", "pass word", true},
+		{"Mu\u0308ller", "Müller", true},
+		{"ﾊﾟｽﾜｰﾄﾞ", "パスワード", true},
+		{"パスワード", "パスワード", true},
+		{"السر", "السر", true},
+		{"\uE000", "", false},
+		{"a\u200Eb", "", false},
+	} {
+		s, err := saslPrep(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("saslPrep(%+q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if s != tt.out {
+			t.Errorf("saslPrep(%+q) = %+q, want %+q", tt.in, s, tt.out)
+		}
+	}
+}
+
+func TestEncodePDFDoc(t *testing.T) {
+
+	for _, tt := range []struct {
+		in, out string
+		ok      bool
+	}{
+		{"secret", "secret", true},
+		{"Müller", "M\xFCller", true},
+		{"Straße", "Stra\xDFe", true},
+		{"€•™Œ", "\xA0\x80\x92\x96", true},
+		{"˘˜", "\x18\x1F", true},
+		{"パスワード", "", false},
+		{"\u00AD", "", false},
+	} {
+		b, err := encodePDFDoc(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("encodePDFDoc(%+q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if string(b) != tt.out {
+			t.Errorf("encodePDFDoc(%+q) = %q, want %q", tt.in, b, tt.out)
+		}
+	}
+}
+
+func encryptedTestContext(t *testing.T, r, l int, upw, opw string) *Context {
+
+	t.Helper()
+
+	ctx := &Context{Configuration: NewDefaultConfiguration(), XRefTable: &XRefTable{}}
+	ctx.UserPW, ctx.OwnerPW = upw, opw
+	ctx.E = &Enc{R: r, L: l, P: -3904, Emd: true, ID: []byte("0123456789abcdef")}
+
+	if err := calcOAndU(ctx, NewDict()); err != nil {
+		t.Fatalf("R%d: calcOAndU: %v", r, err)
+	}
+
+	return ctx
+}
+
+func TestLocalizedPasswords(t *testing.T) {
+
+	for _, tt := range []struct {
+		r, l             int
+		upw, opw         string // passwords used for encryption
+		upwOpen, opwOpen string // passwords entered when opening
+	}{
+		// R2-R4: PDFDocEncoding
+		{2, 40, "Müller", "Straße", "Müller", "Straße"},
+		{3, 128, "€uro", "Grüße", "€uro", "Grüße"},
+		{4, 128, "Müller", "Straße", "Mu\u0308ller", "Straße"},
+
+		// R5/R6: SASLprep
+		{5, 256, "Müller", "Straße", "Mu\u0308ller", "Straße"},
+		{6, 256, "パスワード", "秘密", "ﾊﾟｽﾜｰﾄﾞ", "秘密"},
+		{6, 256, "Müller", "Straße", "Mü\u00ADller", "Straße"},
+	} {
+		ctx := encryptedTestContext(t, tt.r, tt.l, tt.upw, tt.opw)
+		key := ctx.EncKey
+
+		ctx.UserPW, ctx.OwnerPW, ctx.EncKey = tt.upwOpen, "", nil
+		ok, err := validateUserPassword(ctx)
+		if err != nil || !ok || !bytes.Equal(ctx.EncKey, key) {
+			t.Errorf("R%d: user password %+q rejected: %v", tt.r, tt.upwOpen, err)
+		}
+
+		ctx.UserPW, ctx.OwnerPW, ctx.EncKey = "", tt.opwOpen, nil
+		ok, err = validateOwnerPassword(ctx)
+		if err != nil || !ok || !bytes.Equal(ctx.EncKey, key) {
+			t.Errorf("R%d: owner password %+q rejected: %v", tt.r, tt.opwOpen, err)
+		}
+
+		ctx.UserPW, ctx.OwnerPW = "Mueller", "Strasse"
+		if ok, _ := validateUserPassword(ctx); ok {
+			t.Errorf("R%d: wrong user password accepted", tt.r)
+		}
+		if ok, _ := validateOwnerPassword(ctx); ok {
+			t.Errorf("R%d: wrong owner password accepted", tt.r)
+		}
+	}
+}
+
+func hexBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestAES256KnownAnswer(t *testing.T) {
+
+	// O, U, OE and UE computed by an independent implementation of ISO 32000-2 Algorithms 2.B, 8 and 9
+	// using Python's stringprep tables for SASLprep, the validation and key salts below
+	// and the file encryption key 0x20..0x3F.
+	//
+	// U validation salt: 0102030405060708, U key salt: 1112131415161718
+	// O validation salt: 2122232425262728, O key salt: 3132333435363738
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(0x20 + i)
+	}
+
+	for _, tt := range []struct {
+		r        int
+		upw, opw string
+		o, u     string
+		oe, ue   string
+	}{
+		{
+			5, "Müller", "Straße",
+			"335426726386a6b3ac3c01afa2f3690454dbd8e72af60c34eb5659db23e2851c21222324252627283132333435363738",
+			"0a00c03baba19d94e48e5917b411981752bc02d1524acd879ac54f69e2ef91e101020304050607081112131415161718",
+			"d02606466233f7df407adc000be9f7dcd0b8df067f8eb5e534d7086bfe1428a8",
+			"674dbab1d9047b35f08b82278aa1f35595d2c3ee986e043fc7a1da2da07d26e8",
+		},
+		{
+			// NFKC maps half width katakana to full width.
+			6, "ﾊﾟｽﾜｰﾄﾞ", "秘密",
+			"d7e42da11d9d174853cf84c40764a4372098227c900a5705dcfc7da1e3c6fc4321222324252627283132333435363738",
+			"d03ee276c07843b03a218102884f6a2bcddfabdb72c4107c1679d42c52567a5801020304050607081112131415161718",
+			"d71ed68752cbe55acd1515123d7b66d62ed91a351c059f528ed89c3b60a8639b",
+			"33870f9285594200322067a65fb4e82883df1d3bafc75752a3bb00bb077d4451",
+		},
+		{
+			// Soft hyphen maps to nothing, no-break space to space.
+			6, "I\u00ADX Ⅸ", "päss\u00A0wörd",
+			"4f2cb8bbae277a0c875b0549649c5582be515c04456ec8301b3b56333fb8c1b821222324252627283132333435363738",
+			"640dfb8071adc71f94e695c61557b258e4be7721b5fe68a526116a53a60d4f9d01020304050607081112131415161718",
+			"b6c5a454ab6c9f429a38cfec66cdcc0d9cfa79f8dacc4d2d629b3f61f8186cd9",
+			"1fd908f1eefbb1b7bf76c34dd3eeb18ffc06462271f21a50ce16f1547131f84d",
+		},
+		{
+			// Truncated to 127 bytes, splitting the last ü.
+			6, strings.Repeat("ü", 70), strings.Repeat("Ⅸ", 70),
+			"f21a44ea4b5ac95ea1105d0d244626dd547e4acd79f86b59cd7b310dc0fef5ee21222324252627283132333435363738",
+			"3a24ac6ca67cba98918369c9b1d3d70eddc88d49e150baa396b73526b96ad29601020304050607081112131415161718",
+			"34693fd86ab05c627bdc8155733800999b96aebb2e6031cf0572f710455b5991",
+			"8c2c7ae9ec1b87f030888942830503818569ac1e2088ac4cfbb8112ce53a2602",
+		},
+	} {
+		ctx := &Context{Configuration: NewDefaultConfiguration(), XRefTable: &XRefTable{}}
+		ctx.E = &Enc{R: tt.r, L: 256, P: -3904, Emd: true, ID: []byte("0123456789abcdef")}
+		ctx.E.O, ctx.E.U = hexBytes(t, tt.o), hexBytes(t, tt.u)
+		ctx.E.OE, ctx.E.UE = hexBytes(t, tt.oe), hexBytes(t, tt.ue)
+
+		upw, err := encodePassword(tt.upw, tt.r)
+		if err != nil {
+			t.Fatalf("R%d: %+q: %v", tt.r, tt.upw, err)
+		}
+		if s := hashAES256(upw, validationSalt(ctx.E.U), nil, tt.r); !bytes.Equal(s, ctx.E.U[:32]) {
+			t.Errorf("R%d: user password %+q: hash %x, want %x", tt.r, tt.upw, s, ctx.E.U[:32])
+		}
+
+		opw, err := encodePassword(tt.opw, tt.r)
+		if err != nil {
+			t.Fatalf("R%d: %+q: %v", tt.r, tt.opw, err)
+		}
+		if s := hashAES256(opw, validationSalt(ctx.E.O), ctx.E.U, tt.r); !bytes.Equal(s, ctx.E.O[:32]) {
+			t.Errorf("R%d: owner password %+q: hash %x, want %x", tt.r, tt.opw, s, ctx.E.O[:32])
+		}
+
+		ctx.UserPW = tt.upw
+		ok, err := validateUserPassword(ctx)
+		if err != nil || !ok || !bytes.Equal(ctx.EncKey, key) {
+			t.Errorf("R%d: user password %+q: key %x, want %x (%v)", tt.r, tt.upw, ctx.EncKey, key, err)
+		}
+
+		ctx.UserPW, ctx.OwnerPW, ctx.EncKey = "", tt.opw, nil
+		ok, err = validateOwnerPassword(ctx)
+		if err != nil || !ok || !bytes.Equal(ctx.EncKey, key) {
+			t.Errorf("R%d: owner password %+q: key %x, want %x (%v)", tt.r, tt.opw, ctx.EncKey, key, err)
+		}
+	}
+}
+
+func TestPasswordNotRepresentable(t *testing.T) {
+
+	ctx := &Context{Configuration: NewDefaultConfiguration(), XRefTable: &XRefTable{}}
+	ctx.UserPW = "パスワード"
+	ctx.E = &Enc{R: 4, L: 128, P: -3904, Emd: true, ID: []byte("0123456789abcdef")}
+
+	if err := calcOAndU(ctx, NewDict()); err == nil {
+		t.Error("R4: expected error for password not representable in PDFDocEncoding")
+	}
+}
+
+func TestRawUTF8PasswordFallback(t *testing.T) {
+
+	// Files written with the raw UTF-8 bytes of the password still open.
+	for _, r := range []int{4, 6} {
+
+		pw := "Müller"
+
+		ctx := &Context{Configuration: NewDefaultConfiguration(), XRefTable: &XRefTable{}}
+		ctx.E = &Enc{R: r, L: 128, P: -3904, Emd: true, ID: []byte("0123456789abcdef")}
+		if r == 6 {
+			ctx.E.L = 256
+			pw = "Ⅸ"
+		}
+
+		d := NewDict()
+		var err error
+		if r < 5 {
+			ctx.E.O, err = o(ctx, nil, []byte(pw))
+			if err == nil {
+				ctx.E.U, ctx.EncKey, err = u(ctx, []byte(pw))
+			}
+		} else {
+			err = calcOAndUAES256(ctx, d, []byte(pw), []byte(pw))
+		}
+		if err != nil {
+			t.Fatalf("R%d: %v", r, err)
+		}
+
+		ctx.UserPW = pw
+		if ok, err := validateUserPassword(ctx); err != nil || !ok {
+			t.Errorf("R%d: raw UTF-8 user password rejected: %v", r, err)
+		}
+	}
+}
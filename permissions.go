@@ -0,0 +1,158 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// User access permission bits, see Table 22.
+const (
+	permPrint            = 0x0004 // Bit 3
+	permModify           = 0x0008 // Bit 4
+	permCopy             = 0x0010 // Bit 5
+	permAnnotate         = 0x0020 // Bit 6
+	permFillForms        = 0x0100 // Bit 9
+	permAccessibility    = 0x0200 // Bit 10
+	permAssemble         = 0x0400 // Bit 11
+	permPrintHighQuality = 0x0800 // Bit 12
+
+	// Bits 7,8 and 13-32 are reserved and must be 1, bits 1,2 must be 0.
+	permReserved = -3904 // 0xFFFFF0C0
+)
+
+// AccessPermissions represents the user access permissions of an encrypted file.
+type AccessPermissions struct {
+	Print            bool `json:"print"`
+	PrintHighQuality bool `json:"printHighQuality"`
+	Modify           bool `json:"modify"`
+	Copy             bool `json:"copy"`
+	Annotate         bool `json:"annotate"`
+	FillForms        bool `json:"fillForms"`
+	Accessibility    bool `json:"accessibility"`
+	Assemble         bool `json:"assemble"`
+}
+
+// NewAccessPermissions returns the access permissions represented by the P entry of an encrypt dict.
+func NewAccessPermissions(p int) AccessPermissions {
+	return AccessPermissions{
+		Print:            p&permPrint > 0,
+		PrintHighQuality: p&permPrintHighQuality > 0,
+		Modify:           p&permModify > 0,
+		Copy:             p&permCopy > 0,
+		Annotate:         p&permAnnotate > 0,
+		FillForms:        p&permFillForms > 0,
+		Accessibility:    p&permAccessibility > 0,
+		Assemble:         p&permAssemble > 0,
+	}
+}
+
+// P returns the value of the P entry of an encrypt dict representing ap.
+func (ap AccessPermissions) P() int {
+
+	p := permReserved
+
+	for _, f := range []struct {
+		set bool
+		bit int
+	}{
+		{ap.Print, permPrint},
+		{ap.PrintHighQuality, permPrintHighQuality},
+		{ap.Modify, permModify},
+		{ap.Copy, permCopy},
+		{ap.Annotate, permAnnotate},
+		{ap.FillForms, permFillForms},
+		{ap.Accessibility, permAccessibility},
+		{ap.Assemble, permAssemble},
+	} {
+		if f.set {
+			p |= f.bit
+		}
+	}
+
+	return p
+}
+
+func (ap AccessPermissions) String() string {
+	return fmt.Sprintf("print:%t printHighQuality:%t modify:%t copy:%t annotate:%t fillForms:%t accessibility:%t assemble:%t",
+		ap.Print, ap.PrintHighQuality, ap.Modify, ap.Copy, ap.Annotate, ap.FillForms, ap.Accessibility, ap.Assemble)
+}
+
+// ListPermissions returns the user access permissions of ctx.
+// An unencrypted file grants all permissions.
+func ListPermissions(ctx *Context) AccessPermissions {
+
+	if ctx.E == nil {
+		return NewAccessPermissions(int(PermissionsAll))
+	}
+
+	return NewAccessPermissions(ctx.E.P)
+}
+
+// SetPermissions changes the user access permissions of an encrypted file using the owner password.
+//
+// The encrypt dict is updated accordingly: For revisions 2-4 the P entry is part of the file encryption key,
+// so U and the key are recalculated. For revisions 5 and 6 P and Perms are rewritten.
+func SetPermissions(ctx *Context, ap AccessPermissions) error {
+
+	if ctx.E == nil || ctx.Encrypt == nil {
+		return errors.New("pdfcpu: this file is not encrypted")
+	}
+
+	d, err := ctx.DereferenceDict(*ctx.Encrypt)
+	if err != nil {
+		return err
+	}
+
+	if filter := d.NameEntry("Filter"); filter == nil || *filter != "Standard" {
+		return errors.New("pdfcpu: setPermissions: only supported for the standard security handler")
+	}
+
+	opw, ok, err := ownerPassword(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("pdfcpu: please provide the owner password with -opw")
+	}
+
+	ctx.E.P = ap.P()
+	ctx.Permissions = int16(ctx.E.P)
+	d.Update("P", Integer(ctx.E.P))
+
+	if ctx.E.R >= 5 {
+		// The file encryption key is independent of P.
+		return writePermissions(ctx, d)
+	}
+
+	// O only depends on the passwords whereas U and the file encryption key depend on P too.
+	upw, err := userPasswordFromO(ctx, opw)
+	if err != nil {
+		return err
+	}
+
+	ctx.E.U, ctx.EncKey, err = u(ctx, upw)
+	if err != nil {
+		return err
+	}
+
+	d.Update("U", HexLiteral(hex.EncodeToString(ctx.E.U)))
+
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"testing"
+)
+
+// encryptedContext returns the context of minimalPDF encrypted for revision r and key length l
+// using the standard security handler with the passwords upw and opw.
+func encryptedContext(t *testing.T, r, l int) *Context {
+	t.Helper()
+
+	ctx := readMinimalPDF(t)
+	ctx.UserPW, ctx.OwnerPW = "upw", "opw"
+	ctx.E = &Enc{R: r, L: l, P: -3904, Emd: true, ID: []byte("0123456789abcdef")}
+
+	if r >= 5 {
+		// Allocated like the reader does when loading the encrypt dict.
+		ctx.E.OE, ctx.E.UE, ctx.E.Perms = make([]byte, 32), make([]byte, 32), make([]byte, 16)
+	}
+
+	d := NewDict()
+	d.InsertName("Filter", "Standard")
+	d.InsertInt("R", r)
+	d.InsertInt("Length", l)
+	d.InsertInt("P", ctx.E.P)
+
+	if err := calcOAndU(ctx, d); err != nil {
+		t.Fatalf("R%d: %v", r, err)
+	}
+	if r >= 5 {
+		if err := writePermissions(ctx, d); err != nil {
+			t.Fatalf("R%d: %v", r, err)
+		}
+	}
+
+	ir, err := ctx.IndRefForNewObject(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Encrypt = ir
+
+	return ctx
+}
+
+func TestSetPermissions(t *testing.T) {
+
+	ap := AccessPermissions{Print: true, Accessibility: true}
+	want := permReserved | permPrint | permAccessibility
+
+	for _, tt := range []struct {
+		r, l int
+	}{
+		{2, 40},
+		{3, 128},
+		{4, 128},
+		{5, 256},
+		{6, 256},
+	} {
+		ctx := encryptedContext(t, tt.r, tt.l)
+		u := append([]byte(nil), ctx.E.U...)
+		perms := append([]byte(nil), ctx.E.Perms...)
+
+		if err := SetPermissions(ctx, ap); err != nil {
+			t.Fatalf("R%d: %v", tt.r, err)
+		}
+
+		d, err := ctx.DereferenceDict(*ctx.Encrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p := d.IntEntry("P"); p == nil || *p != want {
+			t.Errorf("R%d: got P %v, want %d", tt.r, p, want)
+		}
+
+		if got := ListPermissions(ctx); got != ap {
+			t.Errorf("R%d: got %s, want %s", tt.r, got, ap)
+		}
+
+		// The user password still opens the file, so U and the file encryption key are consistent with the new P.
+		ctx.OwnerPW, ctx.EncKey = "", nil
+		if ok, err := validateUserPassword(ctx); err != nil || !ok {
+			t.Errorf("R%d: user password rejected: %v", tt.r, err)
+		}
+
+		if tt.r < 5 {
+			// For R2-R4 P is part of the file encryption key.
+			if bytes.Equal(ctx.E.U, u) {
+				t.Errorf("R%d: U unchanged", tt.r)
+			}
+			continue
+		}
+
+		if bytes.Equal(ctx.E.Perms, perms) {
+			t.Errorf("R%d: Perms unchanged", tt.r)
+		}
+
+		// Algorithm 13: Perms decrypts to P, followed by 0xFFFFFFFF, T or F, adb.
+		cb, err := aes.NewCipher(ctx.EncKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 16)
+		cb.Decrypt(b, ctx.E.Perms)
+
+		if p := int32(binary.LittleEndian.Uint32(b)); int(p) != want {
+			t.Errorf("R%d: got Perms P %d, want %d", tt.r, p, want)
+		}
+		if string(b[4:12]) != "\xff\xff\xff\xffTadb" {
+			t.Errorf("R%d: got Perms %x", tt.r, b)
+		}
+	}
+}
+
+func TestSetPermissionsFile(t *testing.T) {
+
+	ap := AccessPermissions{Print: true, Accessibility: true}
+
+	for _, tt := range []struct {
+		name string
+		conf func(upw, opw string) *Configuration
+		r, v int // written by the standard security handler
+	}{
+		{"RC4 40", func(upw, opw string) *Configuration { return NewRC4Configuration(upw, opw, 40) }, 2, 1},
+		{"RC4 128", func(upw, opw string) *Configuration { return NewRC4Configuration(upw, opw, 128) }, 4, 4},
+		{"AES 128", func(upw, opw string) *Configuration { return NewAESConfiguration(upw, opw, 128) }, 4, 4},
+		{"AES 256", func(upw, opw string) *Configuration { return NewAESConfiguration(upw, opw, 256) }, 6, 5},
+	} {
+		_, enc := process(t, Command{Mode: ENCRYPT, Conf: tt.conf("upw", "opw")}, minimalPDF())
+
+		ctx, err := Read(bytes.NewReader(enc), tt.conf("upw", ""))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if ctx.E.R != tt.r || ctx.E.V != tt.v {
+			t.Errorf("%s: got R%d V%d, want R%d V%d", tt.name, ctx.E.R, ctx.E.V, tt.r, tt.v)
+		}
+
+		if _, err = Process(Command{Mode: SETPERMISSIONS, Permissions: ap, In: bytes.NewReader(enc), Out: &bytes.Buffer{}, Conf: tt.conf("upw", "")}); err == nil {
+			t.Errorf("%s: missing error for missing owner password", tt.name)
+		}
+
+		_, out := process(t, Command{Mode: SETPERMISSIONS, Permissions: ap, Conf: tt.conf("upw", "opw")}, enc)
+
+		// The user password still opens the file.
+		if ctx, err = Read(bytes.NewReader(out), tt.conf("upw", "")); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if got := ListPermissions(ctx); got != ap {
+			t.Errorf("%s: got %s, want %s", tt.name, got, ap)
+		}
+
+		if tt.r >= 5 {
+			if ok, err := validatePermissions(ctx); err != nil || !ok {
+				t.Errorf("%s: Perms do not match P: %v", tt.name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,312 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Command represents an operation to be executed by Process.
+type Command struct {
+	Mode CommandMode // The operation to be executed.
+
+	In    io.ReadSeeker   // The file to be processed.
+	InAdd []io.ReadSeeker // MERGE: files to be appended to In.
+	Out   io.Writer       // Receives the resulting file for commands modifying In.
+
+	Pages         IntSet // Selected pages, nil means all pages.
+	PageSelection string // Selected pages using the syntax of PagesForPageSelection, ignored if Pages is set.
+
+	Conf *Configuration // nil means the default configuration.
+
+	// Options
+	Files       StringSet         // ADDATTACHMENTS(PORTFOLIO) as filename[,description], REMOVEATTACHMENTS, EXTRACTATTACHMENTS
+	Keywords    []string          // ADDKEYWORDS, REMOVEKEYWORDS
+	Properties  map[string]string // ADDPROPERTIES, REMOVEPROPERTIES (keys only)
+	Permissions AccessPermissions // SETPERMISSIONS
+	Watermark   *Watermark        // ADDWATERMARKS
+	Images      []io.Reader       // IMPORTIMAGES
+	Import      *Import           // IMPORTIMAGES, nil means DefaultImportConfig
+
+	// Results
+	Info        *DocInfo          // INFO: receives the structured info if not nil.
+	Attachments map[string][]byte // EXTRACTATTACHMENTS: receives the contents of the extracted files if not nil.
+}
+
+// operation executes a command on a context that has been read.
+// It returns any output lines and true if ctx has been modified and needs to be written.
+type operation func(ctx *Context, cmd *Command) (ss []string, write bool, err error)
+
+var operations = map[CommandMode]operation{
+	VALIDATE:                validate,
+	INFO:                    info,
+	MERGE:                   merge,
+	LISTATTACHMENTS:         listAttachments,
+	REMOVEATTACHMENTS:       removeAttachments,
+	ADDATTACHMENTS:          addAttachments,
+	ADDATTACHMENTSPORTFOLIO: addAttachments,
+	EXTRACTATTACHMENTS:      extractAttachments,
+	LISTKEYWORDS:            listKeywords,
+	ADDKEYWORDS:             addKeywords,
+	REMOVEKEYWORDS:          removeKeywords,
+	LISTPROPERTIES:          listProperties,
+	ADDPROPERTIES:           addProperties,
+	REMOVEPROPERTIES:        removeProperties,
+	LISTPERMISSIONS:         listPermissions,
+	SETPERMISSIONS:          setPermissions,
+	ENCRYPT:                 rewrite,
+	DECRYPT:                 rewrite,
+	CHANGEUPW:               rewrite,
+	CHANGEOPW:               rewrite,
+	ADDWATERMARKS:           addWatermarks,
+	REMOVEWATERMARKS:        removeWatermarks,
+	INSERTPAGESBEFORE:       insertPages,
+	INSERTPAGESAFTER:        insertPages,
+	IMPORTIMAGES:            importImages,
+}
+
+// Process executes cmd: It reads cmd.In, checks the access permissions needed for cmd.Mode,
+// performs the operation and writes the result to cmd.Out if the file has been modified.
+// It returns any output produced by the operation, eg. a list of attachments.
+func Process(cmd Command) ([]string, error) {
+
+	op, ok := operations[cmd.Mode]
+	if !ok {
+		return nil, fmt.Errorf("pdfcpu: command %d not supported", cmd.Mode)
+	}
+
+	if cmd.In == nil {
+		return nil, errors.New("pdfcpu: missing input")
+	}
+
+	conf := NewDefaultConfiguration()
+	if cmd.Conf != nil {
+		c := *cmd.Conf
+		conf = &c
+	}
+	conf.Cmd = cmd.Mode
+
+	from := time.Now()
+
+	ctx, err := Read(cmd.In, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ctx.EnsurePageCount(); err != nil {
+		return nil, err
+	}
+
+	if err = ensureInfoDict(ctx); err != nil {
+		return nil, err
+	}
+
+	if cmd.Pages == nil && cmd.PageSelection != "" {
+		if cmd.Pages, err = PagesForPageSelection(ctx.PageCount, cmd.PageSelection); err != nil {
+			return nil, err
+		}
+	}
+
+	durRead := time.Since(from).Seconds()
+	from = time.Now()
+
+	if ctx.E != nil && !hasNeededPermissions(ctx.Cmd, ctx.E) {
+		return nil, errors.New("pdfcpu: insufficient access permissions")
+	}
+
+	durPerm := time.Since(from).Seconds()
+	from = time.Now()
+
+	ss, write, err := op(ctx, &cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	durOp := time.Since(from).Seconds()
+	from = time.Now()
+
+	if write {
+		if cmd.Out == nil {
+			return nil, errors.New("pdfcpu: missing output")
+		}
+		if err = Write(ctx, cmd.Out); err != nil {
+			return nil, err
+		}
+		ctx.Write.LogStats()
+	}
+
+	durWrite := time.Since(from).Seconds()
+	durTotal := durRead + durPerm + durOp + durWrite
+
+	ProcessTimingStats(durRead, durPerm, durOp, durWrite, durTotal)
+
+	return ss, nil
+}
+
+func validate(ctx *Context, cmd *Command) ([]string, bool, error) {
+	return nil, false, Validate(ctx)
+}
+
+func info(ctx *Context, cmd *Command) ([]string, bool, error) {
+	if cmd.Info != nil {
+		info, err := ctx.DocInfo()
+		if err != nil {
+			return nil, false, err
+		}
+		*cmd.Info = *info
+	}
+	ss, err := ctx.InfoDigest()
+	return ss, false, err
+}
+
+func merge(ctx *Context, cmd *Command) ([]string, bool, error) {
+
+	for _, rs := range cmd.InAdd {
+
+		ctxSrc, err := Read(rs, ctx.Configuration)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if err = ctxSrc.EnsurePageCount(); err != nil {
+			return nil, false, err
+		}
+
+		if err = MergeXRefTables(ctxSrc, ctx); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return nil, true, nil
+}
+
+func listAttachments(ctx *Context, cmd *Command) ([]string, bool, error) {
+	ss, err := AttachList(ctx.XRefTable)
+	return ss, false, err
+}
+
+func removeAttachments(ctx *Context, cmd *Command) ([]string, bool, error) {
+	ok, err := AttachRemove(ctx.XRefTable, cmd.Files)
+	return nil, ok, err
+}
+
+func addAttachments(ctx *Context, cmd *Command) ([]string, bool, error) {
+	ok, err := AttachAdd(ctx.XRefTable, cmd.Files, cmd.Mode == ADDATTACHMENTSPORTFOLIO)
+	return nil, ok, err
+}
+
+func extractAttachments(ctx *Context, cmd *Command) ([]string, bool, error) {
+
+	m, err := AttachExtract(ctx, cmd.Files)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ss []string
+	for fileName, b := range m {
+		ss = append(ss, fileName)
+		if cmd.Attachments != nil {
+			cmd.Attachments[fileName] = b
+		}
+	}
+	sort.Strings(ss)
+
+	return ss, false, nil
+}
+
+func listKeywords(ctx *Context, cmd *Command) ([]string, bool, error) {
+	ss, err := KeywordsList(ctx.XRefTable)
+	return ss, false, err
+}
+
+func addKeywords(ctx *Context, cmd *Command) ([]string, bool, error) {
+	return nil, true, KeywordsAdd(ctx.XRefTable, cmd.Keywords)
+}
+
+func removeKeywords(ctx *Context, cmd *Command) ([]string, bool, error) {
+	ok, err := KeywordsRemove(ctx.XRefTable, cmd.Keywords)
+	return nil, ok, err
+}
+
+func listProperties(ctx *Context, cmd *Command) ([]string, bool, error) {
+	ss, err := PropertiesList(ctx.XRefTable)
+	return ss, false, err
+}
+
+func addProperties(ctx *Context, cmd *Command) ([]string, bool, error) {
+	return nil, true, PropertiesAdd(ctx.XRefTable, cmd.Properties)
+}
+
+func removeProperties(ctx *Context, cmd *Command) ([]string, bool, error) {
+
+	var keys []string
+	for k := range cmd.Properties {
+		keys = append(keys, k)
+	}
+
+	ok, err := PropertiesRemove(ctx.XRefTable, keys)
+
+	return nil, ok, err
+}
+
+func listPermissions(ctx *Context, cmd *Command) ([]string, bool, error) {
+	return Permissions(ctx), false, nil
+}
+
+func setPermissions(ctx *Context, cmd *Command) ([]string, bool, error) {
+	return nil, true, SetPermissions(ctx, cmd.Permissions)
+}
+
+// rewrite covers commands taking effect when writing, see handleEncryptionForWrite.
+func rewrite(ctx *Context, cmd *Command) ([]string, bool, error) {
+	return nil, true, nil
+}
+
+func addWatermarks(ctx *Context, cmd *Command) ([]string, bool, error) {
+	if cmd.Watermark == nil {
+		return nil, false, errors.New("pdfcpu: missing watermark")
+	}
+	return nil, true, AddWatermarks(ctx, cmd.Pages, cmd.Watermark)
+}
+
+func removeWatermarks(ctx *Context, cmd *Command) ([]string, bool, error) {
+	return nil, true, RemoveWatermarks(ctx, cmd.Pages)
+}
+
+func importImages(ctx *Context, cmd *Command) ([]string, bool, error) {
+	if len(cmd.Images) == 0 {
+		return nil, false, errors.New("pdfcpu: missing images")
+	}
+	return nil, true, ImportImages(ctx.XRefTable, cmd.Images, cmd.Import)
+}
+
+func insertPages(ctx *Context, cmd *Command) ([]string, bool, error) {
+
+	pages := cmd.Pages
+	if pages == nil {
+		pages = IntSet{}
+		for i := 1; i <= ctx.PageCount; i++ {
+			pages[i] = true
+		}
+	}
+
+	return nil, true, ctx.InsertPages(pages, cmd.Mode == INSERTPAGESBEFORE)
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// process runs cmd on in and returns the output lines and the written file.
+func process(t *testing.T, cmd Command, in []byte) ([]string, []byte) {
+	t.Helper()
+
+	var out bytes.Buffer
+	cmd.In = bytes.NewReader(in)
+	cmd.Out = &out
+
+	ss, err := Process(cmd)
+	if err != nil {
+		t.Fatalf("mode %d: %v", cmd.Mode, err)
+	}
+
+	return ss, out.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+
+	in := minimalPDF()
+
+	xRefTable := NewDefaultConfiguration()
+	xRefTable.WriteXRefStream = false
+
+	var out []byte
+
+	for _, tt := range []struct {
+		name string
+		conf *Configuration
+	}{
+		{"xref table", xRefTable},
+		{"xref stream", nil},
+	} {
+		_, out = process(t, Command{Mode: ADDKEYWORDS, Keywords: []string{"alpha", "beta"}, Conf: tt.conf}, in)
+
+		ss, _ := process(t, Command{Mode: LISTKEYWORDS}, out)
+		if want := []string{"alpha", "beta"}; !reflect.DeepEqual(ss, want) {
+			t.Errorf("%s: got %v, want %v", tt.name, ss, want)
+		}
+	}
+
+	// Encrypt, read back using the user password and decrypt.
+	conf := NewAESConfiguration("upw", "opw", 256)
+	_, enc := process(t, Command{Mode: ENCRYPT, Conf: conf}, out)
+
+	if _, err := Process(Command{Mode: LISTKEYWORDS, In: bytes.NewReader(enc)}); err == nil {
+		t.Error("missing error for encrypted file without password")
+	}
+
+	ss, _ := process(t, Command{Mode: LISTKEYWORDS, Conf: conf}, enc)
+	if len(ss) != 2 {
+		t.Errorf("encrypted: got %v", ss)
+	}
+
+	_, dec := process(t, Command{Mode: DECRYPT, Conf: conf}, enc)
+	if ss, _ = process(t, Command{Mode: LISTKEYWORDS}, dec); len(ss) != 2 {
+		t.Errorf("decrypted: got %v", ss)
+	}
+
+	// Add a stamp and remove it again.
+	wm, err := ParseTextWatermarkDetails("Café", "font:Helvetica, points:24", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, stamped := process(t, Command{Mode: ADDWATERMARKS, Watermark: wm}, in)
+	process(t, Command{Mode: REMOVEWATERMARKS}, stamped)
+
+	if _, err := Process(Command{Mode: NUP, In: bytes.NewReader(in)}); err == nil {
+		t.Error("missing error for unsupported command")
+	}
+}
+
+func TestDocInfo(t *testing.T) {
+
+	_, out := process(t, Command{Mode: ADDKEYWORDS, Keywords: []string{"alpha", "beta"}}, minimalPDF())
+	_, out = process(t, Command{Mode: ADDPROPERTIES, Properties: map[string]string{"k": "v"}}, out)
+
+	var info DocInfo
+	process(t, Command{Mode: INFO, Info: &info}, out)
+
+	if info.PageCount != 1 || len(info.PageSizes) != 1 || info.Units != "points" {
+		t.Errorf("got pages %d, sizes %v %s", info.PageCount, info.PageSizes, info.Units)
+	}
+	if want := []string{"alpha", "beta"}; !reflect.DeepEqual(info.Keywords, want) {
+		t.Errorf("got keywords %v, want %v", info.Keywords, want)
+	}
+	if want := map[string]string{"k": "v"}; !reflect.DeepEqual(info.Properties, want) {
+		t.Errorf("got properties %v, want %v", info.Properties, want)
+	}
+	if info.Encrypted || info.Permissions != NewAccessPermissions(int(PermissionsAll)) {
+		t.Errorf("got encrypted %t, permissions %v", info.Encrypted, info.Permissions)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+
+	dir := t.TempDir()
+
+	// More than maxEntries files result in a name tree with kids.
+	files := map[string]string{"a.txt": "alpha", "b.txt": "beta", "c.txt": "gamma", "d.txt": "delta"}
+	for fn, s := range files {
+		if err := os.WriteFile(filepath.Join(dir, fn), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, mode := range []CommandMode{ADDATTACHMENTS, ADDATTACHMENTSPORTFOLIO} {
+
+		add := StringSet{filepath.Join(dir, "a.txt") + ",first": true}
+		for _, fn := range []string{"b.txt", "c.txt", "d.txt"} {
+			add[filepath.Join(dir, fn)] = true
+		}
+		_, out := process(t, Command{Mode: mode, Files: add}, minimalPDF())
+
+		if got := bytes.Contains(out, []byte("/Collection")); got != (mode == ADDATTACHMENTSPORTFOLIO) {
+			t.Errorf("mode %d: got collection %t", mode, got)
+		}
+		if !bytes.Contains(out, []byte("(first)")) {
+			t.Errorf("mode %d: missing description", mode)
+		}
+
+		ss, _ := process(t, Command{Mode: LISTATTACHMENTS}, out)
+		if want := []string{"a.txt", "b.txt", "c.txt", "d.txt"}; !reflect.DeepEqual(ss, want) {
+			t.Errorf("mode %d: got %v, want %v", mode, ss, want)
+		}
+
+		m := map[string][]byte{}
+		ss, _ = process(t, Command{Mode: EXTRACTATTACHMENTS, Attachments: m}, out)
+		if want := []string{"a.txt", "b.txt", "c.txt", "d.txt"}; !reflect.DeepEqual(ss, want) {
+			t.Errorf("mode %d: extracted %v, want %v", mode, ss, want)
+		}
+		for fn, s := range files {
+			if string(m[fn]) != s {
+				t.Errorf("mode %d: %s: got %q, want %q", mode, fn, m[fn], s)
+			}
+		}
+
+		if _, err := Process(Command{Mode: EXTRACTATTACHMENTS, In: bytes.NewReader(out), Files: StringSet{"e.txt": true}}); err == nil {
+			t.Errorf("mode %d: missing error for unknown attachment", mode)
+		}
+
+		_, out = process(t, Command{Mode: REMOVEATTACHMENTS, Files: StringSet{"a.txt": true, "c.txt": true}}, out)
+		if ss, _ = process(t, Command{Mode: LISTATTACHMENTS}, out); !reflect.DeepEqual(ss, []string{"b.txt", "d.txt"}) {
+			t.Errorf("mode %d: after removal got %v, want [b.txt d.txt]", mode, ss)
+		}
+	}
+}
+
+func TestImportImages(t *testing.T) {
+
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(1, 1, color.NRGBA{R: 0xFF, A: 0xFF})
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+
+	imp, err := ParseImportDetails("pos:c, sc:0.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, imp := range []*Import{nil, imp} {
+
+		rr := []io.Reader{bytes.NewReader(b.Bytes()), bytes.NewReader(b.Bytes())}
+		_, out := process(t, Command{Mode: IMPORTIMAGES, Images: rr, Import: imp}, minimalPDF())
+
+		ctx, err := Read(bytes.NewReader(out), NewDefaultConfiguration())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ctx.EnsurePageCount(); err != nil {
+			t.Fatal(err)
+		}
+		if ctx.PageCount != 3 {
+			t.Errorf("%v: got %d pages, want 3", imp, ctx.PageCount)
+		}
+		if err = Validate(ctx); err != nil {
+			t.Errorf("%v: %v", imp, err)
+		}
+	}
+}
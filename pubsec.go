@@ -0,0 +1,763 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+// Functions dealing with the public-key security handler (see 7.6.5).
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Recipient represents a recipient of a file encrypted by the public-key security handler.
+type Recipient struct {
+	Certificate *x509.Certificate
+	Permissions int16 // User access permissions granted to this recipient, see Table 22.
+}
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAESOAEP     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidDESEDE3CBC    = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidAES128CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// CMS structures (RFC 5652) needed for key transport.
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type cmsEnvelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo cmsEncryptedContentInfo
+}
+
+type cmsEncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type cmsKeyTransRecipientInfo struct {
+	Version                int
+	Rid                    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// berToDER converts BER encoded b into DER by resolving indefinite lengths.
+func berToDER(b []byte) ([]byte, error) {
+
+	var out bytes.Buffer
+
+	for len(b) > 0 {
+		n, err := berElement(b, &out)
+		if err != nil {
+			return nil, err
+		}
+		b = b[n:]
+	}
+
+	return out.Bytes(), nil
+}
+
+// berElement writes the DER encoding of the first element of b to out and returns the number of bytes consumed.
+func berElement(b []byte, out *bytes.Buffer) (int, error) {
+
+	errCorrupt := errors.New("pdfcpu: pubsec: corrupt BER encoding")
+
+	if len(b) < 2 {
+		return 0, errCorrupt
+	}
+
+	// Tag
+	i := 1
+	if b[0]&0x1F == 0x1F {
+		for i < len(b) && b[i]&0x80 > 0 {
+			i++
+		}
+		i++
+	}
+	if i >= len(b) {
+		return 0, errCorrupt
+	}
+	tag := b[:i]
+	constructed := b[0]&0x20 > 0
+
+	// Length
+	l := int(b[i])
+	i++
+
+	if l == 0x80 {
+		// Indefinite length, constructed only.
+		if !constructed {
+			return 0, errCorrupt
+		}
+		var content bytes.Buffer
+		for {
+			if i+1 >= len(b) {
+				return 0, errCorrupt
+			}
+			if b[i] == 0 && b[i+1] == 0 {
+				i += 2
+				break
+			}
+			n, err := berElement(b[i:], &content)
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+		writeDERElement(out, tag, content.Bytes())
+		return i, nil
+	}
+
+	if l > 0x80 {
+		c := l & 0x7F
+		if c > 4 || i+c > len(b) {
+			return 0, errCorrupt
+		}
+		l = 0
+		for _, x := range b[i : i+c] {
+			l = l<<8 | int(x)
+		}
+		i += c
+	}
+
+	if l < 0 || i+l > len(b) {
+		return 0, errCorrupt
+	}
+
+	if !constructed {
+		writeDERElement(out, tag, b[i:i+l])
+		return i + l, nil
+	}
+
+	content, err := berToDER(b[i : i+l])
+	if err != nil {
+		return 0, err
+	}
+
+	writeDERElement(out, tag, content)
+
+	return i + l, nil
+}
+
+func writeDERElement(out *bytes.Buffer, tag, content []byte) {
+
+	out.Write(tag)
+
+	l := len(content)
+
+	switch {
+	case l < 0x80:
+		out.WriteByte(byte(l))
+	default:
+		bb := []byte{}
+		for ; l > 0; l >>= 8 {
+			bb = append([]byte{byte(l)}, bb...)
+		}
+		out.WriteByte(0x80 | byte(len(bb)))
+		out.Write(bb)
+	}
+
+	out.Write(content)
+}
+
+// octets returns the content of an octet string that may have been encoded using the constructed form.
+func octets(rv asn1.RawValue) ([]byte, error) {
+
+	if !rv.IsCompound {
+		return rv.Bytes, nil
+	}
+
+	var bb []byte
+
+	for rest := rv.Bytes; len(rest) > 0; {
+		var v asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &v); err != nil {
+			return nil, err
+		}
+		b, err := octets(v)
+		if err != nil {
+			return nil, err
+		}
+		bb = append(bb, b...)
+	}
+
+	return bb, nil
+}
+
+func pkcs7Unpad(b []byte, blockSize int) ([]byte, error) {
+
+	if len(b) == 0 || len(b)%blockSize > 0 {
+		return nil, errors.New("pdfcpu: pubsec: invalid padding")
+	}
+
+	n := int(b[len(b)-1])
+	if n == 0 || n > blockSize || n > len(b) {
+		return nil, errors.New("pdfcpu: pubsec: invalid padding")
+	}
+
+	return b[:len(b)-n], nil
+}
+
+func pkcs7Pad(b []byte, blockSize int) []byte {
+	n := blockSize - len(b)%blockSize
+	return append(b, bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func matchesCertificate(rid asn1.RawValue, cert *x509.Certificate) bool {
+
+	// SubjectKeyIdentifier
+	if rid.Class == asn1.ClassContextSpecific && rid.Tag == 0 {
+		return len(cert.SubjectKeyId) > 0 && bytes.Equal(rid.Bytes, cert.SubjectKeyId)
+	}
+
+	var ias cmsIssuerAndSerialNumber
+	if _, err := asn1.Unmarshal(rid.FullBytes, &ias); err != nil {
+		return false
+	}
+
+	return bytes.Equal(ias.Issuer.FullBytes, cert.RawIssuer) && ias.SerialNumber.Cmp(cert.SerialNumber) == 0
+}
+
+func decryptContentEncryptionKey(ri cmsKeyTransRecipientInfo, key *rsa.PrivateKey) ([]byte, error) {
+
+	alg := ri.KeyEncryptionAlgorithm.Algorithm
+
+	switch {
+
+	case alg.Equal(oidRSAEncryption):
+		return rsa.DecryptPKCS1v15(nil, key, ri.EncryptedKey)
+
+	case alg.Equal(oidRSAESOAEP):
+		// Default parameters only: SHA-1 and MGF1 with SHA-1.
+		return rsa.DecryptOAEP(sha1.New(), nil, key, ri.EncryptedKey, nil)
+	}
+
+	return nil, fmt.Errorf("pdfcpu: pubsec: unsupported key encryption algorithm %s", alg)
+}
+
+func decryptContent(eci cmsEncryptedContentInfo, cek []byte) ([]byte, error) {
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.New("pdfcpu: pubsec: missing content encryption iv")
+	}
+
+	var cb cipher.Block
+	var err error
+
+	alg := eci.ContentEncryptionAlgorithm.Algorithm
+
+	switch {
+
+	case alg.Equal(oidAES128CBC), alg.Equal(oidAES192CBC), alg.Equal(oidAES256CBC):
+		cb, err = aes.NewCipher(cek)
+
+	case alg.Equal(oidDESEDE3CBC):
+		cb, err = des.NewTripleDESCipher(cek)
+
+	default:
+		return nil, fmt.Errorf("pdfcpu: pubsec: unsupported content encryption algorithm %s", alg)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(iv) != cb.BlockSize() {
+		return nil, errors.New("pdfcpu: pubsec: invalid content encryption iv")
+	}
+
+	b, err := octets(eci.EncryptedContent)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 || len(b)%cb.BlockSize() > 0 {
+		return nil, errors.New("pdfcpu: pubsec: corrupt encrypted content")
+	}
+
+	data := make([]byte, len(b))
+	cipher.NewCBCDecrypter(cb, iv).CryptBlocks(data, b)
+
+	return pkcs7Unpad(data, cb.BlockSize())
+}
+
+// openEnvelope returns the content of the CMS enveloped data in b for the recipient identified by cert and key.
+// The bool result is false if there is no matching recipient.
+func openEnvelope(b []byte, cert *x509.Certificate, key *rsa.PrivateKey) ([]byte, bool, error) {
+
+	b, err := berToDER(b)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ci cmsContentInfo
+	if _, err = asn1.Unmarshal(b, &ci); err != nil {
+		return nil, false, err
+	}
+
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, false, errors.New("pdfcpu: pubsec: recipient is not CMS enveloped data")
+	}
+
+	var ed cmsEnvelopedData
+	if _, err = asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, false, err
+	}
+
+	for _, rv := range ed.RecipientInfos {
+
+		var ri cmsKeyTransRecipientInfo
+		if _, err := asn1.Unmarshal(rv.FullBytes, &ri); err != nil {
+			// Key agreement or other recipient info types are not supported.
+			continue
+		}
+
+		if !matchesCertificate(ri.Rid, cert) {
+			continue
+		}
+
+		cek, err := decryptContentEncryptionKey(ri, key)
+		if err != nil {
+			return nil, true, err
+		}
+
+		bb, err := decryptContent(ed.EncryptedContentInfo, cek)
+
+		return bb, true, err
+	}
+
+	return nil, false, nil
+}
+
+// sealEnvelope returns CMS enveloped data encrypting content for certs.
+func sealEnvelope(content []byte, certs []*x509.Certificate) ([]byte, error) {
+
+	cek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	cb, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	data := pkcs7Pad(append([]byte(nil), content...), aes.BlockSize)
+	cipher.NewCBCEncrypter(cb, iv).CryptBlocks(data, data)
+
+	ed := cmsEnvelopedData{}
+
+	for _, cert := range certs {
+
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("pdfcpu: pubsec: recipient %s: RSA public key required", cert.Subject)
+		}
+
+		ek, err := rsa.EncryptPKCS1v15(rand.Reader, pub, cek)
+		if err != nil {
+			return nil, err
+		}
+
+		rid, err := asn1.Marshal(cmsIssuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber})
+		if err != nil {
+			return nil, err
+		}
+
+		ri, err := asn1.Marshal(cmsKeyTransRecipientInfo{
+			Rid:                    asn1.RawValue{FullBytes: rid},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			EncryptedKey:           ek,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		ed.RecipientInfos = append(ed.RecipientInfos, asn1.RawValue{FullBytes: ri})
+	}
+
+	ivParms, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	ed.EncryptedContentInfo = cmsEncryptedContentInfo{
+		ContentType:                oidData,
+		ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParms}},
+		EncryptedContent:           asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: data},
+	}
+
+	b, err := asn1.Marshal(ed)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
+
+func stringBytes(o Object) ([]byte, error) {
+
+	switch o := o.(type) {
+
+	case HexLiteral:
+		return o.Bytes()
+
+	case StringLiteral:
+		return Unescape(o.Value())
+	}
+
+	return nil, errors.New("pdfcpu: pubsec: recipient must be a string")
+}
+
+// pubSecRecipients returns the recipient list for the public-key security handler described by d.
+func pubSecRecipients(xRefTable *XRefTable, d Dict, subFilter string) ([][]byte, error) {
+
+	if subFilter == "adbe.pkcs7.s5" {
+		// Recipients live in the crypt filters.
+		d1 := pubSecCryptFilter(d)
+		if d1 == nil {
+			return nil, errors.New("pdfcpu: pubsec: missing crypt filter")
+		}
+		d = d1
+	}
+
+	o, found := d.Find("Recipients")
+	if !found {
+		return nil, errors.New("pdfcpu: pubsec: missing entry \"Recipients\"")
+	}
+
+	o, err := xRefTable.Dereference(o)
+	if err != nil {
+		return nil, err
+	}
+
+	a, ok := o.(Array)
+	if !ok {
+		// A single recipient.
+		a = Array{o}
+	}
+
+	rr := [][]byte{}
+
+	for _, o := range a {
+		o, err = xRefTable.Dereference(o)
+		if err != nil {
+			return nil, err
+		}
+		b, err := stringBytes(o)
+		if err != nil {
+			return nil, err
+		}
+		rr = append(rr, b)
+	}
+
+	return rr, nil
+}
+
+// pubSecCryptFilter returns the first crypt filter dict in use for streams, strings or embedded files.
+func pubSecCryptFilter(d Dict) Dict {
+
+	cfDict := d.DictEntry("CF")
+	if cfDict == nil {
+		return nil
+	}
+
+	for _, k := range []string{"StmF", "StrF", "EFF"} {
+		if n := d.NameEntry(k); n != nil && *n != "Identity" {
+			if d1 := cfDict.DictEntry(*n); d1 != nil {
+				return d1
+			}
+		}
+	}
+
+	return nil
+}
+
+// pubSecRevision returns the standard security handler revision with equivalent behaviour for v.
+func pubSecRevision(v int) int {
+	switch v {
+	case 1:
+		return 2
+	case 2:
+		return 3
+	}
+	return v
+}
+
+// supportedPubSecEncryption returns a pointer to a struct encapsulating used encryption plus the list of recipients.
+func supportedPubSecEncryption(ctx *Context, d Dict) (*Enc, [][]byte, error) {
+
+	subFilter := d.NameEntry("SubFilter")
+	if subFilter == nil || (*subFilter != "adbe.pkcs7.s4" && *subFilter != "adbe.pkcs7.s5") {
+		return nil, nil, errors.New("pdfcpu: unsupported encryption: \"SubFilter\" must be \"adbe.pkcs7.s4\" or \"adbe.pkcs7.s5\"")
+	}
+
+	v, err := checkV(ctx, d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if (*subFilter == "adbe.pkcs7.s5") != (*v >= 4) {
+		return nil, nil, fmt.Errorf("pdfcpu: unsupported encryption: \"V\" %d invalid for \"%s\"", *v, *subFilter)
+	}
+
+	l, err := length(d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encMeta := true
+
+	if *v >= 4 {
+		cfDict := pubSecCryptFilter(d)
+		if cfDict == nil {
+			return nil, nil, errors.New("pdfcpu: pubsec: missing crypt filter")
+		}
+		if cfl := cfDict.IntEntry("Length"); cfl != nil {
+			l = *cfl
+			if l <= 32 {
+				// in bytes
+				l *= 8
+			}
+		} else if *v == 5 {
+			l = 256
+		} else {
+			l = 128
+		}
+		if emd := cfDict.BooleanEntry("EncryptMetadata"); emd != nil {
+			encMeta = *emd
+		}
+	}
+
+	recipients, err := pubSecRecipients(ctx.XRefTable, d, *subFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &Enc{L: l, R: pubSecRevision(*v), V: *v, Emd: encMeta}, recipients, nil
+}
+
+// pubSecKey calculates the file encryption key from the seed and the recipient list (see 7.6.5.3).
+func pubSecKey(seed []byte, recipients [][]byte, e *Enc) []byte {
+
+	var b []byte
+	b = append(b, seed...)
+	for _, r := range recipients {
+		b = append(b, r...)
+	}
+	if !e.Emd {
+		b = append(b, 0xFF, 0xFF, 0xFF, 0xFF)
+	}
+
+	if e.V == 5 {
+		k := sha256.Sum256(b)
+		return k[:]
+	}
+
+	k := sha1.Sum(b)
+	return k[:e.L/8]
+}
+
+func setupPubSecEncryptionKey(ctx *Context, d Dict) (err error) {
+
+	var recipients [][]byte
+
+	ctx.E, recipients, err = supportedPubSecEncryption(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Certificate == nil || ctx.PrivateKey == nil {
+		return errors.New("pdfcpu: please provide certificate and private key for this file")
+	}
+
+	key, ok := ctx.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("pdfcpu: pubsec: RSA private key required")
+	}
+
+	for _, r := range recipients {
+
+		content, found, err := openEnvelope(r, ctx.Certificate, key)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+
+		if len(content) < 24 {
+			return errors.New("pdfcpu: pubsec: corrupt recipient seed")
+		}
+
+		ctx.E.P = int(int32(binary.BigEndian.Uint32(content[20:24])))
+		ctx.EncKey = pubSecKey(content[:20], recipients, ctx.E)
+
+		// Double check minimum permissions for pdfcpu processing.
+		if !hasNeededPermissions(ctx.Cmd, ctx.E) {
+			return errors.New("pdfcpu: insufficient access permissions")
+		}
+
+		return nil
+	}
+
+	return errors.New("pdfcpu: this file is not encrypted for the supplied certificate")
+}
+
+// newPubSecEncryptDict creates a new encrypt dict for the public-key security handler and the corresponding file encryption key.
+// Recipients sharing the same permissions share a CMS object.
+func newPubSecEncryptDict(ctx *Context) (Dict, error) {
+
+	needAES := ctx.EncryptUsingAES
+	keyLength := ctx.EncryptKeyLength
+
+	if !needAES && (ctx.UnencryptedMetadata || ctx.EncryptEmbeddedFilesOnly) {
+		return nil, errors.New("pdfcpu: pubsec: crypt filters need AES encryption")
+	}
+
+	seed := make([]byte, 20)
+	if _, err := io.ReadFull(rand.Reader, seed); err != nil {
+		return nil, err
+	}
+
+	// Group recipients by permissions, preserving order.
+	perms := []int16{}
+	certs := map[int16][]*x509.Certificate{}
+	for _, r := range ctx.Recipients {
+		if r.Certificate == nil {
+			return nil, errors.New("pdfcpu: pubsec: recipient certificate missing")
+		}
+		if certs[r.Permissions] == nil {
+			perms = append(perms, r.Permissions)
+		}
+		certs[r.Permissions] = append(certs[r.Permissions], r.Certificate)
+	}
+
+	recipients := [][]byte{}
+	a := Array{}
+
+	for _, p := range perms {
+		content := make([]byte, 24)
+		copy(content, seed)
+		binary.BigEndian.PutUint32(content[20:], uint32(int32(p)))
+		b, err := sealEnvelope(content, certs[p])
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, b)
+		a = append(a, NewHexLiteral(b))
+	}
+
+	d := NewDict()
+	d.Insert("Filter", Name("Adobe.PubSec"))
+
+	v := 2
+	if needAES {
+		v = 4
+		if keyLength == 256 {
+			v = 5
+		}
+	} else if keyLength == 40 {
+		v = 1
+	}
+
+	ctx.E = &Enc{L: keyLength, P: int(ctx.Recipients[0].Permissions), R: pubSecRevision(v), V: v, Emd: !ctx.UnencryptedMetadata}
+
+	d.Insert("V", Integer(v))
+	d.Insert("Length", Integer(keyLength))
+
+	if !needAES {
+		d.Insert("SubFilter", Name("adbe.pkcs7.s4"))
+		d.Insert("Recipients", a)
+	} else {
+		d.Insert("SubFilter", Name("adbe.pkcs7.s5"))
+
+		n := "AESV2"
+		if v == 5 {
+			n = "AESV3"
+		}
+
+		d1 := NewDict()
+		d1.Insert("CFM", Name(n))
+		d1.Insert("AuthEvent", Name("DocOpen"))
+		d1.Insert("Length", Integer(keyLength/8))
+		d1.Insert("Recipients", a)
+		d1.Insert("EncryptMetadata", Boolean(ctx.E.Emd))
+
+		d2 := NewDict()
+		d2.Insert("DefaultCryptFilter", d1)
+
+		d.Insert("CF", d2)
+
+		if ctx.EncryptEmbeddedFilesOnly {
+			d.Insert("StmF", Name("Identity"))
+			d.Insert("StrF", Name("Identity"))
+			d.Insert("EFF", Name("DefaultCryptFilter"))
+		} else {
+			d.Insert("StmF", Name("DefaultCryptFilter"))
+			d.Insert("StrF", Name("DefaultCryptFilter"))
+		}
+	}
+
+	if _, err := checkV(ctx, d); err != nil {
+		return nil, err
+	}
+	ctx.EncKey = pubSecKey(seed, recipients, ctx.E)
+
+	return d, nil
+}
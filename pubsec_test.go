@@ -0,0 +1,168 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate for cn and its private key.
+func testCertificate(t *testing.T, cn string, serial int64) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func TestEnvelope(t *testing.T) {
+
+	alice, aliceKey := testCertificate(t, "alice", 1)
+	bob, bobKey := testCertificate(t, "bob", 2)
+
+	content := []byte("0123456789abcdefghij\xff\xff\xf0\xc0")
+
+	b, err := sealEnvelope(content, []*x509.Certificate{alice})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, found, err := openEnvelope(b, alice, aliceKey)
+	if err != nil || !found {
+		t.Fatalf("open: found=%t err=%v", found, err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("got %x, want %x", got, content)
+	}
+
+	if _, found, err = openEnvelope(b, bob, bobKey); err != nil || found {
+		t.Errorf("wrong recipient: found=%t err=%v", found, err)
+	}
+}
+
+func TestPubSecEncryptionKey(t *testing.T) {
+
+	alice, aliceKey := testCertificate(t, "alice", 1)
+	bob, bobKey := testCertificate(t, "bob", 2)
+
+	for _, tt := range []struct {
+		aes       bool
+		keyLength int
+	}{
+		{false, 40},
+		{false, 128},
+		{true, 128},
+		{true, 256},
+	} {
+		ctx := readMinimalPDF(t)
+		ctx.EncryptUsingAES = tt.aes
+		ctx.EncryptKeyLength = tt.keyLength
+		ctx.Recipients = []Recipient{{Certificate: alice, Permissions: -3904}}
+
+		d, err := newPubSecEncryptDict(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A recipient recovers the file encryption key from the encrypt dict.
+		ctx1 := readMinimalPDF(t)
+		ctx1.Certificate, ctx1.PrivateKey = alice, aliceKey
+		if err = setupPubSecEncryptionKey(ctx1, d); err != nil {
+			t.Fatalf("aes=%t %d: %v", tt.aes, tt.keyLength, err)
+		}
+		if !bytes.Equal(ctx1.EncKey, ctx.EncKey) || ctx1.E.P != -3904 || ctx1.E.V != ctx.E.V {
+			t.Errorf("aes=%t %d: got key %x P %d V %d, want %x %d %d", tt.aes, tt.keyLength, ctx1.EncKey, ctx1.E.P, ctx1.E.V, ctx.EncKey, -3904, ctx.E.V)
+		}
+
+		ctx1 = readMinimalPDF(t)
+		ctx1.Certificate, ctx1.PrivateKey = bob, bobKey
+		err = setupPubSecEncryptionKey(ctx1, d)
+		if err == nil || !strings.Contains(err.Error(), "not encrypted for the supplied certificate") {
+			t.Errorf("aes=%t %d: got %v, want error for wrong recipient", tt.aes, tt.keyLength, err)
+		}
+	}
+}
+
+func TestPubSecRoundTrip(t *testing.T) {
+
+	alice, aliceKey := testCertificate(t, "alice", 1)
+	bob, bobKey := testCertificate(t, "bob", 2)
+
+	_, in := process(t, Command{Mode: ADDKEYWORDS, Keywords: []string{"alpha"}}, minimalPDF())
+
+	for _, tt := range []struct {
+		aes       bool
+		keyLength int
+	}{
+		{false, 40},
+		{false, 128},
+		{true, 128},
+		{true, 256},
+	} {
+		conf := NewDefaultConfiguration()
+		conf.EncryptUsingAES = tt.aes
+		conf.EncryptKeyLength = tt.keyLength
+		conf.Recipients = []Recipient{{Certificate: alice, Permissions: -3904}}
+
+		_, enc := process(t, Command{Mode: ENCRYPT, Conf: conf}, in)
+
+		conf = NewDefaultConfiguration()
+		conf.Certificate, conf.PrivateKey = alice, aliceKey
+
+		ss, _ := process(t, Command{Mode: LISTKEYWORDS, Conf: conf}, enc)
+		if len(ss) != 1 || ss[0] != "alpha" {
+			t.Errorf("aes=%t %d: got %v, want [alpha]", tt.aes, tt.keyLength, ss)
+		}
+
+		conf = NewDefaultConfiguration()
+		conf.Certificate, conf.PrivateKey = bob, bobKey
+
+		_, err := Process(Command{Mode: LISTKEYWORDS, In: bytes.NewReader(enc), Conf: conf})
+		if err == nil || !strings.Contains(err.Error(), "not encrypted for the supplied certificate") {
+			t.Errorf("aes=%t %d: got %v, want error for wrong recipient", tt.aes, tt.keyLength, err)
+		}
+	}
+}
@@ -22,11 +22,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/zean00/pdfcpulite/filter"
+	"github.com/zean00/pdfcpulite/log"
 )
 
 const (
@@ -34,15 +36,14 @@ const (
 	//unknownDelimiter = byte(0)
 )
 
-/*
 // ReadFile reads in a PDF file and builds an internal structure holding its cross reference table aka the Context.
 func ReadFile(inFile string, conf *Configuration) (*Context, error) {
 
-	fmt.Printf("reading %s..\n", inFile)
+	log.Read.Infof("reading %s..", inFile)
 
 	f, err := os.Open(inFile)
 	if err != nil {
-		return nil, fmt.Errorf(err.Error()+"can't open %q", inFile)
+		return nil, fmt.Errorf("pdfcpu: can't open %q: %v", inFile, err)
 	}
 
 	defer func() {
@@ -51,12 +52,12 @@ func ReadFile(inFile string, conf *Configuration) (*Context, error) {
 
 	return Read(f, conf)
 }
-*/
+
 // Read takes a readSeeker and generates a Context,
 // an in-memory representation containing a cross reference table.
 func Read(rs io.ReadSeeker, conf *Configuration) (*Context, error) {
 
-	fmt.Println("Read: begin")
+	log.Read.Tracef("Read: begin")
 
 	ctx, err := NewContext(rs, conf)
 	if err != nil {
@@ -64,9 +65,9 @@ func Read(rs io.ReadSeeker, conf *Configuration) (*Context, error) {
 	}
 
 	if ctx.Reader15 {
-		fmt.Println("PDF Version 1.5 conforming reader")
+		log.Read.Debugf("PDF Version 1.5 conforming reader")
 	} else {
-		fmt.Println("PDF Version 1.4 conforming reader - no object streams or xrefstreams allowed")
+		log.Read.Debugf("PDF Version 1.4 conforming reader - no object streams or xrefstreams allowed")
 	}
 
 	// Populate xRefTable.
@@ -82,7 +83,7 @@ func Read(rs io.ReadSeeker, conf *Configuration) (*Context, error) {
 		return nil, err
 	}
 
-	fmt.Println("Read: end")
+	log.Read.Tracef("Read: end")
 
 	return ctx, nil
 }
@@ -140,7 +141,7 @@ func newPositionedReader(rs io.ReadSeeker, offset *int64) (*bufio.Reader, error)
 		return nil, err
 	}
 
-	fmt.Printf("newPositionedReader: positioned to offset: %d\n", *offset)
+	log.Read.Tracef("newPositionedReader: positioned to offset: %d\n", *offset)
 
 	return bufio.NewReader(rs), nil
 }
@@ -157,19 +158,31 @@ func offsetLastXRefSection(ctx *Context) (*int64, error) {
 		offset           int64
 	)
 
+	fileSize, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
 	for i := 1; offset == 0; i++ {
 
-		off, err := rs.Seek(-int64(i)*bufSize, io.SeekEnd)
-		if err != nil {
+		// The first buffer read may be shorter for files smaller than bufSize.
+		off, n := fileSize-int64(i)*bufSize, bufSize
+		if off < 0 {
+			off, n = 0, n+off
+		}
+		if n <= 0 {
 			return nil, errors.New("pdfcpu: can't find last xref section")
 		}
 
-		fmt.Printf("scanning for offsetLastXRefSection starting at %d\n", off)
+		if _, err = rs.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
 
-		curBuf := make([]byte, bufSize)
+		ctx.Log(log.Read).Tracef("scanning for offsetLastXRefSection starting at %d\n", off)
 
-		_, err = rs.Read(curBuf)
-		if err != nil {
+		curBuf := make([]byte, n)
+
+		if _, err = io.ReadFull(rs, curBuf); err != nil {
 			return nil, err
 		}
 
@@ -198,7 +211,7 @@ func offsetLastXRefSection(ctx *Context) (*int64, error) {
 
 	}
 
-	fmt.Printf("Offset last xrefsection: %d\n", offset)
+	ctx.Log(log.Read).Tracef("Offset last xrefsection: %d\n", offset)
 
 	return &offset, nil
 }
@@ -206,7 +219,7 @@ func offsetLastXRefSection(ctx *Context) (*int64, error) {
 // Read next subsection entry and generate corresponding xref table entry.
 func parseXRefTableEntry(s *bufio.Scanner, xRefTable *XRefTable, objectNumber int) error {
 
-	fmt.Println("parseXRefTableEntry: begin")
+	log.Read.Tracef("parseXRefTableEntry: begin")
 
 	line, err := scanLine(s)
 	if err != nil {
@@ -214,7 +227,7 @@ func parseXRefTableEntry(s *bufio.Scanner, xRefTable *XRefTable, objectNumber in
 	}
 
 	if xRefTable.Exists(objectNumber) {
-		fmt.Printf("parseXRefTableEntry: end - Skip entry %d - already assigned\n", objectNumber)
+		log.Read.Tracef("parseXRefTableEntry: end - Skip entry %d - already assigned\n", objectNumber)
 		return nil
 	}
 
@@ -245,10 +258,10 @@ func parseXRefTableEntry(s *bufio.Scanner, xRefTable *XRefTable, objectNumber in
 
 		// in use object
 
-		fmt.Printf("parseXRefTableEntry: Object #%d is in use at offset=%d, generation=%d\n", objectNumber, offset, generation)
+		log.Read.Tracef("parseXRefTableEntry: Object #%d is in use at offset=%d, generation=%d\n", objectNumber, offset, generation)
 
 		if offset == 0 {
-			fmt.Printf("parseXRefTableEntry: Skip entry for in use object #%d with offset 0\n", objectNumber)
+			log.Read.Debugf("parseXRefTableEntry: Skip entry for in use object #%d with offset 0\n", objectNumber)
 			return nil
 		}
 
@@ -262,7 +275,7 @@ func parseXRefTableEntry(s *bufio.Scanner, xRefTable *XRefTable, objectNumber in
 
 		// free object
 
-		fmt.Printf("parseXRefTableEntry: Object #%d is unused, next free is object#%d, generation=%d\n", objectNumber, offset, generation)
+		log.Read.Tracef("parseXRefTableEntry: Object #%d is unused, next free is object#%d, generation=%d\n", objectNumber, offset, generation)
 
 		xRefTableEntry =
 			XRefTableEntry{
@@ -272,11 +285,11 @@ func parseXRefTableEntry(s *bufio.Scanner, xRefTable *XRefTable, objectNumber in
 
 	}
 
-	fmt.Printf("parseXRefTableEntry: Insert new xreftable entry for Object %d\n", objectNumber)
+	log.Read.Tracef("parseXRefTableEntry: Insert new xreftable entry for Object %d\n", objectNumber)
 
 	xRefTable.Table[objectNumber] = &xRefTableEntry
 
-	fmt.Println("parseXRefTableEntry: end")
+	log.Read.Tracef("parseXRefTableEntry: end")
 
 	return nil
 }
@@ -284,7 +297,7 @@ func parseXRefTableEntry(s *bufio.Scanner, xRefTable *XRefTable, objectNumber in
 // Process xRef table subsection and create corrresponding xRef table entries.
 func parseXRefTableSubSection(s *bufio.Scanner, xRefTable *XRefTable, fields []string) error {
 
-	fmt.Println("parseXRefTableSubSection: begin")
+	log.Read.Tracef("parseXRefTableSubSection: begin")
 
 	startObjNumber, err := strconv.Atoi(fields[0])
 	if err != nil {
@@ -296,7 +309,7 @@ func parseXRefTableSubSection(s *bufio.Scanner, xRefTable *XRefTable, fields []s
 		return err
 	}
 
-	fmt.Printf("detected xref subsection, startObj=%d length=%d\n", startObjNumber, objCount)
+	log.Read.Tracef("detected xref subsection, startObj=%d length=%d\n", startObjNumber, objCount)
 
 	// Process all entries of this subsection into xRefTable entries.
 	for i := 0; i < objCount; i++ {
@@ -305,7 +318,7 @@ func parseXRefTableSubSection(s *bufio.Scanner, xRefTable *XRefTable, fields []s
 		}
 	}
 
-	fmt.Println("parseXRefTableSubSection: end")
+	log.Read.Tracef("parseXRefTableSubSection: end")
 
 	return nil
 }
@@ -313,7 +326,7 @@ func parseXRefTableSubSection(s *bufio.Scanner, xRefTable *XRefTable, fields []s
 // Parse compressed object.
 func compressedObject(s string) (Object, error) {
 
-	fmt.Println("compressedObject: begin")
+	log.Read.Tracef("compressedObject: begin")
 
 	o, err := parseObject(&s)
 	if err != nil {
@@ -323,14 +336,14 @@ func compressedObject(s string) (Object, error) {
 	d, ok := o.(Dict)
 	if !ok {
 		// return trivial Object: Integer, Array, etc.
-		fmt.Println("compressedObject: end, any other than dict")
+		log.Read.Tracef("compressedObject: end, any other than dict")
 		return o, nil
 	}
 
 	streamLength, streamLengthRef := d.Length()
 	if streamLength == nil && streamLengthRef == nil {
 		// return Dict
-		fmt.Println("compressedObject: end, dict")
+		log.Read.Tracef("compressedObject: end, dict")
 		return d, nil
 	}
 
@@ -340,7 +353,7 @@ func compressedObject(s string) (Object, error) {
 // Parse all objects of an object stream and save them into objectStreamDict.ObjArray.
 func parseObjectStream(osd *ObjectStreamDict) error {
 
-	fmt.Printf("parseObjectStream begin: decoding %d objects.\n", osd.ObjCount)
+	log.Read.Tracef("parseObjectStream begin: decoding %d objects.\n", osd.ObjCount)
 
 	decodedContent := osd.Content
 	prolog := decodedContent[:osd.FirstObjOffset]
@@ -367,25 +380,25 @@ func parseObjectStream(osd *ObjectStreamDict) error {
 
 		if i > 0 {
 			dstr := string(decodedContent[offsetOld:offset])
-			fmt.Printf("parseObjectStream: objString = %s\n", dstr)
+			log.Read.Tracef("parseObjectStream: objString = %s\n", dstr)
 			o, err := compressedObject(dstr)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("parseObjectStream: [%d] = obj %s:\n%s\n", i/2-1, objs[i-2], o)
+			log.Read.Tracef("parseObjectStream: [%d] = obj %s:\n%s\n", i/2-1, objs[i-2], o)
 			objArray = append(objArray, o)
 		}
 
 		if i == len(objs)-2 {
 			dstr := string(decodedContent[offset:])
-			fmt.Printf("parseObjectStream: objString = %s\n", dstr)
+			log.Read.Tracef("parseObjectStream: objString = %s\n", dstr)
 			o, err := compressedObject(dstr)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("parseObjectStream: [%d] = obj %s:\n%s\n", i/2, objs[i], o)
+			log.Read.Tracef("parseObjectStream: [%d] = obj %s:\n%s\n", i/2, objs[i], o)
 			objArray = append(objArray, o)
 		}
 
@@ -394,7 +407,7 @@ func parseObjectStream(osd *ObjectStreamDict) error {
 
 	osd.ObjArray = objArray
 
-	fmt.Println("parseObjectStream end")
+	log.Read.Tracef("parseObjectStream end")
 
 	return nil
 }
@@ -402,7 +415,7 @@ func parseObjectStream(osd *ObjectStreamDict) error {
 // For each object embedded in this xRefStream create the corresponding xRef table entry.
 func extractXRefTableEntriesFromXRefStream(buf []byte, xsd *XRefStreamDict, ctx *Context) error {
 
-	fmt.Printf("extractXRefTableEntriesFromXRefStream begin")
+	ctx.Log(log.Read).Tracef("extractXRefTableEntriesFromXRefStream begin")
 
 	// Note:
 	// A value of zero for an element in the W array indicates that the corresponding field shall not be present in the stream,
@@ -414,16 +427,16 @@ func extractXRefTableEntriesFromXRefStream(buf []byte, xsd *XRefStreamDict, ctx
 	i3 := xsd.W[2]
 
 	xrefEntryLen := i1 + i2 + i3
-	fmt.Printf("extractXRefTableEntriesFromXRefStream: begin xrefEntryLen = %d\n", xrefEntryLen)
+	ctx.Log(log.Read).Tracef("extractXRefTableEntriesFromXRefStream: begin xrefEntryLen = %d\n", xrefEntryLen)
 
 	if len(buf)%xrefEntryLen > 0 {
 		return errors.New("pdfcpu: extractXRefTableEntriesFromXRefStream: corrupt xrefstream")
 	}
 
 	objCount := len(xsd.Objects)
-	fmt.Printf("extractXRefTableEntriesFromXRefStream: objCount:%d %v\n", objCount, xsd.Objects)
+	ctx.Log(log.Read).Tracef("extractXRefTableEntriesFromXRefStream: objCount:%d %v\n", objCount, xsd.Objects)
 
-	fmt.Printf("extractXRefTableEntriesFromXRefStream: len(buf):%d objCount*xrefEntryLen:%d\n", len(buf), objCount*xrefEntryLen)
+	ctx.Log(log.Read).Tracef("extractXRefTableEntriesFromXRefStream: len(buf):%d objCount*xrefEntryLen:%d\n", len(buf), objCount*xrefEntryLen)
 	if len(buf) < objCount*xrefEntryLen {
 		// Sometimes there is an additional xref entry not accounted for by "Index".
 		// We ignore such a entries and do not treat this as an error.
@@ -457,7 +470,7 @@ func extractXRefTableEntriesFromXRefStream(buf []byte, xsd *XRefStreamDict, ctx
 
 		case 0x00:
 			// free object
-			fmt.Printf("extractXRefTableEntriesFromXRefStream: Object #%d is unused, next free is object#%d, generation=%d\n", objectNumber, c2, c3)
+			ctx.Log(log.Read).Tracef("extractXRefTableEntriesFromXRefStream: Object #%d is unused, next free is object#%d, generation=%d\n", objectNumber, c2, c3)
 			g := int(c3)
 
 			xRefTableEntry =
@@ -469,7 +482,7 @@ func extractXRefTableEntriesFromXRefStream(buf []byte, xsd *XRefStreamDict, ctx
 
 		case 0x01:
 			// in use object
-			fmt.Printf("extractXRefTableEntriesFromXRefStream: Object #%d is in use at offset=%d, generation=%d\n", objectNumber, c2, c3)
+			ctx.Log(log.Read).Tracef("extractXRefTableEntriesFromXRefStream: Object #%d is in use at offset=%d, generation=%d\n", objectNumber, c2, c3)
 			g := int(c3)
 
 			xRefTableEntry =
@@ -482,7 +495,7 @@ func extractXRefTableEntriesFromXRefStream(buf []byte, xsd *XRefStreamDict, ctx
 		case 0x02:
 			// compressed object
 			// generation always 0.
-			fmt.Printf("extractXRefTableEntriesFromXRefStream: Object #%d is compressed at obj %5d[%d]\n", objectNumber, c2, c3)
+			ctx.Log(log.Read).Tracef("extractXRefTableEntriesFromXRefStream: Object #%d is compressed at obj %5d[%d]\n", objectNumber, c2, c3)
 			objNumberRef := int(c2)
 			objIndex := int(c3)
 
@@ -498,7 +511,7 @@ func extractXRefTableEntriesFromXRefStream(buf []byte, xsd *XRefStreamDict, ctx
 		}
 
 		if ctx.XRefTable.Exists(objectNumber) {
-			fmt.Printf("extractXRefTableEntriesFromXRefStream: Skip entry %d - already assigned\n", objectNumber)
+			ctx.Log(log.Read).Tracef("extractXRefTableEntriesFromXRefStream: Skip entry %d - already assigned\n", objectNumber)
 		} else {
 			ctx.Table[objectNumber] = &xRefTableEntry
 		}
@@ -506,7 +519,7 @@ func extractXRefTableEntriesFromXRefStream(buf []byte, xsd *XRefStreamDict, ctx
 		j++
 	}
 
-	fmt.Println("extractXRefTableEntriesFromXRefStream: end")
+	ctx.Log(log.Read).Tracef("extractXRefTableEntriesFromXRefStream: end")
 
 	return nil
 }
@@ -531,7 +544,7 @@ func xRefStreamDict(ctx *Context, o Object, objNr int, streamOffset int64) (*XRe
 	}
 
 	// We have a stream object.
-	fmt.Printf("xRefStreamDict: streamobject #%d\n", objNr)
+	ctx.Log(log.Read).Tracef("xRefStreamDict: streamobject #%d\n", objNr)
 	sd := NewStreamDict(d, streamOffset, streamLength, streamLengthObjNr, filterPipeline)
 
 	if _, err = loadEncodedStreamContent(ctx, &sd); err != nil {
@@ -549,14 +562,14 @@ func xRefStreamDict(ctx *Context, o Object, objNr int, streamOffset int64) (*XRe
 // Parse xRef stream and setup xrefTable entries for all embedded objects and the xref stream dict.
 func parseXRefStream(rd io.Reader, offset *int64, ctx *Context) (prevOffset *int64, err error) {
 
-	fmt.Printf("parseXRefStream: begin at offset %d\n", *offset)
+	ctx.Log(log.Read).Tracef("parseXRefStream: begin at offset %d\n", *offset)
 
 	buf, endInd, streamInd, streamOffset, err := buffer(rd)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Printf("parseXRefStream: endInd=%[1]d(%[1]x) streamInd=%[2]d(%[2]x)\n", endInd, streamInd)
+	ctx.Log(log.Read).Tracef("parseXRefStream: endInd=%[1]d(%[1]x) streamInd=%[2]d(%[2]x)\n", endInd, streamInd)
 
 	line := string(buf)
 
@@ -575,14 +588,14 @@ func parseXRefStream(rd io.Reader, offset *int64, ctx *Context) (prevOffset *int
 	}
 
 	// parse this object
-	fmt.Printf("parseXRefStream: xrefstm obj#:%d gen:%d\n", *objectNumber, *generationNumber)
-	fmt.Printf("parseXRefStream: dereferencing object %d\n", *objectNumber)
+	ctx.Log(log.Read).Tracef("parseXRefStream: xrefstm obj#:%d gen:%d\n", *objectNumber, *generationNumber)
+	ctx.Log(log.Read).Tracef("parseXRefStream: dereferencing object %d\n", *objectNumber)
 	o, err := parseObject(&l)
 	if err != nil {
 		return nil, fmt.Errorf(err.Error() + "parseXRefStream: no object")
 	}
 
-	fmt.Printf("parseXRefStream: we have an object: %s\n", o)
+	ctx.Log(log.Read).Tracef("parseXRefStream: we have an object: %s\n", o)
 
 	streamOffset += *offset
 	sd, err := xRefStreamDict(ctx, o, *objectNumber, streamOffset)
@@ -610,13 +623,13 @@ func parseXRefStream(rd io.Reader, offset *int64, ctx *Context) (prevOffset *int
 			Generation: generationNumber,
 			Object:     *sd}
 
-	fmt.Printf("parseXRefStream: Insert new xRefTable entry for Object %d\n", *objectNumber)
+	ctx.Log(log.Read).Tracef("parseXRefStream: Insert new xRefTable entry for Object %d\n", *objectNumber)
 
 	ctx.Table[*objectNumber] = &entry
 	ctx.Read.XRefStreams[*objectNumber] = true
 	prevOffset = sd.PreviousOffset
 
-	fmt.Println("parseXRefStream: end")
+	ctx.Log(log.Read).Tracef("parseXRefStream: end")
 
 	return prevOffset, nil
 }
@@ -624,7 +637,7 @@ func parseXRefStream(rd io.Reader, offset *int64, ctx *Context) (prevOffset *int
 // Parse an xRefStream for a hybrid PDF file.
 func parseHybridXRefStream(offset *int64, ctx *Context) error {
 
-	fmt.Println("parseHybridXRefStream: begin")
+	ctx.Log(log.Read).Tracef("parseHybridXRefStream: begin")
 
 	rd, err := newPositionedReader(ctx.Read.rs, offset)
 	if err != nil {
@@ -636,7 +649,7 @@ func parseHybridXRefStream(offset *int64, ctx *Context) error {
 		return err
 	}
 
-	fmt.Println("parseHybridXRefStream: end")
+	ctx.Log(log.Read).Tracef("parseHybridXRefStream: end")
 
 	return nil
 }
@@ -644,13 +657,13 @@ func parseHybridXRefStream(offset *int64, ctx *Context) error {
 // Parse trailer dict and return any offset of a previous xref section.
 func parseTrailerInfo(d Dict, xRefTable *XRefTable) error {
 
-	fmt.Println("parseTrailerInfo begin")
+	log.Read.Tracef("parseTrailerInfo begin")
 
 	if _, found := d.Find("Encrypt"); found {
 		encryptObjRef := d.IndirectRefEntry("Encrypt")
 		if encryptObjRef != nil {
 			xRefTable.Encrypt = encryptObjRef
-			fmt.Printf("parseTrailerInfo: Encrypt object: %s\n", *xRefTable.Encrypt)
+			log.Read.Tracef("parseTrailerInfo: Encrypt object: %s\n", *xRefTable.Encrypt)
 		}
 	}
 
@@ -668,14 +681,14 @@ func parseTrailerInfo(d Dict, xRefTable *XRefTable) error {
 			return errors.New("pdfcpu: parseTrailerInfo: missing entry \"Root\"")
 		}
 		xRefTable.Root = rootObjRef
-		fmt.Printf("parseTrailerInfo: Root object: %s\n", *xRefTable.Root)
+		log.Read.Tracef("parseTrailerInfo: Root object: %s\n", *xRefTable.Root)
 	}
 
 	if xRefTable.Info == nil {
 		infoObjRef := d.IndirectRefEntry("Info")
 		if infoObjRef != nil {
 			xRefTable.Info = infoObjRef
-			fmt.Printf("parseTrailerInfo: Info object: %s\n", *xRefTable.Info)
+			log.Read.Tracef("parseTrailerInfo: Info object: %s\n", *xRefTable.Info)
 		}
 	}
 
@@ -683,20 +696,20 @@ func parseTrailerInfo(d Dict, xRefTable *XRefTable) error {
 		idArray := d.ArrayEntry("ID")
 		if idArray != nil {
 			xRefTable.ID = idArray
-			fmt.Printf("parseTrailerInfo: ID object: %s\n", xRefTable.ID)
+			log.Read.Tracef("parseTrailerInfo: ID object: %s\n", xRefTable.ID)
 		} else if xRefTable.Encrypt != nil {
 			return errors.New("pdfcpu: parseTrailerInfo: missing entry \"ID\"")
 		}
 	}
 
-	fmt.Println("parseTrailerInfo end")
+	log.Read.Tracef("parseTrailerInfo end")
 
 	return nil
 }
 
 func parseTrailerDict(trailerDict Dict, ctx *Context) (*int64, error) {
 
-	fmt.Println("parseTrailerDict begin")
+	ctx.Log(log.Read).Tracef("parseTrailerDict begin")
 
 	xRefTable := ctx.XRefTable
 
@@ -706,7 +719,7 @@ func parseTrailerDict(trailerDict Dict, ctx *Context) (*int64, error) {
 	}
 
 	if arr := trailerDict.ArrayEntry("AdditionalStreams"); arr != nil {
-		fmt.Printf("parseTrailerInfo: found AdditionalStreams: %s\n", arr)
+		ctx.Log(log.Read).Tracef("parseTrailerInfo: found AdditionalStreams: %s\n", arr)
 		a := Array{}
 		for _, value := range arr {
 			if indRef, ok := value.(IndirectRef); ok {
@@ -718,7 +731,7 @@ func parseTrailerDict(trailerDict Dict, ctx *Context) (*int64, error) {
 
 	offset := trailerDict.Prev()
 	if offset != nil {
-		fmt.Printf("parseTrailerDict: previous xref table section offset:%d\n", *offset)
+		ctx.Log(log.Read).Tracef("parseTrailerDict: previous xref table section offset:%d\n", *offset)
 	}
 
 	offsetXRefStream := trailerDict.Int64Entry("XRefStm")
@@ -727,7 +740,7 @@ func parseTrailerDict(trailerDict Dict, ctx *Context) (*int64, error) {
 		if !ctx.Reader15 && xRefTable.Version() >= V14 && !ctx.Read.Hybrid {
 			return nil, fmt.Errorf("parseTrailerDict: PDF1.4 conformant reader: found incompatible version: %s", xRefTable.VersionString())
 		}
-		fmt.Println("parseTrailerDict end")
+		ctx.Log(log.Read).Tracef("parseTrailerDict end")
 		// continue to parse previous xref section, if there is any.
 		return offset, nil
 	}
@@ -749,7 +762,7 @@ func parseTrailerDict(trailerDict Dict, ctx *Context) (*int64, error) {
 		}
 	}
 
-	fmt.Println("parseTrailerDict end")
+	ctx.Log(log.Read).Tracef("parseTrailerDict end")
 
 	return offset, nil
 }
@@ -799,7 +812,7 @@ func scanTrailer(s *bufio.Scanner, line string) (string, error) {
 	var err error
 	var i, j, k int
 
-	fmt.Printf("line: <%s>\n", line)
+	log.Read.Tracef("line: <%s>\n", line)
 
 	// Scan for dict start tag "<<".
 	for {
@@ -808,7 +821,7 @@ func scanTrailer(s *bufio.Scanner, line string) (string, error) {
 			break
 		}
 		line, err = scanLine(s)
-		fmt.Printf("line: <%s>\n", line)
+		log.Read.Tracef("line: <%s>\n", line)
 		if err != nil {
 			return "", err
 		}
@@ -817,7 +830,7 @@ func scanTrailer(s *bufio.Scanner, line string) (string, error) {
 	line = line[i:]
 	buf.WriteString(line)
 	buf.WriteString(" ")
-	fmt.Printf("scanTrailer dictBuf after start tag: <%s>\n", line)
+	log.Read.Tracef("scanTrailer dictBuf after start tag: <%s>\n", line)
 
 	// Scan for dict end tag ">>" but account for inner dicts.
 	line = line[2:]
@@ -831,7 +844,7 @@ func scanTrailer(s *bufio.Scanner, line string) (string, error) {
 			}
 			buf.WriteString(line)
 			buf.WriteString(" ")
-			fmt.Printf("scanTrailer dictBuf next line: <%s>\n", line)
+			log.Read.Tracef("scanTrailer dictBuf next line: <%s>\n", line)
 		}
 
 		i = strings.Index(line, "<<")
@@ -859,7 +872,7 @@ func scanTrailer(s *bufio.Scanner, line string) (string, error) {
 			}
 			buf.WriteString(line)
 			buf.WriteString(" ")
-			fmt.Printf("scanTrailer dictBuf next line: <%s>\n", line)
+			log.Read.Tracef("scanTrailer dictBuf next line: <%s>\n", line)
 		} else {
 			// Yes <<
 			j = strings.Index(line, ">>")
@@ -897,9 +910,9 @@ func processTrailer(ctx *Context, s *bufio.Scanner, line string) (*int64, error)
 
 	if line != "trailer" {
 		trailerString = line[7:]
-		fmt.Printf("processTrailer: trailer leftover: <%s>\n", trailerString)
+		ctx.Log(log.Read).Tracef("processTrailer: trailer leftover: <%s>\n", trailerString)
 	} else {
-		fmt.Printf("line (len %d) <%s>\n", len(line), line)
+		ctx.Log(log.Read).Tracef("line (len %d) <%s>\n", len(line), line)
 	}
 
 	trailerString, err := scanTrailer(s, trailerString)
@@ -907,7 +920,7 @@ func processTrailer(ctx *Context, s *bufio.Scanner, line string) (*int64, error)
 		return nil, err
 	}
 
-	fmt.Printf("processTrailer: trailerString: (len:%d) <%s>\n", len(trailerString), trailerString)
+	ctx.Log(log.Read).Tracef("processTrailer: trailerString: (len:%d) <%s>\n", len(trailerString), trailerString)
 
 	o, err := parseObject(&trailerString)
 	if err != nil {
@@ -919,7 +932,7 @@ func processTrailer(ctx *Context, s *bufio.Scanner, line string) (*int64, error)
 		return nil, errors.New("pdfcpu: processTrailer: corrupt trailer dict")
 	}
 
-	fmt.Printf("processTrailer: trailerDict:\n%s\n", trailerDict)
+	ctx.Log(log.Read).Tracef("processTrailer: trailerDict:\n%s\n", trailerDict)
 
 	return parseTrailerDict(trailerDict, ctx)
 }
@@ -927,14 +940,14 @@ func processTrailer(ctx *Context, s *bufio.Scanner, line string) (*int64, error)
 // Parse xRef section into corresponding number of xRef table entries.
 func parseXRefSection(s *bufio.Scanner, ctx *Context) (*int64, error) {
 
-	fmt.Println("parseXRefSection begin")
+	ctx.Log(log.Read).Tracef("parseXRefSection begin")
 
 	line, err := scanLine(s)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Printf("parseXRefSection: <%s>\n", line)
+	ctx.Log(log.Read).Tracef("parseXRefSection: <%s>\n", line)
 
 	fields := strings.Fields(line)
 
@@ -960,13 +973,13 @@ func parseXRefSection(s *bufio.Scanner, ctx *Context) (*int64, error) {
 		fields = strings.Fields(line)
 	}
 
-	fmt.Println("parseXRefSection: All subsections read!")
+	ctx.Log(log.Read).Tracef("parseXRefSection: All subsections read!")
 
 	if !strings.HasPrefix(line, "trailer") {
 		return nil, fmt.Errorf("xrefsection: missing trailer dict, line = <%s>", line)
 	}
 
-	fmt.Println("parseXRefSection: parsing trailer dict..")
+	ctx.Log(log.Read).Tracef("parseXRefSection: parsing trailer dict..")
 
 	return processTrailer(ctx, s, line)
 }
@@ -980,7 +993,7 @@ func parseXRefSection(s *bufio.Scanner, ctx *Context) (*int64, error) {
 // eolCount is the number of characters used for eol (1 or 2).
 func headerVersion(rs io.ReadSeeker) (v *Version, eolCount int, err error) {
 
-	fmt.Println("headerVersion begin")
+	log.Read.Tracef("headerVersion begin")
 
 	var errCorruptHeader = errors.New("pdfcpu: headerVersion: corrupt pdf stream - no header version available")
 
@@ -1023,7 +1036,7 @@ func headerVersion(rs io.ReadSeeker) (v *Version, eolCount int, err error) {
 		return nil, 0, errCorruptHeader
 	}
 
-	fmt.Printf("headerVersion: end, found header version: %s\n", pdfVersion)
+	log.Read.Tracef("headerVersion: end, found header version: %s\n", pdfVersion)
 
 	return &pdfVersion, eolCount, nil
 }
@@ -1127,7 +1140,7 @@ func bypassXrefSection(ctx *Context) error {
 // Build XRefTable by reading XRef streams or XRef sections.
 func buildXRefTableStartingAt(ctx *Context, offset *int64) error {
 
-	fmt.Println("buildXRefTableStartingAt: begin")
+	ctx.Log(log.Read).Tracef("buildXRefTableStartingAt: begin")
 
 	rs := ctx.Read.rs
 
@@ -1154,30 +1167,30 @@ func buildXRefTableStartingAt(ctx *Context, offset *int64) error {
 			return err
 		}
 
-		fmt.Printf("line: <%s>\n", line)
+		ctx.Log(log.Read).Tracef("line: <%s>\n", line)
 
 		if strings.TrimSpace(line) == "xref" {
-			fmt.Println("buildXRefTableStartingAt: found xref section")
+			ctx.Log(log.Read).Tracef("buildXRefTableStartingAt: found xref section")
 			if offset, err = parseXRefSection(s, ctx); err != nil {
 				return err
 			}
 		} else {
 
-			fmt.Println("buildXRefTableStartingAt: found xref stream")
+			ctx.Log(log.Read).Tracef("buildXRefTableStartingAt: found xref stream")
 			ctx.Read.UsingXRefStreams = true
 			rd, err = newPositionedReader(rs, offset)
 			if err != nil {
 				return err
 			}
 			if offset, err = parseXRefStream(rd, offset, ctx); err != nil {
-				fmt.Printf("bypassXRefSection after %v\n", err)
+				ctx.Log(log.Read).Debugf("bypassXRefSection after %v", err)
 				// Try fix for corrupt single xref section.
 				return bypassXrefSection(ctx)
 			}
 		}
 	}
 
-	fmt.Println("buildXRefTableStartingAt: end")
+	ctx.Log(log.Read).Tracef("buildXRefTableStartingAt: end")
 
 	return nil
 }
@@ -1189,7 +1202,7 @@ func buildXRefTableStartingAt(ctx *Context, offset *int64) error {
 // and build up the xref table along the way.
 func readXRefTable(ctx *Context) (err error) {
 
-	fmt.Println("readXRefTable: begin")
+	ctx.Log(log.Read).Tracef("readXRefTable: begin")
 
 	offset, err := offsetLastXRefSection(ctx)
 	if err != nil {
@@ -1213,7 +1226,7 @@ func readXRefTable(ctx *Context) (err error) {
 		return
 	}
 
-	fmt.Println("readXRefTable: end")
+	ctx.Log(log.Read).Tracef("readXRefTable: end")
 
 	return
 }
@@ -1320,7 +1333,7 @@ func buffer(rd io.Reader) (buf []byte, endInd int, streamInd int, streamOffset i
 			lastStreamMarker(&streamInd, endInd, line)
 		}
 
-		fmt.Printf("buffer: endInd=%d streamInd=%d\n", endInd, streamInd)
+		log.Read.Tracef("buffer: endInd=%d streamInd=%d\n", endInd, streamInd)
 
 		if streamInd > 0 {
 
@@ -1373,7 +1386,32 @@ func keywordStreamRightAfterEndOfDict(buf string, streamInd int) bool {
 	return ok
 }
 
-func buildFilterPipeline(ctx *Context, filterArray, decodeParmsArr Array, decodeParms Object) ([]PDFFilter, error) {
+// decodeParmsDict returns the decode parameter dict represented by o.
+func decodeParmsDict(ctx *Context, o Object) (Dict, error) {
+
+	switch o := o.(type) {
+
+	case nil:
+		// null: the filter uses default parameters.
+		return nil, nil
+
+	case Dict:
+		return o, nil
+
+	case IndirectRef:
+		return dereferencedDict(ctx, o.ObjectNumber.Value())
+	}
+
+	return nil, fmt.Errorf("pdfcpu: corrupt decode parms: %s", o)
+}
+
+// buildFilterPipeline returns the filters of filterArray along with their decode parameters.
+// Entries of decodeParmsArr correspond to the entries of filterArray.
+func buildFilterPipeline(ctx *Context, filterArray, decodeParmsArr Array) ([]PDFFilter, error) {
+
+	if len(decodeParmsArr) > len(filterArray) {
+		return nil, errors.New("pdfcpu: buildFilterPipeline: decodeParms array exceeds filter array")
+	}
 
 	var filterPipeline []PDFFilter
 
@@ -1383,25 +1421,19 @@ func buildFilterPipeline(ctx *Context, filterArray, decodeParmsArr Array, decode
 		if !ok {
 			return nil, errors.New("pdfcpu: buildFilterPipeline: filterArray elements corrupt")
 		}
-		if decodeParms == nil || decodeParmsArr[i] == nil {
-			filterPipeline = append(filterPipeline, PDFFilter{Name: filterName.Value(), DecodeParms: nil})
-			continue
-		}
 
-		dict, ok := decodeParmsArr[i].(Dict)
-		if !ok {
-			indRef, ok := decodeParmsArr[i].(IndirectRef)
-			if !ok {
-				return nil, fmt.Errorf("buildFilterPipeline: corrupt Dict: %s\n", dict)
-			}
-			d, err := dereferencedDict(ctx, indRef.ObjectNumber.Value())
+		var dict Dict
+
+		// Missing trailing entries use default parameters.
+		if i < len(decodeParmsArr) {
+			d, err := decodeParmsDict(ctx, decodeParmsArr[i])
 			if err != nil {
 				return nil, err
 			}
 			dict = d
 		}
 
-		filterPipeline = append(filterPipeline, PDFFilter{Name: filterName.String(), DecodeParms: dict})
+		filterPipeline = append(filterPipeline, PDFFilter{Name: filterName.Value(), DecodeParms: dict})
 	}
 
 	return filterPipeline, nil
@@ -1410,7 +1442,7 @@ func buildFilterPipeline(ctx *Context, filterArray, decodeParmsArr Array, decode
 // Return the filter pipeline associated with this stream dict.
 func pdfFilterPipeline(ctx *Context, dict Dict) ([]PDFFilter, error) {
 
-	fmt.Println("pdfFilterPipeline: begin")
+	ctx.Log(log.Read).Tracef("pdfFilterPipeline: begin")
 
 	var err error
 
@@ -1442,24 +1474,17 @@ func pdfFilterPipeline(ctx *Context, dict Dict) ([]PDFFilter, error) {
 		o, found := dict.Find("DecodeParms")
 		if !found {
 			// w/o decode parameters.
-			fmt.Println("pdfFilterPipeline: end w/o decode parms")
+			ctx.Log(log.Read).Tracef("pdfFilterPipeline: end w/o decode parms")
 			return append(filterPipeline, PDFFilter{Name: filterName, DecodeParms: nil}), nil
 		}
 
-		d, ok := o.(Dict)
-		if !ok {
-			ir, ok := o.(IndirectRef)
-			if !ok {
-				return nil, fmt.Errorf("pdfFilterPipeline: corrupt Dict: %s\n", o)
-			}
-			d, err = dereferencedDict(ctx, ir.ObjectNumber.Value())
-			if err != nil {
-				return nil, err
-			}
+		d, err := decodeParmsDict(ctx, o)
+		if err != nil {
+			return nil, err
 		}
 
 		// with decode parameters.
-		fmt.Println("pdfFilterPipeline: end with decode parms")
+		ctx.Log(log.Read).Tracef("pdfFilterPipeline: end with decode parms")
 		return append(filterPipeline, PDFFilter{Name: filterName, DecodeParms: d}), nil
 	}
 
@@ -1473,19 +1498,30 @@ func pdfFilterPipeline(ctx *Context, dict Dict) ([]PDFFilter, error) {
 
 	// Optional array of decode parameter dicts.
 	var decodeParmsArr Array
-	decodeParms, found := dict.Find("DecodeParms")
-	if found {
-		decodeParmsArr, ok = decodeParms.(Array)
-		if !ok {
+	if o, found := dict.Find("DecodeParms"); found {
+		if indRef, ok := o.(IndirectRef); ok {
+			if o, err = dereferencedObject(ctx, indRef.ObjectNumber.Value()); err != nil {
+				return nil, err
+			}
+		}
+		switch o := o.(type) {
+		case nil:
+		case Array:
+			decodeParmsArr = o
+		case Dict:
+			// Tolerate a single parameter dict for a single filter.
+			if len(filterArray) != 1 {
+				return nil, errors.New("pdfcpu: pdfFilterPipeline: expected decodeParms array corrupt")
+			}
+			decodeParmsArr = Array{o}
+		default:
 			return nil, errors.New("pdfcpu: pdfFilterPipeline: expected decodeParms array corrupt")
 		}
 	}
 
-	//fmt.Printf("decodeParmsArr: %s\n", decodeParmsArr)
-
-	filterPipeline, err = buildFilterPipeline(ctx, filterArray, decodeParmsArr, decodeParms)
+	filterPipeline, err = buildFilterPipeline(ctx, filterArray, decodeParmsArr)
 
-	fmt.Println("pdfFilterPipeline: end")
+	ctx.Log(log.Read).Tracef("pdfFilterPipeline: end")
 
 	return filterPipeline, err
 }
@@ -1508,14 +1544,14 @@ func streamDictForObject(ctx *Context, d Dict, objNr, streamInd int, streamOffse
 	// We have a stream object.
 	sd = NewStreamDict(d, streamOffset, streamLength, streamLengthRef, filterPipeline)
 
-	fmt.Printf("streamDictForObject: end, Streamobject #%d\n", objNr)
+	ctx.Log(log.Read).Tracef("streamDictForObject: end, Streamobject #%d\n", objNr)
 
 	return sd, nil
 }
 
 func dict(ctx *Context, d1 Dict, objNr, genNr, endInd, streamInd int) (d2 Dict, err error) {
 
-	if ctx.EncKey != nil {
+	if ctx.encryptsStrings() {
 		_, err := decryptDeepObject(d1, objNr, genNr, ctx.EncKey, ctx.AES4Strings, ctx.E.R)
 		if err != nil {
 			return nil, err
@@ -1523,7 +1559,7 @@ func dict(ctx *Context, d1 Dict, objNr, genNr, endInd, streamInd int) (d2 Dict,
 	}
 
 	if endInd >= 0 && (streamInd < 0 || streamInd > endInd) {
-		fmt.Printf("dict: end, #%d\n", objNr)
+		ctx.Log(log.Read).Tracef("dict: end, #%d\n", objNr)
 		d2 = d1
 	}
 
@@ -1560,25 +1596,25 @@ func object(ctx *Context, offset int64, objNr, genNr int) (o Object, endInd, str
 		// buf: # gen obj ... obj dict ... stream ... data
 		// implies we detected no endobj and a stream starting at streamInd.
 		// big stream, we parse object until "stream"
-		fmt.Println("object: big stream, we parse object until stream")
+		ctx.Log(log.Read).Tracef("object: big stream, we parse object until stream")
 		l = line[:streamInd]
 	} else if streamInd < 0 { // dict
 		// buf: # gen obj ... obj dict ... endobj
 		// implies we detected endobj and no stream.
 		// small object w/o stream, parse until "endobj"
-		fmt.Println("object: small object w/o stream, parse until endobj")
+		ctx.Log(log.Read).Tracef("object: small object w/o stream, parse until endobj")
 		l = line[:endInd]
 	} else if streamInd < endInd { // streamdict
 		// buf: # gen obj ... obj dict ... stream ... data ... endstream endobj
 		// implies we detected endobj and stream.
 		// small stream within buffer, parse until "stream"
-		fmt.Println("object: small stream within buffer, parse until stream")
+		ctx.Log(log.Read).Tracef("object: small stream within buffer, parse until stream")
 		l = line[:streamInd]
 	} else { // dict
 		// buf: # gen obj ... obj dict ... endobj # gen obj ... obj dict ... stream
 		// small obj w/o stream, parse until "endobj"
 		// stream in buf belongs to subsequent object.
-		fmt.Println("object: small obj w/o stream, parse until endobj")
+		ctx.Log(log.Read).Tracef("object: small obj w/o stream, parse until endobj")
 		l = line[:endInd]
 	}
 
@@ -1601,7 +1637,7 @@ func object(ctx *Context, offset int64, objNr, genNr int) (o Object, endInd, str
 // ParseObject parses an object from file at given offset.
 func ParseObject(ctx *Context, offset int64, objNr, genNr int) (Object, error) {
 
-	fmt.Printf("ParseObject: begin, obj#%d, offset:%d\n", objNr, offset)
+	ctx.Log(log.Read).Tracef("ParseObject: begin, obj#%d, offset:%d\n", objNr, offset)
 
 	obj, endInd, streamInd, streamOffset, err := object(ctx, offset, objNr, genNr)
 	if err != nil {
@@ -1620,7 +1656,7 @@ func ParseObject(ctx *Context, offset int64, objNr, genNr int) (Object, error) {
 		return streamDictForObject(ctx, o, objNr, streamInd, streamOffset, offset)
 
 	case Array:
-		if ctx.EncKey != nil {
+		if ctx.encryptsStrings() {
 			if _, err = decryptDeepObject(o, objNr, genNr, ctx.EncKey, ctx.AES4Strings, ctx.E.R); err != nil {
 				return nil, err
 			}
@@ -1628,7 +1664,7 @@ func ParseObject(ctx *Context, offset int64, objNr, genNr int) (Object, error) {
 		return o, nil
 
 	case StringLiteral:
-		if ctx.EncKey != nil {
+		if ctx.encryptsStrings() {
 			s1, err := decryptString(o.Value(), objNr, genNr, ctx.EncKey, ctx.AES4Strings, ctx.E.R)
 			if err != nil {
 				return nil, err
@@ -1638,7 +1674,7 @@ func ParseObject(ctx *Context, offset int64, objNr, genNr int) (Object, error) {
 		return o, nil
 
 	case HexLiteral:
-		if ctx.EncKey != nil {
+		if ctx.encryptsStrings() {
 			bb, err := decryptHexLiteral(o, objNr, genNr, ctx.EncKey, ctx.AES4Strings, ctx.E.R)
 			if err != nil {
 				return nil, err
@@ -1668,7 +1704,7 @@ func dereferencedObject(ctx *Context, objectNumber int) (Object, error) {
 
 	if entry.Object == nil {
 
-		fmt.Printf("dereferencedObject: dereferencing object %d\n", objectNumber)
+		ctx.Log(log.Read).Tracef("dereferencedObject: dereferencing object %d\n", objectNumber)
 
 		o, err := ParseObject(ctx, *entry.Offset, objectNumber, *entry.Generation)
 		if err != nil {
@@ -1718,7 +1754,7 @@ func dereferencedDict(ctx *Context, objectNumber int) (Dict, error) {
 // dereference a Integer object representing an int64 value.
 func int64Object(ctx *Context, objectNumber int) (*int64, error) {
 
-	fmt.Printf("int64Object begin: %d\n", objectNumber)
+	ctx.Log(log.Read).Tracef("int64Object begin: %d\n", objectNumber)
 
 	i, err := dereferencedInteger(ctx, objectNumber)
 	if err != nil {
@@ -1727,7 +1763,7 @@ func int64Object(ctx *Context, objectNumber int) (*int64, error) {
 
 	i64 := int64(i.Value())
 
-	fmt.Printf("int64Object end: %d\n", objectNumber)
+	ctx.Log(log.Read).Tracef("int64Object end: %d\n", objectNumber)
 
 	return &i64, nil
 
@@ -1736,7 +1772,7 @@ func int64Object(ctx *Context, objectNumber int) (*int64, error) {
 // Reads and returns a file buffer with length = stream length using provided reader positioned at offset.
 func readContentStream(rd io.Reader, streamLength int) ([]byte, error) {
 
-	fmt.Printf("readContentStream: begin streamLength:%d\n", streamLength)
+	log.Read.Tracef("readContentStream: begin streamLength:%d\n", streamLength)
 
 	buf := make([]byte, streamLength)
 
@@ -1745,11 +1781,11 @@ func readContentStream(rd io.Reader, streamLength int) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		fmt.Printf("readContentStream: count=%d, buflen=%d(%X)\n", count, len(buf), len(buf))
+		log.Read.Tracef("readContentStream: count=%d, buflen=%d(%X)\n", count, len(buf), len(buf))
 		totalCount += count
 	}
 
-	fmt.Printf("readContentStream: end\n")
+	log.Read.Tracef("readContentStream: end\n")
 
 	return buf, nil
 }
@@ -1757,13 +1793,13 @@ func readContentStream(rd io.Reader, streamLength int) ([]byte, error) {
 // LoadEncodedStreamContent loads the encoded stream content from file into StreamDict.
 func loadEncodedStreamContent(ctx *Context, sd *StreamDict) ([]byte, error) {
 
-	fmt.Printf("LoadEncodedStreamContent: begin\n%v\n", sd)
+	ctx.Log(log.Read).Tracef("LoadEncodedStreamContent: begin\n%v\n", sd)
 
 	var err error
 
 	// Return saved decoded content.
 	if sd.Raw != nil {
-		fmt.Println("LoadEncodedStreamContent: end, already in memory.")
+		ctx.Log(log.Read).Tracef("LoadEncodedStreamContent: end, already in memory.")
 		return sd.Raw, nil
 	}
 
@@ -1779,7 +1815,7 @@ func loadEncodedStreamContent(ctx *Context, sd *StreamDict) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		fmt.Printf("LoadEncodedStreamContent: new indirect streamLength:%d\n", *sd.StreamLength)
+		ctx.Log(log.Read).Tracef("LoadEncodedStreamContent: new indirect streamLength:%d\n", *sd.StreamLength)
 	}
 
 	newOffset := sd.StreamOffset
@@ -1788,7 +1824,7 @@ func loadEncodedStreamContent(ctx *Context, sd *StreamDict) ([]byte, error) {
 		return nil, err
 	}
 
-	fmt.Printf("LoadEncodedStreamContent: seeked to offset:%d\n", newOffset)
+	ctx.Log(log.Read).Tracef("LoadEncodedStreamContent: seeked to offset:%d\n", newOffset)
 
 	// Buffer stream contents.
 	// Read content from disk.
@@ -1802,7 +1838,7 @@ func loadEncodedStreamContent(ctx *Context, sd *StreamDict) ([]byte, error) {
 	// Save encoded content.
 	sd.Raw = rawContent
 
-	fmt.Printf("LoadEncodedStreamContent: end: len(streamDictRaw)=%d\n", len(sd.Raw))
+	ctx.Log(log.Read).Tracef("LoadEncodedStreamContent: end: len(streamDictRaw)=%d\n", len(sd.Raw))
 
 	// Return encoded content.
 	return rawContent, nil
@@ -1811,15 +1847,7 @@ func loadEncodedStreamContent(ctx *Context, sd *StreamDict) ([]byte, error) {
 // Decodes the raw encoded stream content and saves it to streamDict.Content.
 func saveDecodedStreamContent(ctx *Context, sd *StreamDict, objNr, genNr int, decode bool) (err error) {
 
-	fmt.Printf("saveDecodedStreamContent: begin decode=%t\n", decode)
-
-	// If the "Identity" crypt filter is used we do not need to decrypt.
-	if ctx != nil && ctx.EncKey != nil {
-		if len(sd.FilterPipeline) == 1 && sd.FilterPipeline[0].Name == "Crypt" {
-			sd.Content = sd.Raw
-			return nil
-		}
-	}
+	ctx.Log(log.Read).Tracef("saveDecodedStreamContent: begin decode=%t\n", decode)
 
 	// Special case: If the length of the encoded data is 0, we do not need to decode anything.
 	if len(sd.Raw) == 0 {
@@ -1827,10 +1855,14 @@ func saveDecodedStreamContent(ctx *Context, sd *StreamDict, objNr, genNr int, de
 		return nil
 	}
 
-	// ctx gets created after XRefStream parsing.
-	// XRefStreams are not encrypted.
-	if ctx != nil && ctx.EncKey != nil {
-		sd.Raw, err = decryptStream(sd.Raw, objNr, genNr, ctx.EncKey, ctx.AES4Streams, ctx.E.R)
+	// Unless the "Identity" crypt filter is used we have to decrypt.
+	encrypted, aes, err := ctx.streamEncryption(sd)
+	if err != nil {
+		return err
+	}
+
+	if encrypted {
+		sd.Raw, err = decryptStream(sd.Raw, objNr, genNr, ctx.EncKey, aes, ctx.E.R)
 		if err != nil {
 			return err
 		}
@@ -1842,6 +1874,17 @@ func saveDecodedStreamContent(ctx *Context, sd *StreamDict, objNr, genNr int, de
 		return nil
 	}
 
+	if ctx != nil {
+		ok, err := resolveParmStreams(ctx.XRefTable, sd)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Streams referenced by decode parameters not available yet.
+			return nil
+		}
+	}
+
 	// Actual decoding of content stream.
 	err = decodeStream(sd)
 	if err == filter.ErrUnsupportedFilter {
@@ -1851,7 +1894,7 @@ func saveDecodedStreamContent(ctx *Context, sd *StreamDict, objNr, genNr int, de
 		return err
 	}
 
-	fmt.Println("saveDecodedStreamContent: end")
+	ctx.Log(log.Read).Tracef("saveDecodedStreamContent: end")
 
 	return nil
 }
@@ -1859,7 +1902,7 @@ func saveDecodedStreamContent(ctx *Context, sd *StreamDict, objNr, genNr int, de
 // Resolve compressed xRefTableEntry
 func decompressXRefTableEntry(xRefTable *XRefTable, objectNumber int, entry *XRefTableEntry) error {
 
-	fmt.Printf("decompressXRefTableEntry: compressed object %d at %d[%d]\n", objectNumber, *entry.ObjectStream, *entry.ObjectStreamInd)
+	log.Read.Tracef("decompressXRefTableEntry: compressed object %d at %d[%d]\n", objectNumber, *entry.ObjectStream, *entry.ObjectStreamInd)
 
 	// Resolve xRefTable entry of referenced object stream.
 	objectStreamXRefTableEntry, ok := xRefTable.Find(*entry.ObjectStream)
@@ -1885,7 +1928,7 @@ func decompressXRefTableEntry(xRefTable *XRefTable, objectNumber int, entry *XRe
 	entry.Generation = &g
 	entry.Compressed = false
 
-	fmt.Printf("decompressXRefTableEntry: end, Obj %d[%d]:\n<%s>\n", *entry.ObjectStream, *entry.ObjectStreamInd, o)
+	log.Read.Tracef("decompressXRefTableEntry: end, Obj %d[%d]:\n<%s>\n", *entry.ObjectStream, *entry.ObjectStreamInd, o)
 
 	return nil
 }
@@ -1898,7 +1941,7 @@ func logStream(o Object) {
 	case StreamDict:
 
 		if o.Content == nil {
-			fmt.Println("logStream: no stream content")
+			log.Read.Tracef("logStream: no stream content")
 		}
 
 		if o.IsPageContent {
@@ -1908,19 +1951,19 @@ func logStream(o Object) {
 	case ObjectStreamDict:
 
 		if o.Content == nil {
-			fmt.Println("logStream: no object stream content")
+			log.Read.Tracef("logStream: no object stream content")
 		} else {
-			fmt.Printf("logStream: objectStream content = %s\n", o.Content)
+			log.Read.Tracef("logStream: objectStream content = %s\n", o.Content)
 		}
 
 		if o.ObjArray == nil {
-			fmt.Println("logStream: no object stream obj arr")
+			log.Read.Tracef("logStream: no object stream obj arr")
 		} else {
-			fmt.Printf("logStream: objectStream objArr = %s\n", o.ObjArray)
+			log.Read.Tracef("logStream: objectStream objArr = %s\n", o.ObjArray)
 		}
 
 	default:
-		fmt.Println("logStream: no ObjectStreamDict")
+		log.Read.Tracef("logStream: no ObjectStreamDict")
 
 	}
 
@@ -1933,7 +1976,7 @@ func decodeObjectStreams(ctx *Context) error {
 	// Entry "Extends" intentionally left out.
 	// No object stream collection validation necessary.
 
-	fmt.Println("decodeObjectStreams: begin")
+	ctx.Log(log.Read).Tracef("decodeObjectStreams: begin")
 
 	// Get sorted slice of object numbers.
 	var keys []int
@@ -1950,7 +1993,7 @@ func decodeObjectStreams(ctx *Context) error {
 			return fmt.Errorf("decodeObjectStream: missing entry for obj#%d\n", objectNumber)
 		}
 
-		fmt.Printf("decodeObjectStreams: parsing object stream for obj#%d\n", objectNumber)
+		ctx.Log(log.Read).Tracef("decodeObjectStreams: parsing object stream for obj#%d\n", objectNumber)
 
 		// Parse object stream from file.
 		o, err := ParseObject(ctx, *entry.Offset, objectNumber, *entry.Generation)
@@ -1971,7 +2014,7 @@ func decodeObjectStreams(ctx *Context) error {
 
 		// Save decoded stream content to xRefTable.
 		if err = saveDecodedStreamContent(ctx, &sd, objectNumber, *entry.Generation, true); err != nil {
-			fmt.Printf("obj %d: %s", objectNumber, err)
+			ctx.Log(log.Read).Warnf("obj %d: %s", objectNumber, err)
 			return err
 		}
 
@@ -1981,7 +2024,7 @@ func decodeObjectStreams(ctx *Context) error {
 		}
 
 		// We have an object stream.
-		fmt.Printf("decodeObjectStreams: object stream #%d\n", objectNumber)
+		ctx.Log(log.Read).Tracef("decodeObjectStreams: object stream #%d\n", objectNumber)
 
 		ctx.Read.UsingObjectStreams = true
 
@@ -1991,7 +2034,7 @@ func decodeObjectStreams(ctx *Context) error {
 			return fmt.Errorf(err.Error()+"decodeObjectStreams: problem dereferencing object stream %d", objectNumber)
 		}
 
-		fmt.Printf("decodeObjectStreams: decoding object stream %d:\n", objectNumber)
+		ctx.Log(log.Read).Tracef("decodeObjectStreams: decoding object stream %d:\n", objectNumber)
 
 		// Parse all objects of this object stream and save them to ObjectStreamDict.ObjArray.
 		if err = parseObjectStream(osd); err != nil {
@@ -2002,13 +2045,13 @@ func decodeObjectStreams(ctx *Context) error {
 			return errors.New(err.Error() + "decodeObjectStreams: objArray should be set!")
 		}
 
-		fmt.Printf("decodeObjectStreams: decoded object stream %d:\n", objectNumber)
+		ctx.Log(log.Read).Tracef("decodeObjectStreams: decoded object stream %d:\n", objectNumber)
 
 		// Save object stream dict to xRefTableEntry.
 		entry.Object = *osd
 	}
 
-	fmt.Println("decodeObjectStreams: end")
+	ctx.Log(log.Read).Tracef("decodeObjectStreams: end")
 
 	return nil
 }
@@ -2025,7 +2068,7 @@ func handleLinearizationParmDict(ctx *Context, obj Object, objNr int) error {
 
 		ctx.Read.Linearized = true
 		ctx.LinearizationObjs[objNr] = true
-		fmt.Printf("handleLinearizationParmDict: identified linearizationObj #%d\n", objNr)
+		ctx.Log(log.Read).Tracef("handleLinearizationParmDict: identified linearizationObj #%d\n", objNr)
 
 		a := d.ArrayEntry("H")
 
@@ -2099,12 +2142,12 @@ func dereferenceObject(ctx *Context, objNr int) error {
 	xRefTable := ctx.XRefTable
 	xRefTableSize := len(xRefTable.Table)
 
-	fmt.Printf("dereferenceObject: begin, dereferencing object %d\n", objNr)
+	ctx.Log(log.Read).Tracef("dereferenceObject: begin, dereferencing object %d\n", objNr)
 
 	entry := xRefTable.Table[objNr]
 
 	if entry.Free {
-		fmt.Printf("free object %d\n", objNr)
+		ctx.Log(log.Read).Tracef("free object %d\n", objNr)
 		return nil
 	}
 
@@ -2118,10 +2161,10 @@ func dereferenceObject(ctx *Context, objNr int) error {
 	}
 
 	// entry is in use.
-	fmt.Printf("in use object %d\n", objNr)
+	ctx.Log(log.Read).Tracef("in use object %d\n", objNr)
 
 	if entry.Offset == nil || *entry.Offset == 0 {
-		fmt.Printf("dereferenceObject: already decompressed or used object w/o offset -> ignored")
+		ctx.Log(log.Read).Tracef("dereferenceObject: already decompressed or used object w/o offset -> ignored")
 		return nil
 	}
 
@@ -2131,13 +2174,13 @@ func dereferenceObject(ctx *Context, objNr int) error {
 	if o != nil {
 		logStream(entry.Object)
 		updateBinaryTotalSize(ctx, o)
-		fmt.Printf("handleCachedStreamDict: using cached object %d of %d\n<%s>\n", objNr, xRefTableSize, entry.Object)
+		ctx.Log(log.Read).Tracef("handleCachedStreamDict: using cached object %d of %d\n<%s>\n", objNr, xRefTableSize, entry.Object)
 		return nil
 	}
 
 	// Dereference (load from disk into memory).
 
-	fmt.Printf("dereferenceObject: dereferencing object %d\n", objNr)
+	ctx.Log(log.Read).Tracef("dereferenceObject: dereferencing object %d\n", objNr)
 
 	// Parse object from file: anything goes dict, array, integer, float, streamdicts...
 	o, err := ParseObject(ctx, *entry.Offset, objNr, *entry.Generation)
@@ -2173,7 +2216,7 @@ func dereferenceObject(ctx *Context, objNr int) error {
 		entry.Object = sd
 	}
 
-	fmt.Printf("dereferenceObject: end obj %d of %d\n<%s>\n", objNr, xRefTableSize, entry.Object)
+	ctx.Log(log.Read).Tracef("dereferenceObject: end obj %d of %d\n<%s>\n", objNr, xRefTableSize, entry.Object)
 
 	logStream(entry.Object)
 
@@ -2229,7 +2272,7 @@ func processRefCounts(xRefTable *XRefTable, o Object) {
 // Dereferences all objects including compressed objects from object streams.
 func dereferenceObjects(ctx *Context) error {
 
-	fmt.Println("dereferenceObjects: begin")
+	ctx.Log(log.Read).Tracef("dereferenceObjects: begin")
 
 	xRefTable := ctx.XRefTable
 
@@ -2256,7 +2299,7 @@ func dereferenceObjects(ctx *Context) error {
 		processRefCounts(xRefTable, entry.Object)
 	}
 
-	fmt.Println("dereferenceObjects: end")
+	ctx.Log(log.Read).Tracef("dereferenceObjects: end")
 
 	return nil
 }
@@ -2265,7 +2308,7 @@ func dereferenceObjects(ctx *Context) error {
 // and record this as rootVersion (as opposed to headerVersion).
 func identifyRootVersion(xRefTable *XRefTable) error {
 
-	fmt.Println("identifyRootVersion: begin")
+	log.Read.Debugf("identifyRootVersion: begin")
 
 	// Try to get Version from Root.
 	rootVersionStr, err := xRefTable.ParseRootVersion()
@@ -2287,11 +2330,11 @@ func identifyRootVersion(xRefTable *XRefTable) error {
 
 	// since V1.4 the header version may be overridden by a Version entry in the catalog.
 	if *xRefTable.HeaderVersion < V14 {
-		fmt.Printf("identifyRootVersion: PDF version is %s - will ignore root version: %s\n",
+		log.Read.Debugf("identifyRootVersion: PDF version is %s - will ignore root version: %s\n",
 			xRefTable.HeaderVersion, *rootVersionStr)
 	}
 
-	fmt.Println("identifyRootVersion: end")
+	log.Read.Debugf("identifyRootVersion: end")
 
 	return nil
 }
@@ -2300,7 +2343,7 @@ func identifyRootVersion(xRefTable *XRefTable) error {
 // This includes processing of object streams and linearization dicts.
 func dereferenceXRefTable(ctx *Context, conf *Configuration) error {
 
-	fmt.Println("dereferenceXRefTable: begin")
+	ctx.Log(log.Read).Tracef("dereferenceXRefTable: begin")
 
 	xRefTable := ctx.XRefTable
 
@@ -2332,7 +2375,7 @@ func dereferenceXRefTable(ctx *Context, conf *Configuration) error {
 		return err
 	}
 
-	fmt.Println("dereferenceXRefTable: end")
+	ctx.Log(log.Read).Tracef("dereferenceXRefTable: end")
 
 	return nil
 }
@@ -2349,8 +2392,8 @@ func handleUnencryptedFile(ctx *Context) error {
 
 	// Encrypt subcommand found.
 
-	if ctx.OwnerPW == "" {
-		return errors.New("pdfcpu: please provide owner password and optional user password")
+	if ctx.OwnerPW == "" && len(ctx.Recipients) == 0 {
+		return errors.New("pdfcpu: please provide owner password and optional user password or recipients")
 	}
 
 	return nil
@@ -2409,6 +2452,10 @@ func handlePermissions(ctx *Context) error {
 
 func setupEncryptionKey(ctx *Context, d Dict) (err error) {
 
+	if filter := d.NameEntry("Filter"); filter != nil && *filter == "Adobe.PubSec" {
+		return setupPubSecEncryptionKey(ctx, d)
+	}
+
 	ctx.E, err = supportedEncryption(ctx, d)
 	if err != nil {
 		return err
@@ -2473,7 +2520,7 @@ func checkForEncryption(ctx *Context) error {
 	}
 
 	// This file is encrypted.
-	fmt.Printf("Encryption: %v\n", ir)
+	ctx.Log(log.Read).Tracef("Encryption: %v\n", ir)
 
 	if ctx.Cmd == ENCRYPT {
 		// We want to encrypt this file.
@@ -2485,7 +2532,7 @@ func checkForEncryption(ctx *Context) error {
 	if err != nil {
 		return err
 	}
-	fmt.Printf("%s\n", d)
+	ctx.Log(log.Read).Tracef("%s\n", d)
 
 	// We need to decrypt this file in order to read it.
 	return setupEncryptionKey(ctx, d)
@@ -0,0 +1,538 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"fmt"
+)
+
+// SanitizeOptions selects the kinds of active content removed by Sanitize.
+type SanitizeOptions struct {
+	JavaScript    bool // JavaScript name tree, JavaScript actions incl. OpenAction and additional actions.
+	Actions       bool // Launch, ImportData, SubmitForm and URI actions.
+	EmbeddedFiles bool // Embedded files name tree, associated files, file attachment annotations and GoToE actions.
+	RichMedia     bool // RichMedia annotations and RichMediaExecute actions.
+	XFA           bool // XFA forms.
+}
+
+// DefaultSanitizeOptions returns options removing all kinds of active content.
+func DefaultSanitizeOptions() *SanitizeOptions {
+	return &SanitizeOptions{
+		JavaScript:    true,
+		Actions:       true,
+		EmbeddedFiles: true,
+		RichMedia:     true,
+		XFA:           true,
+	}
+}
+
+type sanitizer struct {
+	*XRefTable
+	opts    *SanitizeOptions
+	visited IntSet // annotations, fields and outline items processed
+	removed []string
+}
+
+func (s *sanitizer) report(format string, a ...interface{}) {
+	s.removed = append(s.removed, fmt.Sprintf(format, a...))
+}
+
+// activeActionType returns true if actions of type t get removed.
+func (s *sanitizer) activeActionType(t string, d Dict) bool {
+
+	switch t {
+
+	case "JavaScript":
+		return s.opts.JavaScript
+
+	case "Rendition":
+		// A rendition action may carry a script.
+		_, found := d.Find("JS")
+		return found && s.opts.JavaScript
+
+	case "Launch", "ImportData", "SubmitForm", "URI":
+		return s.opts.Actions
+
+	case "GoToE":
+		return s.opts.EmbeddedFiles
+
+	case "RichMediaExecute":
+		return s.opts.RichMedia
+	}
+
+	return false
+}
+
+// activeAction returns the type of the first action to be removed within the action sequence o.
+func (s *sanitizer) activeAction(o Object, depth int) (string, error) {
+
+	// Guard against cyclic Next chains.
+	if depth > 100 {
+		return "", nil
+	}
+
+	o, err := s.Dereference(o)
+	if err != nil {
+		return "", err
+	}
+
+	switch o := o.(type) {
+
+	case Dict:
+		if t := o.NameEntry("S"); t != nil && s.activeActionType(*t, o) {
+			return *t, nil
+		}
+		if next, found := o.Find("Next"); found {
+			return s.activeAction(next, depth+1)
+		}
+
+	case Array:
+		for _, v := range o {
+			t, err := s.activeAction(v, depth+1)
+			if err != nil || t != "" {
+				return t, err
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// sanitizeAction removes the action entry key of d if it triggers active content.
+func (s *sanitizer) sanitizeAction(d Dict, key, where string) error {
+
+	o, found := d.Find(key)
+	if !found {
+		return nil
+	}
+
+	// OpenAction may also be a destination.
+	if _, ok := o.(Array); ok && key == "OpenAction" {
+		return nil
+	}
+
+	t, err := s.activeAction(o, 0)
+	if err != nil || t == "" {
+		return err
+	}
+
+	d.Delete(key)
+	s.report("%s: %s (%s)", where, key, t)
+
+	return nil
+}
+
+// sanitizeAA removes all additional actions of d triggering active content.
+func (s *sanitizer) sanitizeAA(d Dict, where string) error {
+
+	o, found := d.Find("AA")
+	if !found {
+		return nil
+	}
+
+	aa, err := s.DereferenceDict(o)
+	if err != nil || aa == nil {
+		return err
+	}
+
+	for _, k := range sortedKeys(aa, nil) {
+		if err = s.sanitizeAction(aa, k, where+": AA"); err != nil {
+			return err
+		}
+	}
+
+	if aa.Len() == 0 {
+		d.Delete("AA")
+	}
+
+	return nil
+}
+
+// sanitizeAF removes the associated files of d.
+func (s *sanitizer) sanitizeAF(d Dict, where string) {
+
+	if !s.opts.EmbeddedFiles {
+		return
+	}
+
+	if _, found := d.Find("AF"); found {
+		d.Delete("AF")
+		s.report("%s: AF", where)
+	}
+}
+
+// firstVisit returns true if o is a direct object or an indirect object not yet processed.
+func (s *sanitizer) firstVisit(o Object) bool {
+
+	ir, ok := o.(IndirectRef)
+	if !ok {
+		return true
+	}
+
+	if s.visited[ir.ObjectNumber.Value()] {
+		return false
+	}
+
+	s.visited[ir.ObjectNumber.Value()] = true
+
+	return true
+}
+
+// nameTreeKeys returns the keys of the name tree rooted at d.
+func (s *sanitizer) nameTreeKeys(d Dict, depth int) ([]string, error) {
+
+	if depth > 100 {
+		return nil, nil
+	}
+
+	var keys []string
+
+	names, err := s.DereferenceArray(d["Names"])
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(names); i += 2 {
+		k, err := s.DereferenceText(names[i])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	kids, err := s.DereferenceArray(d["Kids"])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range kids {
+		kid, err := s.DereferenceDict(o)
+		if err != nil || kid == nil {
+			return nil, err
+		}
+		kk, err := s.nameTreeKeys(kid, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, kk...)
+	}
+
+	return keys, nil
+}
+
+func (s *sanitizer) sanitizeNameTrees() error {
+
+	if s.opts.JavaScript {
+
+		if err := s.LocateNameTree("JavaScript", false); err != nil {
+			return err
+		}
+
+		if n := s.Names["JavaScript"]; n != nil {
+
+			keys, err := s.nameTreeKeys(*n.D, 0)
+			if err != nil {
+				return err
+			}
+
+			delete(s.Names, "JavaScript")
+			if err = s.RemoveNameTree("JavaScript"); err != nil {
+				return err
+			}
+
+			for _, k := range keys {
+				s.report("JavaScript: %s", k)
+			}
+		}
+	}
+
+	if s.opts.EmbeddedFiles {
+
+		if err := s.LocateNameTree("EmbeddedFiles", false); err != nil {
+			return err
+		}
+
+		if n := s.Names["EmbeddedFiles"]; n != nil {
+
+			keys, err := s.nameTreeKeys(*n.D, 0)
+			if err != nil {
+				return err
+			}
+
+			if err = s.RemoveEmbeddedFilesNameTree(); err != nil {
+				return err
+			}
+
+			for _, k := range keys {
+				s.report("embedded file: %s", k)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sanitizeAnnotation returns false if the annotation d needs to be removed altogether.
+func (s *sanitizer) sanitizeAnnotation(d Dict, where string) (bool, error) {
+
+	subtype := ""
+	if st := d.Subtype(); st != nil {
+		subtype = *st
+	}
+
+	if subtype == "RichMedia" && s.opts.RichMedia || subtype == "FileAttachment" && s.opts.EmbeddedFiles {
+		s.report("%s: %s annotation", where, subtype)
+		return false, nil
+	}
+
+	where = fmt.Sprintf("%s: %s annotation", where, subtype)
+
+	s.sanitizeAF(d, where)
+
+	if err := s.sanitizeAction(d, "A", where); err != nil {
+		return false, err
+	}
+
+	return true, s.sanitizeAA(d, where)
+}
+
+func (s *sanitizer) sanitizePage(pageNr int, ir IndirectRef) error {
+
+	d, err := s.DereferenceDict(ir)
+	if err != nil || d == nil {
+		return err
+	}
+
+	where := fmt.Sprintf("page %d", pageNr)
+
+	s.sanitizeAF(d, where)
+
+	if err = s.sanitizeAA(d, where); err != nil {
+		return err
+	}
+
+	o, found := d.Find("Annots")
+	if !found {
+		return nil
+	}
+
+	annots, err := s.DereferenceArray(o)
+	if err != nil || annots == nil {
+		return err
+	}
+
+	a := Array{}
+
+	for _, o := range annots {
+
+		if !s.firstVisit(o) {
+			a = append(a, o)
+			continue
+		}
+
+		ad, err := s.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+
+		if ad != nil {
+			keep, err := s.sanitizeAnnotation(ad, where)
+			if err != nil {
+				return err
+			}
+			if !keep {
+				continue
+			}
+		}
+
+		a = append(a, o)
+	}
+
+	if len(a) == len(annots) {
+		return nil
+	}
+
+	if r, ok := o.(IndirectRef); ok {
+		entry, _ := s.FindTableEntryForIndRef(&r)
+		entry.Object = a
+		return nil
+	}
+
+	d.Update("Annots", a)
+
+	return nil
+}
+
+// sanitizeFields processes the actions of all form fields.
+func (s *sanitizer) sanitizeFields(a Array, depth int) error {
+
+	if depth > 100 {
+		return nil
+	}
+
+	for _, o := range a {
+
+		if !s.firstVisit(o) {
+			continue
+		}
+
+		d, err := s.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			continue
+		}
+
+		where := "form field"
+		if t, found := d.Find("T"); found {
+			if name, err := s.DereferenceText(t); err == nil {
+				where = fmt.Sprintf("form field %s", name)
+			}
+		}
+
+		if err = s.sanitizeAction(d, "A", where); err != nil {
+			return err
+		}
+
+		if err = s.sanitizeAA(d, where); err != nil {
+			return err
+		}
+
+		kids, err := s.DereferenceArray(d["Kids"])
+		if err != nil {
+			return err
+		}
+
+		if err = s.sanitizeFields(kids, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sanitizer) sanitizeAcroForm(rootDict Dict) error {
+
+	o, found := rootDict.Find("AcroForm")
+	if !found {
+		return nil
+	}
+
+	d, err := s.DereferenceDict(o)
+	if err != nil || d == nil {
+		return err
+	}
+
+	if _, found = d.Find("XFA"); found && s.opts.XFA {
+		d.Delete("XFA")
+		rootDict.Delete("NeedsRendering")
+		s.report("AcroForm: XFA")
+	}
+
+	fields, err := s.DereferenceArray(d["Fields"])
+	if err != nil {
+		return err
+	}
+
+	return s.sanitizeFields(fields, 0)
+}
+
+// sanitizeOutlines processes the actions of all outline items.
+func (s *sanitizer) sanitizeOutlines(o Object) error {
+
+	for o != nil && s.firstVisit(o) {
+
+		d, err := s.DereferenceDict(o)
+		if err != nil || d == nil {
+			return err
+		}
+
+		if err = s.sanitizeAction(d, "A", "outline item"); err != nil {
+			return err
+		}
+
+		if first, found := d.Find("First"); found {
+			if err = s.sanitizeOutlines(first); err != nil {
+				return err
+			}
+		}
+
+		o, _ = d.Find("Next")
+	}
+
+	return nil
+}
+
+// Sanitize removes active content selected by opts from ctx and returns a list of everything removed.
+// If opts is nil all kinds of active content are removed.
+func Sanitize(ctx *Context, opts *SanitizeOptions) ([]string, error) {
+
+	if opts == nil {
+		opts = DefaultSanitizeOptions()
+	}
+
+	s := &sanitizer{XRefTable: ctx.XRefTable, opts: opts, visited: IntSet{}}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.sanitizeNameTrees(); err != nil {
+		return nil, err
+	}
+
+	if err = s.sanitizeAction(rootDict, "OpenAction", "catalog"); err != nil {
+		return nil, err
+	}
+
+	if err = s.sanitizeAA(rootDict, "catalog"); err != nil {
+		return nil, err
+	}
+
+	s.sanitizeAF(rootDict, "catalog")
+
+	pages, err := pageRefs(ctx.XRefTable)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, ir := range pages {
+		if err = s.sanitizePage(i+1, ir); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.sanitizeAcroForm(rootDict); err != nil {
+		return nil, err
+	}
+
+	if o, found := rootDict.Find("Outlines"); found {
+		d, err := ctx.DereferenceDict(o)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			if err = s.sanitizeOutlines(d["First"]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s.removed, nil
+}
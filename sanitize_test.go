@@ -0,0 +1,236 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// activeContentPDF returns a single page PDF file containing every kind of active content removed by Sanitize.
+func activeContentPDF() []byte {
+
+	return testPDF([]string{
+		// 1: catalog
+		"<</Type/Catalog/Pages 2 0 R/Names 5 0 R/OpenAction 6 0 R/AA<</WC 7 0 R>>" +
+			"/AcroForm 8 0 R/NeedsRendering true/AF[12 0 R]/Outlines 16 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]/Resources<<>>/AA<</O 7 0 R>>/AF[12 0 R]" +
+			"/Annots[9 0 R 10 0 R 11 0 R 13 0 R 14 0 R 20 0 R]>>",
+		"<</Producer(test)>>",
+		// 5: name dict
+		"<</JavaScript<</Names[(init) 7 0 R]>>/EmbeddedFiles<</Names[(secret.txt) 12 0 R]>>>>",
+		"<</S/JavaScript/JS(app.alert\\(1\\))>>",
+		"<</S/JavaScript/JS(run\\(\\))>>",
+		"<</Fields[15 0 R]/XFA[(template) 18 0 R]>>",
+		// 9: annotations
+		"<</Type/Annot/Subtype/Link/Rect[0 0 10 10]/A<</S/Launch/F(cmd.exe)>>>>",
+		"<</Type/Annot/Subtype/Link/Rect[10 0 20 10]/A<</S/GoTo/D[3 0 R/Fit]/Next<</S/URI/URI(http://example.com)>>>>>>",
+		"<</Type/Annot/Subtype/Widget/Rect[20 0 30 10]/A<</S/SubmitForm/F(http://example.com)>>/AF[12 0 R]>>",
+		"<</Type/Filespec/F(secret.txt)/UF(secret.txt)/EF<</F 17 0 R>>/AFRelationship/Data>>",
+		"<</Type/Annot/Subtype/FileAttachment/Rect[30 0 40 10]/FS 12 0 R>>",
+		"<</Type/Annot/Subtype/RichMedia/Rect[40 0 50 10]>>",
+		// 15: form field
+		"<</FT/Tx/T(name)/AA<</K 7 0 R>>>>",
+		"<</Type/Outlines/First 19 0 R/Last 19 0 R/Count 1>>",
+		"<</Type/EmbeddedFile/Length 6>>\nstream\nsecret\nendstream",
+		"<</Length 5>>\nstream\n<xdp>\nendstream",
+		"<</Title(start)/Parent 16 0 R/A 6 0 R>>",
+		// 20: harmless link
+		"<</Type/Annot/Subtype/Link/Rect[50 0 60 10]/Dest[3 0 R/Fit]>>",
+	})
+}
+
+// reachable returns the serialized objects reachable from the root and the info dict of ctx.
+func reachable(t *testing.T, ctx *Context) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	visited := IntSet{}
+
+	var walk func(o Object)
+
+	walk = func(o Object) {
+
+		if ir, ok := o.(IndirectRef); ok {
+			if visited[ir.ObjectNumber.Value()] {
+				return
+			}
+			visited[ir.ObjectNumber.Value()] = true
+
+			var err error
+			if o, err = ctx.Dereference(ir); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		switch o := o.(type) {
+
+		case Dict:
+			b.WriteString(o.PDFString())
+			for _, v := range o {
+				walk(v)
+			}
+
+		case StreamDict:
+			b.WriteString(o.Dict.PDFString())
+			b.Write(o.Raw)
+			for _, v := range o.Dict {
+				walk(v)
+			}
+
+		case Array:
+			b.WriteString(o.PDFString())
+			for _, v := range o {
+				walk(v)
+			}
+
+		case Object:
+			b.WriteString(o.PDFString())
+		}
+	}
+
+	walk(*ctx.Root)
+	if ctx.Info != nil {
+		walk(*ctx.Info)
+	}
+
+	return b.Bytes()
+}
+
+var (
+	sanitizedJavaScript = []string{
+		"JavaScript: init",
+		"catalog: OpenAction (JavaScript)",
+		"catalog: AA: WC (JavaScript)",
+		"page 1: AA: O (JavaScript)",
+		"form field name: AA: K (JavaScript)",
+		"outline item: A (JavaScript)",
+	}
+
+	sanitizedActions = []string{
+		"page 1: Link annotation: A (Launch)",
+		"page 1: Link annotation: A (URI)",
+		"page 1: Widget annotation: A (SubmitForm)",
+	}
+
+	sanitizedEmbeddedFiles = []string{
+		"embedded file: secret.txt",
+		"catalog: AF",
+		"page 1: AF",
+		"page 1: Widget annotation: AF",
+		"page 1: FileAttachment annotation",
+	}
+
+	sanitizedRichMedia = []string{"page 1: RichMedia annotation"}
+
+	sanitizedXFA = []string{"AcroForm: XFA"}
+)
+
+func TestSanitize(t *testing.T) {
+
+	for _, tt := range []struct {
+		opts    *SanitizeOptions
+		removed []string
+		gone    []string // no longer reachable
+	}{
+		{
+			&SanitizeOptions{JavaScript: true},
+			sanitizedJavaScript,
+			[]string{"/JavaScript", "/OpenAction", "/AA"},
+		},
+		{
+			&SanitizeOptions{Actions: true},
+			sanitizedActions,
+			[]string{"/Launch", "/URI", "/SubmitForm"},
+		},
+		{
+			&SanitizeOptions{EmbeddedFiles: true},
+			sanitizedEmbeddedFiles,
+			[]string{"/EmbeddedFile", "/AF", "/FileAttachment", "secret"},
+		},
+		{
+			&SanitizeOptions{RichMedia: true},
+			sanitizedRichMedia,
+			[]string{"/RichMedia"},
+		},
+		{
+			&SanitizeOptions{XFA: true},
+			sanitizedXFA,
+			[]string{"/XFA", "<xdp>", "/NeedsRendering"},
+		},
+	} {
+		ctx, err := Read(bytes.NewReader(activeContentPDF()), NewDefaultConfiguration())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		removed, err := Sanitize(ctx, tt.opts)
+		if err != nil {
+			t.Fatalf("%+v: %v", *tt.opts, err)
+		}
+
+		if !reflect.DeepEqual(removed, tt.removed) {
+			t.Errorf("%+v: removed\n%q\nwant\n%q", *tt.opts, removed, tt.removed)
+		}
+
+		b := reachable(t, ctx)
+
+		for _, s := range tt.gone {
+			if bytes.Contains(b, []byte(s)) {
+				t.Errorf("%+v: %s still in file", *tt.opts, s)
+			}
+		}
+	}
+}
+
+func TestSanitizeAll(t *testing.T) {
+
+	ctx, err := Read(bytes.NewReader(activeContentPDF()), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := Sanitize(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range [][]string{sanitizedJavaScript, sanitizedActions, sanitizedEmbeddedFiles, sanitizedRichMedia, sanitizedXFA} {
+		for _, s := range want {
+			found := false
+			for _, r := range removed {
+				found = found || r == s
+			}
+			if !found {
+				t.Errorf("%q not reported", s)
+			}
+		}
+	}
+
+	if removed, err = Sanitize(ctx, nil); err != nil || len(removed) > 0 {
+		t.Errorf("sanitized file still contains %s (%v)", strings.Join(removed, ", "), err)
+	}
+
+	// The GoTo link and the form field stay.
+	b := reachable(t, ctx)
+	if !bytes.Contains(b, []byte("/Dest")) || !bytes.Contains(b, []byte("(name)")) {
+		t.Error("harmless content removed")
+	}
+}
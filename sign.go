@@ -0,0 +1,877 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+// Creating PAdES signatures via incremental update (see 12.8 and ETSI EN 319 142-1).
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zean00/pdfcpulite/font"
+)
+
+// DefaultSignatureSize is the number of bytes reserved for the CMS signature by default.
+const DefaultSignatureSize = 8192
+
+var (
+	oidContentType           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidSigningCertificateV2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidECDSAWithSHA256       = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384       = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512       = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519               = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidSHA256                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	byteRangePlaceholder     = Array{Integer(0), Integer(9999999999), Integer(9999999999), Integer(9999999999)}
+	signatureDigestAlgorithm = map[crypto.Hash]asn1.ObjectIdentifier{
+		crypto.SHA256: oidSHA256,
+		crypto.SHA384: oidSHA384,
+		crypto.SHA512: oidSHA512,
+	}
+)
+
+// ESS signing certificate v2 (RFC 5035) using the default hash algorithm SHA-256.
+
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type essSigningCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// SignatureConfig represents the parameters of a signing operation.
+type SignatureConfig struct {
+	Key   crypto.Signer       // The signer's private key.
+	Chain []*x509.Certificate // The signer certificate followed by optional intermediate certificates.
+
+	SubFilter string      // ETSI.CAdES.detached (default) or adbe.pkcs7.detached
+	Hash      crypto.Hash // SHA256 (default), SHA384 or SHA512
+
+	FieldName   string    // Name of the new signature field, defaults to SignatureN.
+	Name        string    // Name of the signer, defaults to the common name of the signer certificate.
+	Reason      string    // Reason for signing.
+	Location    string    // Location of signing.
+	ContactInfo string    // Contact info of the signer.
+	SigningTime time.Time // Defaults to now.
+
+	// Page and Rect define the widget for a visible signature.
+	// A nil Rect creates an invisible signature on Page.
+	Page int // Defaults to 1.
+	Rect *Rectangle
+
+	// Size is the number of bytes reserved for the CMS signature, defaults to DefaultSignatureSize.
+	Size int
+}
+
+func (sc *SignatureConfig) validate() error {
+
+	if sc.Key == nil || len(sc.Chain) == 0 {
+		return errors.New("pdfcpu: sign: missing private key or certificate")
+	}
+
+	if k, ok := sc.Key.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(sc.Chain[0].PublicKey) {
+		return errors.New("pdfcpu: sign: private key does not match signer certificate")
+	}
+
+	if sc.SubFilter == "" {
+		sc.SubFilter = "ETSI.CAdES.detached"
+	}
+	if sc.SubFilter != "ETSI.CAdES.detached" && sc.SubFilter != "adbe.pkcs7.detached" {
+		return fmt.Errorf("pdfcpu: sign: unsupported SubFilter %s", sc.SubFilter)
+	}
+
+	if sc.Hash == 0 {
+		sc.Hash = crypto.SHA256
+	}
+	if _, ok := signatureDigestAlgorithm[sc.Hash]; !ok || !sc.Hash.Available() {
+		return fmt.Errorf("pdfcpu: sign: unsupported hash algorithm %s", sc.Hash)
+	}
+
+	if sc.Name == "" {
+		sc.Name = sc.Chain[0].Subject.CommonName
+	}
+
+	if sc.SigningTime.IsZero() {
+		sc.SigningTime = time.Now()
+	}
+
+	if sc.Page == 0 {
+		sc.Page = 1
+	}
+
+	if sc.Size == 0 {
+		sc.Size = DefaultSignatureSize
+	}
+
+	return nil
+}
+
+// signatureAlgorithm returns the CMS signature algorithm for key.
+func signatureAlgorithm(key crypto.PublicKey, h crypto.Hash) (pkix.AlgorithmIdentifier, error) {
+
+	switch key.(type) {
+
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+
+	case *ecdsa.PublicKey:
+		oid := map[crypto.Hash]asn1.ObjectIdentifier{
+			crypto.SHA256: oidECDSAWithSHA256,
+			crypto.SHA384: oidECDSAWithSHA384,
+			crypto.SHA512: oidECDSAWithSHA512,
+		}[h]
+		return pkix.AlgorithmIdentifier{Algorithm: oid}, nil
+
+	case ed25519.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, nil
+	}
+
+	return pkix.AlgorithmIdentifier{}, fmt.Errorf("pdfcpu: sign: unsupported public key type %T", key)
+}
+
+func cmsAttributeBytes(oid asn1.ObjectIdentifier, v interface{}) ([]byte, error) {
+
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(cmsAttribute{Type: oid, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: b}})
+}
+
+// signedAttributes returns the DER encoded content of the signed attributes for a digest of the signed byte ranges.
+func signedAttributes(sc *SignatureConfig, digest []byte) ([]byte, error) {
+
+	var attrs [][]byte
+
+	b, err := cmsAttributeBytes(oidContentType, oidData)
+	if err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, b)
+
+	if b, err = cmsAttributeBytes(oidMessageDigest, digest); err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, b)
+
+	if sc.SubFilter == "adbe.pkcs7.detached" {
+		// PAdES signatures must not carry a signing time attribute, M of the signature dict is used instead.
+		if b, err = cmsAttributeBytes(oidSigningTime, sc.SigningTime.UTC()); err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, b)
+	} else {
+		certHash := sha256.Sum256(sc.Chain[0].Raw)
+		v := essSigningCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}}
+		if b, err = cmsAttributeBytes(oidSigningCertificateV2, v); err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, b)
+	}
+
+	// DER: The elements of a SET OF are sorted by their encodings.
+	sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+
+	return bytes.Join(attrs, nil), nil
+}
+
+// signCMS returns a detached CMS signed data structure for content.
+func signCMS(sc *SignatureConfig, content []byte) ([]byte, error) {
+
+	hh := sc.Hash.New()
+	hh.Write(content)
+
+	attrs, err := signedAttributes(sc, hh.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature covers the DER encoding of the signed attributes as SET OF.
+	signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+
+	cert := sc.Chain[0]
+
+	sigAlg, err := signatureAlgorithm(cert.PublicKey, sc.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig []byte
+
+	if sigAlg.Algorithm.Equal(oidEd25519) {
+		sig, err = sc.Key.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		hh = sc.Hash.New()
+		hh.Write(signed)
+		sig, err = sc.Key.Sign(rand.Reader, hh.Sum(nil), sc.Hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(cmsIssuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber})
+	if err != nil {
+		return nil, err
+	}
+
+	digestAlg := pkix.AlgorithmIdentifier{Algorithm: signatureDigestAlgorithm[sc.Hash]}
+
+	si, err := asn1.Marshal(cmsSignerInfo{
+		Version:            1,
+		Sid:                asn1.RawValue{FullBytes: sid},
+		DigestAlgorithm:    digestAlg,
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+		SignatureAlgorithm: sigAlg,
+		Signature:          sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []byte
+	for _, c := range sc.Chain {
+		certs = append(certs, c.Raw...)
+	}
+
+	b, err := asn1.Marshal(cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
+		EncapContentInfo: cmsEncapContentInfo{EContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      []asn1.RawValue{{FullBytes: si}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
+
+func textString(s string) StringLiteral {
+	es, _ := Escape(s)
+	return StringLiteral(*es)
+}
+
+// updatedArray appends ir to the array entry key of d.
+// An indirect array gets updated in place and is recorded in objNrs, else d is.
+func updatedArray(xRefTable *XRefTable, d Dict, key string, ir IndirectRef, objNrs IntSet) error {
+
+	o, found := d.Find(key)
+	if !found || o == nil {
+		d[key] = Array{ir}
+		return nil
+	}
+
+	if r, ok := o.(IndirectRef); ok {
+		a, err := xRefTable.DereferenceArray(r)
+		if err != nil {
+			return err
+		}
+		entry, _ := xRefTable.FindTableEntryForIndRef(&r)
+		entry.Object = append(a, ir)
+		objNrs[r.ObjectNumber.Value()] = true
+		return nil
+	}
+
+	a, ok := o.(Array)
+	if !ok {
+		return fmt.Errorf("pdfcpu: sign: corrupt %s entry", key)
+	}
+
+	d[key] = append(a, ir)
+
+	return nil
+}
+
+// prepareAcroForm ensures a signature enabled AcroForm and adds field to it.
+func prepareAcroForm(xRefTable *XRefTable, field IndirectRef, objNrs IntSet) error {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return err
+	}
+
+	var d Dict
+
+	switch o := rootDict["AcroForm"].(type) {
+
+	case nil:
+		d = NewDict()
+		ir, err := xRefTable.IndRefForNewObject(d)
+		if err != nil {
+			return err
+		}
+		rootDict["AcroForm"] = *ir
+		objNrs[xRefTable.Root.ObjectNumber.Value()] = true
+		objNrs[ir.ObjectNumber.Value()] = true
+
+	case IndirectRef:
+		if d, err = xRefTable.DereferenceDict(o); err != nil || d == nil {
+			return errors.New("pdfcpu: sign: corrupt AcroForm")
+		}
+		objNrs[o.ObjectNumber.Value()] = true
+
+	case Dict:
+		d = o
+		objNrs[xRefTable.Root.ObjectNumber.Value()] = true
+
+	default:
+		return errors.New("pdfcpu: sign: corrupt AcroForm")
+	}
+
+	// SignaturesExist and AppendOnly
+	sigFlags := 3
+	if i := d.IntEntry("SigFlags"); i != nil {
+		sigFlags |= *i
+	}
+	d["SigFlags"] = Integer(sigFlags)
+
+	return updatedArray(xRefTable, d, "Fields", field, objNrs)
+}
+
+// signatureFieldName returns a name for a new signature field not yet taken by a root field.
+func signatureFieldName(xRefTable *XRefTable, name string) (string, error) {
+
+	taken := map[string]bool{}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return "", err
+	}
+
+	if o, found := rootDict.Find("AcroForm"); found {
+		d, err := xRefTable.DereferenceDict(o)
+		if err != nil {
+			return "", err
+		}
+		fields, err := xRefTable.DereferenceArray(d["Fields"])
+		if err != nil {
+			return "", err
+		}
+		for _, o := range fields {
+			d, err := xRefTable.DereferenceDict(o)
+			if err != nil || d == nil {
+				continue
+			}
+			if t, found := d.Find("T"); found {
+				s, err := xRefTable.DereferenceText(t)
+				if err == nil {
+					taken[s] = true
+				}
+			}
+		}
+	}
+
+	if name != "" {
+		if taken[name] {
+			return "", fmt.Errorf("pdfcpu: sign: field %s already exists", name)
+		}
+		return name, nil
+	}
+
+	for i := 1; ; i++ {
+		name = fmt.Sprintf("Signature%d", i)
+		if !taken[name] {
+			return name, nil
+		}
+	}
+}
+
+// signatureAppearance returns the normal appearance of a signature widget.
+func signatureAppearance(sc *SignatureConfig) (StreamDict, error) {
+
+	var (
+		b    bytes.Buffer
+		w, h float64
+	)
+
+	if sc.Rect != nil {
+
+		w, h = sc.Rect.Width(), sc.Rect.Height()
+
+		lines := []string{"Digitally signed by " + sc.Name, "Date: " + sc.SigningTime.Format("2006-01-02 15:04:05 -07:00")}
+		if sc.Reason != "" {
+			lines = append(lines, "Reason: "+sc.Reason)
+		}
+		if sc.Location != "" {
+			lines = append(lines, "Location: "+sc.Location)
+		}
+
+		// Fit the text lines into the widget.
+		fontSize := int(h / (1.2 * float64(len(lines))))
+		if fontSize > 10 {
+			fontSize = 10
+		}
+		for ; fontSize > 1; fontSize-- {
+			var maxWidth float64
+			for _, s := range lines {
+				if tw := font.TextWidth(s, "Helvetica", fontSize); tw > maxWidth {
+					maxWidth = tw
+				}
+			}
+			if maxWidth <= w-4 {
+				break
+			}
+		}
+
+		fmt.Fprintf(&b, "q 0 G 0.5 w 0.25 0.25 %.2f %.2f re S Q ", w-0.5, h-0.5)
+		fmt.Fprintf(&b, "BT /Helv %d Tf 0 g %d TL 2 %.2f Td ", fontSize, fontSize+2, h-2-float64(fontSize))
+		for _, s := range lines {
+			fmt.Fprintf(&b, "%s Tj T* ", textString(s))
+		}
+		b.WriteString("ET")
+	}
+
+	sd := StreamDict{
+		Dict: Dict(
+			map[string]Object{
+				"Type":      Name("XObject"),
+				"Subtype":   Name("Form"),
+				"BBox":      NewNumberArray(0, 0, w, h),
+				"Resources": Dict(map[string]Object{"Font": Dict(map[string]Object{"Helv": coreFontDict("Helvetica")})}),
+			},
+		),
+		Content: b.Bytes(),
+	}
+
+	err := encodeStream(&sd)
+
+	return sd, err
+}
+
+// addSignatureField adds a signature field with a merged widget annotation referring to the signature dict sig.
+// All objects new or modified are recorded in objNrs.
+func addSignatureField(ctx *Context, sc *SignatureConfig, sig IndirectRef, objNrs IntSet) error {
+
+	pages, err := pageRefs(ctx.XRefTable)
+	if err != nil {
+		return err
+	}
+
+	if sc.Page < 1 || sc.Page > len(pages) {
+		return fmt.Errorf("pdfcpu: sign: invalid page number %d", sc.Page)
+	}
+	pageRef := pages[sc.Page-1]
+
+	pageDict, err := ctx.DereferenceDict(pageRef)
+	if err != nil || pageDict == nil {
+		return fmt.Errorf("pdfcpu: sign: missing page %d", sc.Page)
+	}
+
+	name, err := signatureFieldName(ctx.XRefTable, sc.FieldName)
+	if err != nil {
+		return err
+	}
+
+	ap, err := signatureAppearance(sc)
+	if err != nil {
+		return err
+	}
+
+	apRef, err := ctx.InsertObject(ap)
+	if err != nil {
+		return err
+	}
+	objNrs[apRef] = true
+
+	rect := NewIntegerArray(0, 0, 0, 0)
+	if sc.Rect != nil {
+		rect = sc.Rect.Array()
+	}
+
+	d := Dict(
+		map[string]Object{
+			"Type":    Name("Annot"),
+			"Subtype": Name("Widget"),
+			"FT":      Name("Sig"),
+			"T":       textString(name),
+			"V":       sig,
+			"F":       Integer(132), // Print, Locked
+			"Rect":    rect,
+			"P":       pageRef,
+			"AP":      Dict(map[string]Object{"N": *NewIndirectRef(apRef, 0)}),
+		},
+	)
+
+	fieldNr, err := ctx.InsertObject(d)
+	if err != nil {
+		return err
+	}
+	objNrs[fieldNr] = true
+	field := *NewIndirectRef(fieldNr, 0)
+
+	objNrs[pageRef.ObjectNumber.Value()] = true
+	if err = updatedArray(ctx.XRefTable, pageDict, "Annots", field, objNrs); err != nil {
+		return err
+	}
+
+	return prepareAcroForm(ctx.XRefTable, field, objNrs)
+}
+
+func newSignatureDict(sc *SignatureConfig) Dict {
+
+	d := Dict(
+		map[string]Object{
+			"Type":      Name("Sig"),
+			"Filter":    Name("Adobe.PPKLite"),
+			"SubFilter": Name(sc.SubFilter),
+			"M":         StringLiteral(DateString(sc.SigningTime)),
+			"ByteRange": byteRangePlaceholder,
+			"Contents":  NewHexLiteral(make([]byte, sc.Size)),
+		},
+	)
+
+	for k, v := range map[string]string{"Name": sc.Name, "Reason": sc.Reason, "Location": sc.Location, "ContactInfo": sc.ContactInfo} {
+		if v != "" {
+			d[k] = textString(v)
+		}
+	}
+
+	return d
+}
+
+// writeXRefSection writes a cross reference section for the objects written by ctx.Write followed by the trailer.
+// For an incremental update prev is the offset of the previous cross reference section,
+// a negative prev writes the only section of a complete file.
+func writeXRefSection(ctx *Context, prev int64, xRefStream bool) error {
+
+	w := ctx.Write
+
+	var objNrs []int
+	for objNr := range w.Table {
+		objNrs = append(objNrs, objNr)
+	}
+
+	size := *ctx.Size
+
+	if xRefStream {
+		// The xref stream is an object of this update too.
+		w.SetWriteOffset(size)
+		objNrs = append(objNrs, size)
+		size++
+	}
+
+	sort.Ints(objNrs)
+
+	// Object numbers not written by a full write are free.
+	// They are linked into the free list in ascending order, starting at the head entry 0.
+	nextFree := map[int]int{}
+	if prev < 0 {
+		objNrs = nil
+		last := 0
+		for objNr := 1; objNr < size; objNr++ {
+			if _, written := w.Table[objNr]; !written {
+				nextFree[last] = objNr
+				last = objNr
+			}
+		}
+		nextFree[last] = 0
+		for objNr := 0; objNr < size; objNr++ {
+			objNrs = append(objNrs, objNr)
+		}
+	}
+
+	// Subsections of consecutive object numbers.
+	var index Array
+	for i := 0; i < len(objNrs); {
+		j := i + 1
+		for j < len(objNrs) && objNrs[j] == objNrs[j-1]+1 {
+			j++
+		}
+		index = append(index, Integer(objNrs[i]), Integer(j-i))
+		i = j
+	}
+
+	d := Dict(
+		map[string]Object{
+			"Size": Integer(size),
+			"Root": *ctx.Root,
+		},
+	)
+
+	if prev >= 0 {
+		d["Prev"] = Integer(prev)
+	}
+
+	if ctx.Info != nil {
+		d["Info"] = *ctx.Info
+	}
+
+	if ctx.Encrypt != nil {
+		d["Encrypt"] = *ctx.Encrypt
+	}
+
+	if len(ctx.ID) > 0 {
+		d["ID"] = ctx.ID
+	}
+
+	// Objects are written using the generation number of their entry.
+	// Free entries carry the generation number for the next use of their object number.
+	generation := func(objNr int) int {
+		if objNr == 0 {
+			return 65535
+		}
+		e, found := ctx.Table[objNr]
+		if !found || e.Generation == nil {
+			return 0
+		}
+		if _, written := w.Table[objNr]; written || e.Free || *e.Generation == 65535 {
+			return *e.Generation
+		}
+		return *e.Generation + 1
+	}
+
+	offset := w.Offset
+
+	if xRefStream {
+
+		var b bytes.Buffer
+		for _, objNr := range objNrs {
+			if next, free := nextFree[objNr]; free {
+				b.WriteByte(0)
+				binary.Write(&b, binary.BigEndian, uint32(next))
+			} else {
+				b.WriteByte(1)
+				binary.Write(&b, binary.BigEndian, uint32(w.Table[objNr]))
+			}
+			binary.Write(&b, binary.BigEndian, uint16(generation(objNr)))
+		}
+
+		d.InsertName("Type", "XRef")
+		d.Insert("Index", index)
+		d.Insert("W", NewIntegerArray(1, 4, 2))
+
+		sd := StreamDict{Dict: d, Content: b.Bytes()}
+		if err := encodeStream(&sd); err != nil {
+			return err
+		}
+
+		if err := writeStreamDictObject(ctx, size-1, 0, sd); err != nil {
+			return err
+		}
+
+	} else {
+
+		// Each entry is exactly 20 bytes long.
+		eol := w.Eol
+		if len(eol) == 1 {
+			eol = " " + eol
+		}
+
+		if _, err := w.WriteString("xref" + w.Eol); err != nil {
+			return err
+		}
+
+		for i := 0; i < len(index); i += 2 {
+			first, n := index[i].(Integer).Value(), index[i+1].(Integer).Value()
+			if _, err := w.WriteString(fmt.Sprintf("%d %d%s", first, n, w.Eol)); err != nil {
+				return err
+			}
+			for objNr := first; objNr < first+n; objNr++ {
+				entry := fmt.Sprintf("%010d %05d n", w.Table[objNr], generation(objNr))
+				if next, free := nextFree[objNr]; free {
+					entry = fmt.Sprintf("%010d %05d f", next, generation(objNr))
+				}
+				if _, err := w.WriteString(entry + eol); err != nil {
+					return err
+				}
+			}
+		}
+
+		if _, err := w.WriteString(fmt.Sprintf("trailer%s%s%s", w.Eol, d.PDFString(), w.Eol)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.WriteString(fmt.Sprintf("startxref%s%d%s", w.Eol, offset, w.Eol)); err != nil {
+		return err
+	}
+
+	_, err := writeTrailer(w)
+
+	return err
+}
+
+// writeIncrementalUpdate returns an incremental update of a file of given size containing objNrs.
+func writeIncrementalUpdate(ctx *Context, size, prev int64, objNrs IntSet) ([]byte, error) {
+
+	w := ctx.Write
+	defer func() { ctx.Write = w }()
+
+	var buf bytes.Buffer
+
+	ctx.Write = NewWriteContext(w.Eol)
+	ctx.Write.Writer = bufio.NewWriter(&buf)
+	ctx.Write.Offset = size
+
+	var nrs []int
+	for objNr := range objNrs {
+		nrs = append(nrs, objNr)
+	}
+	sort.Ints(nrs)
+
+	for _, objNr := range nrs {
+
+		entry, found := ctx.FindTableEntryLight(objNr)
+		if !found {
+			return nil, fmt.Errorf("pdfcpu: sign: missing object #%d", objNr)
+		}
+
+		var err error
+
+		switch o := entry.Object.(type) {
+		case Dict:
+			err = writeDictObject(ctx, objNr, *entry.Generation, o)
+		case StreamDict:
+			err = writeStreamDictObject(ctx, objNr, *entry.Generation, o)
+		case Array:
+			err = writeArrayObject(ctx, objNr, *entry.Generation, o)
+		default:
+			err = fmt.Errorf("pdfcpu: sign: unexpected object #%d %T", objNr, o)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeXRefSection(ctx, prev, ctx.Read.UsingXRefStreams && !ctx.Read.Hybrid); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Write.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Sign adds a digital signature to the file read into ctx and writes the signed file to w.
+//
+// The signature field, its widget and the signature dict are appended as an incremental update,
+// so the original revision including any existing signatures remains intact.
+// The signed file needs to be read again for further processing.
+func Sign(ctx *Context, w io.Writer, sc *SignatureConfig) error {
+
+	if err := sc.validate(); err != nil {
+		return err
+	}
+
+	if ctx.Encrypt != nil {
+		return errors.New("pdfcpu: sign: signing encrypted files is not supported")
+	}
+
+	bb, err := fileBytes(ctx)
+	if err != nil {
+		return err
+	}
+
+	prev, err := offsetLastXRefSection(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The update starts on a new line.
+	if !bytes.HasSuffix(bb, []byte("\n")) && !bytes.HasSuffix(bb, []byte("\r")) {
+		bb = append(bb, ctx.Write.Eol...)
+	}
+
+	sigDict := newSignatureDict(sc)
+
+	sigNr, err := ctx.InsertObject(sigDict)
+	if err != nil {
+		return err
+	}
+
+	objNrs := IntSet{sigNr: true}
+
+	if err = addSignatureField(ctx, sc, *NewIndirectRef(sigNr, 0), objNrs); err != nil {
+		return err
+	}
+
+	upd, err := writeIncrementalUpdate(ctx, int64(len(bb)), *prev, objNrs)
+	if err != nil {
+		return err
+	}
+
+	bb = append(bb, upd...)
+
+	return signByteRange(bb, sigDict, w, sc)
+}
+
+// signByteRange fills in ByteRange and Contents of the signature dict in the signed file bb and writes bb to w.
+func signByteRange(bb []byte, sigDict Dict, w io.Writer, sc *SignatureConfig) error {
+
+	contents := sigDict.HexLiteralEntry("Contents").PDFString()
+	br := byteRangePlaceholder.PDFString()
+
+	i := bytes.LastIndex(bb, []byte(contents))
+	j := bytes.LastIndex(bb, []byte(br))
+	if i < 0 || j < 0 {
+		return errors.New("pdfcpu: sign: signature placeholder not found")
+	}
+
+	r := [4]int64{0, int64(i), int64(i + len(contents)), int64(len(bb) - i - len(contents))}
+
+	s := fmt.Sprintf("[%d %d %d %d]", r[0], r[1], r[2], r[3])
+	s = s[:len(s)-1] + strings.Repeat(" ", len(br)-len(s)) + "]"
+	copy(bb[j:], s)
+
+	b, err := signCMS(sc, append(append([]byte(nil), bb[r[0]:r[1]]...), bb[r[2]:]...))
+	if err != nil {
+		return err
+	}
+
+	if len(b) > sc.Size {
+		return fmt.Errorf("pdfcpu: sign: signature needs %d bytes, %d reserved", len(b), sc.Size)
+	}
+
+	copy(bb[i+1:], hex.EncodeToString(b))
+
+	sigDict["ByteRange"] = NewIntegerArray(int(r[0]), int(r[1]), int(r[2]), int(r[3]))
+	sigDict["Contents"] = NewHexLiteral(append(b, make([]byte, sc.Size-len(b))...))
+
+	_, err = w.Write(bb)
+
+	return err
+}
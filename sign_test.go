@@ -0,0 +1,136 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// minimalPDFGen returns minimalPDF using generation 2 for the catalog.
+func minimalPDFGen(t *testing.T) []byte {
+	t.Helper()
+
+	b := minimalPDF()
+
+	for _, r := range [][2]string{
+		{"1 0 obj", "1 2 obj"},
+		{"/Root 1 0 R", "/Root 1 2 R"},
+	} {
+		if !bytes.Contains(b, []byte(r[0])) {
+			t.Fatalf("%q not found", r[0])
+		}
+		b = bytes.Replace(b, []byte(r[0]), []byte(r[1]), 1)
+	}
+
+	// The xref entry of the catalog.
+	i := bytes.Index(b, []byte("00000 n \n"))
+	copy(b[i:], "00002")
+
+	return b
+}
+
+// minimalPDFXRefStream returns the objects of minimalPDFGen using an uncompressed xref stream.
+func minimalPDFXRefStream() []byte {
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+
+	objs := []string{
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]/Resources<<>>>>",
+		"<</Producer(test)>>",
+	}
+
+	var entries bytes.Buffer
+	entries.Write([]byte{0, 0, 0, 0, 0, 0xFF, 0xFF})
+
+	for i, o := range objs {
+		gen := 0
+		if i == 0 {
+			gen = 2
+		}
+		entries.WriteByte(1)
+		binary.Write(&entries, binary.BigEndian, uint32(b.Len()))
+		binary.Write(&entries, binary.BigEndian, uint16(gen))
+		fmt.Fprintf(&b, "%d %d obj\n%s\nendobj\n", i+1, gen, o)
+	}
+
+	xref := b.Len()
+	entries.WriteByte(1)
+	binary.Write(&entries, binary.BigEndian, uint32(xref))
+	entries.Write([]byte{0, 0})
+
+	fmt.Fprintf(&b, "5 0 obj\n<</Type/XRef/Size 6/W[1 4 2]/Root 1 2 R/Info 4 0 R/ID[<0123456789abcdef><0123456789abcdef>]/Length %d>>\nstream\n", entries.Len())
+	b.Write(entries.Bytes())
+	fmt.Fprintf(&b, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	return b.Bytes()
+}
+
+func TestSign(t *testing.T) {
+
+	now := time.Now()
+
+	cert, key := testSigner(t, "signer", now.Add(-time.Hour), now.Add(time.Hour))
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	for _, tt := range []struct {
+		name string
+		in   []byte
+	}{
+		// Smaller than the buffer used to locate the last xref section.
+		{"xref table", minimalPDF()},
+		{"xref table, generation 2", minimalPDFGen(t)},
+		{"xref stream, generation 2", minimalPDFXRefStream()},
+	} {
+		signed := signPDF(t, tt.in, &SignatureConfig{Key: key, Chain: []*x509.Certificate{cert}, Reason: tt.name})
+
+		ctx, err := Read(bytes.NewReader(signed), NewDefaultConfiguration())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		d, err := ctx.Catalog()
+		if err != nil || d == nil {
+			t.Fatalf("%s: catalog: %v", tt.name, err)
+		}
+		if _, found := d.Find("AcroForm"); !found {
+			t.Errorf("%s: AcroForm missing", tt.name)
+		}
+
+		ss, err := VerifySignatures(ctx, roots)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if len(ss) != 1 {
+			t.Fatalf("%s: got %d signatures, want 1", tt.name, len(ss))
+		}
+
+		si := ss[0]
+		if !si.Valid || !si.Trusted || !si.CoversWholeFile || si.Reason != tt.name || len(si.Problems) > 0 {
+			t.Errorf("%s: got\n%s", tt.name, si)
+		}
+	}
+}
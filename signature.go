@@ -0,0 +1,783 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+// Functions dealing with digital signatures (see 12.8).
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidRSASSAPSS     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidTimeStamp     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+
+	digestAlgorithms = map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+)
+
+// CMS structures (RFC 5652) needed for signature verification.
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+type cmsEncapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"optional,explicit,tag:0"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	Sid                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// Time-stamp token info (RFC 3161) up to the time of creation, the remaining fields are not needed.
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint tstMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+type tstMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// SignatureInfo represents the result of verifying a signature field.
+type SignatureInfo struct {
+	Field       string            `json:"field"`     // Fully qualified field name.
+	SubFilter   string            `json:"subFilter"` // adbe.pkcs7.detached or ETSI.CAdES.detached
+	Signer      string            `json:"signer"`    // Subject of the signer certificate.
+	Certificate *x509.Certificate `json:"-"`
+	SigningTime time.Time         `json:"signingTime"` // Signed signing time, or else M of the signature dict.
+	Timestamp   time.Time         `json:"timestamp"`   // Time of a validated signature time-stamp token.
+	Reason      string            `json:"reason,omitempty"`
+	Location    string            `json:"location,omitempty"`
+	ByteRange   [4]int64          `json:"byteRange"`
+
+	// CoversWholeFile is true if ByteRange covers the file except the Contents hole.
+	// It is false for a signature followed by incremental updates.
+	CoversWholeFile bool `json:"coversWholeFile"`
+
+	// Revisions is the number of incremental updates appended after signing.
+	Revisions int `json:"revisions"`
+
+	Valid    bool     `json:"valid"`   // Digest and signature value check out.
+	Trusted  bool     `json:"trusted"` // The signer certificate chains up to the trust pool.
+	Problems []string `json:"problems,omitempty"`
+}
+
+func (si SignatureInfo) String() string {
+
+	ss := []string{
+		fmt.Sprintf("%s: %s", si.Field, si.SubFilter),
+		fmt.Sprintf("  signer:   %s", si.Signer),
+		fmt.Sprintf("  signed:   %s", si.SigningTime),
+	}
+
+	if !si.Timestamp.IsZero() {
+		ss = append(ss, fmt.Sprintf("  stamped:  %s", si.Timestamp))
+	}
+
+	ss = append(ss,
+		fmt.Sprintf("  valid:    %t", si.Valid),
+		fmt.Sprintf("  trusted:  %t", si.Trusted),
+		fmt.Sprintf("  coverage: whole file: %t, revisions after signing: %d", si.CoversWholeFile, si.Revisions),
+	)
+
+	for _, p := range si.Problems {
+		ss = append(ss, "  problem:  "+p)
+	}
+
+	return strings.Join(ss, "\n")
+}
+
+// fileBytes returns the content of the file read into ctx.
+func fileBytes(ctx *Context) ([]byte, error) {
+
+	if ctx.Read == nil || ctx.Read.rs == nil {
+		return nil, errors.New("pdfcpu: missing read context")
+	}
+
+	rs := ctx.Read.rs
+
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(rs)
+}
+
+type sigField struct {
+	name string
+	d    Dict // signature dict
+}
+
+// signatureFields returns all signed signature fields of the AcroForm field tree.
+func signatureFields(xRefTable *XRefTable) ([]sigField, error) {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	o, found := rootDict.Find("AcroForm")
+	if !found {
+		return nil, nil
+	}
+
+	d, err := xRefTable.DereferenceDict(o)
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	fields, err := xRefTable.DereferenceArray(d["Fields"])
+	if err != nil {
+		return nil, err
+	}
+
+	var ff []sigField
+	visited := IntSet{}
+
+	var collect func(a Array, prefix, ft string) error
+
+	collect = func(a Array, prefix, ft string) error {
+
+		for _, o := range a {
+
+			if ir, ok := o.(IndirectRef); ok {
+				if visited[ir.ObjectNumber.Value()] {
+					continue
+				}
+				visited[ir.ObjectNumber.Value()] = true
+			}
+
+			d, err := xRefTable.DereferenceDict(o)
+			if err != nil {
+				return err
+			}
+			if d == nil {
+				continue
+			}
+
+			name := prefix
+			if t, found := d.Find("T"); found {
+				s, err := xRefTable.DereferenceText(t)
+				if err != nil {
+					return err
+				}
+				if name != "" {
+					name += "."
+				}
+				name += s
+			}
+
+			// FT is inheritable.
+			ft1 := ft
+			if n := d.NameEntry("FT"); n != nil {
+				ft1 = *n
+			}
+
+			if kids, found := d.Find("Kids"); found {
+				a, err := xRefTable.DereferenceArray(kids)
+				if err != nil {
+					return err
+				}
+				if err = collect(a, name, ft1); err != nil {
+					return err
+				}
+			}
+
+			if ft1 != "Sig" {
+				continue
+			}
+
+			v, found := d.Find("V")
+			if !found {
+				// Unsigned signature field.
+				continue
+			}
+
+			sd, err := xRefTable.DereferenceDict(v)
+			if err != nil {
+				return err
+			}
+			if sd != nil {
+				ff = append(ff, sigField{name: name, d: sd})
+			}
+		}
+
+		return nil
+	}
+
+	if err = collect(fields, "", ""); err != nil {
+		return nil, err
+	}
+
+	return ff, nil
+}
+
+func byteRange(xRefTable *XRefTable, d Dict, size int64) ([4]int64, error) {
+
+	var br [4]int64
+
+	a, err := xRefTable.DereferenceArray(d["ByteRange"])
+	if err != nil {
+		return br, err
+	}
+
+	if len(a) != 4 {
+		return br, errors.New("pdfcpu: signature: \"ByteRange\" must have 4 elements")
+	}
+
+	for i, o := range a {
+		n, err := xRefTable.DereferenceInteger(o)
+		if err != nil || n == nil {
+			return br, errors.New("pdfcpu: signature: corrupt \"ByteRange\"")
+		}
+		br[i] = int64(*n)
+	}
+
+	// The signed bytes start at the beginning of the file and leave out the Contents hole only.
+	if br[0] != 0 {
+		return br, errors.New("pdfcpu: signature: \"ByteRange\" does not start at the beginning of the file")
+	}
+
+	if br[1] < 0 || br[2] < br[1] || br[3] < 0 || br[2]+br[3] > size {
+		return br, errors.New("pdfcpu: signature: \"ByteRange\" out of bounds")
+	}
+
+	return br, nil
+}
+
+// signatureContents returns the CMS object stored in the hole of the byte range.
+// The hole must consist of a hex string decoding to contents, the value of the Contents entry,
+// unless contents is nil. The raw file bytes are used since Contents never gets encrypted.
+func signatureContents(bb []byte, br [4]int64, contents []byte) ([]byte, error) {
+
+	hole := bb[br[1]:br[2]]
+
+	if len(hole) < 2 || hole[0] != '<' || hole[len(hole)-1] != '>' || len(hole)%2 > 0 {
+		return nil, errors.New("pdfcpu: signature: \"ByteRange\" hole does not match \"Contents\"")
+	}
+
+	b := make([]byte, (len(hole)-2)/2)
+	if _, err := hex.Decode(b, hole[1:len(hole)-1]); err != nil {
+		return nil, errors.New("pdfcpu: signature: \"ByteRange\" hole does not match \"Contents\"")
+	}
+
+	// Both are zero padded up to the reserved size.
+	if contents != nil && !bytes.Equal(bytes.TrimRight(b, "\x00"), bytes.TrimRight(contents, "\x00")) {
+		return nil, errors.New("pdfcpu: signature: \"ByteRange\" hole does not match \"Contents\"")
+	}
+
+	// Strip zero padding by parsing the first element only.
+	var out bytes.Buffer
+	n, err := berElement(b, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimRight(b[n:], "\x00")) > 0 {
+		return nil, errors.New("pdfcpu: signature: \"Contents\" has trailing data")
+	}
+
+	return out.Bytes(), nil
+}
+
+var reXRefStreamObj = regexp.MustCompile(`^\d+\s+\d+\s+obj\s*<<`)
+
+// isXRefSection returns true if b starts with a cross reference table or stream.
+func isXRefSection(b []byte) bool {
+
+	if bytes.HasPrefix(b, []byte("xref")) {
+		return true
+	}
+
+	if !reXRefStreamObj.Match(b) {
+		return false
+	}
+
+	i := bytes.Index(b, []byte("stream"))
+	if i < 0 {
+		return false
+	}
+
+	return bytes.Contains(b[:i], []byte("/XRef"))
+}
+
+// revisionsAfter returns the number of incremental updates following offset.
+// An incremental update ends with startxref pointing to its own cross reference section followed by %%EOF.
+// junk is true if anything else got appended.
+func revisionsAfter(bb []byte, offset int64) (n int, junk bool) {
+
+	marker := []byte("startxref")
+
+	for off := offset; ; {
+
+		rest := bb[off:]
+
+		i := bytes.Index(rest, marker)
+		if i < 0 {
+			return n, junk || len(bytes.TrimSpace(rest)) > 0
+		}
+
+		fields := bytes.Fields(rest[i+len(marker):])
+		if len(fields) < 2 || !bytes.HasPrefix(fields[1], []byte("%%EOF")) {
+			return n, true
+		}
+
+		x, err := strconv.ParseInt(string(fields[0]), 10, 64)
+		if err != nil || x < off || x >= off+int64(i) || !isXRefSection(bb[x:]) {
+			junk = true
+		} else {
+			n++
+		}
+
+		off += int64(i + len(marker))
+		off += int64(bytes.Index(bb[off:], []byte("%%EOF")) + len("%%EOF"))
+	}
+}
+
+func signerCertificate(si cmsSignerInfo, certs []*x509.Certificate) *x509.Certificate {
+	for _, c := range certs {
+		if matchesCertificate(si.Sid, c) {
+			return c
+		}
+	}
+	return nil
+}
+
+func verifySignatureValue(cert *x509.Certificate, sigAlg asn1.ObjectIdentifier, h crypto.Hash, signed, sig []byte) error {
+
+	hh := h.New()
+	hh.Write(signed)
+	hashed := hh.Sum(nil)
+
+	switch pub := cert.PublicKey.(type) {
+
+	case *rsa.PublicKey:
+		if sigAlg.Equal(oidRSASSAPSS) {
+			return rsa.VerifyPSS(pub, h, hashed, sig, nil)
+		}
+		return rsa.VerifyPKCS1v15(pub, h, hashed, sig)
+
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, hashed, sig) {
+			return errors.New("pdfcpu: signature: ECDSA verification failed")
+		}
+		return nil
+
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, signed, sig) {
+			return errors.New("pdfcpu: signature: Ed25519 verification failed")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("pdfcpu: signature: unsupported public key type %T", cert.PublicKey)
+}
+
+// parseSignedData returns the CMS signed data in b, its certificates, its only signer info and the signer certificate.
+func parseSignedData(b []byte) (*cmsSignedData, []*x509.Certificate, *cmsSignerInfo, *x509.Certificate, error) {
+
+	var ci cmsContentInfo
+	if _, err := asn1.Unmarshal(b, &ci); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, nil, nil, nil, errors.New("pdfcpu: signature: not CMS signed data")
+	}
+
+	var sd cmsSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return nil, nil, nil, nil, fmt.Errorf("pdfcpu: signature: expected 1 signer, got %d", len(sd.SignerInfos))
+	}
+
+	var sinf cmsSignerInfo
+	if _, err := asn1.Unmarshal(sd.SignerInfos[0].FullBytes, &sinf); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	cert := signerCertificate(sinf, certs)
+	if cert == nil {
+		return nil, nil, nil, nil, errors.New("pdfcpu: signature: signer certificate missing")
+	}
+
+	return &sd, certs, &sinf, cert, nil
+}
+
+// verifySignerInfo verifies the signature of sinf over content using cert.
+// The signing time is returned if it is part of the signed attributes.
+func verifySignerInfo(sinf *cmsSignerInfo, cert *x509.Certificate, content []byte) (time.Time, error) {
+
+	var signingTime time.Time
+
+	h, ok := digestAlgorithms[sinf.DigestAlgorithm.Algorithm.String()]
+	if !ok || !h.Available() {
+		return signingTime, fmt.Errorf("pdfcpu: signature: unsupported digest algorithm %s", sinf.DigestAlgorithm.Algorithm)
+	}
+
+	hh := h.New()
+	hh.Write(content)
+	digest := hh.Sum(nil)
+
+	signed := content
+
+	if len(sinf.SignedAttrs.FullBytes) > 0 {
+
+		// The signature covers the DER encoding of the signed attributes as SET OF.
+		signed = append([]byte{0x31}, sinf.SignedAttrs.FullBytes[1:]...)
+
+		var md []byte
+
+		for rest := sinf.SignedAttrs.Bytes; len(rest) > 0; {
+
+			var attr cmsAttribute
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+				return signingTime, err
+			}
+
+			switch {
+
+			case attr.Type.Equal(oidMessageDigest):
+				if _, err = asn1.Unmarshal(attr.Values.Bytes, &md); err != nil {
+					return signingTime, err
+				}
+
+			case attr.Type.Equal(oidSigningTime):
+				var t time.Time
+				if _, err = asn1.Unmarshal(attr.Values.Bytes, &t); err == nil {
+					signingTime = t
+				}
+			}
+		}
+
+		if !bytes.Equal(md, digest) {
+			return signingTime, errors.New("pdfcpu: signature: message digest mismatch, the signed content has been modified")
+		}
+	}
+
+	return signingTime, verifySignatureValue(cert, sinf.SignatureAlgorithm.Algorithm, h, signed, sinf.Signature)
+}
+
+// timestampToken returns the signature time-stamp token (RFC 3161) found in the unsigned attributes of sinf.
+func timestampToken(sinf *cmsSignerInfo) ([]byte, error) {
+
+	for rest := sinf.UnsignedAttrs.Bytes; len(rest) > 0; {
+
+		var attr cmsAttribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, err
+		}
+
+		if attr.Type.Equal(oidTimeStamp) {
+			var rv asn1.RawValue
+			if _, err = asn1.Unmarshal(attr.Values.Bytes, &rv); err != nil {
+				return nil, err
+			}
+			return rv.FullBytes, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// verifyTimestamp verifies the time-stamp token b for the signature value sig and returns the time of its creation.
+// The time-stamping authority needs to chain up to roots.
+func verifyTimestamp(b, sig []byte, roots *x509.CertPool) (time.Time, error) {
+
+	var t time.Time
+
+	sd, certs, sinf, cert, err := parseSignedData(b)
+	if err != nil {
+		return t, err
+	}
+
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return t, errors.New("pdfcpu: signature: time-stamp token does not contain TSTInfo")
+	}
+
+	var content []byte
+	if _, err = asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &content); err != nil {
+		return t, err
+	}
+
+	if _, err = verifySignerInfo(sinf, cert, content); err != nil {
+		return t, err
+	}
+
+	var info tstInfo
+	if _, err = asn1.Unmarshal(content, &info); err != nil {
+		return t, err
+	}
+
+	h, ok := digestAlgorithms[info.MessageImprint.HashAlgorithm.Algorithm.String()]
+	if !ok || !h.Available() {
+		return t, fmt.Errorf("pdfcpu: signature: unsupported time-stamp digest algorithm %s", info.MessageImprint.HashAlgorithm.Algorithm)
+	}
+
+	hh := h.New()
+	hh.Write(sig)
+	if !bytes.Equal(hh.Sum(nil), info.MessageImprint.HashedMessage) {
+		return t, errors.New("pdfcpu: signature: time-stamp token does not match the signature")
+	}
+
+	// RFC 3161 2.3: The TSA certificate must be restricted to time-stamping.
+	// x509 would accept certificates without extended key usage for any usage.
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping {
+		return t, errors.New("pdfcpu: signature: time-stamp: certificate not restricted to time-stamping")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+
+	if _, err = cert.Verify(opts); err != nil {
+		return t, fmt.Errorf("pdfcpu: signature: time-stamp: %v", err)
+	}
+
+	return info.GenTime, nil
+}
+
+// verifyCMS verifies the detached CMS signed data b for content and fills in si.
+func verifyCMS(b, content []byte, roots *x509.CertPool, si *SignatureInfo) error {
+
+	_, certs, sinf, cert, err := parseSignedData(b)
+	if err != nil {
+		return err
+	}
+	si.Certificate = cert
+	si.Signer = cert.Subject.String()
+
+	signingTime, err := verifySignerInfo(sinf, cert, content)
+	if err != nil {
+		return err
+	}
+	if !signingTime.IsZero() {
+		si.SigningTime = signingTime
+	}
+
+	si.Valid = true
+
+	if roots == nil {
+		si.Problems = append(si.Problems, "no trust pool supplied")
+		return nil
+	}
+
+	ts, err := timestampToken(sinf)
+	if err == nil && ts != nil {
+		si.Timestamp, err = verifyTimestamp(ts, sinf.Signature, roots)
+	}
+	if err != nil {
+		si.Problems = append(si.Problems, err.Error())
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+
+	// The claimed signing time is not trustworthy, only a validated time-stamp is.
+	// Without one the certificate needs to be valid now.
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   si.Timestamp,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	if _, err = cert.Verify(opts); err != nil {
+		si.Problems = append(si.Problems, err.Error())
+		return nil
+	}
+
+	si.Trusted = true
+
+	return nil
+}
+
+func verifySignature(xRefTable *XRefTable, bb []byte, f sigField, roots *x509.CertPool) SignatureInfo {
+
+	si := SignatureInfo{Field: f.name}
+	d := f.d
+
+	if n := d.NameEntry("SubFilter"); n != nil {
+		si.SubFilter = *n
+	}
+
+	if o, found := d.Find("Reason"); found {
+		si.Reason, _ = xRefTable.DereferenceText(o)
+	}
+
+	if o, found := d.Find("Location"); found {
+		si.Location, _ = xRefTable.DereferenceText(o)
+	}
+
+	if o, found := d.Find("M"); found {
+		if s, err := xRefTable.DereferenceText(o); err == nil {
+			si.SigningTime, _ = DateTime(s)
+		}
+	}
+
+	problem := func(err error) SignatureInfo {
+		si.Problems = append(si.Problems, err.Error())
+		return si
+	}
+
+	if si.SubFilter != "adbe.pkcs7.detached" && si.SubFilter != "ETSI.CAdES.detached" {
+		return problem(fmt.Errorf("pdfcpu: signature: unsupported SubFilter \"%s\"", si.SubFilter))
+	}
+
+	br, err := byteRange(xRefTable, d, int64(len(bb)))
+	if err != nil {
+		return problem(err)
+	}
+	si.ByteRange = br
+
+	end := br[2] + br[3]
+	si.CoversWholeFile = end == int64(len(bb))
+
+	var junk bool
+	si.Revisions, junk = revisionsAfter(bb, end)
+
+	if si.Revisions > 0 {
+		si.Problems = append(si.Problems, fmt.Sprintf("file modified after signing: %d incremental update(s)", si.Revisions))
+	}
+
+	if junk {
+		si.Problems = append(si.Problems, "file modified after signing: unsigned data that is not an incremental update")
+	}
+
+	// Strings of encrypted files get decrypted on read, so the raw Contents cannot be compared.
+	var contents []byte
+	if xRefTable.EncKey == nil {
+		o, err := xRefTable.Dereference(d["Contents"])
+		if err != nil {
+			return problem(err)
+		}
+		if contents, err = stringBytes(o); err != nil {
+			return problem(errors.New("pdfcpu: signature: \"Contents\" must be a string"))
+		}
+		if contents == nil {
+			contents = []byte{}
+		}
+	}
+
+	cms, err := signatureContents(bb, br, contents)
+	if err != nil {
+		return problem(err)
+	}
+
+	content := append(append([]byte{}, bb[:br[1]]...), bb[br[2]:end]...)
+
+	if err = verifyCMS(cms, content, roots, &si); err != nil {
+		return problem(err)
+	}
+
+	return si
+}
+
+// VerifySignatures verifies all signed signature fields of ctx.
+// Signer certificates are validated against roots.
+func VerifySignatures(ctx *Context, roots *x509.CertPool) ([]SignatureInfo, error) {
+
+	ff, err := signatureFields(ctx.XRefTable)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ff) == 0 {
+		return nil, nil
+	}
+
+	bb, err := fileBytes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := []SignatureInfo{}
+
+	for _, f := range ff {
+		ss = append(ss, verifySignature(ctx.XRefTable, bb, f, roots))
+	}
+
+	return ss, nil
+}
@@ -0,0 +1,555 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSigner returns a self-signed ECDSA certificate valid from notBefore to notAfter and its private key.
+func testSigner(t *testing.T, cn string, notBefore, notAfter time.Time, eku ...x509.ExtKeyUsage) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  eku,
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+// signPDF signs in using sc.
+func signPDF(t *testing.T, in []byte, sc *SignatureConfig) []byte {
+	t.Helper()
+
+	ctx, err := Read(bytes.NewReader(in), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err = Sign(ctx, &b, sc); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func verifyPDF(t *testing.T, in []byte, roots *x509.CertPool) []SignatureInfo {
+	t.Helper()
+
+	ctx, err := Read(bytes.NewReader(in), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := VerifySignatures(ctx, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ss
+}
+
+// signatureHole returns the offsets of the Contents hole of the last signature in bb.
+func signatureHole(t *testing.T, bb []byte) (int, int) {
+	t.Helper()
+
+	i := bytes.LastIndex(bb, []byte("/Contents<"))
+	if i < 0 {
+		t.Fatal("signature hole not found")
+	}
+	i += len("/Contents")
+
+	return i, i + bytes.IndexByte(bb[i:], '>') + 1
+}
+
+// replaceByteRange rewrites the ByteRange of the last signature in bb keeping the file size.
+func replaceByteRange(t *testing.T, bb []byte, f func(br [4]int64) [4]int64) []byte {
+	t.Helper()
+
+	i := bytes.LastIndex(bb, []byte("/ByteRange["))
+	if i < 0 {
+		t.Fatal("ByteRange not found")
+	}
+	i += len("/ByteRange")
+	j := i + bytes.IndexByte(bb[i:], ']') + 1
+
+	var br [4]int64
+	if _, err := fmt.Sscanf(string(bb[i:j]), "[%d %d %d %d", &br[0], &br[1], &br[2], &br[3]); err != nil {
+		t.Fatal(err)
+	}
+
+	br = f(br)
+	s := fmt.Sprintf("[%d %d %d %d", br[0], br[1], br[2], br[3])
+	s += strings.Repeat(" ", j-i-len(s)-1) + "]"
+
+	bb = append([]byte(nil), bb...)
+	copy(bb[i:j], s)
+
+	return bb
+}
+
+// appendSignatureDict appends an incremental update to bb replacing the last signature dict by one using contents.
+func appendSignatureDict(t *testing.T, bb, contents []byte) []byte {
+	t.Helper()
+
+	ctx, err := Read(bytes.NewReader(bb), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev, err := offsetLastXRefSection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objNr := -1
+	for k, e := range ctx.Table {
+		if d, ok := e.Object.(Dict); ok && d.Type() != nil && *d.Type() == "Sig" {
+			objNr = k
+		}
+	}
+
+	i := bytes.LastIndex(bb, []byte("/ByteRange["))
+	br := bb[i+len("/ByteRange") : i+bytes.IndexByte(bb[i:], ']')+1]
+
+	var b bytes.Buffer
+	b.Write(bb)
+
+	off := b.Len()
+	fmt.Fprintf(&b, "%d 0 obj\n<</Type/Sig/Filter/Adobe.PPKLite/SubFilter/ETSI.CAdES.detached/ByteRange%s/Contents<%x>>>\nendobj\n", objNr, br, contents)
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 1\n0000000000 65535 f \n%d 1\n%010d 00000 n \n", objNr, off)
+	fmt.Fprintf(&b, "trailer\n<</Size %d/Root 1 0 R/Prev %d>>\nstartxref\n%d\n%%%%EOF\n", *ctx.Size, *prev, xref)
+
+	return b.Bytes()
+}
+
+// newTimestampToken returns a time-stamp token for the signature value sig issued by cert at genTime.
+func newTimestampToken(t *testing.T, sig []byte, cert *x509.Certificate, key *ecdsa.PrivateKey, genTime time.Time) []byte {
+	t.Helper()
+
+	imprint := sha256.Sum256(sig)
+
+	content, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: tstMessageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, HashedMessage: imprint[:]},
+		SerialNumber:   big.NewInt(1),
+		GenTime:        genTime.UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256(content)
+
+	ct, err := cmsAttributeBytes(oidContentType, oidTSTInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := cmsAttributeBytes(oidMessageDigest, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := append(ct, md...)
+
+	signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(signed)
+	signature, err := key.Sign(rand.Reader, h[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sid, err := asn1.Marshal(cmsIssuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	si, err := asn1.Marshal(cmsSignerInfo{
+		Version:            1,
+		Sid:                asn1.RawValue{FullBytes: sid},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+		Signature:          signature,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eContent, err := asn1.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := asn1.Marshal(cmsSignedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: cmsEncapContentInfo{EContentType: oidTSTInfo, EContent: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: eContent}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos:      []asn1.RawValue{{FullBytes: si}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// addTimestamp adds a time-stamp token issued at genTime to the last signature of bb.
+// The Contents hole is not part of the signed bytes, so the signature remains valid.
+func addTimestamp(t *testing.T, bb []byte, cert *x509.Certificate, key *ecdsa.PrivateKey, genTime time.Time) []byte {
+	t.Helper()
+
+	i, j := signatureHole(t, bb)
+
+	b, err := hex.DecodeString(string(bb[i+1 : j-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ci cmsContentInfo
+	if _, err = asn1.Unmarshal(b, &ci); err != nil {
+		t.Fatal(err)
+	}
+	var sd cmsSignedData
+	if _, err = asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	var sinf cmsSignerInfo
+	if _, err = asn1.Unmarshal(sd.SignerInfos[0].FullBytes, &sinf); err != nil {
+		t.Fatal(err)
+	}
+
+	attr, err := cmsAttributeBytes(oidTimeStamp, asn1.RawValue{FullBytes: newTimestampToken(t, sinf.Signature, cert, key, genTime)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sinf.UnsignedAttrs = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: attr}
+
+	if sd.SignerInfos[0].FullBytes, err = asn1.Marshal(sinf); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = asn1.Marshal(sd); err != nil {
+		t.Fatal(err)
+	}
+	ci.Content = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}
+	if b, err = asn1.Marshal(ci); err != nil {
+		t.Fatal(err)
+	}
+
+	s := hex.EncodeToString(b)
+	if len(s) > j-i-2 {
+		t.Fatal("time-stamp token does not fit into signature hole")
+	}
+
+	bb = append([]byte(nil), bb...)
+	copy(bb[i+1:], s+strings.Repeat("0", j-i-2-len(s)))
+
+	return bb
+}
+
+func TestVerifySignatures(t *testing.T) {
+
+	now := time.Now()
+
+	cert, key := testSigner(t, "signer", now.Add(-time.Hour), now.Add(time.Hour))
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	sc := func() *SignatureConfig {
+		return &SignatureConfig{Key: key, Chain: []*x509.Certificate{cert}, Reason: "test"}
+	}
+
+	signed := signPDF(t, minimalPDF(), sc())
+	other := signPDF(t, minimalPDF(), &SignatureConfig{Key: key, Chain: []*x509.Certificate{cert}, Reason: "other"})
+
+	i, j := signatureHole(t, other)
+	otherContents, err := hex.DecodeString(string(other[i+1 : j-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		in        []byte
+		valid     bool
+		revisions int
+		problem   string
+	}{
+		{"signed", signed, true, 0, ""},
+		{"modified byte", bytes.Replace(signed, []byte("/Producer(test)"), []byte("/Producer(tesT)"), 1), false, 0, "message digest mismatch"},
+		{"ByteRange not starting at 0", replaceByteRange(t, signed, func(br [4]int64) [4]int64 {
+			br[0]++
+			br[1]--
+			return br
+		}), false, 0, "does not start at the beginning"},
+		{"ByteRange with gap", replaceByteRange(t, signed, func(br [4]int64) [4]int64 {
+			br[1] -= 10
+			return br
+		}), false, 0, "hole does not match"},
+		{"swapped Contents", appendSignatureDict(t, signed, otherContents), false, 1, "hole does not match"},
+		{"trailing junk", append(append([]byte(nil), signed...), "junk\n%%EOF\n"...), true, 0, "not an incremental update"},
+		{"signed twice", signPDF(t, signed, sc()), true, 1, "1 incremental update"},
+	} {
+		ss := verifyPDF(t, tt.in, roots)
+		if len(ss) == 0 {
+			t.Errorf("%s: no signatures found", tt.name)
+			continue
+		}
+
+		si := ss[0]
+
+		if si.Valid != tt.valid || si.Revisions != tt.revisions {
+			t.Errorf("%s: got valid=%t revisions=%d, want %t %d\n%s", tt.name, si.Valid, si.Revisions, tt.valid, tt.revisions, si)
+		}
+
+		if tt.problem == "" {
+			if !si.Trusted || !si.CoversWholeFile || len(si.Problems) > 0 {
+				t.Errorf("%s: got\n%s", tt.name, si)
+			}
+			continue
+		}
+
+		if !strings.Contains(strings.Join(si.Problems, "\n"), tt.problem) {
+			t.Errorf("%s: got problems %v, want %q", tt.name, si.Problems, tt.problem)
+		}
+	}
+}
+
+func TestVerifySignatureTimestamp(t *testing.T) {
+
+	now := time.Now()
+	signingTime := now.Add(-48 * time.Hour)
+
+	// The signer certificate expired after signing.
+	cert, key := testSigner(t, "signer", now.Add(-72*time.Hour), now.Add(-24*time.Hour))
+	tsa, tsaKey := testSigner(t, "tsa", now.Add(-72*time.Hour), now.Add(time.Hour), x509.ExtKeyUsageTimeStamping)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	roots.AddCert(tsa)
+
+	signed := signPDF(t, minimalPDF(), &SignatureConfig{Key: key, Chain: []*x509.Certificate{cert}, SigningTime: signingTime})
+
+	for _, tt := range []struct {
+		name      string
+		in        []byte
+		timestamp time.Time
+		trusted   bool
+	}{
+		// The claimed signing time does not count.
+		{"no time-stamp", signed, time.Time{}, false},
+		{"time-stamp", addTimestamp(t, signed, tsa, tsaKey, signingTime), signingTime, true},
+		{"late time-stamp", addTimestamp(t, signed, tsa, tsaKey, now), now, false},
+		{"untrusted time-stamp", addTimestamp(t, signed, cert, key, signingTime), time.Time{}, false},
+	} {
+		ss := verifyPDF(t, tt.in, roots)
+		if len(ss) != 1 {
+			t.Fatalf("%s: got %d signatures, want 1", tt.name, len(ss))
+		}
+
+		si := ss[0]
+
+		if !si.Valid || si.Trusted != tt.trusted || !si.Timestamp.Equal(tt.timestamp.Truncate(time.Second)) {
+			t.Errorf("%s: got valid=%t trusted=%t timestamp=%s, want trusted=%t timestamp=%s\n%s",
+				tt.name, si.Valid, si.Trusted, si.Timestamp, tt.trusted, tt.timestamp, si)
+		}
+	}
+}
+
+func TestByteRange(t *testing.T) {
+
+	for _, tt := range []struct {
+		br   Array
+		size int64
+		ok   bool
+	}{
+		{Array{Integer(0), Integer(10), Integer(20), Integer(5)}, 25, true},
+		{Array{Integer(0), Integer(10), Integer(20), Integer(5)}, 24, false},
+		{Array{Integer(1), Integer(10), Integer(20), Integer(5)}, 25, false},
+		{Array{Integer(0), Integer(10), Integer(5), Integer(5)}, 25, false},
+		{Array{Integer(0), Integer(-1), Integer(20), Integer(5)}, 25, false},
+		{Array{Integer(0), Integer(10), Integer(20)}, 25, false},
+		{Array{Integer(0), Integer(10), Integer(20), Name("5")}, 25, false},
+	} {
+		d := Dict(map[string]Object{"ByteRange": tt.br})
+		_, err := byteRange(&XRefTable{}, d, tt.size)
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("%s: got %v, want ok=%t", tt.br, err, tt.ok)
+		}
+	}
+}
+
+func TestSignatureContents(t *testing.T) {
+
+	cms, err := asn1.Marshal([]int{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded := append(append([]byte(nil), cms...), 0, 0, 0, 0)
+
+	for _, tt := range []struct {
+		name     string
+		hole     string
+		contents []byte
+		ok       bool
+	}{
+		{"padded", "<" + hex.EncodeToString(padded) + ">", cms, true},
+		{"no contents", "<" + hex.EncodeToString(padded) + ">", nil, true},
+		{"other contents", "<" + hex.EncodeToString(padded) + ">", []byte{0x30, 0}, false},
+		{"no hex string", "(" + hex.EncodeToString(padded) + ")", nil, false},
+		{"odd length", "<" + hex.EncodeToString(padded) + "0>", nil, false},
+		{"no hex digits", "<" + strings.Repeat("x", 2*len(padded)) + ">", nil, false},
+		{"trailing data", "<" + hex.EncodeToString(append(cms, 1, 0)) + ">", nil, false},
+	} {
+		bb := []byte("head" + tt.hole + "tail")
+		br := [4]int64{0, 4, int64(4 + len(tt.hole)), 4}
+
+		b, err := signatureContents(bb, br, tt.contents)
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("%s: got %v, want ok=%t", tt.name, err, tt.ok)
+			continue
+		}
+		if tt.ok && !bytes.Equal(b, cms) {
+			t.Errorf("%s: got %x, want %x", tt.name, b, cms)
+		}
+	}
+}
+
+func TestRevisionsAfter(t *testing.T) {
+
+	signed := "%PDF-1.7\n1 0 obj\n<<>>\nendobj\nxref\n0 1\n0000000000 65535 f \ntrailer\n<<>>\nstartxref\n23\n%%EOF\n"
+	end := int64(len(signed))
+
+	// update appends an incremental update whose startxref points to its xref table or stream.
+	update := func(s string, stream bool) string {
+		off := len(s) + len("2 0 obj\n<<>>\nendobj\n")
+		if stream {
+			return s + fmt.Sprintf("2 0 obj\n<<>>\nendobj\n3 0 obj\n<</Type/XRef>>stream\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", off)
+		}
+		return s + fmt.Sprintf("2 0 obj\n<<>>\nendobj\nxref\n0 1\n0000000000 65535 f \ntrailer\n<<>>\nstartxref\n%d\n%%%%EOF\n", off)
+	}
+
+	for _, tt := range []struct {
+		name string
+		bb   string
+		n    int
+		junk bool
+	}{
+		{"unchanged", signed, 0, false},
+		{"trailing whitespace", signed + "\r\n", 0, false},
+		{"xref table", update(signed, false), 1, false},
+		{"xref stream", update(signed, true), 1, false},
+		{"two updates", update(update(signed, false), true), 2, false},
+		{"trailing junk", signed + "junk", 0, true},
+		{"update and junk", update(signed, false) + "junk", 1, true},
+		{"startxref into signed part", signed + "startxref\n23\n%%EOF\n", 0, true},
+		{"no EOF", signed + "startxref\n23\n", 0, true},
+	} {
+		n, junk := revisionsAfter([]byte(tt.bb), end)
+		if n != tt.n || junk != tt.junk {
+			t.Errorf("%s: got %d %t, want %d %t", tt.name, n, junk, tt.n, tt.junk)
+		}
+	}
+}
+
+func TestVerifySignatureFields(t *testing.T) {
+
+	bb := testPDF([]string{
+		"<</Type/Catalog/Pages 2 0 R/AcroForm<</Fields[5 0 R 6 0 R]>>>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]/Resources<<>>>>",
+		"<</Producer(test)>>",
+		"<</FT/Sig/T(unsigned)>>",
+		"<</FT/Sig/T(parent)/Kids[7 0 R 8 0 R]>>",
+		"<</T(forged)/V<</Type/Sig/SubFilter/adbe.pkcs7.detached/ByteRange[1 2 3 4]/Contents<00>>>>>",
+		"<</T(rsa)/V<</Type/Sig/SubFilter/adbe.pkcs7.sha1/ByteRange[0 2 3 4]/Contents<00>>>>>",
+	})
+
+	ctx, err := Read(bytes.NewReader(bb), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := VerifySignatures(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ field, problem string }{
+		{"parent.forged", "does not start at the beginning of the file"},
+		{"parent.rsa", "unsupported SubFilter"},
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d signatures, want %d", len(ss), len(want))
+	}
+
+	for i, si := range ss {
+		if si.Field != want[i].field || si.Valid || len(si.Problems) != 1 || !strings.Contains(si.Problems[0], want[i].problem) {
+			t.Errorf("got %s, want %s: %s", si, want[i].field, want[i].problem)
+		}
+	}
+}
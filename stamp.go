@@ -20,14 +20,21 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"image"
 	"io"
+	"io/ioutil"
 	"math"
+	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf16"
 
 	"github.com/zean00/pdfcpulite/filter"
 	"github.com/zean00/pdfcpulite/font"
+	"github.com/zean00/pdfcpulite/log"
+	"github.com/zean00/pdfcpulite/types"
 )
 
 const stampWithBBox = false
@@ -356,7 +363,7 @@ func (sc SimpleColor) String() string {
 	return fmt.Sprintf("r=%1.1f g=%1.1f b=%1.1f", sc.r, sc.g, sc.b)
 }
 
-type formCache map[Rectangle]*IndirectRef
+type formCache map[types.Rectangle]*IndirectRef
 
 type pdfResources struct {
 	content []byte
@@ -377,7 +384,7 @@ type Watermark struct {
 	OnTop             bool        // if true this is a STAMP else this is a WATERMARK.
 	Pos               anchor      // position anchor, one of tl,tc,tr,l,c,r,bl,bc,br.
 	Dx, Dy            int         // anchor offset.
-	FontName          string      // supported are Adobe base fonts only. (as of now: Helvetica, Times-Roman, Courier)
+	FontName          string      // a core font or an installed user font.
 	FontSize          int         // font scaling factor.
 	ScaledFontSize    int         // font scaling factor for a specific page
 	Color             SimpleColor // fill color(=non stroking color).
@@ -393,6 +400,9 @@ type Watermark struct {
 	// resources
 	ocg, extGState, font, image *IndirectRef
 
+	// for a user font
+	cids map[rune]uint16 // CIDs by rune.
+
 	// for an image or PDF watermark
 	width, height int // image or page dimensions.
 
@@ -740,7 +750,9 @@ func parseWatermarkDetails(mode int, modeParm, s string, onTop bool) (*Watermark
 
 	wm := DefaultWatermarkConfig()
 	wm.OnTop = onTop
-	setWatermarkType(mode, modeParm, wm)
+	if err := setWatermarkType(mode, modeParm, wm); err != nil {
+		return nil, err
+	}
 
 	ss := strings.Split(s, ",")
 	if len(ss) < 1 || len(ss[0]) == 0 {
@@ -936,11 +948,8 @@ func setWatermarkType(mode int, s string, wm *Watermark) error {
 	switch mode {
 	case WMText:
 		wm.TextString = s
-		bb := []byte{}
-		for _, r := range s {
-			bb = append(bb, byte(r))
-		}
-		s = strings.ReplaceAll(string(bb), "\\n", "\n")
+		// Text lines are kept in UTF-8 and encoded using CP1252 for rendering.
+		s = strings.ReplaceAll(s, "\\n", "\n")
 		for _, l := range strings.FieldsFunc(s, func(c rune) bool { return c == 0x0a }) {
 			wm.TextLines = append(wm.TextLines, l)
 		}
@@ -992,33 +1001,36 @@ func coreFontDict(fontName string) Dict {
 	return d
 }
 
-func ttfWidths(xRefTable *XRefTable, ttf font.TTFLight) (*IndirectRef, error) {
+// cidWidths returns the W array of a CIDFont for the glyphs of a user font by CID.
+func cidWidths(xRefTable *XRefTable, fontName string, gids map[uint16]uint16) (*IndirectRef, error) {
 
-	// we have tff firstchar, lastchar !
-
-	missingW := ttf.GlyphWidths[0]
-
-	w := make([]int, 256)
+	ttf := font.UserFontMetrics[fontName]
 
-	for i := 0; i < 256; i++ {
-		if i < 32 || WinAnsiGlyphMap[i] == ".notdef" {
-			w[i] = missingW
-			continue
+	cids := make([]int, 0, len(gids))
+	widths := map[int]int{}
+	for gid, cid := range gids {
+		if int(gid) < len(ttf.GlyphWidths) {
+			cids = append(cids, int(cid))
+			widths[int(cid)] = ttf.GlyphWidths[gid]
 		}
+	}
+	sort.Ints(cids)
 
-		pos, ok := ttf.Chars[uint16(i)]
-		if !ok {
-			//fmt.Printf("Character %s missing\n", metrics.WinAnsiGlyphMap[i])
-			w[i] = missingW
-			continue
+	// Consecutive CIDs share a width array: c [w1 w2 ...]
+	a := Array{}
+	var ws Array
+	for i, cid := range cids {
+		if i == 0 || cid != cids[i-1]+1 {
+			if ws != nil {
+				a = append(a, ws)
+			}
+			a = append(a, Integer(cid))
+			ws = Array{}
 		}
-
-		w[i] = ttf.GlyphWidths[pos]
+		ws = append(ws, Integer(widths[cid]))
 	}
-
-	a := make(Array, 256-32)
-	for i := 32; i < 256; i++ {
-		a[i-32] = Integer(w[i])
+	if ws != nil {
+		a = append(a, ws)
 	}
 
 	return xRefTable.IndRefForNewObject(a)
@@ -1043,9 +1055,9 @@ func ttfFontDescriptorFlags(ttf font.TTFLight) uint32 {
 		flags |= 0x01
 	}
 
-	// Bit 6 Set for non symbolic
-	// Note: Symbolic fonts are unsupported.
-	flags |= 0x20
+	// Bit 3 Set for symbolic
+	// User fonts are embedded as CIDFonts covering glyphs outside the standard Latin character set.
+	flags |= 0x04
 
 	// Bit 7
 	//fmt.Printf("italicAngle: %f\n", ttf.ItalicAngle)
@@ -1058,18 +1070,11 @@ func ttfFontDescriptorFlags(ttf font.TTFLight) uint32 {
 	return flags
 }
 
-/*
-func ttfFontFile(xRefTable *XRefTable, ttf font.TTFLight, fontName string) (*IndirectRef, error) {
+func ttfFontFile(xRefTable *XRefTable, bb []byte) (*IndirectRef, error) {
 
 	sd := &StreamDict{Dict: NewDict()}
 	sd.InsertName("Filter", filter.Flate)
 	sd.FilterPipeline = []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}
-
-	bb, err := font.Read(fontName)
-	if err != nil {
-		return nil, err
-	}
-	//fmt.Printf("read %d fontfile bytes\n", len(bb))
 	sd.InsertInt("Length1", len(bb))
 
 	sd.Content = bb
@@ -1081,9 +1086,9 @@ func ttfFontFile(xRefTable *XRefTable, ttf font.TTFLight, fontName string) (*Ind
 	return xRefTable.IndRefForNewObject(*sd)
 }
 
-func ttfFontDescriptor(xRefTable *XRefTable, ttf font.TTFLight, fontName string) (*IndirectRef, error) {
+func ttfFontDescriptor(xRefTable *XRefTable, ttf font.TTFLight, baseFont string, bb []byte) (*IndirectRef, error) {
 
-	fontFile, err := ttfFontFile(xRefTable, ttf, fontName)
+	fontFile, err := ttfFontFile(xRefTable, bb)
 	if err != nil {
 		return nil, err
 	}
@@ -1091,7 +1096,7 @@ func ttfFontDescriptor(xRefTable *XRefTable, ttf font.TTFLight, fontName string)
 	d := Dict(
 		map[string]Object{
 			"Type":        Name("FontDescriptor"),
-			"FontName":    Name(fontName),
+			"FontName":    Name(baseFont),
 			"Flags":       Integer(ttfFontDescriptorFlags(ttf)),
 			"FontBBox":    NewNumberArray(ttf.LLx, ttf.LLy, ttf.URx, ttf.URy),
 			"ItalicAngle": Float(ttf.ItalicAngle),
@@ -1107,32 +1112,157 @@ func ttfFontDescriptor(xRefTable *XRefTable, ttf font.TTFLight, fontName string)
 	return xRefTable.IndRefForNewObject(d)
 }
 
-func userFontDict(xRefTable *XRefTable, fontName string) (Dict, error) {
+// ttfSubset returns a subset of an installed user font holding the glyphs needed for rs
+// and its name prefixed by a subset tag.
+func ttfSubset(fontName string, rs []rune) ([]byte, map[uint16]uint16, string, error) {
+
+	bb, err := font.Read(fontName)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	sub, gids, err := font.Subset(bb, rs)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	log.Write.Debugf("ttfSubset: %s %d of %d bytes", fontName, len(sub), len(bb))
+
+	return sub, gids, font.SubsetTag(sub) + "+" + fontName, nil
+}
+
+// toUnicodeCMap returns a ToUnicode CMap stream mapping CIDs to the runes they render.
+func toUnicodeCMap(xRefTable *XRefTable, cids map[rune]uint16) (*IndirectRef, error) {
+
+	m := map[uint16]rune{}
+	for r, cid := range cids {
+		if r1, ok := m[cid]; !ok || r < r1 {
+			m[cid] = r
+		}
+	}
+
+	cc := make([]int, 0, len(m))
+	for cid := range m {
+		cc = append(cc, int(cid))
+	}
+	sort.Ints(cc)
+
+	var b bytes.Buffer
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	b.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	b.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	b.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+
+	// At most 100 mappings per block.
+	for i := 0; i < len(cc); i += 100 {
+		j := i + 100
+		if j > len(cc) {
+			j = len(cc)
+		}
+		fmt.Fprintf(&b, "%d beginbfchar\n", j-i)
+		for _, cid := range cc[i:j] {
+			fmt.Fprintf(&b, "<%04X> <", cid)
+			for _, u := range utf16.Encode([]rune{m[uint16(cid)]}) {
+				fmt.Fprintf(&b, "%04X", u)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+	}
+
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+
+	sd := &StreamDict{Dict: NewDict()}
+	sd.InsertName("Filter", filter.Flate)
+	sd.FilterPipeline = []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}
+	sd.Content = b.Bytes()
+
+	if err := encodeStream(sd); err != nil {
+		return nil, err
+	}
+
+	return xRefTable.IndRefForNewObject(*sd)
+}
+
+// userFontDict returns a Type0 font using Identity-H encoding for an installed user font.
+// The embedded font is a subset for the runes of text, its glyph ids are used as CIDs.
+// The CIDs needed to render text are returned by rune.
+func userFontDict(xRefTable *XRefTable, fontName string, text []string) (Dict, map[rune]uint16, error) {
 
 	ttf := font.UserFontMetrics[fontName]
 
-	d := NewDict()
-	d.InsertName("Type", "Font")
-	d.InsertName("Subtype", "TrueType")
-	d.InsertName("BaseFont", fontName)
-	d.InsertInt("FirstChar", 32)
-	d.InsertInt("LastChar", 255)
+	var rs []rune
+	for _, s := range text {
+		rs = append(rs, []rune(s)...)
+	}
 
-	w, err := ttfWidths(xRefTable, ttf)
+	bb, gids, baseFont, err := ttfSubset(fontName, rs)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	d.Insert("Widths", *w)
 
-	fd, err := ttfFontDescriptor(xRefTable, ttf, fontName)
+	cids := map[rune]uint16{}
+	missing := map[rune]bool{}
+	for _, r := range rs {
+		if gid, ok := ttf.Chars[r]; ok {
+			cids[r] = gids[gid]
+		} else if !missing[r] {
+			missing[r] = true
+			log.Write.Warnf("pdfcpu: font %s has no glyph for %q (U+%04X), rendering .notdef", fontName, r, r)
+		}
+	}
+
+	fd, err := ttfFontDescriptor(xRefTable, ttf, baseFont, bb)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	w, err := cidWidths(xRefTable, fontName, gids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cidFont := Dict(
+		map[string]Object{
+			"Type":     Name("Font"),
+			"Subtype":  Name("CIDFontType2"),
+			"BaseFont": Name(baseFont),
+			"CIDSystemInfo": Dict(
+				map[string]Object{
+					"Registry":   StringLiteral("Adobe"),
+					"Ordering":   StringLiteral("Identity"),
+					"Supplement": Integer(0),
+				},
+			),
+			"FontDescriptor": *fd,
+			"DW":             Integer(ttf.GlyphWidths[0]),
+			"W":              *w,
+			"CIDToGIDMap":    Name("Identity"),
+		},
+	)
+
+	ir, err := xRefTable.IndRefForNewObject(cidFont)
+	if err != nil {
+		return nil, nil, err
 	}
-	d.Insert("FontDescriptor", *fd)
 
-	d.InsertName("Encoding", "WinAnsiEncoding")
+	toUnicode, err := toUnicodeCMap(xRefTable, cids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d := Dict(
+		map[string]Object{
+			"Type":            Name("Font"),
+			"Subtype":         Name("Type0"),
+			"BaseFont":        Name(baseFont),
+			"Encoding":        Name("Identity-H"),
+			"DescendantFonts": Array{*ir},
+			"ToUnicode":       *toUnicode,
+		},
+	)
 
-	return d, nil
+	return d, cids, nil
 }
 
 func createFontResForWM(xRefTable *XRefTable, wm *Watermark) error {
@@ -1142,10 +1272,14 @@ func createFontResForWM(xRefTable *XRefTable, wm *Watermark) error {
 		err error
 	)
 
+	if !font.SupportedFont(wm.FontName) {
+		return fmt.Errorf("pdfcpu: font %s not installed", wm.FontName)
+	}
+
 	if font.IsCoreFont(wm.FontName) {
 		d = coreFontDict(wm.FontName)
 	} else {
-		d, err = userFontDict(xRefTable, wm.FontName)
+		d, wm.cids, err = userFontDict(xRefTable, wm.FontName, wm.TextLines)
 		if err != nil {
 			return err
 		}
@@ -1160,7 +1294,6 @@ func createFontResForWM(xRefTable *XRefTable, wm *Watermark) error {
 
 	return nil
 }
-*/
 func contentStream(xRefTable *XRefTable, o Object) ([]byte, error) {
 
 	o, err := xRefTable.Dereference(o)
@@ -1290,6 +1423,7 @@ func migrateObject(ctxSource, ctxDest *Context, migrated map[int]int, o Object)
 	for k := range objNrs {
 		patchObject(ctxSource.Table[k].Object, migrated)
 		v := migrated[k]
+		ctxDest.snapshot(v)
 		ctxDest.Table[v] = ctxSource.Table[k]
 	}
 
@@ -1343,7 +1477,6 @@ func createPDFRes(ctx, otherCtx *Context, pageNr int, migrated map[int]int, wm *
 	return nil
 }
 
-/*
 func createPDFResForWM(ctx *Context, wm *Watermark) error {
 
 	// The stamp pdf is assumed to be valid.
@@ -1425,7 +1558,6 @@ func createImageResource(xRefTable *XRefTable, r io.Reader) (*IndirectRef, int,
 	return indRef, w, h, nil
 }
 
-
 func createImageResForWM(xRefTable *XRefTable, wm *Watermark) (err error) {
 
 	f, err := os.Open(wm.FileName)
@@ -1453,7 +1585,6 @@ func createResourcesForWM(ctx *Context, wm *Watermark) error {
 
 	return createFontResForWM(xRefTable, wm)
 }
-*/
 func ensureOCG(xRefTable *XRefTable, wm *Watermark) error {
 
 	name := "Background"
@@ -1641,12 +1772,32 @@ func textFormContent(w io.Writer, pageNr int, wm *Watermark) {
 		sw := font.TextWidth(wm.TextLines[i], wm.FontName, wm.ScaledFontSize)
 		dx := wm.bb.Width()/2 - sw/2
 
-		fmt.Fprintf(w, "BT /%s %d Tf %f %f %f rg %f %f Td (%s) Tj ET ",
-			wm.FontName, wm.ScaledFontSize, wm.Color.r, wm.Color.g, wm.Color.b, dx, dy+float64(j*wm.ScaledFontSize), wm.TextLines[i])
+		fmt.Fprintf(w, "BT /%s %d Tf %f %f %f rg %f %f Td %s Tj ET ",
+			wm.FontName, wm.ScaledFontSize, wm.Color.r, wm.Color.g, wm.Color.b, dx, dy+float64(j*wm.ScaledFontSize), wm.textString(wm.TextLines[i]))
 		j++
 	}
 }
 
+// textString returns a string object rendering s using the watermark font.
+// User fonts use 2 byte CIDs, all other fonts CP1252.
+// Runes missing in a user font are rendered using CID 0 (.notdef), see userFontDict.
+func (wm Watermark) textString(s string) string {
+
+	if wm.cids == nil {
+		es, _ := Escape(font.WinAnsiEncode(s))
+		return "(" + *es + ")"
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('<')
+	for _, r := range s {
+		fmt.Fprintf(&sb, "%04X", wm.cids[r])
+	}
+	sb.WriteByte('>')
+
+	return sb.String()
+}
+
 func formContent(w io.Writer, pageNr int, wm *Watermark) error {
 	switch true {
 	case wm.isPDF():
@@ -1659,7 +1810,6 @@ func formContent(w io.Writer, pageNr int, wm *Watermark) error {
 	return nil
 }
 
-/*
 func createForm(xRefTable *XRefTable, pageNr int, wm *Watermark, withBB bool) error {
 
 	// The forms bounding box is dependent on the page dimensions.
@@ -1804,7 +1954,6 @@ func updatePageResourcesForWM(xRefTable *XRefTable, resDict Dict, wm *Watermark,
 
 	return nil
 }
-*/
 func wmContent(wm *Watermark, gsID, xoID string) []byte {
 
 	m := wm.calcTransformMatrix()
@@ -1941,12 +2090,11 @@ func viewPort(xRefTable *XRefTable, a *InheritedPageAttrs) *Rectangle {
 	return visibleRegion
 }
 
-/*
 func addPageWatermark(xRefTable *XRefTable, i int, wm *Watermark) error {
 
-	fmt.Printf("addPageWatermark page:%d\n", i)
+	log.Write.Tracef("addPageWatermark page:%d\n", i)
 	if wm.Update {
-		fmt.Println("Updating")
+		log.Write.Tracef("Updating")
 		if _, err := removePageWatermark(xRefTable, i); err != nil {
 			return err
 		}
@@ -1966,7 +2114,7 @@ func addPageWatermark(xRefTable *XRefTable, i int, wm *Watermark) error {
 
 	wm.pageRot = float64(inhPAttrs.rotate)
 
-	fmt.Printf("\n%s\n", wm)
+	log.Write.Tracef("\n%s\n", wm)
 
 	gsID := "GS0"
 	xoID := "Fm0"
@@ -1987,13 +2135,12 @@ func addPageWatermark(xRefTable *XRefTable, i int, wm *Watermark) error {
 
 	return updatePageContentsForWM(xRefTable, obj, wm, gsID, xoID)
 }
-*/
 func patchContentForWM(sd *StreamDict, gsID, xoID string, wm *Watermark, saveGState bool) error {
 
 	// Decode streamDict for supported filters only.
 	err := decodeStream(sd)
 	if err == filter.ErrUnsupportedFilter {
-		fmt.Println("unsupported filter: unable to patch content with watermark.")
+		log.Write.Warnf("unsupported filter: unable to patch content with watermark.")
 		return nil
 	}
 	if err != nil {
@@ -2019,7 +2166,7 @@ func patchFirstContentForWM(sd *StreamDict) error {
 
 	err := decodeStream(sd)
 	if err == filter.ErrUnsupportedFilter {
-		fmt.Println("unsupported filter: unable to patch content with watermark.")
+		log.Write.Warnf("unsupported filter: unable to patch content with watermark.")
 		return nil
 	}
 	if err != nil {
@@ -2031,11 +2178,10 @@ func patchFirstContentForWM(sd *StreamDict) error {
 	return encodeStream(sd)
 }
 
-/*
 // AddWatermarks adds watermarks to all pages selected.
 func AddWatermarks(ctx *Context, selectedPages IntSet, wm *Watermark) error {
 
-	fmt.Printf("AddWatermarks wm:\n%s\n", wm)
+	ctx.Log(log.Write).Tracef("AddWatermarks wm:\n%s\n", wm)
 
 	xRefTable := ctx.XRefTable
 
@@ -2070,7 +2216,6 @@ func AddWatermarks(ctx *Context, selectedPages IntSet, wm *Watermark) error {
 
 	return nil
 }
-*/
 func removeResDictEntry(xRefTable *XRefTable, d *Dict, entry string, ids []string, i int) error {
 
 	o, ok := d.Find(entry)
@@ -2113,7 +2258,7 @@ func removeArtifacts(sd *StreamDict, i int) (ok bool, extGStates []string, forms
 
 	err = decodeStream(sd)
 	if err == filter.ErrUnsupportedFilter {
-		fmt.Printf("unsupported filter: unable to patch content with watermark for page %d\n", i)
+		log.Write.Warnf("unsupported filter: unable to patch content with watermark for page %d\n", i)
 		return false, nil, nil, nil
 	}
 	if err != nil {
@@ -2329,7 +2474,7 @@ func locateOCGs(ctx *Context) (Array, error) {
 // RemoveWatermarks removes watermarks for all pages selected.
 func RemoveWatermarks(ctx *Context, selectedPages IntSet) error {
 
-	fmt.Printf("RemoveWatermarks\n")
+	ctx.Log(log.Write).Tracef("RemoveWatermarks\n")
 
 	a, err := locateOCGs(ctx)
 	if err != nil {
@@ -2369,6 +2514,13 @@ func RemoveWatermarks(ctx *Context, selectedPages IntSet) error {
 		return errNoWatermark
 	}
 
+	if len(selectedPages) == 0 {
+		selectedPages = IntSet{}
+		for i := 1; i <= ctx.PageCount; i++ {
+			selectedPages[i] = true
+		}
+	}
+
 	var removedSmth bool
 
 	for k, v := range selectedPages {
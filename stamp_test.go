@@ -0,0 +1,228 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/zean00/pdfcpulite/font"
+)
+
+// installTestFont installs the user font Test with the glyphs .notdef, A, B and 😀 without outlines.
+// Its cmap is a single format 12 subtable.
+func installTestFont(t *testing.T) {
+	t.Helper()
+
+	widths := []int{500, 600, 700, 800}
+	n := len(widths)
+
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint32(head[12:], 0x5F0F3CF5) // magicNumber
+	binary.BigEndian.PutUint16(head[18:], 1000)       // unitsPerEm
+
+	hhea := make([]byte, 36)
+	binary.BigEndian.PutUint16(hhea[34:], uint16(n))
+
+	maxp := make([]byte, 6)
+	binary.BigEndian.PutUint16(maxp[4:], uint16(n))
+
+	hmtx := make([]byte, n*4)
+	for i, w := range widths {
+		binary.BigEndian.PutUint16(hmtx[i*4:], uint16(w))
+	}
+
+	// Empty glyphs, short loca offsets.
+	loca := make([]byte, (n+1)*2)
+
+	// Groups: A-B => 1-2, 😀 => 3
+	cmap := make([]byte, 12+16+2*12)
+	binary.BigEndian.PutUint16(cmap[2:], 1)
+	binary.BigEndian.PutUint16(cmap[4:], 3)
+	binary.BigEndian.PutUint16(cmap[6:], 10)
+	binary.BigEndian.PutUint32(cmap[8:], 12)
+	st := cmap[12:]
+	binary.BigEndian.PutUint16(st, 12)
+	binary.BigEndian.PutUint32(st[4:], uint32(len(st)))
+	binary.BigEndian.PutUint32(st[12:], 2)
+	for i, g := range [][3]uint32{{'A', 'B', 1}, {'😀', '😀', 3}} {
+		binary.BigEndian.PutUint32(st[16+i*12:], g[0])
+		binary.BigEndian.PutUint32(st[20+i*12:], g[1])
+		binary.BigEndian.PutUint32(st[24+i*12:], g[2])
+	}
+
+	tables := map[string][]byte{
+		"head": head,
+		"hhea": hhea,
+		"maxp": maxp,
+		"hmtx": hmtx,
+		"loca": loca,
+		"glyf": {},
+		"cmap": cmap,
+		"post": make([]byte, 32),
+	}
+
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	dir := make([]byte, 12+len(tags)*16)
+	copy(dir, "\x00\x01\x00\x00")
+	binary.BigEndian.PutUint16(dir[4:], uint16(len(tags)))
+
+	var data []byte
+	for i, tag := range tags {
+		b := tables[tag]
+		padded := append(b[:len(b):len(b)], make([]byte, (4-len(b)%4)%4)...)
+		var sum uint32
+		for j := 0; j < len(padded); j += 4 {
+			if tag != "head" || j != 8 {
+				sum += binary.BigEndian.Uint32(padded[j:])
+			}
+		}
+		rec := dir[12+i*16:]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[4:], sum)
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(dir)+len(data)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(b)))
+		data = append(data, padded...)
+	}
+
+	fontDir := t.TempDir()
+	f, err := os.Create(filepath.Join(fontDir, "Test.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := gob.NewEncoder(f).Encode(struct{ FontFile []byte }{append(dir, data...)}); err != nil {
+		t.Fatal(err)
+	}
+
+	oldDir := font.UserFontDir
+	font.UserFontDir = fontDir
+	font.UserFontMetrics["Test"] = font.TTFLight{
+		UnitsPerEm:  1000,
+		GlyphWidths: widths,
+		Chars:       map[rune]uint16{'A': 1, 'B': 2, '😀': 3},
+	}
+	t.Cleanup(func() {
+		font.UserFontDir = oldDir
+		delete(font.UserFontMetrics, "Test")
+	})
+}
+
+func TestUserFontDict(t *testing.T) {
+
+	installTestFont(t)
+	ctx := readMinimalPDF(t)
+
+	// B is not used and ? is missing in the font.
+	d, cids, err := userFontDict(ctx.XRefTable, "Test", []string{"A😀", "?A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[rune]uint16{'A': 1, '😀': 2}; !reflect.DeepEqual(cids, want) {
+		t.Errorf("cids: got %v, want %v", cids, want)
+	}
+
+	if s := (Watermark{cids: cids}).textString("A?😀"); s != "<000100000002>" {
+		t.Errorf("textString: got %s", s)
+	}
+
+	baseFont := d.NameEntry("BaseFont")
+	if baseFont == nil || !strings.HasSuffix(*baseFont, "+Test") || len(*baseFont) != 11 {
+		t.Errorf("BaseFont: got %v", baseFont)
+	}
+	for k, v := range map[string]string{"Type": "Font", "Subtype": "Type0", "Encoding": "Identity-H"} {
+		if n := d.NameEntry(k); n == nil || *n != v {
+			t.Errorf("%s: got %v, want %s", k, n, v)
+		}
+	}
+
+	a, err := ctx.DereferenceArray(d["DescendantFonts"])
+	if err != nil || len(a) != 1 {
+		t.Fatalf("DescendantFonts: got %v, %v", a, err)
+	}
+	cidFont, err := ctx.DereferenceDict(a[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{"Subtype": "CIDFontType2", "CIDToGIDMap": "Identity"} {
+		if n := cidFont.NameEntry(k); n == nil || *n != v {
+			t.Errorf("%s: got %v, want %s", k, n, v)
+		}
+	}
+	if dw := cidFont.IntEntry("DW"); dw == nil || *dw != 500 {
+		t.Errorf("DW: got %v, want 500", dw)
+	}
+	w, err := ctx.DereferenceArray(cidFont["W"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Array{Integer(0), Array{Integer(500), Integer(600), Integer(800)}}); !reflect.DeepEqual(w, want) {
+		t.Errorf("W: got %v, want %v", w, want)
+	}
+
+	sd, err := ctx.DereferenceStreamDict(d["ToUnicode"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decodeStream(sd); err != nil {
+		t.Fatal(err)
+	}
+	if want := "2 beginbfchar\n<0001> <0041>\n<0002> <D83DDE00>\nendbfchar\n"; !bytes.Contains(sd.Content, []byte(want)) {
+		t.Errorf("ToUnicode: missing %q in\n%s", want, sd.Content)
+	}
+}
+
+func TestCIDWidths(t *testing.T) {
+
+	font.UserFontMetrics["Test"] = font.TTFLight{GlyphWidths: []int{500, 600, 700, 800, 900}}
+	defer delete(font.UserFontMetrics, "Test")
+
+	ctx := readMinimalPDF(t)
+
+	// Runs of consecutive CIDs share a width array, glyphs without metrics are skipped.
+	ir, err := cidWidths(ctx.XRefTable, "Test", map[uint16]uint16{0: 0, 1: 1, 4: 2, 3: 5, 2: 7, 9: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := ctx.DereferenceArray(*ir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Array{
+		Integer(0), Array{Integer(500), Integer(600), Integer(900)},
+		Integer(5), Array{Integer(800)},
+		Integer(7), Array{Integer(700)},
+	}
+	if !reflect.DeepEqual(w, want) {
+		t.Errorf("W: got %v, want %v", w, want)
+	}
+}
@@ -16,7 +16,7 @@ limitations under the License.
 
 package pdflite
 
-import "fmt"
+import "github.com/zean00/pdfcpulite/log"
 
 // The PDF root object fields.
 const (
@@ -116,18 +116,28 @@ func (stats PDFStats) UsesPageAttr(name int) bool {
 
 // ValidationTimingStats prints processing time stats for validation.
 func ValidationTimingStats(dur1, dur2, dur float64) {
-	fmt.Println("Timing:")
-	fmt.Printf("read                 : %6.3fs  %4.1f%%\n", dur1, dur1/dur*100)
-	fmt.Printf("validate             : %6.3fs  %4.1f%%\n", dur2, dur2/dur*100)
-	fmt.Printf("total processing time: %6.3fs\n\n", dur)
+	log.Info.Infof("Timing:")
+	log.Info.Infof("read                 : %6.3fs  %4.1f%%\n", dur1, dur1/dur*100)
+	log.Info.Infof("validate             : %6.3fs  %4.1f%%\n", dur2, dur2/dur*100)
+	log.Info.Infof("total processing time: %6.3fs\n\n", dur)
 }
 
 // TimingStats prints processing time stats for an operation.
 func TimingStats(op string, durRead, durVal, durOpt, durWrite, durTotal float64) {
-	fmt.Println("Timing:")
-	fmt.Printf("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
-	fmt.Printf("validate             : %6.3fs  %4.1f%%\n", durVal, durVal/durTotal*100)
-	fmt.Printf("optimize             : %6.3fs  %4.1f%%\n", durOpt, durOpt/durTotal*100)
-	fmt.Printf("%-21s: %6.3fs  %4.1f%%\n", op, durWrite, durWrite/durTotal*100)
-	fmt.Printf("total processing time: %6.3fs\n\n", durTotal)
+	log.Info.Infof("Timing:")
+	log.Info.Infof("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
+	log.Info.Infof("validate             : %6.3fs  %4.1f%%\n", durVal, durVal/durTotal*100)
+	log.Info.Infof("optimize             : %6.3fs  %4.1f%%\n", durOpt, durOpt/durTotal*100)
+	log.Info.Infof("%-21s: %6.3fs  %4.1f%%\n", op, durWrite, durWrite/durTotal*100)
+	log.Info.Infof("total processing time: %6.3fs\n\n", durTotal)
+}
+
+// ProcessTimingStats prints processing time stats for a command executed by Process.
+func ProcessTimingStats(durRead, durPerm, durOp, durWrite, durTotal float64) {
+	log.Info.Infof("Timing:")
+	log.Info.Infof("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
+	log.Info.Infof("permissions          : %6.3fs  %4.1f%%\n", durPerm, durPerm/durTotal*100)
+	log.Info.Infof("operation            : %6.3fs  %4.1f%%\n", durOp, durOp/durTotal*100)
+	log.Info.Infof("write                : %6.3fs  %4.1f%%\n", durWrite, durWrite/durTotal*100)
+	log.Info.Infof("total processing time: %6.3fs\n\n", durTotal)
 }
@@ -20,12 +20,14 @@ import (
 	"fmt"
 
 	"github.com/zean00/pdfcpulite/filter"
+	"github.com/zean00/pdfcpulite/log"
 )
 
 // PDFFilter represents a PDF stream filter object.
 type PDFFilter struct {
 	Name        string
 	DecodeParms Dict
+	streams     map[string][]byte // Decoded streams referenced by DecodeParms, eg. JBIG2Globals
 }
 
 // StreamDict represents a PDF stream dict object.
@@ -118,7 +120,7 @@ func (osd *ObjectStreamDict) AddObject(objNumber int, entry *XRefTableEntry) err
 
 	osd.ObjCount++
 
-	fmt.Printf("AddObject end : ObjCount:%d prolog = <%s> Content = <%s>\n", osd.ObjCount, osd.Prolog, osd.Content)
+	log.Write.Tracef("AddObject end : ObjCount:%d prolog = <%s> Content = <%s>\n", osd.ObjCount, osd.Prolog, osd.Content)
 
 	return nil
 }
@@ -127,7 +129,7 @@ func (osd *ObjectStreamDict) AddObject(objNumber int, entry *XRefTableEntry) err
 func (osd *ObjectStreamDict) Finalize() {
 	osd.Content = append(osd.Prolog, osd.Content...)
 	osd.FirstObjOffset = len(osd.Prolog)
-	fmt.Printf("Finalize : firstObjOffset:%d Content = <%s>\n", osd.FirstObjOffset, osd.Content)
+	log.Write.Tracef("Finalize : firstObjOffset:%d Content = <%s>\n", osd.FirstObjOffset, osd.Content)
 }
 
 // XRefStreamDict represents a cross reference stream dictionary.
@@ -0,0 +1,302 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"errors"
+	"sort"
+)
+
+// Tx represents a set of edits applied to a Context that may be committed or rolled back as a unit.
+//
+// Begin records the root, the size and the page count of the cross reference table.
+// Entries are snapshotted lazily: the first time an entry is looked up or replaced during the transaction
+// a copy of it is kept for Rollback, so the cost of a transaction depends on the objects it touches,
+// not on the size of the file. Entries created during the transaction are removed on Rollback.
+// The object graph is copied down to the stream level; raw and decoded stream data is shared
+// with the snapshot and is only copied when written, as every edit replaces these byte slices instead of modifying them in place.
+//
+// Objects looked up before Begin need to be looked up again before being modified.
+// Only one transaction may be in progress for a Context.
+type Tx struct {
+	ctx       *Context
+	table     map[int]*XRefTableEntry // Entries as of Begin, nil for entries that did not exist.
+	size      *int
+	root      *IndirectRef
+	pageCount int
+	names     []string // Name trees cached at the time of Begin.
+	done      bool
+}
+
+// Begin starts a transaction for ctx.
+func (ctx *Context) Begin() *Tx {
+
+	tx := &Tx{
+		ctx:       ctx,
+		table:     map[int]*XRefTableEntry{},
+		root:      ctx.Root,
+		pageCount: ctx.PageCount,
+	}
+
+	if ctx.Size != nil {
+		i := *ctx.Size
+		tx.size = &i
+	}
+
+	for k := range ctx.Names {
+		tx.names = append(tx.names, k)
+	}
+	sort.Strings(tx.names)
+
+	ctx.tx = tx
+
+	// The catalog and the cached name trees may be modified without a lookup.
+	if ctx.Root != nil {
+		ctx.snapshot(ctx.Root.ObjectNumber.Value())
+		if d, err := ctx.Catalog(); err == nil {
+			ctx.snapshotNameTrees(d)
+		}
+	}
+
+	return tx
+}
+
+// snapshot keeps a copy of the entry for objNr if a transaction is in progress
+// and the entry has not been snapshotted yet.
+func (xRefTable *XRefTable) snapshot(objNr int) {
+
+	tx := xRefTable.tx
+	if tx == nil {
+		return
+	}
+
+	if _, ok := tx.table[objNr]; ok {
+		return
+	}
+
+	// Missing entries are recorded as nil and removed on rollback.
+	tx.table[objNr] = copyXRefTableEntry(xRefTable.Table[objNr])
+}
+
+// snapshotNameTrees snapshots the nodes of all name trees cached for the catalog d.
+func (xRefTable *XRefTable) snapshotNameTrees(d Dict) {
+
+	ir, ok := d.Find("Names")
+	if !ok {
+		return
+	}
+
+	d, err := xRefTable.DereferenceDict(ir)
+	if err != nil || d == nil {
+		return
+	}
+
+	for name := range xRefTable.Names {
+		if ir := d.IndirectRefEntry(name); ir != nil {
+			xRefTable.snapshotNameTreeNode(*ir)
+		}
+	}
+}
+
+func (xRefTable *XRefTable) snapshotNameTreeNode(ir IndirectRef) {
+
+	d, err := xRefTable.DereferenceDict(ir)
+	if err != nil || d == nil {
+		return
+	}
+
+	kids := d.ArrayEntry("Kids")
+	for _, o := range kids {
+		if ir, ok := o.(IndirectRef); ok {
+			xRefTable.snapshotNameTreeNode(ir)
+		}
+	}
+}
+
+// Commit accepts all edits applied since Begin and releases the snapshot.
+func (tx *Tx) Commit() error {
+
+	if tx.done {
+		return errors.New("pdfcpu: commit: transaction already finished")
+	}
+
+	tx.ctx.tx = nil
+	tx.table = nil
+	tx.done = true
+
+	return nil
+}
+
+// Rollback discards all edits applied since Begin and restores the state of the Context at that time.
+func (tx *Tx) Rollback() error {
+
+	if tx.done {
+		return errors.New("pdfcpu: rollback: transaction already finished")
+	}
+
+	xRefTable := tx.ctx.XRefTable
+	xRefTable.tx = nil
+
+	for k, e := range tx.table {
+		if e == nil {
+			delete(xRefTable.Table, k)
+			continue
+		}
+		xRefTable.Table[k] = e
+	}
+
+	xRefTable.Size = tx.size
+	xRefTable.Root = tx.root
+	xRefTable.PageCount = tx.pageCount
+
+	// Cached dicts point into the discarded object graph and need to be resolved again.
+	xRefTable.RootDict = nil
+	xRefTable.Names = map[string]*Node{}
+	tx.ctx.copied = nil
+
+	tx.table = nil
+	tx.done = true
+
+	if xRefTable.Root == nil {
+		return nil
+	}
+
+	if _, err := xRefTable.Catalog(); err != nil {
+		return err
+	}
+
+	for _, name := range tx.names {
+		if err := xRefTable.LocateNameTree(name, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyXRefTableEntry(e *XRefTableEntry) *XRefTableEntry {
+
+	if e == nil {
+		return nil
+	}
+
+	e1 := *e
+	e1.Object = copyObject(e.Object)
+
+	// Free list maintenance modifies offsets and generations in place.
+	if e.Offset != nil {
+		off := *e.Offset
+		e1.Offset = &off
+	}
+
+	if e.Generation != nil {
+		g := *e.Generation
+		e1.Generation = &g
+	}
+
+	return &e1
+}
+
+func copyDict(d Dict) Dict {
+
+	if d == nil {
+		return nil
+	}
+
+	d1 := make(Dict, len(d))
+	for k, v := range d {
+		d1[k] = copyObject(v)
+	}
+
+	return d1
+}
+
+func copyArray(a Array) Array {
+
+	if a == nil {
+		return nil
+	}
+
+	a1 := make(Array, len(a))
+	for i, v := range a {
+		a1[i] = copyObject(v)
+	}
+
+	return a1
+}
+
+func copyStreamDict(sd StreamDict) StreamDict {
+
+	sd.Dict = copyDict(sd.Dict)
+
+	if sd.FilterPipeline != nil {
+		fp := make([]PDFFilter, len(sd.FilterPipeline))
+		for i, f := range sd.FilterPipeline {
+			fp[i] = PDFFilter{Name: f.Name, DecodeParms: copyDict(f.DecodeParms)}
+			if f.streams != nil {
+				fp[i].streams = make(map[string][]byte, len(f.streams))
+				for k, b := range f.streams {
+					fp[i].streams[k] = b
+				}
+			}
+		}
+		sd.FilterPipeline = fp
+	}
+
+	return sd
+}
+
+// copyObject returns a copy of o which may be modified without affecting o.
+func copyObject(o Object) Object {
+
+	switch obj := o.(type) {
+
+	case Dict:
+		return copyDict(obj)
+
+	case Array:
+		return copyArray(obj)
+
+	case StreamDict:
+		return copyStreamDict(obj)
+
+	case ObjectStreamDict:
+		obj.StreamDict = copyStreamDict(obj.StreamDict)
+		obj.ObjArray = copyArray(obj.ObjArray)
+		return obj
+
+	case *ObjectStreamDict:
+		osd := *obj
+		osd.StreamDict = copyStreamDict(obj.StreamDict)
+		osd.ObjArray = copyArray(obj.ObjArray)
+		return &osd
+
+	case XRefStreamDict:
+		obj.StreamDict = copyStreamDict(obj.StreamDict)
+		obj.Objects = append([]int(nil), obj.Objects...)
+		return obj
+
+	case *XRefStreamDict:
+		xsd := *obj
+		xsd.StreamDict = copyStreamDict(obj.StreamDict)
+		xsd.Objects = append([]int(nil), obj.Objects...)
+		return &xsd
+	}
+
+	// Remaining objects are immutable values.
+	return o
+}
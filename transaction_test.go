@@ -0,0 +1,178 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/zean00/pdfcpulite/filter"
+)
+
+// tableObjects returns a copy of all objects in the cross reference table of ctx.
+func tableObjects(ctx *Context) map[int]Object {
+	m := map[int]Object{}
+	for k, e := range ctx.Table {
+		m[k] = copyObject(e.Object)
+	}
+	return m
+}
+
+func TestTransaction(t *testing.T) {
+
+	for _, tt := range []struct {
+		name string
+		edit func(ctx *Context) error
+	}{
+		{"modify catalog", func(ctx *Context) error {
+			d, err := ctx.Catalog()
+			if err != nil {
+				return err
+			}
+			d.Insert("Lang", StringLiteral("en"))
+			return nil
+		}},
+		{"insert object", func(ctx *Context) error {
+			_, err := ctx.InsertObject(Dict(map[string]Object{"Type": Name("Test")}))
+			return err
+		}},
+		{"insert pages", func(ctx *Context) error {
+			return ctx.InsertPages(IntSet{1: true}, false)
+		}},
+		{"add keywords", func(ctx *Context) error {
+			return KeywordsAdd(ctx.XRefTable, []string{"a", "b"})
+		}},
+	} {
+		for _, commit := range []bool{false, true} {
+
+			ctx := readMinimalPDF(t)
+
+			want := tableObjects(ctx)
+			size, pageCount := *ctx.Size, ctx.PageCount
+
+			tx := ctx.Begin()
+			if err := tt.edit(ctx); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+
+			if !commit {
+				if err := tx.Rollback(); err != nil {
+					t.Fatalf("%s: rollback: %v", tt.name, err)
+				}
+				if got := tableObjects(ctx); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: rollback: got %v, want %v", tt.name, got, want)
+				}
+				if *ctx.Size != size || ctx.PageCount != pageCount {
+					t.Errorf("%s: rollback: got size %d, %d pages, want %d, %d", tt.name, *ctx.Size, ctx.PageCount, size, pageCount)
+				}
+				continue
+			}
+
+			got := tableObjects(ctx)
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("%s: commit: %v", tt.name, err)
+			}
+			if reflect.DeepEqual(got, want) {
+				t.Errorf("%s: commit: edit has no effect", tt.name)
+			}
+			if after := tableObjects(ctx); !reflect.DeepEqual(after, got) {
+				t.Errorf("%s: commit: got %v, want %v", tt.name, after, got)
+			}
+			if err := tx.Rollback(); err == nil {
+				t.Errorf("%s: rollback after commit succeeded", tt.name)
+			}
+		}
+	}
+}
+
+func TestTransactionSnapshotsLazily(t *testing.T) {
+
+	ctx := readMinimalPDF(t)
+
+	tx := ctx.Begin()
+
+	// Only the catalog is snapshotted up front.
+	if len(tx.table) != 1 {
+		t.Errorf("got %d snapshotted entries at Begin, want 1", len(tx.table))
+	}
+
+	d, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Update("Producer", StringLiteral("changed"))
+
+	if len(tx.table) != 2 {
+		t.Errorf("got %d snapshotted entries, want 2", len(tx.table))
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := d.StringEntry("Producer"); s == nil || *s != "test" {
+		t.Errorf("got Producer %v, want test", s)
+	}
+}
+
+func TestTransactionJBIG2Globals(t *testing.T) {
+
+	ctx := readMinimalPDF(t)
+
+	globals := []byte{0, 0, 0, 0, 0x30, 0, 1, 0, 0, 0, 0}
+
+	ir, err := ctx.IndRefForNewObject(StreamDict{Dict: NewDict(), Content: globals})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parms := Dict(map[string]Object{"JBIG2Globals": *ir})
+	sd := StreamDict{
+		Dict: Dict(map[string]Object{
+			"Type":        Name("XObject"),
+			"Subtype":     Name("Image"),
+			"Filter":      Name(filter.JBIG2),
+			"DecodeParms": parms,
+		}),
+		FilterPipeline: []PDFFilter{{Name: filter.JBIG2, DecodeParms: parms, streams: map[string][]byte{"JBIG2Globals": globals}}},
+	}
+
+	objNr, err := ctx.InsertObject(sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := ctx.Begin()
+
+	entry, _ := ctx.Find(objNr)
+	delete(entry.Object.(StreamDict).FilterPipeline[0].streams, "JBIG2Globals")
+
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, _ = ctx.Find(objNr)
+	sd = entry.Object.(StreamDict)
+	if b, ok := parmsForFilter(sd.FilterPipeline[0])["JBIG2Globals"].([]byte); !ok || !bytes.Equal(b, globals) {
+		t.Errorf("rollback: got JBIG2Globals %v, want %v", b, globals)
+	}
+}
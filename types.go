@@ -21,6 +21,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zean00/pdfcpulite/types"
@@ -275,6 +276,57 @@ func DateString(t time.Time) string {
 		tz/60/60, tz/60%60)
 }
 
+// DateTime parses a PDF date string (see 7.9.4) like "D:YYYYMMDDHHmmSSOHH'mm'".
+// Omitted trailing fields default to their lowest value.
+func DateTime(s string) (time.Time, bool) {
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+
+	// Split off the time zone.
+	tz := ""
+	if i := strings.IndexAny(s, "Z+-"); i >= 0 {
+		s, tz = s[:i], s[i:]
+	}
+
+	if len(s) < 4 || len(s) > 14 || len(s)%2 > 0 {
+		return time.Time{}, false
+	}
+
+	// Complete missing fields: MMDDHHmmSS
+	s += "0101000000"[len(s)-4:]
+
+	loc := time.UTC
+
+	if len(tz) > 1 {
+		tz = strings.Replace(tz, "'", "", -1)
+		if len(tz) != 3 && len(tz) != 5 {
+			return time.Time{}, false
+		}
+		h, err := strconv.Atoi(tz[1:3])
+		if err != nil {
+			return time.Time{}, false
+		}
+		m := 0
+		if len(tz) == 5 {
+			if m, err = strconv.Atoi(tz[3:5]); err != nil {
+				return time.Time{}, false
+			}
+		}
+		offset := h*60*60 + m*60
+		if tz[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+
+	t, err := time.ParseInLocation("20060102150405", s, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
 ///////////////////////////////////////////////////////////////////////////////////
 
 // HexLiteral represents a PDF hex literal object.
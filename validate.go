@@ -0,0 +1,239 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/zean00/pdfcpulite/filter"
+	"github.com/zean00/pdfcpulite/log"
+)
+
+// validator checks the structure of a document.
+type validator struct {
+	*XRefTable
+	strict bool
+}
+
+func (v *validator) validateCatalog() (*IndirectRef, error) {
+
+	d, err := v.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, errors.New("pdfcpu: validate: missing catalog")
+	}
+
+	if t := d.Type(); t == nil && v.strict || t != nil && *t != "Catalog" {
+		return nil, errors.New("pdfcpu: validate: catalog: invalid entry \"Type\"")
+	}
+
+	root := d.IndirectRefEntry("Pages")
+	if root == nil {
+		return nil, errors.New("pdfcpu: validate: catalog: missing entry \"Pages\"")
+	}
+
+	return root, nil
+}
+
+// validatePageTree checks the page tree node ir and returns the number of pages it contains.
+func (v *validator) validatePageTree(ir, parent *IndirectRef, mediaBox bool, visited IntSet) (int, error) {
+
+	objNr := ir.ObjectNumber.Value()
+	if visited[objNr] {
+		return 0, fmt.Errorf("pdfcpu: validate: page tree cycle at obj #%d", objNr)
+	}
+	visited[objNr] = true
+
+	d, err := v.DereferenceDict(*ir)
+	if err != nil {
+		return 0, fmt.Errorf("pdfcpu: validate: page tree obj #%d: %v", objNr, err)
+	}
+	if d == nil {
+		return 0, fmt.Errorf("pdfcpu: validate: page tree obj #%d: missing", objNr)
+	}
+
+	if parent != nil {
+		p := d.IndirectRefEntry("Parent")
+		if p == nil && v.strict || p != nil && p.ObjectNumber != parent.ObjectNumber {
+			return 0, fmt.Errorf("pdfcpu: validate: page tree obj #%d: invalid entry \"Parent\"", objNr)
+		}
+	}
+
+	if _, found := d.Find("MediaBox"); found {
+		mediaBox = true
+	}
+
+	kids, found := d.Find("Kids")
+
+	t := d.Type()
+	if t == nil && !v.strict {
+		// Relaxed: Tell nodes apart by their kids.
+		s := "Page"
+		if found {
+			s = "Pages"
+		}
+		t = &s
+	}
+
+	switch {
+
+	case t != nil && *t == "Page":
+		if !mediaBox {
+			return 0, fmt.Errorf("pdfcpu: validate: page obj #%d: missing entry \"MediaBox\"", objNr)
+		}
+		return 1, nil
+
+	case t == nil || *t != "Pages":
+		return 0, fmt.Errorf("pdfcpu: validate: page tree obj #%d: invalid entry \"Type\"", objNr)
+	}
+
+	a, err := v.DereferenceArray(kids)
+	if err != nil || a == nil {
+		return 0, fmt.Errorf("pdfcpu: validate: page tree obj #%d: invalid entry \"Kids\"", objNr)
+	}
+
+	n := 0
+	for _, o := range a {
+		kid, ok := o.(IndirectRef)
+		if !ok {
+			return 0, fmt.Errorf("pdfcpu: validate: page tree obj #%d: kids must be indirect references", objNr)
+		}
+		i, err := v.validatePageTree(&kid, ir, mediaBox, visited)
+		if err != nil {
+			return 0, err
+		}
+		n += i
+	}
+
+	if c := d.IntEntry("Count"); c == nil || *c != n {
+		return 0, fmt.Errorf("pdfcpu: validate: page tree obj #%d: \"Count\" does not match %d pages", objNr, n)
+	}
+
+	return n, nil
+}
+
+// validateReferences checks that all indirect references within o point to objects in the cross reference table.
+func (v *validator) validateReferences(objNr int, o Object) error {
+
+	switch o := o.(type) {
+
+	case IndirectRef:
+		e, found := v.Find(o.ObjectNumber.Value())
+		if found && !e.Free {
+			return nil
+		}
+		// A reference to a missing object is a reference to the null object.
+		if v.strict {
+			return fmt.Errorf("pdfcpu: validate: obj #%d: reference to missing obj #%d", objNr, o.ObjectNumber.Value())
+		}
+		log.Validate.Infof("obj #%d: reference to missing obj #%d", objNr, o.ObjectNumber.Value())
+
+	case Dict:
+		for _, k := range sortedKeys(o, nil) {
+			if err := v.validateReferences(objNr, o[k]); err != nil {
+				return err
+			}
+		}
+
+	case StreamDict:
+		return v.validateReferences(objNr, o.Dict)
+
+	case Array:
+		for _, o1 := range o {
+			if err := v.validateReferences(objNr, o1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateStream checks that sd decodes using its filters.
+func (v *validator) validateStream(objNr int, sd StreamDict) error {
+
+	if sd.Content != nil {
+		return nil
+	}
+
+	// Decode a copy, the original stays encoded.
+	sd.FilterPipeline = append([]PDFFilter(nil), sd.FilterPipeline...)
+
+	if _, err := resolveParmStreams(v.XRefTable, &sd); err != nil {
+		return fmt.Errorf("pdfcpu: validate: stream obj #%d: %v", objNr, err)
+	}
+
+	err := decodeStream(&sd)
+	if err == filter.ErrUnsupportedFilter {
+		log.Validate.Infof("stream obj #%d: skipped, unsupported filter", objNr)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("pdfcpu: validate: stream obj #%d: %v", objNr, err)
+	}
+
+	return nil
+}
+
+// Validate checks the structure of the document read into ctx:
+// The catalog and the page tree need to be well formed, every page needs a media box,
+// and all streams need to decode using their filters.
+//
+// In strict validation mode all indirect references need to point to existing objects.
+// Otherwise references to missing objects are treated as null objects, see 7.3.10.
+func Validate(ctx *Context) error {
+
+	v := &validator{XRefTable: ctx.XRefTable, strict: ctx.XRefTable.ValidationMode == ValidationStrict}
+
+	root, err := v.validateCatalog()
+	if err != nil {
+		return err
+	}
+
+	if _, err = v.validatePageTree(root, nil, false, IntSet{}); err != nil {
+		return err
+	}
+
+	var objNrs []int
+	for objNr, e := range ctx.Table {
+		if !e.Free && e.Object != nil {
+			objNrs = append(objNrs, objNr)
+		}
+	}
+	sort.Ints(objNrs)
+
+	for _, objNr := range objNrs {
+
+		o := ctx.Table[objNr].Object
+
+		if err = v.validateReferences(objNr, o); err != nil {
+			return err
+		}
+
+		if sd, ok := o.(StreamDict); ok {
+			if err = v.validateStream(objNr, sd); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
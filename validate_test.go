@@ -0,0 +1,92 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+
+	const (
+		catalog = "<</Type/Catalog/Pages 2 0 R>>"
+		pages   = "<</Type/Pages/Kids[3 0 R]/Count 1>>"
+		page    = "<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]/Resources<<>>>>"
+		info    = "<</Producer(test)>>"
+	)
+
+	for _, tt := range []struct {
+		name            string
+		objs            []string
+		strict, relaxed string // expected error, "" for a valid file
+	}{
+		{"valid", []string{catalog, pages, page, info}, "", ""},
+		{"inherited media box",
+			[]string{catalog, "<</Type/Pages/Kids[3 0 R]/Count 1/MediaBox[0 0 200 100]>>", "<</Type/Page/Parent 2 0 R/Resources<<>>>>", info},
+			"", ""},
+		{"missing media box",
+			[]string{catalog, pages, "<</Type/Page/Parent 2 0 R/Resources<<>>>>", info},
+			"missing entry \"MediaBox\"", "missing entry \"MediaBox\""},
+		{"catalog type",
+			[]string{"<</Pages 2 0 R>>", pages, page, info},
+			"catalog: invalid entry \"Type\"", ""},
+		{"wrong count",
+			[]string{catalog, "<</Type/Pages/Kids[3 0 R 5 0 R]/Count 1>>", page, info, "<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]>>"},
+			"\"Count\" does not match 2 pages", "\"Count\" does not match 2 pages"},
+		{"wrong parent",
+			[]string{catalog, pages, "<</Type/Page/Parent 1 0 R/MediaBox[0 0 200 100]>>", info},
+			"invalid entry \"Parent\"", "invalid entry \"Parent\""},
+		{"missing page type",
+			[]string{catalog, pages, "<</Parent 2 0 R/MediaBox[0 0 200 100]>>", info},
+			"invalid entry \"Type\"", ""},
+		{"cycle",
+			[]string{catalog, "<</Type/Pages/Kids[5 0 R]/Count 1>>", page, info, "<</Type/Pages/Parent 2 0 R/Kids[2 0 R]/Count 1>>"},
+			"page tree cycle", "page tree cycle"},
+		{"missing object",
+			[]string{catalog, pages, "<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]/Resources 9 0 R>>", info},
+			"reference to missing obj #9", ""},
+		{"corrupt stream",
+			[]string{catalog, pages, "<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]/Contents 5 0 R>>", info,
+				"<</Length 4/Filter/FlateDecode>>\nstream\nxxxx\nendstream"},
+			"stream obj #5", "stream obj #5"},
+	} {
+		for _, mode := range []int{ValidationStrict, ValidationRelaxed} {
+
+			want := tt.relaxed
+			if mode == ValidationStrict {
+				want = tt.strict
+			}
+
+			conf := NewDefaultConfiguration()
+			conf.ValidationMode = mode
+
+			_, err := Process(Command{Mode: VALIDATE, In: bytes.NewReader(testPDF(tt.objs)), Conf: conf})
+
+			if want == "" {
+				if err != nil {
+					t.Errorf("%s, mode %d: %v", tt.name, mode, err)
+				}
+				continue
+			}
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("%s, mode %d: got error %v, want %s", tt.name, mode, err, want)
+			}
+		}
+	}
+}
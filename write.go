@@ -0,0 +1,163 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/zean00/pdfcpulite/log"
+)
+
+// Write writes the PDF file represented by ctx to w.
+// Only objects reachable from the root and the document info dict are written.
+// Depending on ctx.Cmd the file gets encrypted, decrypted or its passwords get changed.
+func Write(ctx *Context, w io.Writer) error {
+
+	ctx.Log(log.Write).Tracef("Write begin")
+
+	ctx.ResetWriteContext()
+	ctx.Write.Writer = bufio.NewWriter(w)
+
+	if err := handleEncryptionForWrite(ctx); err != nil {
+		return err
+	}
+
+	if err := writeHeader(ctx.Write, ctx.Version()); err != nil {
+		return err
+	}
+
+	if _, _, err := writeDeepObject(ctx, *ctx.Root); err != nil {
+		return err
+	}
+
+	if err := writeDocumentInfoDict(ctx); err != nil {
+		return err
+	}
+
+	if err := writeEncryptDict(ctx); err != nil {
+		return err
+	}
+
+	if err := writeXRefSection(ctx, -1, ctx.WriteXRefStream); err != nil {
+		return err
+	}
+
+	if err := ctx.Write.Flush(); err != nil {
+		return err
+	}
+
+	ctx.Write.FileSize = ctx.Write.Offset
+
+	ctx.Log(log.Write).Tracef("Write end: %d bytes", ctx.Write.FileSize)
+
+	return nil
+}
+
+// handleEncryptionForWrite sets up the security handler for the file to be written according to ctx.Cmd.
+func handleEncryptionForWrite(ctx *Context) error {
+
+	switch ctx.Cmd {
+
+	case ENCRYPT:
+		if err := ensureFileID(ctx); err != nil {
+			return err
+		}
+		return setupEncryption(ctx)
+
+	case DECRYPT:
+		ctx.Encrypt, ctx.E, ctx.EncKey = nil, nil, nil
+
+	case CHANGEUPW, CHANGEOPW:
+		return changePassword(ctx)
+	}
+
+	return nil
+}
+
+// ensureFileID generates the file identifier required for encryption if missing.
+func ensureFileID(ctx *Context) error {
+
+	if ctx.ID != nil {
+		return nil
+	}
+
+	if ctx.Info == nil {
+		return errors.New("pdfcpu: encrypt: missing ID")
+	}
+
+	id, err := fileID(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx.ID = Array{id, id}
+
+	return nil
+}
+
+// changePassword replaces the user or owner password of an encrypted file and updates its encrypt dict.
+func changePassword(ctx *Context) error {
+
+	if ctx.E == nil || ctx.Encrypt == nil {
+		return errors.New("pdfcpu: this file is not encrypted")
+	}
+
+	if ctx.Cmd == CHANGEUPW {
+		if ctx.UserPWNew == nil {
+			return errors.New("pdfcpu: missing new user password")
+		}
+		ctx.UserPW = *ctx.UserPWNew
+	} else {
+		if ctx.OwnerPWNew == nil {
+			return errors.New("pdfcpu: missing new owner password")
+		}
+		ctx.OwnerPW = *ctx.OwnerPWNew
+	}
+
+	d, err := ctx.DereferenceDict(*ctx.Encrypt)
+	if err != nil {
+		return err
+	}
+
+	if filter := d.NameEntry("Filter"); filter == nil || *filter != "Standard" {
+		return errors.New("pdfcpu: changing passwords is only supported for the standard security handler")
+	}
+
+	if err = calcOAndU(ctx, d); err != nil {
+		return err
+	}
+
+	return writePermissions(ctx, d)
+}
+
+// writeEncryptDict writes the encrypt dict which itself is never encrypted.
+func writeEncryptDict(ctx *Context) error {
+
+	if ctx.Encrypt == nil {
+		return nil
+	}
+
+	key := ctx.EncKey
+	ctx.EncKey = nil
+	defer func() { ctx.EncKey = key }()
+
+	_, _, err := writeDeepObject(ctx, *ctx.Encrypt)
+
+	return err
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+// Creation of image XObjects (see 8.9).
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png" // register the PNG format for image.Decode
+
+	"github.com/zean00/pdfcpulite/filter"
+)
+
+// ReadJPEG wraps the JPEG data bb into an image XObject using the DCTDecode filter.
+// The data is embedded as is.
+func ReadJPEG(xRefTable *XRefTable, bb []byte, c image.Config) (*StreamDict, error) {
+
+	var cs string
+	var decode Array
+
+	switch c.ColorModel {
+	case color.GrayModel:
+		cs = "DeviceGray"
+	case color.YCbCrModel:
+		cs = "DeviceRGB"
+	case color.CMYKModel:
+		// CMYK JPEGs are usually written inverted by Adobe applications.
+		cs = "DeviceCMYK"
+		decode = NewIntegerArray(1, 0, 1, 0, 1, 0, 1, 0)
+	default:
+		return nil, fmt.Errorf("pdfcpu: unsupported JPEG color model")
+	}
+
+	sd := &StreamDict{
+		Dict: Dict(
+			map[string]Object{
+				"Type":             Name("XObject"),
+				"Subtype":          Name("Image"),
+				"Width":            Integer(c.Width),
+				"Height":           Integer(c.Height),
+				"BitsPerComponent": Integer(8),
+				"ColorSpace":       Name(cs),
+				"Filter":           Name(filter.DCT),
+			},
+		),
+		FilterPipeline: []PDFFilter{{Name: filter.DCT, DecodeParms: nil}},
+		Raw:            bb,
+	}
+
+	if decode != nil {
+		sd.Insert("Decode", decode)
+	}
+
+	streamLength := int64(len(bb))
+	sd.StreamLength = &streamLength
+	sd.InsertInt("Length", len(bb))
+
+	return sd, nil
+}
+
+// imgToImageDict creates a Flate encoded image XObject for img.
+// Gray images result in DeviceGray, all others in DeviceRGB samples.
+// Transparency is retained in a soft mask.
+func imgToImageDict(xRefTable *XRefTable, img image.Image) (*StreamDict, error) {
+
+	r := img.Bounds()
+	w, h := r.Dx(), r.Dy()
+
+	_, gray := img.(*image.Gray)
+
+	n := 3
+	cs := "DeviceRGB"
+	if gray {
+		n = 1
+		cs = "DeviceGray"
+	}
+
+	samples := make([]byte, 0, w*h*n)
+	alpha := make([]byte, 0, w*h)
+	var transparent bool
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if gray {
+				samples = append(samples, c.R)
+			} else {
+				samples = append(samples, c.R, c.G, c.B)
+			}
+			alpha = append(alpha, c.A)
+			if c.A != 0xFF {
+				transparent = true
+			}
+		}
+	}
+
+	sd, err := flateImageDict(w, h, cs, samples)
+	if err != nil {
+		return nil, err
+	}
+
+	if transparent {
+		sm, err := flateImageDict(w, h, "DeviceGray", alpha)
+		if err != nil {
+			return nil, err
+		}
+		ir, err := xRefTable.IndRefForNewObject(*sm)
+		if err != nil {
+			return nil, err
+		}
+		sd.Insert("SMask", *ir)
+	}
+
+	return sd, nil
+}
+
+func flateImageDict(w, h int, cs string, samples []byte) (*StreamDict, error) {
+
+	sd := &StreamDict{
+		Dict: Dict(
+			map[string]Object{
+				"Type":             Name("XObject"),
+				"Subtype":          Name("Image"),
+				"Width":            Integer(w),
+				"Height":           Integer(h),
+				"BitsPerComponent": Integer(8),
+				"ColorSpace":       Name(cs),
+				"Filter":           Name(filter.Flate),
+			},
+		),
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}},
+		Content:        samples,
+	}
+
+	if err := encodeStream(sd); err != nil {
+		return nil, err
+	}
+
+	return sd, nil
+}
@@ -18,6 +18,8 @@ package pdflite
 
 import (
 	"fmt"
+
+	"github.com/zean00/pdfcpulite/log"
 )
 
 const (
@@ -64,7 +66,7 @@ func startObjectStream(ctx *Context) error {
 	// See 7.5.7 Object streams
 	// When new object streams and compressed objects are created, they shall always be assigned new object numbers.
 
-	fmt.Println("startObjectStream begin")
+	ctx.Log(log.Write).Tracef("startObjectStream begin")
 
 	objStreamDict := NewObjectStreamDict()
 
@@ -75,14 +77,14 @@ func startObjectStream(ctx *Context) error {
 
 	ctx.Write.CurrentObjStream = &objNr
 
-	fmt.Printf("startObjectStream end: %d\n", objNr)
+	ctx.Log(log.Write).Tracef("startObjectStream end: %d\n", objNr)
 
 	return nil
 }
 
 func stopObjectStream(ctx *Context) error {
 
-	fmt.Println("stopObjectStream begin")
+	ctx.Log(log.Write).Tracef("stopObjectStream begin")
 
 	xRefTable := ctx.XRefTable
 
@@ -92,7 +94,7 @@ func stopObjectStream(ctx *Context) error {
 
 	if ctx.Write.CurrentObjStream == nil {
 		ctx.Write.WriteToObjectStream = false
-		fmt.Println("stopObjectStream end (no content)")
+		ctx.Log(log.Write).Tracef("stopObjectStream end (no content)")
 		return nil
 	}
 
@@ -116,7 +118,7 @@ func stopObjectStream(ctx *Context) error {
 	osd.StreamDict.Insert("N", Integer(osd.ObjCount))
 
 	// for each objStream execute at the end right before xRefStreamDict gets written.
-	fmt.Printf("stopObjectStream: objStreamDict: %s\n", osd)
+	ctx.Log(log.Write).Tracef("stopObjectStream: objStreamDict: %s\n", osd)
 
 	err = writeStreamDictObject(ctx, *ctx.Write.CurrentObjStream, 0, osd.StreamDict)
 	if err != nil {
@@ -129,14 +131,14 @@ func stopObjectStream(ctx *Context) error {
 	ctx.Write.CurrentObjStream = nil
 	ctx.Write.WriteToObjectStream = false
 
-	fmt.Println("stopObjectStream end")
+	ctx.Log(log.Write).Tracef("stopObjectStream end")
 
 	return nil
 }
 
 func writeToObjectStream(ctx *Context, objNumber, genNumber int) (ok bool, err error) {
 
-	fmt.Printf("addToObjectStream begin, obj#:%d gen#:%d\n", objNumber, genNumber)
+	ctx.Log(log.Write).Tracef("addToObjectStream begin, obj#:%d gen#:%d\n", objNumber, genNumber)
 
 	w := ctx.Write
 
@@ -176,7 +178,7 @@ func writeToObjectStream(ctx *Context, objNumber, genNumber int) (ok bool, err e
 
 		objStrEntry.Object = objStreamDict
 
-		fmt.Printf("writeObject end, obj#%d written to objectStream #%d\n", objNumber, *ctx.Write.CurrentObjStream)
+		ctx.Log(log.Write).Tracef("writeObject end, obj#%d written to objectStream #%d\n", objNumber, *ctx.Write.CurrentObjStream)
 
 		if objStreamDict.ObjCount == ObjectStreamMaxObjects {
 			err = stopObjectStream(ctx)
@@ -190,14 +192,14 @@ func writeToObjectStream(ctx *Context, objNumber, genNumber int) (ok bool, err e
 
 	}
 
-	fmt.Printf("addToObjectStream end, obj#:%d gen#:%d\n", objNumber, genNumber)
+	ctx.Log(log.Write).Tracef("addToObjectStream end, obj#:%d gen#:%d\n", objNumber, genNumber)
 
 	return ok, nil
 }
 
 func writeObject(ctx *Context, objNumber, genNumber int, s string) error {
 
-	fmt.Printf("writeObject begin, obj#:%d gen#:%d <%s>\n", objNumber, genNumber, s)
+	ctx.Log(log.Write).Tracef("writeObject begin, obj#:%d gen#:%d <%s>\n", objNumber, genNumber, s)
 
 	w := ctx.Write
 
@@ -230,7 +232,7 @@ func writeObject(ctx *Context, objNumber, genNumber int, s string) error {
 	// Write-offset for next object.
 	w.Offset += int64(written + i + j)
 
-	fmt.Printf("writeObject end, %d bytes written\n", written+i+j)
+	ctx.Log(log.Write).Tracef("writeObject end, %d bytes written\n", written+i+j)
 
 	return nil
 }
@@ -281,7 +283,7 @@ func writeStringLiteralObject(ctx *Context, objNumber, genNumber int, stringLite
 
 	sl := stringLiteral
 
-	if ctx.EncKey != nil {
+	if ctx.encryptsStrings() {
 		s1, err := encryptString(stringLiteral.Value(), objNumber, genNumber, ctx.EncKey, ctx.AES4Strings, ctx.E.R)
 		if err != nil {
 			return err
@@ -306,7 +308,7 @@ func writeHexLiteralObject(ctx *Context, objNumber, genNumber int, hexLiteral He
 
 	hl := hexLiteral
 
-	if ctx.EncKey != nil {
+	if ctx.encryptsStrings() {
 		s1, err := encryptString(hexLiteral.Value(), objNumber, genNumber, ctx.EncKey, ctx.AES4Strings, ctx.E.R)
 		if err != nil {
 			return err
@@ -357,7 +359,7 @@ func writeDictObject(ctx *Context, objNumber, genNumber int, d Dict) error {
 		return nil
 	}
 
-	if ctx.EncKey != nil {
+	if ctx.encryptsStrings() {
 		_, err := encryptDeepObject(d, objNumber, genNumber, ctx.EncKey, ctx.AES4Strings, ctx.E.R)
 		if err != nil {
 			return err
@@ -378,7 +380,7 @@ func writeArrayObject(ctx *Context, objNumber, genNumber int, a Array) error {
 		return nil
 	}
 
-	if ctx.EncKey != nil {
+	if ctx.encryptsStrings() {
 		_, err := encryptDeepObject(a, objNumber, genNumber, ctx.EncKey, ctx.AES4Strings, ctx.E.R)
 		if err != nil {
 			return err
@@ -419,7 +421,7 @@ func handleIndirectLength(ctx *Context, ir *IndirectRef) error {
 	genNr := int(ir.GenerationNumber)
 
 	if ctx.Write.HasWriteOffset(objNr) {
-		fmt.Printf("*** handleIndirectLength: object #%d already written offset=%d ***\n", objNr, ctx.Write.Offset)
+		ctx.Log(log.Write).Tracef("*** handleIndirectLength: object #%d already written offset=%d ***\n", objNr, ctx.Write.Offset)
 	} else {
 		length, err := ctx.DereferenceInteger(*ir)
 		if err != nil || length == nil {
@@ -436,7 +438,7 @@ func handleIndirectLength(ctx *Context, ir *IndirectRef) error {
 
 func writeStreamDictObject(ctx *Context, objNumber, genNumber int, sd StreamDict) error {
 
-	fmt.Printf("writeStreamDictObject begin: object #%d\n%v", objNumber, sd)
+	ctx.Log(log.Write).Tracef("writeStreamDictObject begin: object #%d\n%v", objNumber, sd)
 
 	var inObjStream bool
 
@@ -453,15 +455,15 @@ func writeStreamDictObject(ctx *Context, objNumber, genNumber int, sd StreamDict
 		}
 	}
 
-	var err error
-
 	// Unless the "Identity" crypt filter is used we have to encrypt.
-	isXRefStreamDict := sd.Type() != nil && *sd.Type() == "XRef"
-	if ctx.EncKey != nil &&
-		!isXRefStreamDict &&
-		!(len(sd.FilterPipeline) == 1 && sd.FilterPipeline[0].Name == "Crypt") {
+	encrypted, aes, err := ctx.streamEncryption(&sd)
+	if err != nil {
+		return err
+	}
+
+	if encrypted {
 
-		sd.Raw, err = encryptStream(sd.Raw, objNumber, genNumber, ctx.EncKey, ctx.AES4Streams, ctx.E.R)
+		sd.Raw, err = encryptStream(sd.Raw, objNumber, genNumber, ctx.EncKey, aes, ctx.E.R)
 		if err != nil {
 			return err
 		}
@@ -504,7 +506,7 @@ func writeStreamDictObject(ctx *Context, objNumber, genNumber int, sd StreamDict
 		ctx.Write.WriteToObjectStream = true
 	}
 
-	fmt.Printf("writeStreamDictObject end: object #%d written=%d\n", objNumber, written)
+	ctx.Log(log.Write).Tracef("writeStreamDictObject end: object #%d written=%d\n", objNumber, written)
 
 	return nil
 }
@@ -524,7 +526,7 @@ func writeDirectObject(ctx *Context, o Object) error {
 			}
 			ctx.dest = false
 		}
-		fmt.Printf("writeDirectObject: end offset=%d\n", ctx.Write.Offset)
+		ctx.Log(log.Write).Tracef("writeDirectObject: end offset=%d\n", ctx.Write.Offset)
 
 	case Array:
 		for i, v := range o {
@@ -536,10 +538,10 @@ func writeDirectObject(ctx *Context, o Object) error {
 				return err
 			}
 		}
-		fmt.Printf("writeDirectObject: end offset=%d\n", ctx.Write.Offset)
+		ctx.Log(log.Write).Tracef("writeDirectObject: end offset=%d\n", ctx.Write.Offset)
 
 	default:
-		fmt.Printf("writeDirectObject: end, direct obj - nothing written: offset=%d\n%v\n", ctx.Write.Offset, o)
+		ctx.Log(log.Write).Tracef("writeDirectObject: end, direct obj - nothing written: offset=%d\n%v\n", ctx.Write.Offset, o)
 
 	}
 
@@ -582,7 +584,7 @@ func writeDeepDict(ctx *Context, d Dict, objNr, genNr int) error {
 
 func writeDeepStreamDict(ctx *Context, sd *StreamDict, objNr, genNr int) error {
 
-	if ctx.EncKey != nil {
+	if ctx.encryptsStrings() {
 		_, err := encryptDeepObject(*sd, objNr, genNr, ctx.EncKey, ctx.AES4Strings, ctx.E.R)
 		if err != nil {
 			return err
@@ -630,7 +632,7 @@ func writeIndirectObject(ctx *Context, ir IndirectRef) (Object, error) {
 	genNr := int(ir.GenerationNumber)
 
 	if ctx.Write.HasWriteOffset(objNr) {
-		fmt.Printf("writeIndirectObject end: object #%d already written.\n", objNr)
+		ctx.Log(log.Write).Tracef("writeIndirectObject end: object #%d already written.\n", objNr)
 		return nil, nil
 	}
 
@@ -639,7 +641,7 @@ func writeIndirectObject(ctx *Context, ir IndirectRef) (Object, error) {
 		return nil, fmt.Errorf(err.Error()+"writeIndirectObject: unable to dereference indirect object #%d", objNr)
 	}
 
-	fmt.Printf("writeIndirectObject: object #%d gets writeoffset: %d\n", objNr, ctx.Write.Offset)
+	ctx.Log(log.Write).Tracef("writeIndirectObject: object #%d gets writeoffset: %d\n", objNr, ctx.Write.Offset)
 
 	if o == nil {
 
@@ -648,7 +650,7 @@ func writeIndirectObject(ctx *Context, ir IndirectRef) (Object, error) {
 			return nil, err
 		}
 
-		fmt.Printf("writeIndirectObject: end, obj#%d resolved to nil, offset=%d\n", objNr, ctx.Write.Offset)
+		ctx.Log(log.Write).Tracef("writeIndirectObject: end, obj#%d resolved to nil, offset=%d\n", objNr, ctx.Write.Offset)
 		return nil, nil
 	}
 
@@ -691,7 +693,7 @@ func writeIndirectObject(ctx *Context, ir IndirectRef) (Object, error) {
 
 func writeDeepObject(ctx *Context, objIn Object) (objOut Object, written bool, err error) {
 
-	fmt.Printf("writeDeepObject: begin offset=%d\n%s\n", ctx.Write.Offset, objIn)
+	ctx.Log(log.Write).Tracef("writeDeepObject: begin offset=%d\n%s\n", ctx.Write.Offset, objIn)
 
 	ir, ok := objIn.(IndirectRef)
 	if !ok {
@@ -701,7 +703,7 @@ func writeDeepObject(ctx *Context, objIn Object) (objOut Object, written bool, e
 	objOut, err = writeIndirectObject(ctx, ir)
 	if err == nil {
 		written = true
-		fmt.Printf("writeDeepObject: end offset=%d\n", ctx.Write.Offset)
+		ctx.Log(log.Write).Tracef("writeDeepObject: end offset=%d\n", ctx.Write.Offset)
 	}
 
 	return objOut, written, err
@@ -711,11 +713,11 @@ func writeEntry(ctx *Context, d Dict, dictName, entryName string) (Object, error
 
 	o, found := d.Find(entryName)
 	if !found || o == nil {
-		fmt.Printf("writeEntry end: entry %s is nil\n", entryName)
+		ctx.Log(log.Write).Tracef("writeEntry end: entry %s is nil\n", entryName)
 		return nil, nil
 	}
 
-	fmt.Printf("writeEntry begin: dict=%s entry=%s offset=%d\n", dictName, entryName, ctx.Write.Offset)
+	ctx.Log(log.Write).Tracef("writeEntry begin: dict=%s entry=%s offset=%d\n", dictName, entryName, ctx.Write.Offset)
 
 	o, _, err := writeDeepObject(ctx, o)
 	if err != nil {
@@ -723,11 +725,11 @@ func writeEntry(ctx *Context, d Dict, dictName, entryName string) (Object, error
 	}
 
 	if o == nil {
-		fmt.Printf("writeEntry end: dict=%s entry=%s resolved to nil, offset=%d\n", dictName, entryName, ctx.Write.Offset)
+		ctx.Log(log.Write).Tracef("writeEntry end: dict=%s entry=%s resolved to nil, offset=%d\n", dictName, entryName, ctx.Write.Offset)
 		return nil, nil
 	}
 
-	fmt.Printf("writeEntry end: dict=%s entry=%s offset=%d\n", dictName, entryName, ctx.Write.Offset)
+	ctx.Log(log.Write).Tracef("writeEntry end: dict=%s entry=%s offset=%d\n", dictName, entryName, ctx.Write.Offset)
 
 	return o, nil
 }
@@ -0,0 +1,75 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdflite
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteXRefFreeEntries(t *testing.T) {
+
+	// Object 3 is not reachable and is not written.
+	in := testPDF([]string{
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[5 0 R]/Count 1>>",
+		"<</Unused true>>",
+		"<</Producer(test)>>",
+		"<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 100]/Resources<<>>>>",
+	})
+
+	for _, xRefStream := range []bool{false, true} {
+
+		ctx, err := Read(bytes.NewReader(in), NewDefaultConfiguration())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx.WriteXRefStream = xRefStream
+
+		var b bytes.Buffer
+		if err = Write(ctx, &b); err != nil {
+			t.Fatalf("xref stream %t: %v", xRefStream, err)
+		}
+
+		if !xRefStream {
+			// A single subsection, free entries link 0 -> 3 -> 0.
+			want := "xref\n0 6\n0000000003 65535 f \n"
+			if !bytes.Contains(b.Bytes(), []byte(want)) {
+				t.Errorf("xref table: missing %q in\n%s", want, b.Bytes())
+			}
+			if want = "0000000000 00001 f \n"; !bytes.Contains(b.Bytes(), []byte(want)) {
+				t.Errorf("xref table: missing %q", want)
+			}
+		}
+
+		ctx, err = Read(bytes.NewReader(b.Bytes()), NewDefaultConfiguration())
+		if err != nil {
+			t.Fatalf("xref stream %t: read: %v", xRefStream, err)
+		}
+
+		for objNr, free := range map[int]bool{0: true, 1: false, 2: false, 3: true, 4: false, 5: false} {
+			e, found := ctx.Find(objNr)
+			if !found || e.Free != free {
+				t.Errorf("xref stream %t: object %d: found %t, want free %t", xRefStream, objNr, found, free)
+				continue
+			}
+			if objNr == 3 && *e.Generation != 1 {
+				t.Errorf("xref stream %t: object 3: got generation %d, want 1", xRefStream, *e.Generation)
+			}
+		}
+	}
+}
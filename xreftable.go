@@ -21,11 +21,13 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"sort"
 	"strings"
 
 	"github.com/zean00/pdfcpulite/filter"
+	"github.com/zean00/pdfcpulite/log"
 )
 
 // XRefTableEntry represents an entry in the PDF cross reference table.
@@ -90,6 +92,12 @@ type XRefTable struct {
 	AES4Streams         bool
 	AES4EmbeddedStreams bool
 
+	// Crypt filter methods in effect: Identity, None, V2, AESV2 or AESV3.
+	CFM4Strings         string
+	CFM4Streams         string
+	CFM4EmbeddedStreams string
+	CFM                 map[string]string // Crypt filter methods by crypt filter name.
+
 	// PDF Version
 	HeaderVersion *Version // The PDF version the source is claiming to us as per its header.
 	RootVersion   *Version // Optional PDF version taking precedence over the header version.
@@ -126,6 +134,8 @@ type XRefTable struct {
 
 	Optimized   bool
 	Watermarked bool
+
+	tx *Tx // Transaction in progress, see Context.Begin.
 }
 
 // NewXRefTable creates a new XRefTable.
@@ -221,6 +231,7 @@ func (xRefTable *XRefTable) Exists(objNr int) bool {
 
 // Find returns the XRefTable entry for given object number.
 func (xRefTable *XRefTable) Find(objNr int) (*XRefTableEntry, bool) {
+	xRefTable.snapshot(objNr)
 	e, found := xRefTable.Table[objNr]
 	if !found {
 		return nil, false
@@ -298,6 +309,7 @@ func (xRefTable *XRefTable) FindTableEntryForIndRef(ir *IndirectRef) (*XRefTable
 // Called by InsertAndUseRecycled.
 func (xRefTable *XRefTable) InsertNew(xRefTableEntry XRefTableEntry) (objNr int) {
 	objNr = *xRefTable.Size
+	xRefTable.snapshot(objNr)
 	xRefTable.Table[objNr] = &xRefTableEntry
 	*xRefTable.Size++
 	return
@@ -314,7 +326,7 @@ func (xRefTable *XRefTable) InsertAndUseRecycled(xRefTableEntry XRefTableEntry)
 	// This is because pdfcpu does not reuse objects
 	// in an incremental fashion like laid out in the PDF spec.
 
-	fmt.Println("InsertAndUseRecycled: begin")
+	log.Read.Tracef("InsertAndUseRecycled: begin")
 
 	// Get Next free object from freelist.
 	freeListHeadEntry, err := xRefTable.Free(0)
@@ -326,7 +338,7 @@ func (xRefTable *XRefTable) InsertAndUseRecycled(xRefTableEntry XRefTableEntry)
 	if *freeListHeadEntry.Offset == 0 {
 		xRefTableEntry.RefCount = 1
 		objNr = xRefTable.InsertNew(xRefTableEntry)
-		fmt.Printf("InsertAndUseRecycled: end, new objNr=%d\n", objNr)
+		log.Read.Tracef("InsertAndUseRecycled: end, new objNr=%d\n", objNr)
 		return objNr, nil
 	}
 
@@ -349,7 +361,7 @@ func (xRefTable *XRefTable) InsertAndUseRecycled(xRefTableEntry XRefTableEntry)
 	xRefTableEntry.RefCount = 1
 	xRefTable.Table[objNr] = &xRefTableEntry
 
-	fmt.Printf("InsertAndUseRecycled: end, recycled objNr=%d\n", objNr)
+	log.Read.Tracef("InsertAndUseRecycled: end, recycled objNr=%d\n", objNr)
 
 	return objNr, nil
 }
@@ -393,7 +405,6 @@ func (xRefTable *XRefTable) NewStreamDict(filename string) (*StreamDict, error)
 	return &sd, nil
 }
 
-/*
 // NewEmbeddedFileStreamDict creates and returns an embeddedFileStreamDict containing the file "filename".
 func (xRefTable *XRefTable) NewEmbeddedFileStreamDict(filename string) (*StreamDict, error) {
 
@@ -416,7 +427,7 @@ func (xRefTable *XRefTable) NewEmbeddedFileStreamDict(filename string) (*StreamD
 
 	return sd, nil
 }
-*/
+
 // NewSoundStreamDict returns a new sound stream dict.
 func (xRefTable *XRefTable) NewSoundStreamDict(filename string, samplingRate int, fileSpecDict Dict) (*StreamDict, error) {
 
@@ -482,7 +493,7 @@ func (xRefTable *XRefTable) freeObjects() IntSet {
 // See 7.5.4 Cross-Reference Table
 func (xRefTable *XRefTable) EnsureValidFreeList() error {
 
-	fmt.Println("EnsureValidFreeList begin")
+	log.Read.Tracef("EnsureValidFreeList begin")
 
 	m := xRefTable.freeObjects()
 
@@ -507,7 +518,7 @@ func (xRefTable *XRefTable) EnsureValidFreeList() error {
 			*head.Offset = 0
 		}
 
-		fmt.Println("EnsureValidFreeList: empty free list.")
+		log.Read.Tracef("EnsureValidFreeList: empty free list.")
 		return nil
 	}
 
@@ -516,7 +527,7 @@ func (xRefTable *XRefTable) EnsureValidFreeList() error {
 	// until we have found the last free object which should point to obj 0.
 	for f != 0 {
 
-		fmt.Printf("EnsureValidFreeList: validating obj #%d %v\n", f, m)
+		log.Read.Tracef("EnsureValidFreeList: validating obj #%d %v\n", f, m)
 		// verify if obj f is one of the free objects recorded.
 		if !m[f] {
 			return errors.New("pdfcpu: ensureValidFreeList: freelist corrupted")
@@ -531,7 +542,7 @@ func (xRefTable *XRefTable) EnsureValidFreeList() error {
 	}
 
 	if len(m) == 0 {
-		fmt.Println("EnsureValidFreeList: end, regular linked list")
+		log.Read.Tracef("EnsureValidFreeList: end, regular linked list")
 		return nil
 	}
 
@@ -560,7 +571,7 @@ func (xRefTable *XRefTable) EnsureValidFreeList() error {
 		head.Offset = &next
 	}
 
-	fmt.Println("EnsureValidFreeList: end, linked list plus some dangling free objects.")
+	log.Read.Tracef("EnsureValidFreeList: end, linked list plus some dangling free objects.")
 
 	return nil
 }
@@ -640,7 +651,7 @@ func (xRefTable *XRefTable) deleteObject(o Object) error {
 // DeleteObjectGraph deletes all objects reachable by indRef.
 func (xRefTable *XRefTable) DeleteObjectGraph(o Object) error {
 
-	fmt.Println("DeleteObjectGraph: begin")
+	log.Read.Tracef("DeleteObjectGraph: begin")
 
 	ir, ok := o.(IndirectRef)
 	if !ok {
@@ -653,7 +664,7 @@ func (xRefTable *XRefTable) DeleteObjectGraph(o Object) error {
 		return err
 	}
 
-	fmt.Println("DeleteObjectGraph: end")
+	log.Read.Tracef("DeleteObjectGraph: end")
 	return nil
 }
 
@@ -662,7 +673,7 @@ func (xRefTable *XRefTable) DeleteObject(objNr int) error {
 
 	// see 7.5.4 Cross-Reference Table
 
-	fmt.Printf("DeleteObject: begin %d\n", objNr)
+	log.Read.Tracef("DeleteObject: begin %d\n", objNr)
 
 	freeListHeadEntry, err := xRefTable.Free(0)
 	if err != nil {
@@ -675,7 +686,7 @@ func (xRefTable *XRefTable) DeleteObject(objNr int) error {
 	}
 
 	if entry.Free {
-		fmt.Printf("DeleteObject: end %d already free\n", objNr)
+		log.Read.Tracef("DeleteObject: end %d already free\n", objNr)
 		return nil
 	}
 
@@ -689,7 +700,7 @@ func (xRefTable *XRefTable) DeleteObject(objNr int) error {
 	next := int64(objNr)
 	freeListHeadEntry.Offset = &next
 
-	fmt.Printf("DeleteObject: end %d\n", objNr)
+	log.Read.Tracef("DeleteObject: end %d\n", objNr)
 
 	return nil
 }
@@ -698,7 +709,7 @@ func (xRefTable *XRefTable) DeleteObject(objNr int) error {
 // e.g. sometimes caused by indirect references to free objects in the original PDF file.
 func (xRefTable *XRefTable) UndeleteObject(objectNumber int) error {
 
-	fmt.Printf("UndeleteObject: begin %d\n", objectNumber)
+	log.Read.Tracef("UndeleteObject: begin %d\n", objectNumber)
 
 	f, err := xRefTable.Free(0)
 	if err != nil {
@@ -715,7 +726,7 @@ func (xRefTable *XRefTable) UndeleteObject(objectNumber int) error {
 		}
 
 		if objNr == objectNumber {
-			fmt.Printf("UndeleteObject end: undeleting obj#%d\n", objectNumber)
+			log.Read.Tracef("UndeleteObject end: undeleting obj#%d\n", objectNumber)
 			*f.Offset = *entry.Offset
 			entry.Offset = nil
 			if *entry.Generation > 0 {
@@ -728,7 +739,7 @@ func (xRefTable *XRefTable) UndeleteObject(objectNumber int) error {
 		f = entry
 	}
 
-	fmt.Printf("UndeleteObject: end: obj#%d not in free list.\n", objectNumber)
+	log.Read.Tracef("UndeleteObject: end: obj#%d not in free list.\n", objectNumber)
 
 	return nil
 }
@@ -1195,7 +1206,7 @@ func (xRefTable *XRefTable) list(logStr []string) []string {
 // At this point the free list is assumed to be a linked list with its last node linked to the beginning.
 func (xRefTable *XRefTable) freeList(logStr []string) ([]string, error) {
 
-	fmt.Printf("freeList begin")
+	log.Read.Tracef("freeList begin")
 
 	head, err := xRefTable.Free(0)
 	if err != nil {
@@ -1213,7 +1224,7 @@ func (xRefTable *XRefTable) freeList(logStr []string) ([]string, error) {
 
 	for f != 0 {
 
-		fmt.Printf("freeList validating free object %d\n", f)
+		log.Read.Tracef("freeList validating free object %d\n", f)
 
 		entry, err := xRefTable.Free(f)
 		if err != nil {
@@ -1224,12 +1235,12 @@ func (xRefTable *XRefTable) freeList(logStr []string) ([]string, error) {
 		generation := *entry.Generation
 		s := fmt.Sprintf("%5d %5d %5d\n", f, next, generation)
 		logStr = append(logStr, s)
-		fmt.Printf("freeList: %s", s)
+		log.Read.Tracef("freeList: %s", s)
 
 		f = next
 	}
 
-	fmt.Printf("freeList end")
+	log.Read.Tracef("freeList end")
 
 	return logStr, nil
 }
@@ -1253,7 +1264,7 @@ func (xRefTable *XRefTable) bindNameTreeNode(name string, n *Node, root bool) er
 			}
 			namesDict.Update(name, *n.D)
 		}
-		fmt.Printf("bind dict = %v\n", *n.D)
+		log.Read.Tracef("bind dict = %v\n", *n.D)
 		dict = *n.D
 	}
 
@@ -1270,7 +1281,7 @@ func (xRefTable *XRefTable) bindNameTreeNode(name string, n *Node, root bool) er
 			a = append(a, e.v)
 		}
 		dict.Update("Names", a)
-		fmt.Printf("bound nametree node(leaf): %s/n", dict)
+		log.Read.Tracef("bound nametree node(leaf): %s/n", dict)
 		return nil
 	}
 
@@ -1290,7 +1301,7 @@ func (xRefTable *XRefTable) bindNameTreeNode(name string, n *Node, root bool) er
 	dict.Update("Kids", kids)
 	dict.Delete("Names")
 
-	fmt.Printf("bound nametree node(intermediary): %s/n", dict)
+	log.Read.Tracef("bound nametree node(intermediary): %s/n", dict)
 
 	return nil
 }
@@ -1298,11 +1309,11 @@ func (xRefTable *XRefTable) bindNameTreeNode(name string, n *Node, root bool) er
 // BindNameTrees syncs up the internal name tree cache with the xreftable.
 func (xRefTable *XRefTable) BindNameTrees() error {
 
-	fmt.Println("BindNameTrees..")
+	log.Read.Tracef("BindNameTrees..")
 
 	// Iterate over internal name tree rep.
 	for k, v := range xRefTable.Names {
-		fmt.Printf("bindNameTree: %s\n", k)
+		log.Read.Tracef("bindNameTree: %s\n", k)
 		err := xRefTable.bindNameTreeNode(k, v, true)
 		if err != nil {
 			return err
@@ -1370,7 +1381,12 @@ func (xRefTable *XRefTable) LocateNameTree(nameTreeName string, ensure bool) err
 		return err
 	}
 
-	xRefTable.Names[nameTreeName] = &Node{D: &d1}
+	n, err := loadNameTreeNode(xRefTable, d1, 0)
+	if err != nil {
+		return err
+	}
+
+	xRefTable.Names[nameTreeName] = n
 
 	return nil
 }
@@ -1437,7 +1453,7 @@ func (xRefTable *XRefTable) RemoveNameTree(nameTreeName string) error {
 
 	rootDict.Delete("Names")
 
-	fmt.Printf("Deleted Names from root: %s\n", rootDict)
+	log.Read.Debugf("Deleted Names from root: %s\n", rootDict)
 
 	return nil
 }
@@ -1458,7 +1474,7 @@ func (xRefTable *XRefTable) RemoveCollection() error {
 	}
 
 	rootDict.Delete("Collection")
-	fmt.Printf("deleted collection from root: %s\n", rootDict)
+	log.Read.Debugf("deleted collection from root: %s\n", rootDict)
 
 	return nil
 }
@@ -1966,7 +1982,6 @@ func (xRefTable *XRefTable) insertIntoPageTree(root *IndirectRef, pAttrs *Inheri
 			*p++
 			if !before {
 				a = append(a, ir)
-				i++
 			}
 			if selectedPages[*p] {
 				// Insert empty page.
@@ -1980,7 +1995,6 @@ func (xRefTable *XRefTable) insertIntoPageTree(root *IndirectRef, pAttrs *Inheri
 			}
 			if before {
 				a = append(a, ir)
-				i++
 			}
 
 		}
@@ -1989,6 +2003,7 @@ func (xRefTable *XRefTable) insertIntoPageTree(root *IndirectRef, pAttrs *Inheri
 
 	d.Update("Kids", a)
 
+	// i is the number of pages inserted into this page tree.
 	return i, d.IncrementBy("Count", i)
 }
 
@@ -2003,9 +2018,14 @@ func (xRefTable *XRefTable) InsertPages(pages IntSet, before bool) error {
 	var inhPAttrs InheritedPageAttrs
 	p := 0
 
-	_, err = xRefTable.insertIntoPageTree(root, &inhPAttrs, &p, pages, before)
+	n, err := xRefTable.insertIntoPageTree(root, &inhPAttrs, &p, pages, before)
+	if err != nil {
+		return err
+	}
+
+	xRefTable.PageCount += n
 
-	return err
+	return nil
 }
 
 func (xRefTable *XRefTable) detectPageTreeWatermarks(root *IndirectRef) error {